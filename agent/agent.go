@@ -0,0 +1,183 @@
+// Package agent provides tools for constructing RDF statements for fields
+// added to events by processors configured in agent stream templates.
+package agent
+
+import (
+	"crypto/sha1"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gonum.org/v1/gonum/graph/formats/rdf"
+	"gopkg.in/yaml.v3"
+
+	"github.com/efd6/ecsinrdf/term"
+	"github.com/efd6/ecsinrdf/vocab"
+)
+
+// Hint is a field that a processor adds to events.
+type Hint struct {
+	// Path is the full dotted path of the field.
+	Path string
+	// Processor is the name of the processor adding
+	// the field.
+	Processor string
+	// Object is whether the field is an object whose
+	// children are not known, as for the target of
+	// decode_json_fields.
+	Object bool
+}
+
+// placeholder replaces handlebars expressions that are not on a line of
+// their own so that the template can be parsed as YAML. Paths holding it
+// are not hinted.
+const placeholder = "__hbs__"
+
+var (
+	blockLine  = regexp.MustCompile(`^\s*(\{\{[^}]*\}\}\s*)+$`)
+	expression = regexp.MustCompile(`\{\{\{?[^}]*\}?\}\}`)
+)
+
+// Hints returns the fields added by add_fields and decode_json_fields
+// processors configured in the agent stream template held in src, sorted by
+// path. Lines holding only handlebars expressions, such as conditional
+// blocks and injected user processors, are removed before parsing and
+// other expressions are treated as opaque values, so fields configured
+// only through template variables are not found.
+func Hints(src []byte) ([]Hint, error) {
+	lines := strings.Split(string(src), "\n")
+	for i, l := range lines {
+		if blockLine.MatchString(l) {
+			lines[i] = ""
+			continue
+		}
+		lines[i] = expression.ReplaceAllString(l, placeholder)
+	}
+	var doc interface{}
+	err := yaml.Unmarshal([]byte(strings.Join(lines, "\n")), &doc)
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[Hint]bool)
+	var walk func(key string, v interface{})
+	walk = func(key string, v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for k, e := range v {
+				walk(k, e)
+			}
+		case []interface{}:
+			for _, e := range v {
+				if key == "processors" {
+					processorHints(e, found)
+				}
+				walk("", e)
+			}
+		}
+	}
+	walk("", doc)
+	hints := make([]Hint, 0, len(found))
+	for h := range found {
+		if !strings.Contains(h.Path, placeholder) {
+			hints = append(hints, h)
+		}
+	}
+	sort.Slice(hints, func(i, j int) bool {
+		if hints[i].Path == hints[j].Path {
+			return hints[i].Processor < hints[j].Processor
+		}
+		return hints[i].Path < hints[j].Path
+	})
+	return hints, nil
+}
+
+// processorHints adds the fields added by the processor configuration p to
+// found.
+func processorHints(p interface{}, found map[Hint]bool) {
+	m, ok := p.(map[string]interface{})
+	if !ok {
+		return
+	}
+	if cfg, ok := m["add_fields"].(map[string]interface{}); ok {
+		// Fields are added under "fields" unless
+		// another target is given. An empty target
+		// adds them at the root of the event.
+		target := "fields"
+		if t, ok := cfg["target"]; ok {
+			target, _ = t.(string)
+		}
+		fields, _ := cfg["fields"].(map[string]interface{})
+		for _, path := range leaves(target, fields) {
+			found[Hint{Path: path, Processor: "add_fields"}] = true
+		}
+	}
+	if cfg, ok := m["decode_json_fields"].(map[string]interface{}); ok {
+		// Without a target, JSON is decoded in place
+		// or into the root, so the added fields are
+		// not known.
+		if target, _ := cfg["target"].(string); target != "" {
+			found[Hint{Path: target, Processor: "decode_json_fields", Object: true}] = true
+		}
+	}
+}
+
+// leaves returns the full paths of the leaf values in fields under parent.
+func leaves(parent string, fields map[string]interface{}) []string {
+	var paths []string
+	for name, v := range fields {
+		if parent != "" {
+			name = parent + "." + name
+		}
+		if m, ok := v.(map[string]interface{}); ok && len(m) != 0 {
+			paths = append(paths, leaves(name, m)...)
+			continue
+		}
+		paths = append(paths, name)
+	}
+	return paths
+}
+
+// DataStreamStatements calls fn on all RDF statements constructed from the
+// hints found in the agent stream templates of the named data stream.
+//
+// The graph that results has the following triples structure
+//
+// _:hint <is:hinted> "processor" .
+// _:hint <is:path> "full.dotted.path.to.name" .
+// _:hint <in:data_stream> _:context .
+// _:context <is:data_stream> "data_stream" .
+//
+// Hints for objects whose children are not known are marked.
+//
+// _:hint <is:hinted_object> "true" .
+//
+// The data stream statements are omitted for package-level templates.
+func DataStreamStatements(dataStream string, hints []Hint, fn func(*rdf.Statement, error)) {
+	var hashContext string
+	if dataStream != "" {
+		h := sha1.Sum([]byte("data_stream" + dataStream))
+		hashContext = string(hex(h[:]))
+		fn(term.Triple(term.Blank(hashContext), vocab.IsDataStream.Term(), term.LiteralTerm(dataStream)), nil)
+	}
+	for _, hint := range hints {
+		h := sha1.Sum([]byte("agent" + dataStream + "\x00" + hint.Path))
+		hashHint := string(hex(h[:]))
+		fn(term.Triple(term.Blank(hashHint), vocab.IsHinted.Term(), term.LiteralTerm(hint.Processor)), nil)
+		fn(term.Triple(term.Blank(hashHint), vocab.IsPath.Term(), term.LiteralTerm(hint.Path)), nil)
+		if hint.Object {
+			fn(term.Triple(term.Blank(hashHint), vocab.IsHintedObject.Term(), term.LiteralTerm("true")), nil)
+		}
+		if hashContext != "" {
+			fn(term.Triple(term.Blank(hashHint), vocab.InDataStream.Term(), term.Blank(hashContext)), nil)
+		}
+	}
+}
+
+func hex(data []byte) []byte {
+	const digit = "0123456789abcdef"
+	buf := make([]byte, 0, len(data)*2)
+	for _, b := range data {
+		buf = append(buf, digit[b>>4], digit[b&0xf])
+	}
+	return buf
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/efd6/ecsinrdf/graph"
+)
+
+// isArchive returns whether the ECS root at path names a release archive
+// of the ECS repo rather than a clone.
+func isArchive(path string) bool {
+	for _, ext := range []string{".tar.gz", ".tgz", ".tar", ".zip"} {
+		if strings.HasSuffix(path, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// archiveSpec returns the ECS specification artifact at the slash-separated
+// path file in the ECS release archive at the path archive. Release
+// archives hold the repo under a single top-level directory, which is
+// ignored.
+func archiveSpec(archive, file string) ([]byte, error) {
+	match := func(name string) bool { return name == file }
+	if file == schemasPath {
+		match = func(name string) bool {
+			return path.Dir(name) == schemasPath && strings.HasSuffix(name, ".yml")
+		}
+	}
+	files, _, err := readArchive(archive, match)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%s: %s not found in archive", archive, file)
+	}
+	if file != schemasPath {
+		return files[file], nil
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	docs := make([][]byte, len(names))
+	for i, name := range names {
+		docs[i] = files[name]
+	}
+	return graph.YAMLStream(docs), nil
+}
+
+// archiveRevision returns the commit name recorded in the ECS release
+// archive at path by git archive, or an error if there is none.
+func archiveRevision(path string) (string, error) {
+	_, comment, err := readArchive(path, func(string) bool { return false })
+	if err != nil {
+		return "", err
+	}
+	comment = strings.TrimSpace(comment)
+	if len(comment) != 40 || !immutable.MatchString(comment) {
+		return "", fmt.Errorf("%s: no commit recorded in archive", path)
+	}
+	return comment, nil
+}
+
+// readArchive returns the regular files in the tar, gzipped tar or zip
+// archive at path whose names, with the top-level directory removed,
+// satisfy match, keyed by that name. It also returns the archive's comment,
+// which git archive sets to the commit name of the archived tree.
+func readArchive(path string, match func(name string) bool) (files map[string][]byte, comment string, err error) {
+	files = make(map[string][]byte)
+	if strings.HasSuffix(path, ".zip") {
+		z, err := zip.OpenReader(path)
+		if err != nil {
+			return nil, "", err
+		}
+		defer z.Close()
+		for _, f := range z.File {
+			name, ok := trimTopLevel(f.Name)
+			if !ok || !f.Mode().IsRegular() || !match(name) {
+				continue
+			}
+			r, err := f.Open()
+			if err != nil {
+				return nil, "", fmt.Errorf("%s: %w", path, err)
+			}
+			b, err := io.ReadAll(r)
+			r.Close()
+			if err != nil {
+				return nil, "", fmt.Errorf("%s: %s: %w", path, f.Name, err)
+			}
+			files[name] = b
+		}
+		return files, z.Comment, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if !strings.HasSuffix(path, ".tar") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, "", fmt.Errorf("%s: %w", path, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err != nil {
+			if err == io.EOF {
+				return files, comment, nil
+			}
+			return nil, "", fmt.Errorf("%s: %w", path, err)
+		}
+		if h.Typeflag == tar.TypeXGlobalHeader {
+			comment = h.PAXRecords["comment"]
+			continue
+		}
+		name, ok := trimTopLevel(h.Name)
+		if !ok || h.Typeflag != tar.TypeReg || !match(name) {
+			continue
+		}
+		b, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, "", fmt.Errorf("%s: %s: %w", path, h.Name, err)
+		}
+		files[name] = b
+	}
+}
+
+// trimTopLevel returns the slash-separated archive member name with its
+// top-level directory removed, and whether the member is below one.
+func trimTopLevel(name string) (string, bool) {
+	_, rest, ok := strings.Cut(strings.TrimPrefix(name, "./"), "/")
+	return rest, ok && rest != ""
+}
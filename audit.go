@@ -0,0 +1,297 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"gonum.org/v1/gonum/graph/formats/rdf"
+
+	"github.com/efd6/ecsinrdf/query"
+	"github.com/efd6/ecsinrdf/term"
+)
+
+func auditCommand(args []string) {
+	fs := newFlagSet("audit", "", "Analyze the package(s), record the findings in a state file and report the changes since the previous recorded run and the trend over the recorded runs")
+	gf := addGraphFlags(fs, true)
+	var exclude stringList
+	fs.Var(&exclude, "exclude", "specify a comma-separated list of graft destination path patterns to exclude (may be repeated)")
+	paths := addPathRuleFlags(fs, true)
+	state := fs.String("state", "", "specify the path to the JSON audit state file, which is created if it does not exist")
+	keep := fs.Int("keep", 30, "specify the number of runs retained in the state file and shown in the trend (0 retains all runs)")
+	dryRun := fs.Bool("dry-run", false, "report the changes without recording the run in the state file")
+	fs.Parse(args)
+	gf.requireECS(fs)
+	if *state == "" || gf.pkg == "" || *keep < 0 || fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	defer gf.profile()()
+
+	st, err := readAuditState(*state)
+	if err != nil {
+		log.Fatal(err)
+	}
+	cfg, err := gf.config(false)
+	if err != nil {
+		log.Fatal(err)
+	}
+	rules, err := paths.rules(cfg.pkg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	g, _ := gf.buildConfig(cfg)
+	run, err := auditPackage(g, cfg, exclude, rules)
+	if err != nil {
+		log.Fatal(err)
+	}
+	run.Time = time.Now().UTC()
+
+	var prev *auditRun
+	if len(st.Runs) != 0 {
+		prev = &st.Runs[len(st.Runs)-1]
+	}
+	st.Runs = append(st.Runs, run)
+	if *keep != 0 && len(st.Runs) > *keep {
+		st.Runs = st.Runs[len(st.Runs)-*keep:]
+	}
+	writeAuditReport(os.Stdout, prev, &run, st.Runs)
+	if *dryRun {
+		return
+	}
+	err = writeAuditState(*state, st)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// auditState is the record of audit runs held in an audit state file.
+type auditState struct {
+	// Runs holds the recorded runs, oldest first.
+	Runs []auditRun `json:"runs"`
+}
+
+// auditRun is the recorded result of an audit. All paths, types and names
+// are unquoted.
+type auditRun struct {
+	Time    time.Time `json:"time"`
+	Version string    `json:"ecs_version"`
+	// Findings holds the graft finding lines
+	// described by findingLines, prefixed with
+	// the package name when the audit covers a
+	// repository of packages.
+	Findings []string `json:"findings"`
+	// Conflicts holds a line for each field
+	// declared with different types in different
+	// data streams, naming the path and its types.
+	Conflicts []string `json:"conflicts"`
+	// Coverage holds the metadata completeness
+	// score of each data stream.
+	Coverage map[string]float64 `json:"coverage"`
+}
+
+// meanCoverage returns the mean of the data stream completeness scores of
+// the run, or zero if it has none.
+func (r *auditRun) meanCoverage() float64 {
+	if len(r.Coverage) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, s := range r.Coverage {
+		sum += s
+	}
+	return sum / float64(len(r.Coverage))
+}
+
+// auditPackage returns the audit of the package(s) described by cfg in g.
+// The time of the run is not set.
+func auditPackage(g *rdf.Graph, cfg graphConfig, exclude []string, rules query.PathRules) (auditRun, error) {
+	run := auditRun{Version: cfg.version, Coverage: make(map[string]float64)}
+	suggestions, err := graftSuggestionsIn(g, cfg.version, exclude, rules, false)
+	if err != nil {
+		return auditRun{}, err
+	}
+	idx, err := packagesIn(cfg.pkg)
+	if err != nil {
+		return auditRun{}, err
+	}
+	if len(idx) < 2 {
+		run.Findings, err = findingLines(suggestions)
+		if err != nil {
+			return auditRun{}, err
+		}
+	} else {
+		groups, err := suggestionsByPackage(g, suggestions)
+		if err != nil {
+			return auditRun{}, err
+		}
+		for _, grp := range groups {
+			lines, err := findingLines(grp.suggestions)
+			if err != nil {
+				return auditRun{}, err
+			}
+			for _, l := range lines {
+				run.Findings = append(run.Findings, grp.name+" "+l)
+			}
+		}
+		sort.Strings(run.Findings)
+	}
+
+	for _, c := range query.DataStreamConflictsIn(g) {
+		types := make([]string, 0, len(c.Types))
+		for t := range c.Types {
+			types = append(types, t)
+		}
+		types, err := unquote(types)
+		if err != nil {
+			return auditRun{}, err
+		}
+		sort.Strings(types)
+		path, err := term.Text(c.Path)
+		if err != nil {
+			return auditRun{}, err
+		}
+		run.Conflicts = append(run.Conflicts, path+" "+strings.Join(types, ","))
+	}
+	sort.Strings(run.Conflicts)
+
+	for _, c := range query.CompletenessIn(g) {
+		name := ""
+		if c.DataStream != "" {
+			name, err = term.Text(c.DataStream)
+			if err != nil {
+				return auditRun{}, err
+			}
+		}
+		run.Coverage[name] = c.Score
+	}
+	return run, nil
+}
+
+// writeAuditReport writes the changes in run since prev, which may be nil
+// for the first run, and the trend over the retained runs to w.
+func writeAuditReport(w io.Writer, prev, run *auditRun, runs []auditRun) {
+	if prev == nil {
+		fmt.Fprintln(w, msg("audit.first_run"))
+		prev = &auditRun{}
+	} else {
+		fmt.Fprintln(w, msg("audit.since", prev.Time.Format(time.RFC3339)))
+		if prev.Version != run.Version {
+			fmt.Fprintln(w, msg("audit.version", prev.Version, run.Version))
+		}
+	}
+	added, resolved := lineDelta(prev.Findings, run.Findings)
+	writeAuditLines(w, msg("audit.new_findings"), added)
+	writeAuditLines(w, msg("audit.resolved_findings"), resolved)
+	added, resolved = lineDelta(prev.Conflicts, run.Conflicts)
+	writeAuditLines(w, msg("audit.new_conflicts"), added)
+	writeAuditLines(w, msg("audit.resolved_conflicts"), resolved)
+
+	var streams []string
+	for ds := range run.Coverage {
+		streams = append(streams, ds)
+	}
+	for ds := range prev.Coverage {
+		if _, ok := run.Coverage[ds]; !ok {
+			streams = append(streams, ds)
+		}
+	}
+	sort.Strings(streams)
+	var changes []string
+	for _, ds := range streams {
+		was, wasOK := prev.Coverage[ds]
+		now, nowOK := run.Coverage[ds]
+		if wasOK && nowOK && was == now {
+			continue
+		}
+		name := ds
+		if name == "" {
+			name = msg("lint.package")
+		}
+		switch {
+		case !wasOK:
+			changes = append(changes, fmt.Sprintf("%s: %.2f", name, now))
+		case !nowOK:
+			changes = append(changes, fmt.Sprintf("%s: %.2f -> -", name, was))
+		default:
+			changes = append(changes, fmt.Sprintf("%s: %.2f -> %.2f", name, was, now))
+		}
+	}
+	writeAuditLines(w, msg("audit.coverage"), changes)
+
+	fmt.Fprintf(w, "\n%s\n", msg("audit.trend"))
+	for _, r := range runs {
+		fmt.Fprintf(w, "\t%s\t%s\t%s\n", r.Time.Format(time.RFC3339), r.Version,
+			msg("audit.trend_row", len(r.Findings), len(r.Conflicts), r.meanCoverage()))
+	}
+}
+
+// writeAuditLines writes the heading and the indented lines to w if there
+// are any lines.
+func writeAuditLines(w io.Writer, heading string, lines []string) {
+	if len(lines) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\n%s\n", heading)
+	for _, l := range lines {
+		fmt.Fprintf(w, "\t%s\n", l)
+	}
+}
+
+// lineDelta returns the lines in b that are not in a, and the lines in a
+// that are not in b. Both are sorted.
+func lineDelta(a, b []string) (added, removed []string) {
+	inA := make(map[string]bool, len(a))
+	for _, l := range a {
+		inA[l] = true
+	}
+	inB := make(map[string]bool, len(b))
+	for _, l := range b {
+		inB[l] = true
+		if !inA[l] {
+			added = append(added, l)
+		}
+	}
+	for _, l := range a {
+		if !inB[l] {
+			removed = append(removed, l)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
+
+// readAuditState returns the audit state held in the file at path. A
+// missing file holds no runs.
+func readAuditState(path string) (*auditState, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return &auditState{}, nil
+		}
+		return nil, err
+	}
+	var st auditState
+	err = json.Unmarshal(b, &st)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &st, nil
+}
+
+// writeAuditState writes the audit state to the file at path.
+func writeAuditState(path string, st *auditState) error {
+	b, err := json.MarshalIndent(st, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o644)
+}
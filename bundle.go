@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/efd6/ecsinrdf/gitrepo"
+)
+
+// ecsBundle is a recording of the ECS specification used to build a
+// graph, allowing the graph to be rebuilt without access to the ECS repo
+// or to GitHub.
+type ecsBundle struct {
+	// Version is the ECS version the specification
+	// was read for.
+	Version string `json:"version"`
+	// Artifact is the key in ecsArtifacts of the
+	// specification artifact. It is nested if
+	// empty.
+	Artifact string `json:"artifact,omitempty"`
+	// SHA is the object name of the version in the
+	// ECS repo, if it could be resolved.
+	SHA string `json:"sha,omitempty"`
+	// SHA256 is the hex SHA-256 hash of Spec.
+	SHA256 string `json:"sha256"`
+	// Spec is the ECS specification artifact.
+	Spec string `json:"spec"`
+}
+
+// commitURL is the URL template for resolving an ECS version to a commit
+// name with the GitHub API.
+var commitURL = "https://api.github.com/repos/elastic/ecs/commits/%s"
+
+// recordECS writes a bundle of the ECS specification artifact spec read
+// for the version from the ECS repo at root, or from GitHub if root is
+// empty, to the file at path. Failing to resolve the version's object name
+// is not an error; the bundle is written without it.
+func recordECS(ctx context.Context, path, root, version, artifact string, spec []byte) error {
+	sha, err := ecsRevision(ctx, root, version)
+	if err != nil {
+		slog.Warn("failed to resolve ECS version for recording", "version", version, "error", err)
+	}
+	sum := sha256.Sum256(spec)
+	b, err := json.MarshalIndent(ecsBundle{
+		Version:  version,
+		Artifact: artifact,
+		SHA:      sha,
+		SHA256:   hex.EncodeToString(sum[:]),
+		Spec:     string(spec),
+	}, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o644)
+}
+
+// artifact returns the specification artifact held by the bundle.
+func (b ecsBundle) artifact() string {
+	if b.Artifact == "" {
+		return "nested"
+	}
+	return b.Artifact
+}
+
+// readBundle returns the ECS bundle held in the file at path. It is an
+// error for the specification not to match the bundle's hash.
+func readBundle(path string) (ecsBundle, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return ecsBundle{}, err
+	}
+	var bundle ecsBundle
+	err = json.Unmarshal(b, &bundle)
+	if err != nil {
+		return ecsBundle{}, fmt.Errorf("%s: %w", path, err)
+	}
+	if bundle.Version == "" {
+		return ecsBundle{}, fmt.Errorf("%s: no version in ECS bundle", path)
+	}
+	sum := sha256.Sum256([]byte(bundle.Spec))
+	if got := hex.EncodeToString(sum[:]); got != bundle.SHA256 {
+		return ecsBundle{}, fmt.Errorf("%s: ECS bundle hash mismatch: have %s, want %s", path, got, bundle.SHA256)
+	}
+	return bundle, nil
+}
+
+// ecsRevision returns the object name of the version in the ECS repo at
+// root, or in github.com/elastic/ecs if root is empty. If root is a release
+// archive, the object name is the commit recorded in the archive.
+func ecsRevision(ctx context.Context, root, version string) (string, error) {
+	if isArchive(root) {
+		return archiveRevision(root)
+	}
+	if root != "" {
+		repo, err := gitrepo.Open(root)
+		if err != nil {
+			return "", err
+		}
+		defer repo.Close()
+		return repo.Resolve(version)
+	}
+	if len(version) == 40 && immutable.MatchString(version) {
+		return version, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf(commitURL, url.PathEscape(version)), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/vnd.github.sha")
+	cli := http.Client{Timeout: time.Minute}
+	resp, err := cli.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("resolving ECS %s: %s", version, resp.Status)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"gonum.org/v1/gonum/graph/formats/rdf"
+
+	"github.com/efd6/ecsinrdf/graph"
+	"github.com/efd6/ecsinrdf/term"
+)
+
+// ecsCacheVersion identifies the statements constructed from an ECS
+// specification. It must be changed whenever the schema package changes
+// the statements it constructs so that stale cached graphs are not used.
+const ecsCacheVersion = "13"
+
+// ecsStatements returns the canonicalized statements constructed from the
+// ECS specification described by cfg. Unless cfg.noCache is set, the
+// statements are read from the user's cache directory if they have been
+// cached, and are cached otherwise. Cached statements are keyed by the ECS
+// version and a hash of the specification, so changes to a branch are not
+// hidden by the cache.
+func ecsStatements(ctx context.Context, cfg graphConfig) ([]*rdf.Statement, error) {
+	spec, err := ecsSpecFor(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var cache string
+	if !cfg.noCache {
+		cache, err = ecsCachePath(cfg.version, spec)
+		if err == nil {
+			statements, err := readStatements(cache, cfg.store)
+			if err == nil {
+				return statements, nil
+			}
+		}
+	}
+
+	var statements []*rdf.Statement
+	add := term.CanonicalPaths(func(s *rdf.Statement, err error) {
+		if err != nil {
+			slog.Warn("omitting invalid ECS statement", "version", cfg.version, "error", err)
+			return
+		}
+		statements = append(statements, s)
+	})
+	err = graph.ECSStatements(ctx, bytes.NewReader(spec), cfg.artifact, add)
+	if err != nil {
+		return nil, err
+	}
+	statements, err = graph.Canonicalize(statements)
+	if err != nil {
+		return nil, err
+	}
+
+	if cache != "" {
+		var buf bytes.Buffer
+		for _, s := range statements {
+			buf.WriteString(s.String())
+			buf.WriteByte('\n')
+		}
+		err = writeCache(cache, buf.Bytes())
+		if err != nil {
+			// The cache is an optimization, so
+			// failing to write it is not fatal.
+			slog.Warn("failed to cache ECS graph", "version", cfg.version, "error", err)
+		}
+	}
+	return statements, nil
+}
+
+// ecsCachePath returns the path of the cached statements for the ECS
+// specification spec at the given version.
+func ecsCachePath(version string, spec []byte) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	h.Write([]byte(ecsCacheVersion))
+	h.Write([]byte{0})
+	h.Write(spec)
+	name := hex.EncodeToString(h.Sum(nil)) + ".nq"
+	return filepath.Join(dir, "ecsinrdf", "graph", url.PathEscape(version), name), nil
+}
+
+// ecsSpecFor returns the nested ECS specification described by cfg,
+// reading it from the replay bundle if one is given, and records it to
+// the record bundle if one is given.
+func ecsSpecFor(ctx context.Context, cfg graphConfig) ([]byte, error) {
+	var spec []byte
+	if cfg.replay != "" {
+		bundle, err := readBundle(cfg.replay)
+		if err != nil {
+			return nil, err
+		}
+		if bundle.Version != cfg.version {
+			return nil, fmt.Errorf("%s: ECS bundle is for version %s, not %s", cfg.replay, bundle.Version, cfg.version)
+		}
+		if bundle.artifact() != cfg.artifact {
+			return nil, fmt.Errorf("%s: ECS bundle holds the %s artifact, not %s", cfg.replay, bundle.artifact(), cfg.artifact)
+		}
+		spec = []byte(bundle.Spec)
+	} else {
+		ecs, err := ecsSpec(ctx, cfg.root, cfg.version, cfg.artifact)
+		if err != nil {
+			return nil, err
+		}
+		spec, err = io.ReadAll(ecs)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if cfg.record != "" {
+		err := recordECS(ctx, cfg.record, cfg.root, cfg.version, cfg.artifact, spec)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return spec, nil
+}
+
+// readStatements returns the statements held as N-Quads in the file at
+// path, parsed with store.
+func readStatements(path string, store *term.Store) ([]*rdf.Statement, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var statements []*rdf.Statement
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		s, err := store.Parse(sc.Text())
+		if err != nil {
+			return nil, err
+		}
+		statements = append(statements, s)
+	}
+	return statements, sc.Err()
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// changelogLink is the placeholder link of generated changelog entries.
+// The link is to the pull request making the change, which does not exist
+// when the entry is generated.
+const changelogLink = "https://github.com/elastic/integrations/pull/TODO"
+
+// changelogEntry is a version entry of a package's changelog.yml.
+type changelogEntry struct {
+	Version string            `yaml:"version"`
+	Changes []changelogChange `yaml:"changes"`
+}
+
+// changelogChange is a change in a changelog.yml version entry.
+type changelogChange struct {
+	Description string `yaml:"description"`
+	Type        string `yaml:"type"`
+	Link        string `yaml:"link"`
+}
+
+// appliedGraft is a graft applied to the fields files of a package.
+type appliedGraft struct {
+	from, to string
+}
+
+// writeChangelog writes a changelog.yml fragment to w for each package
+// directory in applied, describing the grafts applied to it. Each
+// fragment is a new version entry following the version in the package's
+// manifest, and is preceded by a comment naming the changelog it belongs
+// in. Grafts that leave an alias are enhancements and bump the minor
+// version. Grafts that move fields without an alias break queries on the
+// old path, so they are breaking changes and bump the major version.
+func writeChangelog(w io.Writer, applied map[string][]appliedGraft, alias bool) error {
+	dirs := make([]string, 0, len(applied))
+	for dir := range applied {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	typ := "breaking-change"
+	if alias {
+		typ = "enhancement"
+	}
+	for i, dir := range dirs {
+		version, err := packageVersion(dir)
+		if err != nil {
+			return err
+		}
+		next, err := nextVersion(version, !alias)
+		if err != nil {
+			return fmt.Errorf("%s: %w", dir, err)
+		}
+		entry := changelogEntry{Version: next}
+		for _, a := range applied[dir] {
+			desc := fmt.Sprintf("Move %s field to ECS field %s.", a.from, a.to)
+			if alias {
+				desc = fmt.Sprintf("Move %s field to ECS field %s, leaving an alias at %s.", a.from, a.to, a.from)
+			}
+			entry.Changes = append(entry.Changes, changelogChange{
+				Description: desc,
+				Type:        typ,
+				Link:        changelogLink,
+			})
+		}
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		err = enc.Encode([]changelogEntry{entry})
+		if err != nil {
+			return err
+		}
+		err = enc.Close()
+		if err != nil {
+			return err
+		}
+		if i != 0 {
+			fmt.Fprintln(w, "---")
+		}
+		fmt.Fprintf(w, "# %s\n", filepath.Join(dir, "changelog.yml"))
+		_, err = w.Write(buf.Bytes())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nextVersion returns the package version following the semantic version
+// v. If breaking is true, the major version is bumped, otherwise the minor
+// version is bumped. Pre-release and build suffixes are dropped.
+func nextVersion(v string, breaking bool) (string, error) {
+	core, _, _ := strings.Cut(v, "+")
+	core, _, _ = strings.Cut(core, "-")
+	elems := strings.Split(core, ".")
+	if len(elems) != 3 {
+		return "", fmt.Errorf("invalid package version: %s", v)
+	}
+	var n [3]int
+	for i, e := range elems {
+		var err error
+		n[i], err = strconv.Atoi(e)
+		if err != nil {
+			return "", fmt.Errorf("invalid package version: %s", v)
+		}
+	}
+	if breaking {
+		return fmt.Sprintf("%d.0.0", n[0]+1), nil
+	}
+	return fmt.Sprintf("%d.%d.0", n[0], n[1]+1), nil
+}
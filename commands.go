@@ -0,0 +1,1374 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gonum.org/v1/gonum/graph/formats/rdf"
+
+	"github.com/efd6/ecsinrdf/owner"
+	"github.com/efd6/ecsinrdf/query"
+	"github.com/efd6/ecsinrdf/template"
+	"github.com/efd6/ecsinrdf/term"
+	"github.com/efd6/ecsinrdf/vocab"
+)
+
+// command is an ecsinrdf subcommand.
+type command struct {
+	name string
+	// summary is a one line description of the
+	// command shown in the top-level usage.
+	summary string
+	run     func(args []string)
+}
+
+// commands is the list of subcommands in the order they are shown in the
+// top-level usage.
+var commands = []command{
+	{name: "graft", summary: "report or apply graft candidates for package fields", run: graftCommand},
+	{name: "query", summary: "report graft candidates for a field path and type", run: queryCommand},
+	{name: "lint", summary: "report package field problems found by the named check", run: lintCommand},
+	{name: "categorize", summary: "report problems with event.category and event.type combinations", run: categorizeCommand},
+	{name: "audit", summary: "record package findings and report changes since the last run", run: auditCommand},
+	{name: "adopt", summary: "write a migration plan for adopting an ECS field set", run: adoptCommand},
+	{name: "diff", summary: "report field-level changes between two ECS versions", run: diffCommand},
+	{name: "upgrade", summary: "report package external ECS fields affected by an ECS upgrade", run: upgradeCommand},
+	{name: "simulate", summary: "report the simulated effective mapping of a data stream", run: simulateCommand},
+	{name: "export", summary: "write the canonicalized graph to a file", run: exportCommand},
+	{name: "repl", summary: "build the graph once and answer queries interactively", run: replCommand},
+	{name: "schema", summary: "write the JSON Schema of the /check analysis report", run: schemaCommand},
+	{name: "serve", summary: "serve JSON-RPC requests over stdio or HTTP", run: serveCommand},
+}
+
+// newFlagSet returns a flag set for the named subcommand. The args
+// parameter describes the positional arguments of the command and is shown
+// in its usage with the summary of the command.
+func newFlagSet(name, args, summary string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s %s [flags] %s\n\n%s.\n\n", os.Args[0], name, args, summary)
+		printDefaults(fs)
+	}
+	return fs
+}
+
+// graphFlags holds the flags shared by subcommands that build an analysis
+// graph.
+type graphFlags struct {
+	root, version string
+	pkg, owners   string
+	prune         bool
+	noCache       bool
+	sources       []string
+	record        string
+	replay        string
+	fields        stringList
+	artifact      string
+
+	// versions holds the ECS versions given after
+	// the first by repeating the version flag.
+	versions []string
+
+	// fs is the flag set holding the flags.
+	fs *flag.FlagSet
+
+	cpuProfile, memProfile, execTrace string
+}
+
+// addGraphFlags adds the shared graph flags to fs. Package flags are only
+// added if pkg is true.
+func addGraphFlags(fs *flag.FlagSet, pkg bool) *graphFlags {
+	f := graphFlags{fs: fs}
+	fs.StringVar(&f.root, "ecs-root", "", "specify the path to the root of the ecs repo, or to a release archive of it (.tar.gz, .tgz, .tar or .zip) from which the ECS spec is read without extraction (if empty, the ECS spec is fetched from github.com/elastic/ecs and cached for release tags)")
+	fs.Func("version", "specify the `version` of ECS to use (tag, branch or sha); if repeated, the fields of the later versions are added to the graph tagged with their version, and the first version is the one the package uses", func(s string) error {
+		if f.version == "" {
+			f.version = s
+			return nil
+		}
+		if s == f.version {
+			return nil
+		}
+		for _, v := range f.versions {
+			if s == v {
+				return nil
+			}
+		}
+		f.versions = append(f.versions, s)
+		return nil
+	})
+	fs.StringVar(&f.artifact, "ecs-artifact", "nested", "specify the ECS artifact to build the graph from: nested (ecs_nested.yml), flat (ecs_flat.yml) or schemas (the source schemas, for versions without up to date generated artifacts)")
+	fs.BoolVar(&f.noCache, "no-cache", false, "do not read or write the on-disk cache of canonicalized ECS graphs")
+	fs.StringVar(&f.record, "record-ecs", "", "write the ECS spec used, with its version, commit and hash, to the specified bundle file for replay")
+	fs.StringVar(&f.replay, "replay-ecs", "", "read the ECS spec from the specified bundle file written by record-ecs (the version defaults to the bundle's version)")
+	fs.Func("source", "run the specified command and add the N-Quads it writes to stdout to the graph (may be repeated)", func(s string) error {
+		f.sources = append(f.sources, s)
+		return nil
+	})
+	if pkg {
+		fs.StringVar(&f.pkg, "pkg-path", ".", "specify the path to the root of the package(s)")
+		fs.Var(&f.fields, "fields-file", "specify a comma-separated list of fields files or glob patterns to analyze in place of the fields files found in pkg-path (may be repeated; other package files are only read if pkg-path is set)")
+		fs.StringVar(&f.owners, "owners", "", "specify the path to a CODEOWNERS-like file attributing package paths to teams (paths are relative to pkg-path)")
+		fs.BoolVar(&f.prune, "prune-groups", false, "collapse chains of package groups with a single child before analysis")
+	}
+	fs.StringVar(&f.cpuProfile, "cpuprofile", "", "write a CPU profile to the specified file")
+	fs.StringVar(&f.memProfile, "memprofile", "", "write a heap profile to the specified file")
+	fs.StringVar(&f.execTrace, "trace", "", "write an execution trace to the specified file")
+	return &f
+}
+
+// config returns the graph configuration described by the flags. Sample
+// and test documents are included if documents is true.
+func (f *graphFlags) config(documents bool) (graphConfig, error) {
+	cfg := graphConfig{
+		root:      f.root,
+		version:   f.version,
+		versions:  f.versions,
+		artifact:  f.artifact,
+		pkg:       f.pkg,
+		documents: documents,
+		prune:     f.prune,
+		noCache:   f.noCache,
+		sources:   f.sources,
+		record:    f.record,
+		replay:    f.replay,
+		fields:    f.fields,
+	}
+	if len(f.fields) != 0 && !f.isSet("pkg-path") {
+		cfg.pkg = ""
+	}
+	if _, ok := ecsArtifacts[cfg.artifact]; !ok {
+		return graphConfig{}, fmt.Errorf("unknown ECS artifact: %s", cfg.artifact)
+	}
+	if f.record != "" && len(f.versions) != 0 {
+		return graphConfig{}, fmt.Errorf("cannot record more than one ECS version")
+	}
+	if f.replay != "" {
+		bundle, err := readBundle(f.replay)
+		if err != nil {
+			return graphConfig{}, err
+		}
+		if cfg.version == "" {
+			cfg.version = bundle.Version
+		}
+		if !f.isSet("ecs-artifact") {
+			cfg.artifact = bundle.artifact()
+		}
+	}
+	if f.owners != "" {
+		r, err := os.Open(f.owners)
+		if err != nil {
+			return graphConfig{}, err
+		}
+		cfg.rules, err = owner.Parse(r)
+		r.Close()
+		if err != nil {
+			return graphConfig{}, err
+		}
+	}
+	return cfg, nil
+}
+
+// build returns the analysis graph described by the flags and the package
+// fields files that were included. Failures are fatal.
+func (f *graphFlags) build(documents bool) (*rdf.Graph, []fieldsFile) {
+	cfg, err := f.config(documents)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return f.buildConfig(cfg)
+}
+
+// buildConfig returns the analysis graph described by cfg and the package
+// fields files that were included. An interrupt cancels the build. Failures
+// are fatal.
+func (f *graphFlags) buildConfig(cfg graphConfig) (*rdf.Graph, []fieldsFile) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	g, files, err := buildGraph(ctx, cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return g, files
+}
+
+// profile starts the profiling requested by the flags and returns a
+// function that stops it.
+func (f *graphFlags) profile() (stop func()) {
+	s, err := startProfiling(f.cpuProfile, f.memProfile, f.execTrace)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return func() {
+		err := s()
+		if err != nil {
+			slog.Error("failed to stop profiling", "error", err)
+		}
+	}
+}
+
+// pathRuleFlags holds the flags describing how package paths are rewritten
+// before they are matched against ECS paths, and which ECS fields they may
+// match.
+type pathRuleFlags struct {
+	prefixes, transparent stringList
+	packagePrefix         bool
+	coreOnly              bool
+	reusePoints           bool
+}
+
+// addPathRuleFlags adds the path rewriting flags to fs. The package prefix
+// flag is only added if pkg is true.
+func addPathRuleFlags(fs *flag.FlagSet, pkg bool) *pathRuleFlags {
+	var f pathRuleFlags
+	fs.Var(&f.prefixes, "strip-prefix", "specify a comma-separated list of dotted vendor prefixes that are removed from the start of package paths before matching them to ECS paths (may be repeated)")
+	fs.Var(&f.transparent, "transparent", "specify a comma-separated list of dotted path segments, such as vendor prefixes, that are skipped when matching package paths to ECS paths (may be repeated)")
+	if pkg {
+		fs.BoolVar(&f.packagePrefix, "strip-package-prefix", false, "remove the names of the packages under pkg-path from the start of package paths before matching them to ECS paths")
+	}
+	fs.BoolVar(&f.coreOnly, "core-only", false, "only match package paths to core level ECS fields, omitting extended fields from graft candidates")
+	fs.BoolVar(&f.reusePoints, "reuse-points", false, "only report graft candidates at the locations of ECS field sets: the locations of top level field sets and the locations field sets are expected to be reused at")
+	return &f
+}
+
+// addLimitFlags adds the flags bounding graft candidate queries to fs.
+func addLimitFlags(fs *flag.FlagSet) *query.Limits {
+	var l query.Limits
+	fs.IntVar(&l.FanOut, "max-fanout", 0, "specify the maximum number of graph nodes held at each step of a query's path walk (0 is no limit; results are marked as truncated when the limit is reached)")
+	fs.IntVar(&l.Results, "max-candidates", 0, "specify the maximum number of candidates returned for a query (0 is no limit)")
+	fs.DurationVar(&l.Timeout, "query-timeout", 0, "specify the maximum time spent walking the path of a query, returning the candidates found so far when it is reached (0 is no limit)")
+	return &l
+}
+
+// rules returns the path rules described by the flags for the package(s)
+// rooted at pkg.
+func (f *pathRuleFlags) rules(pkg string) (query.PathRules, error) {
+	return pathRules(f.base(), f.packagePrefix, pkg)
+}
+
+// base returns the path rules described by the flags without the names of
+// any packages.
+func (f *pathRuleFlags) base() query.PathRules {
+	rules := query.PathRules{Prefixes: f.prefixes, Transparent: f.transparent, ReusePoints: f.reusePoints}
+	if f.coreOnly {
+		rules.Levels = []string{"core"}
+	}
+	return rules
+}
+
+// isSet returns whether the named flag was set on the command line.
+func (f *graphFlags) isSet(name string) bool {
+	var set bool
+	f.fs.Visit(func(fl *flag.Flag) {
+		set = set || fl.Name == name
+	})
+	return set
+}
+
+// requireECS exits with the usage of fs if the ECS version is not set and
+// is not provided by a replayed bundle.
+func (f *graphFlags) requireECS(fs *flag.FlagSet) {
+	if f.version == "" && f.replay == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+}
+
+func graftCommand(args []string) {
+	fs := newFlagSet("graft", "", "Report graft candidates for package fields, or apply grafts to the package fields files")
+	gf := addGraphFlags(fs, true)
+	format := fs.String("format", "text", "specify the graft report format: text, lines (a stable line-oriented format suitable for committing and diffing), github (GitHub Actions annotations) or markdown (a report grouped by data stream, including type conflicts)")
+	baseline := fs.String("baseline", "", "specify the path to a baseline file of known findings that are not reported")
+	writeBase := fs.String("write-baseline", "", "write the current findings to the specified baseline file")
+	var exclude stringList
+	fs.Var(&exclude, "exclude", "specify a comma-separated list of graft destination path patterns to exclude (may be repeated)")
+	paths := addPathRuleFlags(fs, true)
+	var apply stringList
+	fs.Var(&apply, "apply", "specify a comma-separated list of grafts old.path=ecs.path to apply to the package fields files (may be repeated)")
+	alias := fs.Bool("alias", false, "leave an alias field at the old path of each applied graft")
+	changelog := fs.String("changelog", "", "write the changelog.yml fragments describing applied grafts to the specified file instead of to stdout after the applied grafts")
+	evidenceOnly := fs.Bool("evidence-only", false, "omit graft candidates in field sets the package does not use when another candidate's field set is used")
+	var failOn stringList
+	fs.Var(&failOn, "fail-on", "specify a comma-separated list of findings that cause a non-zero exit status: grafts, conflicts or errors (the status is the sum of 4 for grafts, 8 for conflicts and 16 for errors)")
+	fs.Parse(args)
+	gf.requireECS(fs)
+	switch *format {
+	case "text", "lines", "github", "markdown":
+	default:
+		fmt.Fprintf(fs.Output(), "unknown format: %s\n", *format)
+		fs.Usage()
+		os.Exit(2)
+	}
+	for _, f := range failOn {
+		if _, ok := failureStatus[f]; !ok {
+			fmt.Fprintf(fs.Output(), "unknown finding: %s\n", f)
+			fs.Usage()
+			os.Exit(2)
+		}
+	}
+	stop := gf.profile()
+	defer stop()
+
+	cfg, err := gf.config(false)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Saved object references are only needed to
+	// warn about grafts that break them.
+	cfg.kibana = len(apply) != 0
+	g, files := gf.buildConfig(cfg)
+
+	if len(apply) != 0 {
+		idx, err := packagesIn(cfg.pkg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		changes := make(map[string][]appliedGraft)
+		for _, a := range apply {
+			parts := strings.Split(a, "=")
+			if len(parts) != 2 {
+				log.Fatalf("invalid graft: %q", a)
+			}
+			if !isECSField(g, parts[1]) {
+				log.Fatalf("invalid graft: %s is not an ECS field", parts[1])
+			}
+			if refs := query.ReferencesTo(g, term.Literal(parts[0])); len(refs) != 0 {
+				slog.Warn("graft breaks saved object references", "path", parts[0], "references", refs)
+			}
+			var applied bool
+			described := make(map[string]bool)
+			for _, ff := range files {
+				ok, err := applyGraft(ff.path, parts[0], parts[1], *alias)
+				if err != nil {
+					log.Fatalf("%s: %v", ff.path, err)
+				}
+				if ok {
+					fmt.Println(msg("graft.applied", ff.path, parts[0], parts[1]))
+					dir := filepath.FromSlash(idx.PackageDirOf(filepath.ToSlash(ff.path)))
+					if len(idx) == 0 {
+						// A single package without a
+						// format version is not indexed.
+						dir = cfg.pkg
+					}
+					if dir != "" && !described[dir] {
+						described[dir] = true
+						changes[dir] = append(changes[dir], appliedGraft{from: parts[0], to: parts[1]})
+					}
+				}
+				applied = applied || ok
+			}
+			if !applied {
+				slog.Warn("field not defined in package", "path", parts[0])
+			}
+		}
+		if len(changes) == 0 {
+			return
+		}
+		if *changelog == "" {
+			fmt.Println()
+			err = writeChangelog(os.Stdout, changes, *alias)
+			if err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+		f, err := os.Create(*changelog)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = writeChangelog(f, changes, *alias)
+		if err != nil {
+			f.Close()
+			log.Fatal(err)
+		}
+		err = f.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	rules, err := paths.rules(cfg.pkg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	suggestions, err := graftSuggestionsIn(g, gf.version, exclude, rules, *evidenceOnly)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *writeBase != "" {
+		err := writeBaseline(*writeBase, suggestions)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *baseline != "" {
+		known, err := readBaseline(*baseline)
+		if err != nil {
+			log.Fatal(err)
+		}
+		suggestions, err = newFindings(suggestions, known)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	var conflicts []query.Conflict
+	if *format == "markdown" || failOn.contains("conflicts") {
+		conflicts = query.DataStreamConflictsIn(g)
+	}
+	switch *format {
+	case "text":
+		idx, err := packagesIn(cfg.pkg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(idx) < 2 {
+			writeGraftText(suggestions)
+			break
+		}
+		groups, err := suggestionsByPackage(g, suggestions)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, grp := range groups {
+			fmt.Printf("%s\n\n", msg("graft.package", grp.name))
+			writeGraftText(grp.suggestions)
+		}
+	case "lines":
+		lines, err := findingLines(suggestions)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, l := range lines {
+			fmt.Println(l)
+		}
+	case "github":
+		err := writeAnnotations(os.Stdout, g, cfg.pkg, suggestions)
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "markdown":
+		err := writeMarkdown(os.Stdout, g, cfg.version, cfg.pkg, suggestions, conflicts)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if status := findingStatus(failOn, suggestions, conflicts); status != 0 {
+		// Exiting skips deferred calls.
+		stop()
+		os.Exit(status)
+	}
+}
+
+// failureStatus holds the exit status bit for each kind of finding that
+// may be named by the graft command's fail-on flag. The low bits are used
+// by fatal errors and usage errors.
+var failureStatus = map[string]int{
+	"grafts":    1 << 2,
+	"conflicts": 1 << 3,
+	"errors":    1 << 4,
+}
+
+// findingStatus returns the exit status for the findings in suggestions
+// and conflicts of the kinds named in failOn. It is zero if there are no
+// such findings. The number of findings of each kind is logged.
+func findingStatus(failOn stringList, suggestions []graftSuggestion, conflicts []query.Conflict) int {
+	var grafts, errs int
+	for _, s := range suggestions {
+		if s.err != nil {
+			errs++
+		}
+		if len(s.candidates) != 0 {
+			grafts++
+		}
+	}
+	status := 0
+	for _, f := range []struct {
+		kind string
+		n    int
+	}{
+		{kind: "grafts", n: grafts},
+		{kind: "conflicts", n: len(conflicts)},
+		{kind: "errors", n: errs},
+	} {
+		if f.n != 0 && failOn.contains(f.kind) {
+			slog.Info("found failing findings", "kind", f.kind, "count", f.n)
+			status |= failureStatus[f.kind]
+		}
+	}
+	return status
+}
+
+// writeGraftText writes the graft findings in suggestions to stdout as
+// text.
+func writeGraftText(suggestions []graftSuggestion) {
+	for _, s := range suggestions {
+		var notes []string
+		if len(s.fields) != 0 {
+			notes = append(notes, msg("graft.object", len(s.fields)))
+		}
+		if s.inferredType != "" {
+			notes = append(notes, msg("graft.inferred", s.inferredType))
+		}
+		if len(s.owners) != 0 {
+			notes = append(notes, msg("graft.owners", strings.Join(s.owners, ", ")))
+		}
+		if len(notes) != 0 {
+			fmt.Printf("%s (%s)\n", s.path, strings.Join(notes, "; "))
+		} else {
+			fmt.Printf("%s\n", s.path)
+		}
+		if s.err != nil {
+			fmt.Printf("\t%s: %v\n", s.path, s.err)
+		}
+		for _, c := range s.candidates {
+			var notes []string
+			if len(c.Evidence) != 0 {
+				notes = append(notes, msg("graft.evidence", evidenceSummary(c.Evidence)))
+			}
+			if len(c.Examples) != 0 {
+				notes = append(notes, msg("graft.examples", strings.Join(c.Examples, ", ")))
+			}
+			if len(notes) == 0 {
+				fmt.Printf("\t%s\n", c)
+				continue
+			}
+			fmt.Printf("\t%s (%s)\n", c, strings.Join(notes, "; "))
+		}
+		fmt.Println()
+	}
+}
+
+// maxEvidence is the number of evidence paths shown for a candidate in
+// text reports.
+const maxEvidence = 3
+
+// evidenceSummary returns a summary of the evidence paths for text
+// reports.
+func evidenceSummary(evidence []string) string {
+	if len(evidence) <= maxEvidence {
+		return strings.Join(evidence, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(evidence[:maxEvidence], ", "), len(evidence)-maxEvidence)
+}
+
+func queryCommand(args []string) {
+	fs := newFlagSet("query", "path.to.field:type... | -", "Report the ECS graft candidates for fields with the given paths and types. If the query is -, newline-delimited queries are read from stdin and each result is written as soon as it is computed. When more than one query is given, each result is prefixed with its query")
+	gf := addGraphFlags(fs, false)
+	var exclude stringList
+	fs.Var(&exclude, "exclude", "specify a comma-separated list of graft destination path patterns to exclude (may be repeated)")
+	paths := addPathRuleFlags(fs, false)
+	queryFile := fs.String("query-file", "", "specify a file holding one path.to.field:type query per line (blank lines and lines starting with # are ignored)")
+	limits := addLimitFlags(fs)
+	field := fs.String("field", "", "specify a single path.to.field:type query to report the full placement decision for: the exact ECS match, rename candidates, type-coerced candidates and the locations each candidate is reused at (no other queries may be given)")
+	fs.Parse(args)
+	gf.requireECS(fs)
+	if *field != "" {
+		if !validQuery(*field) || fs.NArg() != 0 || *queryFile != "" {
+			fs.Usage()
+			os.Exit(2)
+		}
+		defer gf.profile()()
+		rules, err := paths.rules("")
+		if err != nil {
+			log.Fatal(err)
+		}
+		g, _ := gf.build(false)
+		err = writePlacement(g, *field, exclude, rules)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	queries := fs.Args()
+	stdin := len(queries) == 1 && queries[0] == "-"
+	if stdin {
+		queries = nil
+	}
+	if *queryFile != "" {
+		fileQueries, err := readQueries(*queryFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		queries = append(queries, fileQueries...)
+	}
+	if len(queries) == 0 && !stdin {
+		fs.Usage()
+		os.Exit(2)
+	}
+	for _, q := range queries {
+		if !validQuery(q) {
+			fs.Usage()
+			os.Exit(2)
+		}
+	}
+	defer gf.profile()()
+
+	rules, err := paths.rules("")
+	if err != nil {
+		log.Fatal(err)
+	}
+	g, _ := gf.build(false)
+	prefix := stdin || len(queries) > 1
+	for _, q := range queries {
+		writeQuery(g, q, exclude, rules, *limits, prefix)
+	}
+	if !stdin {
+		return
+	}
+	// Invalid queries are reported in place so
+	// that a pipeline is not stopped by bad input.
+	sc := bufio.NewScanner(os.Stdin)
+	for sc.Scan() {
+		q := strings.TrimSpace(sc.Text())
+		switch {
+		case q == "" || strings.HasPrefix(q, "#"):
+		case !validQuery(q):
+			fmt.Println(msg("query.invalid", q))
+		default:
+			writeQuery(g, q, exclude, rules, *limits, prefix)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func categorizeCommand(args []string) {
+	fs := newFlagSet("categorize", "category[,category...]:type[,type...]...", "Report the problems with event categorizations given as comma-separated event.category and event.type values, such as authentication:start, checking that the values are allowed by ECS and that the types are expected with the categories")
+	gf := addGraphFlags(fs, false)
+	fs.Parse(args)
+	gf.requireECS(fs)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	for _, c := range fs.Args() {
+		if !validQuery(c) {
+			fs.Usage()
+			os.Exit(2)
+		}
+	}
+	defer gf.profile()()
+
+	g, _ := gf.build(false)
+	for _, c := range fs.Args() {
+		parts := strings.Split(c, ":")
+		issues := query.CategorizationIssuesOf(g, categorizationValues(parts[0]), categorizationValues(parts[1]))
+		if len(issues) == 0 {
+			fmt.Println(msg("categorize.valid", c))
+			continue
+		}
+		fmt.Printf("%s: %s\n", c, strings.Join(issues, "; "))
+	}
+}
+
+// categorizationValues returns the quoted values in the comma-separated
+// list.
+func categorizationValues(list string) []string {
+	var vals []string
+	for _, v := range strings.Split(list, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			vals = append(vals, term.Literal(v))
+		}
+	}
+	return vals
+}
+
+// validQuery returns whether q is a path:type query.
+func validQuery(q string) bool {
+	return len(strings.Split(q, ":")) == 2
+}
+
+// writeQuery writes the graft candidates for the path:type query q in g
+// to stdout, omitting those matching the exclude patterns. The query path
+// is rewritten by the rules before matching and the query is bounded by
+// the limits. The result is prefixed with the query if prefix is true, and
+// is marked if it was truncated by the limits.
+func writeQuery(g *rdf.Graph, q string, exclude []string, rules query.PathRules, limits query.Limits, prefix bool) {
+	var p string
+	if prefix {
+		p = q + ": "
+	}
+	parts := strings.Split(q, ":")
+	cands, truncated, err := query.LimitedCandidateGraftsFor(g, term.Literal(parts[0]), term.Literal(parts[1]), rules, limits)
+	if err != nil {
+		fmt.Printf("%s%v\n", p, err)
+		return
+	}
+	cands, err = query.ExcludeCandidates(cands, exclude)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Without package fields, candidates are
+	// ranked by depth.
+	cands, err = query.PathContext{}.Rank(cands)
+	if err != nil {
+		log.Fatal(err)
+	}
+	collapsed, err := query.CollapseMultiFields(g, term.Literal(parts[0]), cands, rules)
+	if err != nil {
+		fmt.Printf("%s%v\n", p, err)
+		return
+	}
+	if truncated {
+		fmt.Printf("%s%v %s\n", p, collapsed, msg("query.truncated"))
+		return
+	}
+	fmt.Printf("%s%v\n", p, collapsed)
+}
+
+// writePlacement writes the placement decision trace for the path:type
+// query q in g to stdout, omitting candidates matching the exclude
+// patterns. The query path is rewritten by the rules before matching.
+func writePlacement(g *rdf.Graph, q string, exclude []string, rules query.PathRules) error {
+	parts := strings.Split(q, ":")
+	p, err := query.PlacementOf(g, term.Literal(parts[0]), term.Literal(parts[1]), rules)
+	if err != nil {
+		return err
+	}
+	var all []string
+	for _, r := range p.Renames {
+		all = append(all, r.Path)
+		all = append(all, r.Reuses...)
+	}
+	for _, c := range p.Coerced {
+		all = append(all, c.Path)
+	}
+	kept, err := query.ExcludeCandidates(all, exclude)
+	if err != nil {
+		return err
+	}
+	isKept := make(map[string]bool, len(kept))
+	for _, c := range kept {
+		isKept[c] = true
+	}
+	keep := func(path string) bool { return isKept[path] }
+
+	fmt.Println(q)
+	switch {
+	case p.Exact == nil:
+		fmt.Println(msg("field.exact_none"))
+	default:
+		types, err := unquote(p.Exact.Types)
+		if err != nil {
+			return err
+		}
+		fieldsets, err := unquote(p.Exact.Fieldsets)
+		if err != nil {
+			return err
+		}
+		fmt.Println(msg("field.exact", parts[0], strings.Join(types, ", "), strings.Join(fieldsets, ", ")))
+		matched := false
+		for _, t := range types {
+			matched = matched || t == parts[1]
+		}
+		if !matched {
+			fmt.Println("\t" + msg("field.exact_mismatch", parts[1]))
+		}
+	}
+
+	fmt.Println(msg("field.renames"))
+	var n int
+	for _, r := range p.Renames {
+		if !keep(r.Path) {
+			continue
+		}
+		n++
+		path, err := term.Text(r.Path)
+		if err != nil {
+			return err
+		}
+		fmt.Println("\t" + path)
+		var reuses []string
+		for _, u := range r.Reuses {
+			if keep(u) {
+				reuses = append(reuses, u)
+			}
+		}
+		if len(reuses) != 0 {
+			reuses, err = unquote(reuses)
+			if err != nil {
+				return err
+			}
+			fmt.Println("\t\t" + msg("field.reused_at", strings.Join(reuses, ", ")))
+		}
+	}
+	if n == 0 {
+		fmt.Println("\t" + msg("field.none"))
+	}
+
+	fmt.Println(msg("field.coerced"))
+	n = 0
+	for _, c := range p.Coerced {
+		if !keep(c.Path) {
+			continue
+		}
+		n++
+		text, err := unquote([]string{c.Path, c.Type})
+		if err != nil {
+			return err
+		}
+		fmt.Println("\t" + msg("field.coerced_as", text[0], text[1]))
+	}
+	if n == 0 {
+		fmt.Println("\t" + msg("field.none"))
+	}
+	return nil
+}
+
+// readQueries returns the path:type queries held one per line in the file
+// at path. Blank lines and lines starting with # are ignored.
+func readQueries(path string) ([]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var queries []string
+	for i, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !validQuery(line) {
+			return nil, fmt.Errorf("%s:%d: invalid query: %q", path, i+1, line)
+		}
+		queries = append(queries, line)
+	}
+	return queries, nil
+}
+
+// lintChecks are the checks available to the lint command.
+var lintChecks = []struct {
+	name, summary string
+	// documents specifies whether the check needs
+	// sample and test documents.
+	documents bool
+	run       func(g *rdf.Graph, gf *graphFlags)
+}{
+	{name: "conflicts", summary: "fields declared with different types in different data streams", run: lintConflicts},
+	{name: "unobserved", summary: "declared fields not observed in sample or test documents", documents: true, run: lintUnobserved},
+	{name: "undeclared", summary: "fields observed in sample or test documents that are not declared", documents: true, run: lintUndeclared},
+	{name: "completeness", summary: "field metadata completeness scores for each data stream", run: lintCompleteness},
+	{name: "analysis", summary: "fields with custom analyzers or norms that deviate from ECS practice", run: lintAnalysis},
+	{name: "groups", summary: "implicit package groups that ECS defines as nested or leaf fields", run: lintGroups},
+	{name: "descriptions", summary: "package field descriptions that differ from the description of the ECS field with the same path", run: lintDescriptions},
+	{name: "docs", summary: "descriptions that are blank, badly formatted, too long or copied from ECS, and examples that are not valid for the field type", run: lintDocs},
+	{name: "examples", summary: "package fields without an example, with the examples of the ECS field with the same path", run: lintExamples},
+	{name: "hinted", summary: "fields added by agent processors that are not declared", run: lintHinted},
+	{name: "removed", summary: "fields still declared at or after their removal version, using the version in the package manifest", run: lintRemoved},
+	{name: "assets", summary: "fields used by ML jobs and transforms that are not declared or have incompatible types", run: lintAssets},
+	{name: "multis", summary: "multi-fields orphaned from or attached to the wrong parent field", run: lintMultis},
+	{name: "variants", summary: "field paths that differ only in case or word separators", run: lintVariants},
+	{name: "versions", summary: "ECS fields not present in every ECS version given by repeating the version flag", run: lintVersions},
+}
+
+func lintCommand(args []string) {
+	fs := newFlagSet("lint", "check", "Report package field problems found by the named check")
+	gf := addGraphFlags(fs, true)
+	usage := fs.Usage
+	fs.Usage = func() {
+		usage()
+		fmt.Fprintln(fs.Output(), "\nChecks:")
+		for _, c := range lintChecks {
+			fmt.Fprintf(fs.Output(), "  %-14s%s\n", c.name, c.summary)
+		}
+	}
+	fs.Parse(args)
+	gf.requireECS(fs)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	for _, c := range lintChecks {
+		if c.name != fs.Arg(0) {
+			continue
+		}
+		defer gf.profile()()
+		g, _ := gf.build(c.documents)
+		c.run(g, gf)
+		return
+	}
+	fmt.Fprintf(fs.Output(), "unknown check: %s\n", fs.Arg(0))
+	fs.Usage()
+	os.Exit(2)
+}
+
+func lintConflicts(g *rdf.Graph, _ *graphFlags) {
+	for _, c := range query.DataStreamConflictsIn(g) {
+		fmt.Println(c.Path)
+		types := make([]string, 0, len(c.Types))
+		for t := range c.Types {
+			types = append(types, t)
+		}
+		sort.Strings(types)
+		for _, t := range types {
+			fmt.Printf("\t%s: %s\n", t, strings.Join(c.Types[t], ", "))
+		}
+		if len(c.Destinations) != 0 {
+			fmt.Printf("\t%s\n", msg("lint.destinations", strings.Join(c.Destinations, ", ")))
+		}
+		fmt.Println()
+	}
+}
+
+func lintUnobserved(g *rdf.Graph, _ *graphFlags) {
+	paths := query.UnobservedFieldsIn(g).Out(vocab.IsPath.Match)
+	for _, n := range paths.Unique().Result() {
+		fmt.Println(n.Value)
+	}
+}
+
+func lintUndeclared(g *rdf.Graph, _ *graphFlags) {
+	q, err := query.UndeclaredFieldsIn(g)
+	if err != nil {
+		log.Fatal(err)
+	}
+	paths := q.Out(vocab.IsPath.Match)
+	for _, n := range paths.Unique().Result() {
+		fmt.Println(n.Value)
+	}
+}
+
+func lintCompleteness(g *rdf.Graph, _ *graphFlags) {
+	for _, ds := range query.CompletenessIn(g) {
+		name := ds.DataStream
+		if name == "" {
+			name = msg("lint.package")
+		}
+		fmt.Printf("%s: %.2f\n", name, ds.Score)
+		for _, f := range ds.Fields {
+			if len(f.Missing) == 0 {
+				continue
+			}
+			fmt.Printf("\t%s: %.2f (%s)\n", f.Path, f.Score, msg("lint.missing", strings.Join(f.Missing, ", ")))
+		}
+		fmt.Println()
+	}
+}
+
+func lintAnalysis(g *rdf.Graph, _ *graphFlags) {
+	for _, d := range query.AnalysisDeviationsIn(g) {
+		fmt.Printf("%s: %s\n", d.Path, strings.Join(d.Reasons, "; "))
+	}
+}
+
+func lintGroups(g *rdf.Graph, _ *graphFlags) {
+	for _, m := range query.ImplicitGroupMismatchesIn(g) {
+		fmt.Println(msg("lint.implicit_group", m.Path, m.Type))
+	}
+}
+
+func lintMultis(g *rdf.Graph, _ *graphFlags) {
+	issues, err := query.MultiFieldIssuesIn(g)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, i := range issues {
+		fmt.Printf("%s: %s\n", i.Path, strings.Join(i.Issues, "; "))
+	}
+}
+
+func lintVariants(g *rdf.Graph, _ *graphFlags) {
+	for _, v := range query.PathVariantsIn(g) {
+		fmt.Printf("%s: %s\n", v.Canonical, strings.Join(v.Paths, ", "))
+	}
+}
+
+func lintVersions(g *rdf.Graph, _ *graphFlags) {
+	fields, err := query.VersionedFieldsIn(g)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, f := range fields {
+		fmt.Printf("%s: %s\n", f.Path, strings.Join(f.Versions, ", "))
+	}
+}
+
+func lintDocs(g *rdf.Graph, _ *graphFlags) {
+	issues, err := query.DescriptionIssuesIn(g)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, i := range issues {
+		fmt.Printf("%s: %s\n", i.Path, strings.Join(i.Issues, "; "))
+	}
+	mismatches, err := query.ExampleMismatchesIn(g)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, m := range mismatches {
+		fmt.Println(msg("lint.invalid_examples", m.Path, m.Type, strings.Join(m.Examples, ", ")))
+	}
+}
+
+func lintExamples(g *rdf.Graph, _ *graphFlags) {
+	paths := query.FieldsMissingExamplesIn(g).Out(vocab.IsPath.Match)
+	for _, n := range paths.Unique().Result() {
+		if f, ok := query.ECSFieldOf(g, n.Value); ok && len(f.Examples) != 0 {
+			fmt.Println(msg("lint.ecs_examples", n.Value, strings.Join(f.Examples, ", ")))
+			continue
+		}
+		fmt.Println(n.Value)
+	}
+}
+
+func lintDescriptions(g *rdf.Graph, _ *graphFlags) {
+	divergences, err := query.DescriptionDivergencesIn(g)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, d := range divergences {
+		fmt.Println(d.Path)
+		for _, desc := range d.Descriptions {
+			fmt.Printf("\t%s\n", msg("lint.description_package", desc))
+		}
+		for _, desc := range d.ECS {
+			fmt.Printf("\t%s\n", msg("lint.description_ecs", desc))
+		}
+		fmt.Println()
+	}
+}
+
+func lintHinted(g *rdf.Graph, _ *graphFlags) {
+	isPath := vocab.IsPath.Match
+	isHinted := vocab.IsHinted.Match
+	found := make(map[string][]string)
+	for _, f := range query.WeaklyDeclaredFieldsIn(g).Result() {
+		for _, p := range g.Query(f).Out(isPath).Result() {
+			for _, h := range g.Query(f).Out(isHinted).Result() {
+				found[p.Value] = append(found[p.Value], h.Value)
+			}
+		}
+	}
+	paths := make([]string, 0, len(found))
+	for p := range found {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		procs := found[p]
+		sort.Strings(procs)
+		fmt.Println(msg("lint.hinted", p, strings.Join(procs, ", ")))
+	}
+}
+
+func lintRemoved(g *rdf.Graph, gf *graphFlags) {
+	idx, err := packagesIn(gf.pkg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Each field is compared against the version of
+	// its own package, since pkg-path may hold more
+	// than one package.
+	versions := make(map[string]string)
+	versionOf := func(file string) (string, error) {
+		file = packageFile(gf.pkg, file)
+		dir := filepath.FromSlash(idx.PackageDirOf(filepath.ToSlash(file)))
+		if len(idx) == 0 {
+			// A single package without a
+			// format version is not indexed.
+			dir = gf.pkg
+		}
+		if dir == "" {
+			return "", nil
+		}
+		v, ok := versions[dir]
+		if !ok {
+			var err error
+			v, err = packageVersion(dir)
+			if err != nil {
+				return "", err
+			}
+			versions[dir] = v
+		}
+		return v, nil
+	}
+	fields, err := query.RemovedFieldsIn(g, versionOf)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, f := range fields {
+		if f.Deprecated != "" {
+			fmt.Println(msg("lint.removed_deprecated", f.Path, f.Removed, f.Deprecated, f.Version))
+		} else {
+			fmt.Println(msg("lint.removed", f.Path, f.Removed, f.Version))
+		}
+	}
+}
+
+func lintAssets(g *rdf.Graph, _ *graphFlags) {
+	for _, u := range query.UseIssuesIn(g) {
+		verb := "lint.used"
+		if u.Destination {
+			verb = "lint.written"
+		}
+		if len(u.Types) == 0 {
+			fmt.Println(msg(verb+"_undeclared", u.Path, u.By))
+		} else {
+			fmt.Println(msg(verb+"_mismatch", u.Path, u.By, u.Requires, strings.Join(u.Types, ", ")))
+		}
+	}
+}
+
+func adoptCommand(args []string) {
+	fs := newFlagSet("adopt", "fieldset", "Write a markdown migration plan for adopting the named ECS field set")
+	gf := addGraphFlags(fs, true)
+	fs.Parse(args)
+	gf.requireECS(fs)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	defer gf.profile()()
+
+	g, _ := gf.build(false)
+	plan, err := query.AdoptionPlanFor(g, fs.Arg(0))
+	if err != nil {
+		log.Fatalf("%s: %v", fs.Arg(0), err)
+	}
+	writeAdoptionPlan(os.Stdout, fs.Arg(0), plan)
+}
+
+func diffCommand(args []string) {
+	fs := newFlagSet("diff", "new-version", "Report the ECS fields added, removed, changed in type or defined by different field sets between the ECS version given by the version flag and new-version")
+	gf := addGraphFlags(fs, false)
+	fs.Parse(args)
+	gf.requireECS(fs)
+	if fs.NArg() != 1 || len(gf.versions) != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	defer gf.profile()()
+
+	cfg, err := gf.config(false)
+	if err != nil {
+		log.Fatal(err)
+	}
+	old, _ := gf.buildConfig(cfg)
+	cfg.version = fs.Arg(0)
+	new, _ := gf.buildConfig(cfg)
+	err = writeECSDiff(os.Stdout, query.DiffECS(old, new))
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func upgradeCommand(args []string) {
+	fs := newFlagSet("upgrade", "", "Report the package fields declared as external ECS fields that are removed, change type or are defined by different field sets between the ECS versions given by the version-old and version-new flags")
+	gf := addGraphFlags(fs, true)
+	fs.StringVar(&gf.version, "version-old", "", "specify the version of ECS the package currently uses (equivalent to version)")
+	newVersion := fs.String("version-new", "", "specify the version of ECS to upgrade to")
+	fs.Parse(args)
+	gf.requireECS(fs)
+	if *newVersion == "" || fs.NArg() != 0 || len(gf.versions) != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	defer gf.profile()()
+
+	cfg, err := gf.config(false)
+	if err != nil {
+		log.Fatal(err)
+	}
+	old, _ := gf.buildConfig(cfg)
+	// Only the ECS fields of the new version are
+	// needed for comparison.
+	cfg.version = *newVersion
+	cfg.pkg = ""
+	new, _ := gf.buildConfig(cfg)
+	err = writeECSDiff(os.Stdout, query.ExternalImpactIn(old, new))
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func simulateCommand(args []string) {
+	fs := newFlagSet("simulate", "data_stream", "Report the simulated effective mapping of the named data stream")
+	gf := addGraphFlags(fs, true)
+	dynamic := fs.String("dynamic-templates", "", "specify the path to a JSON file holding dynamic templates")
+	fs.Parse(args)
+	gf.requireECS(fs)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	defer gf.profile()()
+
+	g, _ := gf.build(true)
+	var templates []template.Dynamic
+	if *dynamic != "" {
+		f, err := os.Open(*dynamic)
+		if err != nil {
+			log.Fatal(err)
+		}
+		templates, err = template.Decode(f)
+		f.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	sim, err := query.SimulateMapping(g, fs.Arg(0), templates)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, m := range sim.Declared {
+		fmt.Printf("%s: %s\n", m.Path, m.Type)
+	}
+	for _, m := range sim.Gained {
+		fmt.Println(msg("simulate.gained", m.Path, m.Type, m.Template))
+	}
+	for _, m := range sim.Dynamic {
+		fmt.Println(msg("simulate.dynamic", m.Path, m.Type))
+	}
+	for _, m := range sim.Unmapped {
+		fmt.Println(msg("simulate.unmapped", m.Path, m.Type))
+	}
+	if len(sim.Shadowed) != 0 {
+		fmt.Println()
+	}
+	for _, m := range sim.Shadowed {
+		fmt.Println(msg("simulate.shadowed", m.Path, m.Type, m.Template, m.TemplateType))
+	}
+}
+
+func exportCommand(args []string) {
+	fs := newFlagSet("export", "file", "Write the canonicalized graph to the named file. If pkg-path is empty, only ECS statements are written")
+	gf := addGraphFlags(fs, true)
+	format := fs.String("format", "nquads", "specify the format of the output graph: nquads, jsonld, turtle, graphml (for graph tools such as Gephi and yEd), or csv or tsv (an inventory of the ECS and package fields, one row per field)")
+	documents := fs.Bool("documents", false, "include statements for sample and test documents")
+	shortIRIs := fs.Bool("short-iris", false, "write predicates in their short forms, such as <is:name>, instead of their canonical https://ecsinrdf.dev/ns/ IRIs, for compatibility with tools written for the short forms (nquads, jsonld and turtle formats)")
+	dotField := fs.String("dot", "", "write a Graphviz DOT rendering of the nodes with the specified path.to.field, their ancestors, children and multi-fields instead of the graph (format is ignored)")
+	mermaidFieldset := fs.String("mermaid-fieldset", "", "write a Mermaid flowchart of the fields of the specified ECS field set instead of the graph (format is ignored)")
+	mermaidDataStream := fs.String("mermaid-data-stream", "", "write a Mermaid flowchart of the fields of the specified package data stream instead of the graph (format is ignored)")
+	fs.Parse(args)
+	gf.requireECS(fs)
+	diagrams := 0
+	for _, set := range []bool{*dotField != "", *mermaidFieldset != "", *mermaidDataStream != ""} {
+		if set {
+			diagrams++
+		}
+	}
+	if fs.NArg() != 1 || diagrams > 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *mermaidFieldset != "" || *mermaidDataStream != "" {
+		defer gf.profile()()
+		cfg, err := gf.config(*documents)
+		if err != nil {
+			log.Fatal(err)
+		}
+		g, _ := gf.buildConfig(cfg)
+		err = writeMermaid(fs.Arg(0), g, *mermaidFieldset, *mermaidDataStream, cfg.version)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *dotField != "" {
+		defer gf.profile()()
+		g, _ := gf.build(*documents)
+		err := writeDOT(fs.Arg(0), g, *dotField)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	switch *format {
+	case "nquads", "jsonld", "turtle", "graphml", "csv", "tsv":
+	default:
+		fmt.Fprintf(fs.Output(), "unknown format: %s\n", *format)
+		fs.Usage()
+		os.Exit(2)
+	}
+	defer gf.profile()()
+
+	g, _ := gf.build(*documents)
+	err := writeGraph(fs.Arg(0), *format, g, *shortIRIs)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func schemaCommand(args []string) {
+	fs := newFlagSet("schema", "", "Write the JSON Schema of the JSON package analysis report returned by the /check endpoint of serve")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	os.Stdout.Write(reportSchema)
+}
+
+func serveCommand(args []string) {
+	fs := newFlagSet("serve", "", "Serve JSON-RPC requests over stdin and stdout or over HTTP, or serve REST lookups. The ecs-root, version and pkg-path flags provide defaults for the initialize request and describe the graph served by rest")
+	gf := addGraphFlags(fs, true)
+	var exclude stringList
+	fs.Var(&exclude, "exclude", "specify a comma-separated list of graft destination path patterns to exclude (may be repeated)")
+	paths := addPathRuleFlags(fs, true)
+	stdio := fs.Bool("stdio", false, "serve JSON-RPC requests over stdin and stdout")
+	httpAddr := fs.String("http", "", "serve JSON-RPC requests for the graphs described by graphs on the specified address")
+	graphs := fs.String("graphs", "", "specify the path to a JSON file mapping graph names to initialize parameters for http")
+	tokens := fs.String("tokens", "", "specify the path to a file of bearer tokens and the graphs they may access for http")
+	restAddr := fs.String("rest", "", "serve GET /grafts?path=...&type=... and GET /field?path=... lookups on the graph described by the flags on the specified address")
+	metricsAddr := fs.String("metrics-addr", "", "serve Prometheus metrics on the specified address in stdio mode")
+	validate := fs.Bool("validate-output", false, "validate /check reports against the report JSON Schema before returning them for http")
+	limits := addLimitFlags(fs)
+	fs.Parse(args)
+	modes := 0
+	for _, set := range []bool{*stdio, *httpAddr != "", *restAddr != ""} {
+		if set {
+			modes++
+		}
+	}
+	if modes != 1 || (*httpAddr != "" && *graphs == "") || fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *restAddr != "" {
+		gf.requireECS(fs)
+	}
+	defer gf.profile()()
+
+	cfg, err := gf.config(false)
+	if err != nil {
+		log.Fatal(err)
+	}
+	srv := &rpcServer{
+		cfg:           cfg,
+		exclude:       exclude,
+		limits:        *limits,
+		rules:         paths.base(),
+		packagePrefix: paths.packagePrefix,
+		metrics:       newServerMetrics(),
+	}
+	if *metricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", srv.metrics)
+		go func() {
+			log.Fatal(http.ListenAndServe(*metricsAddr, mux))
+		}()
+	}
+	switch {
+	case *httpAddr != "":
+		err = serveHTTP(*httpAddr, *graphs, *tokens, srv, *validate)
+	case *restAddr != "":
+		err = serveREST(*restAddr, srv)
+	default:
+		err = srv.serve(os.Stdin, os.Stdout)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
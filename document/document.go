@@ -0,0 +1,167 @@
+// Package document provides tools for constructing RDF statements
+// for fields observed in sample and test event documents.
+package document
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+
+	"gonum.org/v1/gonum/graph/formats/rdf"
+
+	"github.com/efd6/ecsinrdf/term"
+	"github.com/efd6/ecsinrdf/vocab"
+)
+
+// Statements calls fn on all RDF statements constructed from the fields
+// observed in the provided document.
+//
+// The graph that results has the following triples structure
+//
+// _:field <is:observed> "true" .
+// _:field <is:path> "full.dotted.path.to.name" .
+// _:field <is:value_type> "json_type" .
+//
+// Only leaf values are observed; objects are walked and arrays of objects
+// contribute their elements' fields under the array's path. The JSON type
+// is the Elasticsearch detected mapping type of the value: "string", "long",
+// "double" or "boolean". Fields observed holding an array of leaf values
+// are marked as arrays, as ECS marks fields normalized to arrays.
+//
+// _:field <is:normalized> "array" .
+//
+func Statements(parent string, doc map[string]interface{}, fn func(*rdf.Statement, error)) {
+	statements("", parent, doc, fn)
+}
+
+// DataStreamStatements calls fn on all RDF statements constructed from the
+// fields observed in the provided document for the named data stream.
+//
+// The statements are the same as those constructed by Statements, but field
+// nodes are distinct for each data stream and are linked to a data stream
+// context node.
+//
+// _:field <in:data_stream> _:context .
+// _:context <is:data_stream> "data_stream" .
+//
+func DataStreamStatements(dataStream, parent string, doc map[string]interface{}, fn func(*rdf.Statement, error)) {
+	statements(dataStream, parent, doc, fn)
+}
+
+func statements(context, parent string, doc map[string]interface{}, fn func(*rdf.Statement, error)) {
+	h := sha1.New()
+	hash := func(s string) string {
+		h.Reset()
+		h.Write([]byte("document"))
+		if context != "" {
+			h.Write([]byte(context))
+			h.Write([]byte{0})
+		}
+		h.Write([]byte(s))
+		return string(hex(h.Sum(nil)))
+	}
+	var hashContext string
+	inContext := func(node string) {}
+	if context != "" {
+		hashContext = contextHash(context)
+		inContext = func(node string) {
+			fn(term.Triple(term.Blank(node), vocab.InDataStream.Term(), term.Blank(hashContext)), nil)
+		}
+		fn(term.Triple(term.Blank(hashContext), vocab.IsDataStream.Term(), term.LiteralTerm(context)), nil)
+	}
+	var walk func(path string, v interface{}, array bool)
+	walk = func(path string, v interface{}, array bool) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			statements(context, path, v, fn)
+		case []interface{}:
+			for _, e := range v {
+				walk(path, e, true)
+			}
+		default:
+			hashField := hash(path)
+			fn(term.Triple(term.Blank(hashField), vocab.IsObserved.Term(), term.LiteralTerm("true")), nil)
+			fn(term.Triple(term.Blank(hashField), vocab.IsPath.Term(), term.LiteralTerm(path)), nil)
+			if typ := mappingType(v); typ != "" {
+				fn(term.Triple(term.Blank(hashField), vocab.IsValueType.Term(), term.LiteralTerm(typ)), nil)
+			}
+			if array {
+				fn(term.Triple(term.Blank(hashField), vocab.IsNormalized.Term(), term.LiteralTerm("array")), nil)
+			}
+			inContext(hashField)
+		}
+	}
+	for name, v := range doc {
+		if parent != "" {
+			name = parent + "." + name
+		}
+		walk(name, v, false)
+	}
+}
+
+// mappingType returns the Elasticsearch detected mapping type for v.
+// Null values have no mapping type.
+func mappingType(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<63 {
+			return "long"
+		}
+		return "double"
+	default:
+		return ""
+	}
+}
+
+// Decode returns the documents held in r. The data in r may either be a
+// single document, as found in sample_event.json, or an object holding an
+// "expected" array of documents, as found in pipeline test expectations.
+func Decode(r io.Reader) ([]map[string]interface{}, error) {
+	var doc map[string]interface{}
+	err := json.NewDecoder(r).Decode(&doc)
+	if err != nil {
+		return nil, err
+	}
+	expected, ok := doc["expected"]
+	if !ok || len(doc) != 1 {
+		return []map[string]interface{}{doc}, nil
+	}
+	list, ok := expected.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected type for expected documents: %T", expected)
+	}
+	docs := make([]map[string]interface{}, 0, len(list))
+	for _, e := range list {
+		d, ok := e.(map[string]interface{})
+		if !ok {
+			// Expected documents may be null when the
+			// pipeline drops the event.
+			continue
+		}
+		docs = append(docs, d)
+	}
+	return docs, nil
+}
+
+// contextHash returns the blank node label for the named data stream
+// context. The label is shared with other sources of data stream
+// statements.
+func contextHash(dataStream string) string {
+	h := sha1.Sum([]byte("data_stream" + dataStream))
+	return string(hex(h[:]))
+}
+
+func hex(data []byte) []byte {
+	const digit = "0123456789abcdef"
+	buf := make([]byte, 0, len(data)*2)
+	for _, b := range data {
+		buf = append(buf, digit[b>>4], digit[b&0xf])
+	}
+	return buf
+}
@@ -0,0 +1,82 @@
+// Package dot provides tools for rendering RDF statements as Graphviz DOT.
+package dot
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+
+	"gonum.org/v1/gonum/graph/formats/rdf"
+)
+
+// Encode writes the statements to w as a Graphviz DOT digraph named name.
+// Each statement is written as an edge from its subject to its object
+// labelled with its predicate. Blank nodes and IRIs are written as nodes
+// labelled with their value, and each literal object is written as its own
+// box node, so that common values such as field types do not join
+// otherwise unrelated nodes. Nodes with a label in highlight are filled.
+// The output is stable for a given set of statements. For example, the
+// statements
+//
+//  _:b0 <has:child> _:b1 .
+//  _:b1 <is:path> "source.ip" .
+//
+// are encoded as
+//
+//  digraph "name" {
+//  	"_:b0";
+//  	"_:b1";
+//  	"_:b0" -> "_:b1" [label="<has:child>"];
+//  	"lit0" [shape=box, label="\"source.ip\""];
+//  	"_:b1" -> "lit0" [label="<is:path>"];
+//  }
+//
+// Graph labels are not represented.
+func Encode(w io.Writer, name string, statements []*rdf.Statement, highlight map[string]bool) error {
+	sorted := make([]*rdf.Statement, len(statements))
+	copy(sorted, statements)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].String() < sorted[j].String()
+	})
+
+	nodes := make(map[string]bool)
+	for _, s := range sorted {
+		nodes[s.Subject.Value] = true
+		_, _, kind, err := s.Object.Parts()
+		if err != nil {
+			return fmt.Errorf("%s: %w", s.Object.Value, err)
+		}
+		if kind != rdf.Literal {
+			nodes[s.Object.Value] = true
+		}
+	}
+	names := make([]string, 0, len(nodes))
+	for n := range nodes {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "digraph %s {\n", strconv.Quote(name))
+	for _, n := range names {
+		if highlight[n] {
+			fmt.Fprintf(bw, "\t%s [style=filled];\n", strconv.Quote(n))
+		} else {
+			fmt.Fprintf(bw, "\t%s;\n", strconv.Quote(n))
+		}
+	}
+	var lits int
+	for _, s := range sorted {
+		obj := s.Object.Value
+		if !nodes[obj] {
+			obj = fmt.Sprintf("lit%d", lits)
+			lits++
+			fmt.Fprintf(bw, "\t%s [shape=box, label=%s];\n", strconv.Quote(obj), strconv.Quote(s.Object.Value))
+		}
+		fmt.Fprintf(bw, "\t%s -> %s [label=%s];\n", strconv.Quote(s.Subject.Value), strconv.Quote(obj), strconv.Quote(s.Predicate.Value))
+	}
+	bw.WriteString("}\n")
+	return bw.Flush()
+}
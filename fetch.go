@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/efd6/ecsinrdf/graph"
+)
+
+// specURL is the URL template for fetching an ECS specification artifact
+// for a version from GitHub.
+var specURL = "https://raw.githubusercontent.com/elastic/ecs/%s/%s"
+
+// contentsURL is the URL template for listing a directory in the ECS repo
+// for a version with the GitHub API.
+var contentsURL = "https://api.github.com/repos/elastic/ecs/contents/%s?ref=%s"
+
+// immutable matches versions that are expected not to change once
+// published: release tags and full commit names.
+var immutable = regexp.MustCompile(`^(v\d+\.\d+\.\d+(-[0-9A-Za-z.-]+)?|[0-9a-f]{40})$`)
+
+// fetchSpec returns the ECS specification artifact at the slash-separated
+// path in github.com/elastic/ecs for the given version. Specifications for release tags and full
+// commit names are cached on disk in the user's cache directory and are
+// fetched only once. Other versions, such as branches, are fetched on
+// every call.
+func fetchSpec(ctx context.Context, version, path string) (io.Reader, error) {
+	var cache string
+	if immutable.MatchString(version) {
+		dir, err := os.UserCacheDir()
+		if err == nil {
+			cache = filepath.Join(dir, "ecsinrdf", "ecs", version, filepath.Base(path))
+			b, err := os.ReadFile(cache)
+			if err == nil {
+				return bytes.NewReader(b), nil
+			}
+		}
+	}
+
+	cli := http.Client{Timeout: time.Minute}
+	var (
+		b   []byte
+		err error
+	)
+	if path == schemasPath {
+		b, err = fetchSchemas(ctx, &cli, version)
+	} else {
+		b, err = fetch(ctx, &cli, version, fmt.Sprintf(specURL, url.PathEscape(version), path))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if cache != "" {
+		err = writeCache(cache, b)
+		if err != nil {
+			// The cache is an optimization, so
+			// failing to write it is not fatal.
+			slog.Warn("failed to cache ECS spec", "version", version, "error", err)
+		}
+	}
+	return bytes.NewReader(b), nil
+}
+
+// fetchSchemas returns the .yml files in the schemas directory of
+// github.com/elastic/ecs for the given version as a single YAML stream.
+func fetchSchemas(ctx context.Context, cli *http.Client, version string) ([]byte, error) {
+	b, err := fetch(ctx, cli, version, fmt.Sprintf(contentsURL, schemasPath, url.QueryEscape(version)))
+	if err != nil {
+		return nil, err
+	}
+	var entries []struct {
+		Name string `json:"name"`
+		Type string `json:"type"`
+	}
+	err = json.Unmarshal(b, &entries)
+	if err != nil {
+		return nil, fmt.Errorf("listing ECS %s schemas: %w", version, err)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	var docs [][]byte
+	for _, e := range entries {
+		if e.Type != "file" || !strings.HasSuffix(e.Name, ".yml") {
+			continue
+		}
+		b, err := fetch(ctx, cli, version, fmt.Sprintf(specURL, url.PathEscape(version), schemasPath+"/"+e.Name))
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, b)
+	}
+	return graph.YAMLStream(docs), nil
+}
+
+// fetch returns the body of a GET request for the ECS version at u.
+func fetch(ctx context.Context, cli *http.Client, version, u string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := cli.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching ECS %s: %s", version, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// writeCache atomically writes b to the file at path, creating parent
+// directories as needed.
+func writeCache(path string, b []byte) error {
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,430 @@
+// Package gitrepo provides read access to files held in a git repository's
+// object store without requiring a git binary.
+package gitrepo
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Repo is a git repository.
+type Repo struct {
+	// gitDir is the repository's git directory and
+	// commonDir is the directory holding its shared
+	// refs and objects. They differ for linked
+	// worktrees.
+	gitDir, commonDir string
+	// objectDirs holds the repository's object
+	// directory and its alternates.
+	objectDirs []string
+
+	packs []*pack
+}
+
+// Open returns the repository at root. The root may be a working tree, a
+// linked working tree or a bare repository.
+func Open(root string) (*Repo, error) {
+	gitDir := filepath.Join(root, ".git")
+	fi, err := os.Stat(gitDir)
+	switch {
+	case err == nil && !fi.IsDir():
+		// Linked worktrees and submodules hold
+		// a reference to their git directory.
+		b, err := os.ReadFile(gitDir)
+		if err != nil {
+			return nil, err
+		}
+		ref := strings.TrimSpace(string(b))
+		if !strings.HasPrefix(ref, "gitdir: ") {
+			return nil, fmt.Errorf("%s: invalid gitdir file", gitDir)
+		}
+		gitDir = strings.TrimPrefix(ref, "gitdir: ")
+		if !filepath.IsAbs(gitDir) {
+			gitDir = filepath.Join(root, gitDir)
+		}
+	case errors.Is(err, os.ErrNotExist):
+		// Treat root as a bare repository.
+		gitDir = root
+	case err != nil:
+		return nil, err
+	}
+	r := &Repo{gitDir: gitDir, commonDir: gitDir}
+	b, err := os.ReadFile(filepath.Join(gitDir, "commondir"))
+	if err == nil {
+		common := strings.TrimSpace(string(b))
+		if !filepath.IsAbs(common) {
+			common = filepath.Join(gitDir, common)
+		}
+		r.commonDir = common
+	}
+	objects := filepath.Join(r.commonDir, "objects")
+	if _, err := os.Stat(objects); err != nil {
+		return nil, fmt.Errorf("%s: not a git repository", root)
+	}
+	r.objectDirs = []string{objects}
+	b, err = os.ReadFile(filepath.Join(objects, "info", "alternates"))
+	if err == nil {
+		for _, alt := range strings.Split(string(b), "\n") {
+			alt = strings.TrimSpace(alt)
+			if alt == "" || strings.HasPrefix(alt, "#") {
+				continue
+			}
+			if !filepath.IsAbs(alt) {
+				alt = filepath.Join(objects, alt)
+			}
+			r.objectDirs = append(r.objectDirs, alt)
+		}
+	}
+	for _, dir := range r.objectDirs {
+		idx, err := filepath.Glob(filepath.Join(dir, "pack", "*.idx"))
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(idx)
+		for _, path := range idx {
+			p, err := openPack(path)
+			if err != nil {
+				r.Close()
+				return nil, err
+			}
+			r.packs = append(r.packs, p)
+		}
+	}
+	return r, nil
+}
+
+// Close releases the resources held by the repository.
+func (r *Repo) Close() error {
+	var err error
+	for _, p := range r.packs {
+		if e := p.close(); err == nil {
+			err = e
+		}
+	}
+	r.packs = nil
+	return err
+}
+
+// ReadFile returns the contents of the file at the slash-separated path in
+// the tree of the commit named by rev. The revision may be a tag, a branch,
+// a remote-tracking branch, HEAD, or a full or unambiguous abbreviated
+// object name, as accepted by git show.
+func (r *Repo) ReadFile(rev, path string) ([]byte, error) {
+	typ, data, err := r.lookup(rev, path)
+	if err != nil {
+		return nil, err
+	}
+	if typ != "blob" {
+		return nil, fmt.Errorf("path '%s' in '%s' is not a file", path, rev)
+	}
+	return data, nil
+}
+
+// ReadDir returns the names of the entries of the directory at the
+// slash-separated path in the tree of the commit named by rev, sorted
+// lexically. The revision is interpreted as for ReadFile.
+func (r *Repo) ReadDir(rev, path string) ([]string, error) {
+	typ, data, err := r.lookup(rev, path)
+	if err != nil {
+		return nil, err
+	}
+	if typ != "tree" {
+		return nil, fmt.Errorf("path '%s' in '%s' is not a directory", path, rev)
+	}
+	var names []string
+	for len(data) != 0 {
+		sp := bytes.IndexByte(data, ' ')
+		nul := bytes.IndexByte(data, 0)
+		if sp < 0 || nul < sp || len(data) < nul+21 {
+			return nil, errors.New("invalid tree")
+		}
+		names = append(names, string(data[sp+1:nul]))
+		data = data[nul+21:]
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// lookup returns the type and contents of the object at the slash-separated
+// path in the tree of the commit named by rev.
+func (r *Repo) lookup(rev, path string) (typ string, data []byte, err error) {
+	id, err := r.Resolve(rev)
+	if err != nil {
+		return "", nil, err
+	}
+	typ, data, err = r.object(id)
+	if err != nil {
+		return "", nil, err
+	}
+	// Peel tags to their commit and the commit to its tree.
+	for typ == "tag" || typ == "commit" {
+		key := "object"
+		if typ == "commit" {
+			key = "tree"
+		}
+		next, err := header(data, key)
+		if err != nil {
+			return "", nil, fmt.Errorf("%s %s: %w", typ, id, err)
+		}
+		id = next
+		typ, data, err = r.object(id)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+	if typ != "tree" {
+		return "", nil, fmt.Errorf("%s: not a tree-ish: %s", rev, typ)
+	}
+	for _, name := range strings.Split(path, "/") {
+		if typ != "tree" {
+			return "", nil, fmt.Errorf("path '%s' does not exist in '%s'", path, rev)
+		}
+		id, err = treeEntry(data, name)
+		if err != nil {
+			return "", nil, fmt.Errorf("path '%s' does not exist in '%s'", path, rev)
+		}
+		typ, data, err = r.object(id)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+	return typ, data, nil
+}
+
+// Resolve returns the hex object name for rev.
+func (r *Repo) Resolve(rev string) (string, error) {
+	if rev == "" {
+		return "", errors.New("empty revision")
+	}
+	candidates := []string{rev}
+	if !strings.HasPrefix(rev, "refs/") && rev != "HEAD" {
+		candidates = append(candidates,
+			"refs/"+rev,
+			"refs/tags/"+rev,
+			"refs/heads/"+rev,
+			"refs/remotes/"+rev,
+			"refs/remotes/"+rev+"/HEAD",
+		)
+	}
+	for _, ref := range candidates {
+		id, ok, err := r.ref(ref, 0)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			return id, nil
+		}
+	}
+	if isHex(rev) && len(rev) >= 4 && len(rev) <= 40 {
+		return r.expand(strings.ToLower(rev))
+	}
+	return "", fmt.Errorf("unknown revision: %s", rev)
+}
+
+// ref returns the object name held by the named ref, following symbolic
+// refs to a limited depth.
+func (r *Repo) ref(name string, depth int) (id string, ok bool, err error) {
+	if depth > 5 {
+		return "", false, fmt.Errorf("%s: symbolic ref loop", name)
+	}
+	dir := r.commonDir
+	if name == "HEAD" {
+		dir = r.gitDir
+	}
+	b, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+	if err == nil {
+		v := strings.TrimSpace(string(b))
+		if strings.HasPrefix(v, "ref: ") {
+			return r.ref(strings.TrimPrefix(v, "ref: "), depth+1)
+		}
+		if len(v) == 40 && isHex(v) {
+			return v, true, nil
+		}
+		// Directories and other files are not refs.
+	} else if !errors.Is(err, os.ErrNotExist) && !isDirErr(err) {
+		return "", false, err
+	}
+	f, err := os.Open(filepath.Join(r.commonDir, "packed-refs"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := sc.Text()
+		if strings.HasPrefix(line, "#") || strings.HasPrefix(line, "^") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[1] == name {
+			return fields[0], true, nil
+		}
+	}
+	return "", false, sc.Err()
+}
+
+// isDirErr returns whether err is the result of reading a directory.
+func isDirErr(err error) bool {
+	var perr *os.PathError
+	if !errors.As(err, &perr) {
+		return false
+	}
+	fi, serr := os.Stat(perr.Path)
+	return serr == nil && fi.IsDir()
+}
+
+// expand returns the full object name of the unique object whose name
+// starts with prefix.
+func (r *Repo) expand(prefix string) (string, error) {
+	found := make(map[string]bool)
+	if len(prefix) == 40 {
+		found[prefix] = r.has(prefix)
+	} else {
+		for _, dir := range r.objectDirs {
+			names, err := os.ReadDir(filepath.Join(dir, prefix[:2]))
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return "", err
+			}
+			for _, n := range names {
+				id := prefix[:2] + n.Name()
+				if strings.HasPrefix(id, prefix) {
+					found[id] = true
+				}
+			}
+		}
+		for _, p := range r.packs {
+			for _, id := range p.withPrefix(prefix) {
+				found[id] = true
+			}
+		}
+	}
+	var ids []string
+	for id, ok := range found {
+		if ok {
+			ids = append(ids, id)
+		}
+	}
+	switch len(ids) {
+	case 0:
+		return "", fmt.Errorf("unknown revision: %s", prefix)
+	case 1:
+		return ids[0], nil
+	default:
+		return "", fmt.Errorf("ambiguous revision: %s", prefix)
+	}
+}
+
+// has returns whether the repository holds the named object.
+func (r *Repo) has(id string) bool {
+	for _, dir := range r.objectDirs {
+		if _, err := os.Stat(filepath.Join(dir, id[:2], id[2:])); err == nil {
+			return true
+		}
+	}
+	for _, p := range r.packs {
+		if _, ok := p.offset(id); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// object returns the type and contents of the named object.
+func (r *Repo) object(id string) (typ string, data []byte, err error) {
+	for _, dir := range r.objectDirs {
+		f, err := os.Open(filepath.Join(dir, id[:2], id[2:]))
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return "", nil, err
+		}
+		defer f.Close()
+		return looseObject(f)
+	}
+	for _, p := range r.packs {
+		if off, ok := p.offset(id); ok {
+			return p.object(r, off)
+		}
+	}
+	return "", nil, fmt.Errorf("object not found: %s", id)
+}
+
+// looseObject returns the type and contents of the loose object held in r.
+func looseObject(r io.Reader) (typ string, data []byte, err error) {
+	z, err := zlib.NewReader(r)
+	if err != nil {
+		return "", nil, err
+	}
+	defer z.Close()
+	b, err := io.ReadAll(z)
+	if err != nil {
+		return "", nil, err
+	}
+	i := bytes.IndexByte(b, 0)
+	if i < 0 {
+		return "", nil, errors.New("invalid object header")
+	}
+	var size int
+	_, err = fmt.Sscanf(string(b[:i]), "%s %d", &typ, &size)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid object header: %w", err)
+	}
+	data = b[i+1:]
+	if len(data) != size {
+		return "", nil, errors.New("object size mismatch")
+	}
+	return typ, data, nil
+}
+
+// header returns the hex object name in the first header line of the commit
+// or tag in data with the given key.
+func header(data []byte, key string) (string, error) {
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == "" {
+			break
+		}
+		if v := strings.TrimPrefix(line, key+" "); v != line && len(v) == 40 && isHex(v) {
+			return v, nil
+		}
+	}
+	return "", fmt.Errorf("no %s header", key)
+}
+
+// treeEntry returns the hex object name of the named entry in the tree held
+// in data.
+func treeEntry(data []byte, name string) (string, error) {
+	for len(data) != 0 {
+		sp := bytes.IndexByte(data, ' ')
+		nul := bytes.IndexByte(data, 0)
+		if sp < 0 || nul < sp || len(data) < nul+21 {
+			return "", errors.New("invalid tree")
+		}
+		if string(data[sp+1:nul]) == name {
+			return hex.EncodeToString(data[nul+1 : nul+21]), nil
+		}
+		data = data[nul+21:]
+	}
+	return "", fmt.Errorf("%s not found", name)
+}
+
+func isHex(s string) bool {
+	for _, c := range s {
+		if !('0' <= c && c <= '9') && !('a' <= c && c <= 'f') && !('A' <= c && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
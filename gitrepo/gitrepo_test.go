@@ -0,0 +1,253 @@
+package gitrepo
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// git runs the git command with args in dir and returns its output.
+func git(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"HOME="+dir,
+		"GIT_CONFIG_NOSYSTEM=1",
+		"GIT_AUTHOR_NAME=test",
+		"GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test",
+		"GIT_COMMITTER_EMAIL=test@example.com",
+	)
+	out, err := cmd.Output()
+	if err != nil {
+		var stderr []byte
+		if e, ok := err.(*exec.ExitError); ok {
+			stderr = e.Stderr
+		}
+		t.Fatalf("git %s: %v: %s", strings.Join(args, " "), err, stderr)
+	}
+	return string(out)
+}
+
+// packedRepo returns the path to a repository whose objects are all held
+// in a single pack with deltas, and the tags of its commits. Each commit
+// changes a few lines of a large file so that git stores most versions
+// as deltas against others.
+func packedRepo(t *testing.T) (dir string, tags []string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	dir = t.TempDir()
+	git(t, dir, "init", "-q")
+	var lines []string
+	for i := 0; i < 500; i++ {
+		lines = append(lines, fmt.Sprintf("field%d:\n  type: keyword\n  description: field number %d", i, i))
+	}
+	for v := 0; v < 5; v++ {
+		lines[v*100] = fmt.Sprintf("changed%d:\n  type: long", v)
+		write(t, filepath.Join(dir, "generated", "ecs", "ecs_nested.yml"), strings.Join(lines, "\n"))
+		write(t, filepath.Join(dir, "version"), fmt.Sprintf("v%d\n", v))
+		git(t, dir, "add", "-A")
+		git(t, dir, "commit", "-q", "-m", fmt.Sprintf("v%d", v))
+		tag := fmt.Sprintf("v%d", v)
+		if v%2 == 0 {
+			git(t, dir, "tag", tag)
+		} else {
+			git(t, dir, "tag", "-a", "-m", tag, tag)
+		}
+		tags = append(tags, tag)
+	}
+	git(t, dir, "repack", "-a", "-d", "-f", "-q", "--depth=50", "--window=50")
+	git(t, dir, "prune-packed")
+	git(t, dir, "pack-refs", "--all")
+	loose, err := filepath.Glob(filepath.Join(dir, ".git", "objects", "??"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loose) != 0 {
+		t.Fatalf("unexpected loose objects: %v", loose)
+	}
+	if !strings.Contains(git(t, dir, "verify-pack", "-v", packIndex(t, dir)), "chain length") {
+		t.Fatal("pack holds no deltas")
+	}
+	return dir, tags
+}
+
+// packIndex returns the path to the single pack index of the repository
+// at dir.
+func packIndex(t *testing.T, dir string) string {
+	t.Helper()
+	idx, err := filepath.Glob(filepath.Join(dir, ".git", "objects", "pack", "*.idx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(idx) != 1 {
+		t.Fatalf("unexpected pack indexes: %v", idx)
+	}
+	return idx[0]
+}
+
+func write(t *testing.T, path, data string) {
+	t.Helper()
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(path, []byte(data), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPackedRepo(t *testing.T) {
+	dir, tags := packedRepo(t)
+	r, err := Open(dir)
+	if err != nil {
+		t.Fatalf("unexpected error opening repo: %v", err)
+	}
+	defer r.Close()
+
+	for _, rev := range append(tags, "HEAD") {
+		for _, path := range []string{"generated/ecs/ecs_nested.yml", "version"} {
+			got, err := r.ReadFile(rev, path)
+			if err != nil {
+				t.Errorf("unexpected error reading %s:%s: %v", rev, path, err)
+				continue
+			}
+			want := git(t, dir, "show", rev+":"+path)
+			if !bytes.Equal(got, []byte(want)) {
+				t.Errorf("unexpected content for %s:%s", rev, path)
+			}
+		}
+
+		got, err := r.ReadDir(rev, "generated")
+		if err != nil {
+			t.Errorf("unexpected error reading directory at %s: %v", rev, err)
+		} else if want := []string{"ecs"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("unexpected directory entries at %s: got:%v want:%v", rev, got, want)
+		}
+
+		id, err := r.Resolve(rev)
+		if err != nil {
+			t.Errorf("unexpected error resolving %s: %v", rev, err)
+			continue
+		}
+		want := strings.TrimSpace(git(t, dir, "rev-parse", rev))
+		if id != want {
+			t.Errorf("unexpected object name for %s: got:%s want:%s", rev, id, want)
+		}
+		short, err := r.Resolve(want[:7])
+		if err != nil || short != want {
+			t.Errorf("unexpected resolution of abbreviated %s: got:%s err:%v want:%s", want[:7], short, err, want)
+		}
+	}
+
+	_, err = r.ReadFile("v0", "missing")
+	if err == nil {
+		t.Error("expected error reading missing file")
+	}
+	_, err = r.Resolve("no-such-ref")
+	if err == nil {
+		t.Error("expected error resolving missing ref")
+	}
+}
+
+var applyDeltaTests = []struct {
+	name    string
+	base    string
+	delta   []byte
+	want    string
+	wantErr bool
+}{
+	{
+		name: "copy and insert",
+		base: "hello world",
+		// Source size 11, destination size 11, copy
+		// offset 0 length 6, insert "there".
+		delta: []byte{11, 11, 0x90, 6, 5, 't', 'h', 'e', 'r', 'e'},
+		want:  "hello there",
+	},
+	{
+		name: "copy with offset",
+		base: "hello world",
+		// Copy offset 6 length 5.
+		delta: []byte{11, 5, 0x91, 6, 5},
+		want:  "world",
+	},
+	{
+		name:    "source size mismatch",
+		base:    "hello",
+		delta:   []byte{4, 1, 1, 'x'},
+		wantErr: true,
+	},
+	{
+		name:    "destination size mismatch",
+		base:    "hello",
+		delta:   []byte{5, 2, 1, 'x'},
+		wantErr: true,
+	},
+	{
+		name:    "copy out of range",
+		base:    "hello",
+		delta:   []byte{5, 5, 0x91, 3, 5},
+		wantErr: true,
+	},
+	{
+		name:    "truncated insert",
+		base:    "hello",
+		delta:   []byte{5, 3, 3, 'x'},
+		wantErr: true,
+	},
+	{
+		name:    "truncated copy",
+		base:    "hello",
+		delta:   []byte{5, 5, 0x91},
+		wantErr: true,
+	},
+	{
+		name:    "reserved opcode",
+		base:    "hello",
+		delta:   []byte{5, 0, 0},
+		wantErr: true,
+	},
+	{
+		name:    "truncated size",
+		base:    "hello",
+		delta:   []byte{0x85},
+		wantErr: true,
+	},
+	{
+		name:    "huge destination size",
+		base:    "hello",
+		delta:   []byte{5, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f},
+		wantErr: true,
+	},
+	{
+		name: "unsatisfiable destination size",
+		base: "hello",
+		// Destination size 1<<35 with a single copy op.
+		delta:   []byte{5, 0x80, 0x80, 0x80, 0x80, 0x80, 0x01, 0x91, 0, 5},
+		wantErr: true,
+	},
+}
+
+func TestApplyDelta(t *testing.T) {
+	for _, test := range applyDeltaTests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := applyDelta([]byte(test.base), test.delta)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("unexpected error: got:%v want error:%t", err, test.wantErr)
+			}
+			if err == nil && string(got) != test.want {
+				t.Errorf("unexpected result: got:%q want:%q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,302 @@
+package gitrepo
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// pack is a pack file and its index.
+type pack struct {
+	f *os.File
+	// names holds the sorted binary object names in
+	// the pack and offsets their positions.
+	names   [][20]byte
+	offsets []int64
+}
+
+// Pack object types.
+const (
+	objCommit   = 1
+	objTree     = 2
+	objBlob     = 3
+	objTag      = 4
+	objOfsDelta = 6
+	objRefDelta = 7
+)
+
+var typeNames = map[int]string{
+	objCommit: "commit",
+	objTree:   "tree",
+	objBlob:   "blob",
+	objTag:    "tag",
+}
+
+// openPack opens the pack with the index at the path idx.
+func openPack(idx string) (*pack, error) {
+	b, err := os.ReadFile(idx)
+	if err != nil {
+		return nil, err
+	}
+	p := &pack{}
+	err = p.readIndex(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", idx, err)
+	}
+	p.f, err = os.Open(strings.TrimSuffix(idx, ".idx") + ".pack")
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *pack) close() error {
+	return p.f.Close()
+}
+
+// readIndex reads the version 1 or 2 pack index held in b.
+func (p *pack) readIndex(b []byte) error {
+	errInvalid := errors.New("invalid pack index")
+	v2 := bytes.HasPrefix(b, []byte("\xfftOc"))
+	fanout := 0
+	if v2 {
+		if len(b) < 8 || binary.BigEndian.Uint32(b[4:]) != 2 {
+			return errors.New("unsupported pack index version")
+		}
+		fanout = 8
+	}
+	if len(b) < fanout+256*4 {
+		return errInvalid
+	}
+	n := int(binary.BigEndian.Uint32(b[fanout+255*4:]))
+	p.names = make([][20]byte, n)
+	p.offsets = make([]int64, n)
+	tab := fanout + 256*4
+	if !v2 {
+		if len(b) < tab+n*24 {
+			return errInvalid
+		}
+		for i := 0; i < n; i++ {
+			e := b[tab+i*24:]
+			p.offsets[i] = int64(binary.BigEndian.Uint32(e))
+			copy(p.names[i][:], e[4:24])
+		}
+		return nil
+	}
+	names := tab
+	offsets := names + n*20 + n*4 // Skip the CRC table.
+	large := offsets + n*4
+	if len(b) < large {
+		return errInvalid
+	}
+	for i := 0; i < n; i++ {
+		copy(p.names[i][:], b[names+i*20:])
+		off := binary.BigEndian.Uint32(b[offsets+i*4:])
+		if off&0x80000000 == 0 {
+			p.offsets[i] = int64(off)
+			continue
+		}
+		j := large + int(off&0x7fffffff)*8
+		if len(b) < j+8 {
+			return errInvalid
+		}
+		p.offsets[i] = int64(binary.BigEndian.Uint64(b[j:]))
+	}
+	return nil
+}
+
+// offset returns the position of the named object in the pack.
+func (p *pack) offset(id string) (int64, bool) {
+	var name [20]byte
+	_, err := hex.Decode(name[:], []byte(id))
+	if err != nil {
+		return 0, false
+	}
+	i := sort.Search(len(p.names), func(i int) bool {
+		return bytes.Compare(p.names[i][:], name[:]) >= 0
+	})
+	if i < len(p.names) && p.names[i] == name {
+		return p.offsets[i], true
+	}
+	return 0, false
+}
+
+// withPrefix returns the hex names of the objects in the pack that start
+// with prefix.
+func (p *pack) withPrefix(prefix string) []string {
+	i := sort.Search(len(p.names), func(i int) bool {
+		return hex.EncodeToString(p.names[i][:]) >= prefix
+	})
+	var ids []string
+	for ; i < len(p.names); i++ {
+		id := hex.EncodeToString(p.names[i][:])
+		if !strings.HasPrefix(id, prefix) {
+			break
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// object returns the type and contents of the object at the offset in the
+// pack, resolving deltas against their bases. Bases referred to by name
+// are looked up in r.
+func (p *pack) object(r *Repo, off int64) (typ string, data []byte, err error) {
+	br := bufio.NewReader(io.NewSectionReader(p.f, off, 1<<62))
+	c, err := br.ReadByte()
+	if err != nil {
+		return "", nil, err
+	}
+	kind := int(c>>4) & 7
+	size := int64(c & 0x0f)
+	for shift := 4; c&0x80 != 0; shift += 7 {
+		c, err = br.ReadByte()
+		if err != nil {
+			return "", nil, err
+		}
+		size |= int64(c&0x7f) << shift
+	}
+
+	var baseType string
+	var base []byte
+	switch kind {
+	case objOfsDelta:
+		c, err = br.ReadByte()
+		if err != nil {
+			return "", nil, err
+		}
+		rel := int64(c & 0x7f)
+		for c&0x80 != 0 {
+			c, err = br.ReadByte()
+			if err != nil {
+				return "", nil, err
+			}
+			rel = (rel+1)<<7 | int64(c&0x7f)
+		}
+		baseType, base, err = p.object(r, off-rel)
+		if err != nil {
+			return "", nil, err
+		}
+	case objRefDelta:
+		var name [20]byte
+		_, err = io.ReadFull(br, name[:])
+		if err != nil {
+			return "", nil, err
+		}
+		baseType, base, err = r.object(hex.EncodeToString(name[:]))
+		if err != nil {
+			return "", nil, err
+		}
+	default:
+		var ok bool
+		typ, ok = typeNames[kind]
+		if !ok {
+			return "", nil, fmt.Errorf("invalid pack object type: %d", kind)
+		}
+	}
+
+	z, err := zlib.NewReader(br)
+	if err != nil {
+		return "", nil, err
+	}
+	defer z.Close()
+	data, err = io.ReadAll(io.LimitReader(z, size))
+	if err != nil {
+		return "", nil, err
+	}
+	if int64(len(data)) != size {
+		return "", nil, errors.New("pack object size mismatch")
+	}
+	if kind == objOfsDelta || kind == objRefDelta {
+		data, err = applyDelta(base, data)
+		if err != nil {
+			return "", nil, err
+		}
+		typ = baseType
+	}
+	return typ, data, nil
+}
+
+// applyDelta returns the result of applying the delta to base.
+func applyDelta(base, delta []byte) ([]byte, error) {
+	errInvalid := errors.New("invalid delta")
+	varint := func() (int, bool) {
+		var v, shift int
+		for len(delta) != 0 && shift < 63 {
+			c := delta[0]
+			delta = delta[1:]
+			v |= int(c&0x7f) << shift
+			if c&0x80 == 0 {
+				return v, true
+			}
+			shift += 7
+		}
+		return 0, false
+	}
+	srcSize, ok := varint()
+	if !ok || srcSize != len(base) {
+		return nil, errInvalid
+	}
+	dstSize, ok := varint()
+	// Each op byte can produce at most a 24 bit copy length, so
+	// larger sizes cannot be satisfied by the remaining delta.
+	if !ok || dstSize < 0 || dstSize > len(delta)<<24 {
+		return nil, errInvalid
+	}
+	dst := make([]byte, 0, dstSize)
+	for len(delta) != 0 {
+		op := delta[0]
+		delta = delta[1:]
+		switch {
+		case op&0x80 != 0:
+			// Copy from base.
+			var off, n int
+			for i := 0; i < 4; i++ {
+				if op&(1<<i) != 0 {
+					if len(delta) == 0 {
+						return nil, errInvalid
+					}
+					off |= int(delta[0]) << (8 * i)
+					delta = delta[1:]
+				}
+			}
+			for i := 0; i < 3; i++ {
+				if op&(0x10<<i) != 0 {
+					if len(delta) == 0 {
+						return nil, errInvalid
+					}
+					n |= int(delta[0]) << (8 * i)
+					delta = delta[1:]
+				}
+			}
+			if n == 0 {
+				n = 0x10000
+			}
+			if off+n > len(base) {
+				return nil, errInvalid
+			}
+			dst = append(dst, base[off:off+n]...)
+		case op != 0:
+			// Insert literal data.
+			if int(op) > len(delta) {
+				return nil, errInvalid
+			}
+			dst = append(dst, delta[:op]...)
+			delta = delta[op:]
+		default:
+			return nil, errInvalid
+		}
+	}
+	if len(dst) != dstSize {
+		return nil, errInvalid
+	}
+	return dst, nil
+}
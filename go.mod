@@ -1,6 +1,6 @@
 module github.com/efd6/ecsinrdf
 
-go 1.17
+go 1.23
 
 require (
 	gonum.org/v1/gonum v0.9.1-0.20220209100752-1f712d5ee065
@@ -0,0 +1,519 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"gonum.org/v1/gonum/graph/formats/rdf"
+
+	"github.com/efd6/ecsinrdf/dot"
+	"github.com/efd6/ecsinrdf/graph"
+	"github.com/efd6/ecsinrdf/graphml"
+	"github.com/efd6/ecsinrdf/integration"
+	"github.com/efd6/ecsinrdf/jsonld"
+	"github.com/efd6/ecsinrdf/mermaid"
+	"github.com/efd6/ecsinrdf/owner"
+	"github.com/efd6/ecsinrdf/term"
+	"github.com/efd6/ecsinrdf/turtle"
+	"github.com/efd6/ecsinrdf/vocab"
+)
+
+// graphConfig holds the options for constructing an analysis graph.
+type graphConfig struct {
+	// root and version specify the ECS repo and
+	// the version of ECS to use.
+	root, version string
+	// versions holds additional ECS versions whose
+	// fields are added to the graph. The ECS fields
+	// of each version, including version, are
+	// distinct nodes tagged with their version.
+	versions []string
+	// artifact is the key in ecsArtifacts of the
+	// ECS specification artifact to use.
+	artifact string
+	// pkg is the path to the root of the package(s).
+	// If it is empty, only ECS statements are included.
+	pkg string
+	// documents specifies whether to include sample
+	// and test documents.
+	documents bool
+	// kibana specifies whether to include field
+	// references from Kibana saved objects.
+	kibana bool
+	// prune specifies whether to collapse chains of
+	// package groups with a single child.
+	prune bool
+	// rules holds ownership rules for package paths.
+	rules []owner.Rule
+	// noCache specifies whether to bypass the on-disk
+	// cache of canonicalized ECS statements.
+	noCache bool
+	// sources holds external schema source commands
+	// whose statements are added to the graph.
+	sources []string
+	// fields holds the paths or glob patterns of
+	// fields files to use in place of the fields
+	// files found in pkg.
+	fields []string
+	// record is the path of a file to write a bundle
+	// of the ECS specification to. If replay is not
+	// empty, the ECS specification is read from the
+	// bundle in the file at the path in place of the
+	// ECS repo or GitHub.
+	record, replay string
+	// store interns the terms of the statements parsed
+	// during a build. If it is nil, buildGraph uses a
+	// new Store for the build.
+	store *term.Store
+}
+
+// buildGraph returns the analysis graph described by cfg and the package
+// fields files that were included. Invalid statements are logged and
+// omitted from the graph. If cfg.pkg holds more than one package, as when
+// it is the root of the integrations repo, data streams are named by
+// their package as described by graph.PackageIndex.DataStreamOf. Building
+// stops with the context's error if ctx is cancelled.
+func buildGraph(ctx context.Context, cfg graphConfig) (*rdf.Graph, []fieldsFile, error) {
+	if cfg.store == nil {
+		cfg.store = term.NewStore()
+	}
+	ecs, err := ecsStatements(ctx, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	ecs = graph.VersionStatements(ecs, cfg.version)
+	for _, v := range cfg.versions {
+		vcfg := cfg
+		vcfg.version = v
+		// Bundles only hold the first version.
+		vcfg.record, vcfg.replay = "", ""
+		statements, err := ecsStatements(ctx, vcfg)
+		if err != nil {
+			return nil, nil, err
+		}
+		// Each version's statements are canonicalized
+		// alone, so they are relabeled to follow the
+		// blank nodes of the earlier versions.
+		ecs = append(ecs, graph.Relabel(graph.VersionStatements(statements, v), ecs)...)
+	}
+
+	var statements []*rdf.Statement
+	add := term.CanonicalPaths(func(s *rdf.Statement, err error) {
+		var conflict *integration.ConflictError
+		if errors.As(err, &conflict) {
+			// The merged field is still emitted.
+			slog.Warn("conflicting duplicate declarations", "error", err)
+			return
+		}
+		if err != nil {
+			slog.Warn("omitting invalid statement", "error", err)
+			return
+		}
+		statements = append(statements, s)
+	})
+
+	var (
+		files []fieldsFile
+		fsys  fs.FS
+		rel   graph.PackageIndex
+		idx   graph.PackageIndex
+	)
+	if cfg.pkg != "" {
+		fsys = os.DirFS(cfg.pkg)
+		rel, err = graph.PackagesIn(ctx, fsys)
+		if err != nil {
+			return nil, nil, err
+		}
+		idx = rootedIndex(rel, cfg.pkg)
+	}
+	switch {
+	case len(cfg.fields) != 0:
+		files, err = matchFieldsFiles(cfg.fields, idx)
+	case cfg.pkg != "":
+		files, err = fieldsFiles(ctx, cfg.pkg, rel)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(files) != 0 {
+		err = parallelFieldsStatements(files, runtime.GOMAXPROCS(0), func(ff fieldsFile, fn func(*rdf.Statement, error)) error {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			name := fieldsFileName(cfg.pkg, ff.path)
+			if cfg.rules != nil {
+				fn = owner.Statements(owner.Of(cfg.rules, name), fn)
+			}
+			return fieldsStatements(ff, name, fn)
+		}, add)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if cfg.pkg != "" {
+		loaders := []func(context.Context, fs.FS, graph.PackageIndex, func(*rdf.Statement, error)) error{
+			graph.TemplateStatements,
+			graph.RouteStatements,
+			graph.MLStatements,
+			graph.TransformStatements,
+		}
+		if cfg.documents {
+			loaders = append(loaders, graph.DocumentStatements)
+		}
+		if cfg.kibana {
+			loaders = append(loaders, graph.SavedObjectStatements)
+		}
+		for _, load := range loaders {
+			err = load(ctx, fsys, rel, add)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", cfg.pkg, err)
+			}
+		}
+	}
+
+	if cfg.prune {
+		statements = integration.PruneGroupChains(statements)
+	}
+	for _, src := range cfg.sources {
+		err = sourceStatements(ctx, src, cfg, add)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Package statements never share blank nodes with
+	// ECS statements, so they are canonicalized alone
+	// and relabeled to follow the ECS blank nodes.
+	statements, err = graph.Canonicalize(statements)
+	if err != nil {
+		return nil, nil, err
+	}
+	return graph.New(graph.Merge(ecs, statements)), files, nil
+}
+
+// fieldsStatements calls fn on the statements constructed from the fields
+// file ff, naming the file in the statements with name.
+func fieldsStatements(ff fieldsFile, name string, fn func(*rdf.Statement, error)) error {
+	b, err := os.ReadFile(ff.path)
+	if err != nil {
+		return err
+	}
+	return graph.FieldsStatements(name, ff.dataStream, b, fn)
+}
+
+// fieldsFileName returns the name of the fields file at path in the graph
+// of the package(s) rooted at pkg: its slash-separated path relative to
+// pkg. Field node labels and <defined:in> statements hold the name, so
+// graphs do not depend on where the packages are checked out. Files that
+// are not below pkg, or read without a package root, are named by their
+// path, made absolute if it cannot be related to pkg.
+func fieldsFileName(pkg, path string) string {
+	if pkg != "" {
+		rel, err := filepath.Rel(pkg, path)
+		if err != nil {
+			abs, err := filepath.Abs(path)
+			if err == nil {
+				path = abs
+			}
+		} else if rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return filepath.ToSlash(path)
+}
+
+// packageFile returns the path of the fields file with the name given by
+// fieldsFileName for the package(s) rooted at pkg.
+func packageFile(pkg, name string) string {
+	path := filepath.FromSlash(name)
+	if pkg == "" || filepath.IsAbs(path) || strings.HasPrefix(name, "../") {
+		return path
+	}
+	return filepath.Join(pkg, path)
+}
+
+// parallelFieldsStatements calls parse on each of the fields files using
+// the given number of concurrent workers and calls fn on the statements,
+// and statement errors, that each parse call emits. Emissions are passed
+// to fn from the calling goroutine in the order of files, so the result
+// is the same as calling parse on each file in sequence. The first error
+// returned by parse in file order is returned.
+func parallelFieldsStatements(files []fieldsFile, workers int, parse func(fieldsFile, func(*rdf.Statement, error)) error, fn func(*rdf.Statement, error)) error {
+	type emission struct {
+		s   *rdf.Statement
+		err error
+	}
+	type result struct {
+		emitted []emission
+		err     error
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	results := make([]chan result, len(files))
+	for i := range results {
+		results[i] = make(chan result, 1)
+	}
+	jobs := make(chan int)
+	done := make(chan struct{})
+	defer close(done)
+	for w := 0; w < workers && w < len(files); w++ {
+		go func() {
+			for i := range jobs {
+				var r result
+				r.err = parse(files[i], func(s *rdf.Statement, err error) {
+					r.emitted = append(r.emitted, emission{s, err})
+				})
+				results[i] <- r
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		for i := range files {
+			select {
+			case jobs <- i:
+			case <-done:
+				return
+			}
+		}
+	}()
+	for _, c := range results {
+		r := <-c
+		for _, e := range r.emitted {
+			fn(e.s, e.err)
+		}
+		if r.err != nil {
+			return r.err
+		}
+	}
+	return nil
+}
+
+// writeGraph writes the statements in g to the file at path in the given
+// format, either nquads, written as sorted N-Quads, jsonld, turtle,
+// graphml, or csv or tsv, written as a field inventory by writeInventory.
+// The predicates of nquads, jsonld and turtle statements are written in
+// their canonical forms unless short is true.
+func writeGraph(path, format string, g *rdf.Graph, short bool) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	predicates := vocab.CanonicalStatement
+	if short {
+		predicates = func(s *rdf.Statement) *rdf.Statement { return s }
+	}
+	w := bufio.NewWriter(f)
+	switch format {
+	case "nquads":
+		var lines []string
+		for it := g.AllStatements(); it.Next(); {
+			lines = append(lines, predicates(it.Statement()).String())
+		}
+		sort.Strings(lines)
+		for _, l := range lines {
+			w.WriteString(l)
+			w.WriteByte('\n')
+		}
+	case "jsonld":
+		var statements []*rdf.Statement
+		for it := g.AllStatements(); it.Next(); {
+			statements = append(statements, predicates(it.Statement()))
+		}
+		err = jsonld.Encode(w, statements)
+	case "turtle":
+		var statements []*rdf.Statement
+		for it := g.AllStatements(); it.Next(); {
+			statements = append(statements, predicates(it.Statement()))
+		}
+		err = turtle.Encode(w, statements)
+	case "graphml":
+		var statements []*rdf.Statement
+		for it := g.AllStatements(); it.Next(); {
+			statements = append(statements, it.Statement())
+		}
+		err = graphml.Encode(w, statements)
+	case "csv":
+		err = writeInventory(w, g, ',')
+	case "tsv":
+		err = writeInventory(w, g, '\t')
+	default:
+		err = fmt.Errorf("unknown output format: %s", format)
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeDOT writes the Graphviz DOT rendering of the nodes in g with the
+// unquoted field path to the file at path. The rendering holds the nodes,
+// their ancestors, and their children and multi-fields, with an edge for
+// each statement between them and for each statement with a literal
+// object. The nodes with the path are highlighted.
+func writeDOT(path string, g *rdf.Graph, field string) error {
+	lit, ok := g.TermFor(term.Literal(field))
+	if !ok {
+		return fmt.Errorf("%s: field not found", field)
+	}
+	isPath := vocab.IsPath.Match
+	isStructural := func(s *rdf.Statement) bool {
+		switch vocab.Of(s) {
+		case vocab.HasChild, vocab.HasDescendant, vocab.HasMulti:
+			return true
+		default:
+			return false
+		}
+	}
+	fields := g.Query(lit).In(isPath).Unique()
+	if len(fields.Result()) == 0 {
+		return fmt.Errorf("%s: field not found", field)
+	}
+	highlight := make(map[string]bool)
+	selected := make(map[rdf.Term]bool)
+	for _, n := range fields.Result() {
+		highlight[n.Value] = true
+		selected[n] = true
+	}
+	for _, n := range fields.Out(isStructural).Result() {
+		selected[n] = true
+	}
+	for q := fields.In(isStructural).Unique(); len(q.Result()) != 0; q = q.In(isStructural).Unique() {
+		var grew bool
+		for _, n := range q.Result() {
+			if !selected[n] {
+				selected[n] = true
+				grew = true
+			}
+		}
+		if !grew {
+			break
+		}
+	}
+
+	var statements []*rdf.Statement
+	for n := range selected {
+		for to := g.FromSubject(n); to.Next(); {
+			o := to.Node().(rdf.Term)
+			_, _, kind, err := o.Parts()
+			if err != nil {
+				return err
+			}
+			if kind != rdf.Literal && !selected[o] {
+				continue
+			}
+			for it := g.Statements(n.ID(), o.ID()); it.Next(); {
+				statements = append(statements, it.Statement())
+			}
+		}
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = dot.Encode(f, field, statements, highlight)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeMermaid writes a Mermaid flowchart of the fields in g to the file at
+// path. The fields are those of the unquoted ECS field set if fieldset is
+// not empty, otherwise those of the unquoted package data stream, together
+// with their multi-fields and the objects above them. ECS fields tagged
+// with a version other than the provided unquoted version are omitted.
+func writeMermaid(path string, g *rdf.Graph, fieldset, dataStream, version string) error {
+	var fields []rdf.Term
+	if fieldset != "" {
+		if lit, ok := g.TermFor(term.Literal(fieldset)); ok {
+			fields = g.Query(lit).In(vocab.InFieldset.Match).Unique().Result()
+			// The ECS group node of the field set
+			// is not itself in the field set.
+			isType := vocab.IsType.Match
+			for _, n := range g.Query(lit).In(vocab.IsPath.Match).Result() {
+				if len(g.Query(n).Out(isType).Result()) != 0 {
+					fields = append(fields, n)
+				}
+			}
+		}
+		if len(fields) == 0 {
+			return fmt.Errorf("%s: field set not found", fieldset)
+		}
+	} else {
+		if lit, ok := g.TermFor(term.Literal(dataStream)); ok {
+			fields = g.Query(lit).In(vocab.IsDataStream.Match).In(vocab.InDataStream.Match).Unique().Result()
+		}
+		if len(fields) == 0 {
+			return fmt.Errorf("%s: data stream not found", dataStream)
+		}
+	}
+	inVersion := vocab.InVersion.Match
+	isMulti := vocab.HasMulti.Match
+	isChild := vocab.HasChild.Match
+	selected := make(map[rdf.Term]bool)
+	for _, n := range fields {
+		versions := g.Query(n).Out(inVersion).Result()
+		if len(versions) != 0 && versions[0].Value != term.Literal(version) {
+			continue
+		}
+		selected[n] = true
+		for _, m := range g.Query(n).Out(isMulti).Result() {
+			selected[m] = true
+		}
+		// Include the intermediate objects so
+		// that each field is below its root.
+		for q := g.Query(n).In(isChild); len(q.Result()) != 0; q = q.In(isChild) {
+			for _, p := range q.Result() {
+				selected[p] = true
+			}
+		}
+	}
+
+	var statements []*rdf.Statement
+	for n := range selected {
+		for to := g.FromSubject(n); to.Next(); {
+			o := to.Node().(rdf.Term)
+			for it := g.Statements(n.ID(), o.ID()); it.Next(); {
+				s := it.Statement()
+				switch vocab.Of(s) {
+				case vocab.IsName, vocab.IsType, vocab.AsType:
+				case vocab.HasChild, vocab.HasMulti:
+					if !selected[o] {
+						continue
+					}
+				default:
+					continue
+				}
+				statements = append(statements, s)
+			}
+		}
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = mermaid.Encode(f, statements)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
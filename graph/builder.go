@@ -0,0 +1,162 @@
+package graph
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"sort"
+	"strings"
+
+	"gonum.org/v1/gonum/graph/formats/rdf"
+
+	"github.com/efd6/ecsinrdf/term"
+)
+
+// Builder accumulates statements from named sources and constructs a
+// canonicalized graph from them. Statements are canonicalized and
+// deduplicated once, when Build is called.
+//
+// Blank node labels are rewritten to be distinct for each source name so
+// that sources cannot share blank nodes with each other. Statements added
+// under the same source name share their blank nodes. Sources should link
+// to the fields of other sources through their quoted paths.
+//
+// The zero value is an empty Builder ready to use.
+type Builder struct {
+	statements []*rdf.Statement
+	source     map[*rdf.Statement]string
+
+	// sources holds the source names of the
+	// statements of the last built graph
+	// keyed by their N-Quad text.
+	sources map[string][]string
+}
+
+// AddECS adds the statements constructed from the ECS specification
+// artifact read from r under the source name. The artifact is one of
+// Nested, Flat or Schemas. Each field path is also held in its canonical
+// form as described by term.CanonicalPaths. Invalid statements are
+// omitted.
+func (b *Builder) AddECS(ctx context.Context, source string, r io.Reader, artifact string) error {
+	return ECSStatements(ctx, r, artifact, term.CanonicalPaths(b.adder(source)))
+}
+
+// AddIntegration adds the statements of the fields files, agent stream
+// templates, data stream routing rules, ML modules and transforms of the
+// package or repository of packages held in fsys under the source name.
+// Each field path is also held in its canonical form as described by
+// term.CanonicalPaths. Invalid statements are omitted.
+func (b *Builder) AddIntegration(ctx context.Context, source string, fsys fs.FS) error {
+	add := term.CanonicalPaths(b.adder(source))
+	idx, err := PackagesIn(ctx, fsys)
+	if err != nil {
+		return err
+	}
+	files, err := FieldsFiles(ctx, fsys, idx)
+	if err != nil {
+		return err
+	}
+	for _, ff := range files {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		text, err := fs.ReadFile(fsys, ff.Path)
+		if err != nil {
+			return err
+		}
+		err = FieldsStatements(ff.Path, ff.DataStream, text, add)
+		if err != nil {
+			return err
+		}
+	}
+	for _, load := range []func(context.Context, fs.FS, PackageIndex, func(*rdf.Statement, error)) error{
+		TemplateStatements,
+		RouteStatements,
+		MLStatements,
+		TransformStatements,
+	} {
+		err = load(ctx, fsys, idx, add)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddStatements adds the statements under the source name. The statements
+// are held by the Builder and are modified when the graph is built.
+func (b *Builder) AddStatements(source string, statements ...*rdf.Statement) {
+	add := b.adder(source)
+	for _, s := range statements {
+		add(s, nil)
+	}
+}
+
+// adder returns a statement callback that adds valid statements to b
+// under the source name.
+func (b *Builder) adder(source string) func(*rdf.Statement, error) {
+	sum := sha1.Sum([]byte(source))
+	prefix := "_:" + hex.EncodeToString(sum[:8])
+	blank := func(t rdf.Term) rdf.Term {
+		if !strings.HasPrefix(t.Value, "_:") {
+			return t
+		}
+		return rdf.Term{Value: prefix + t.Value[len("_:"):]}
+	}
+	return func(s *rdf.Statement, err error) {
+		if err != nil {
+			return
+		}
+		s.Subject = blank(s.Subject)
+		s.Object = blank(s.Object)
+		s.Label = blank(s.Label)
+		if b.source == nil {
+			b.source = make(map[*rdf.Statement]string)
+		}
+		b.source[s] = source
+		b.statements = append(b.statements, s)
+	}
+}
+
+// Build returns the canonicalized graph holding the statements added to b
+// with duplicate statements removed, and resets b. The provenance of the
+// statements of the graph is available from Sources until the next call
+// to Build.
+func (b *Builder) Build() (*rdf.Graph, error) {
+	statements, source := b.statements, b.source
+	b.statements, b.source = nil, nil
+	// Canonicalization relabels the statements in place,
+	// so their sources are keyed by their final text.
+	statements, err := rdf.URDNA2015(statements, statements)
+	if err != nil {
+		return nil, err
+	}
+	statements = canonicalLiterals(statements)
+	sources := make(map[string][]string)
+	for _, s := range statements {
+		key := s.String()
+		sources[key] = appendSource(sources[key], source[s])
+	}
+	b.sources = sources
+	return New(rdf.Deduplicate(statements)), nil
+}
+
+// Sources returns the names of the sources that added the statement s to
+// the graph returned by the last call to Build, in lexical order.
+func (b *Builder) Sources(s *rdf.Statement) []string {
+	return b.sources[s.String()]
+}
+
+// appendSource returns the sorted set of source names with source added.
+func appendSource(sources []string, source string) []string {
+	i := sort.SearchStrings(sources, source)
+	if i < len(sources) && sources[i] == source {
+		return sources
+	}
+	sources = append(sources, "")
+	copy(sources[i+1:], sources[i:])
+	sources[i] = source
+	return sources
+}
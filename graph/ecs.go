@@ -0,0 +1,108 @@
+package graph
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"gonum.org/v1/gonum/graph/formats/rdf"
+	"gopkg.in/yaml.v3"
+
+	"github.com/efd6/ecsinrdf/schema"
+)
+
+// ECS specification artifacts that statements can be constructed from.
+const (
+	// Nested is the generated ecs_nested.yml artifact.
+	Nested = "nested"
+	// Flat is the generated ecs_flat.yml artifact.
+	Flat = "flat"
+	// Schemas is the stream of the hand-written
+	// source schemas, for versions without up to
+	// date generated artifacts.
+	Schemas = "schemas"
+)
+
+// LoadECS returns the canonicalized graph constructed from the ECS
+// ecs_nested.yml specification read from r. Each field path is also held
+// in its canonical form as described by term.CanonicalPaths. Invalid
+// statements are omitted from the graph.
+func LoadECS(ctx context.Context, r io.Reader) (*rdf.Graph, error) {
+	var b Builder
+	err := b.AddECS(ctx, "ecs", r, Nested)
+	if err != nil {
+		return nil, err
+	}
+	return b.Build()
+}
+
+// ECSStatements calls fn on the statements constructed from the ECS
+// specification artifact read from r. The artifact is one of Nested, Flat
+// or Schemas.
+func ECSStatements(ctx context.Context, r io.Reader, artifact string, fn func(*rdf.Statement, error)) error {
+	dec := yaml.NewDecoder(r)
+	switch artifact {
+	case Nested, Flat:
+	case Schemas:
+		// The source schemas hold documentation
+		// attributes that are not modeled.
+		var fieldsets []schema.Fieldset
+		for {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			var f []schema.Fieldset
+			err := dec.Decode(&f)
+			if err != nil {
+				if err == io.EOF {
+					break
+				}
+				return err
+			}
+			fieldsets = append(fieldsets, f...)
+		}
+		nested, err := schema.Expand(fieldsets)
+		if err != nil {
+			return err
+		}
+		schema.Statements("", nested, fn)
+		return nil
+	default:
+		return fmt.Errorf("unknown ECS artifact: %s", artifact)
+	}
+	dec.KnownFields(true)
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var f map[string]schema.Field
+		err := dec.Decode(&f)
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if artifact == Flat {
+			schema.FlatStatements(f, fn)
+		} else {
+			schema.Statements("", f, fn)
+		}
+	}
+}
+
+// YAMLStream returns the YAML documents in docs as a single stream, with
+// each document started by a document marker. It is used to present the
+// files of the Schemas artifact as a single specification.
+func YAMLStream(docs [][]byte) []byte {
+	var buf bytes.Buffer
+	for _, d := range docs {
+		buf.WriteString("---\n")
+		buf.Write(d)
+		if len(d) != 0 && d[len(d)-1] != '\n' {
+			buf.WriteByte('\n')
+		}
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,119 @@
+// Package graph provides tools for constructing the RDF analysis graphs of
+// ECS specifications and integration packages that are queried by the
+// query package.
+//
+// Graphs are built from statements in two parts. ECS statements are
+// constructed and canonicalized alone, so that they can be cached for a
+// version of ECS, and package statements are canonicalized alone and then
+// merged into the ECS statements with Merge. LoadECS and LoadPackage build
+// a graph from either part alone, and a Builder builds a graph from any
+// number of sources, recording which sources added each statement.
+//
+// Functions that read specifications or walk package file systems take a
+// context and stop with its error when it is cancelled.
+package graph
+
+import (
+	"strconv"
+	"strings"
+
+	"gonum.org/v1/gonum/graph/formats/rdf"
+
+	"github.com/efd6/ecsinrdf/term"
+	"github.com/efd6/ecsinrdf/vocab"
+)
+
+// Canonicalize returns the statements with their blank nodes given
+// canonical labels and with duplicate statements removed. The statements
+// are modified in place.
+func Canonicalize(statements []*rdf.Statement) ([]*rdf.Statement, error) {
+	statements, err := rdf.URDNA2015(statements, statements)
+	if err != nil {
+		return nil, err
+	}
+	return rdf.Deduplicate(canonicalLiterals(statements)), nil
+}
+
+// canonicalLiterals rewrites the literal objects of the statements in the
+// escaped form of term.Literal. Canonicalization re-escapes literals in
+// the form of rdf.NewLiteralTerm, which writes control characters other
+// than line breaks unescaped. The statements are modified in place.
+func canonicalLiterals(statements []*rdf.Statement) []*rdf.Statement {
+	for _, s := range statements {
+		if !strings.HasPrefix(s.Object.Value, `"`) {
+			continue
+		}
+		lit, err := term.CanonicalLiteral(s.Object.Value)
+		if err != nil {
+			continue
+		}
+		s.Object.Value = lit
+	}
+	return statements
+}
+
+// Merge returns the canonicalized statements in base followed by the
+// separately canonicalized statements, relabeled with Relabel so that
+// their blank nodes are distinct from those of base, with duplicate
+// statements removed.
+func Merge(base, statements []*rdf.Statement) []*rdf.Statement {
+	return rdf.Deduplicate(append(base, Relabel(statements, base)...))
+}
+
+// New returns a graph holding the statements.
+func New(statements []*rdf.Statement) *rdf.Graph {
+	g := rdf.NewGraph()
+	for _, s := range statements {
+		g.AddStatement(s)
+	}
+	return g
+}
+
+// VersionStatements returns statements with statements tagging each field
+// node in statements with the version of ECS it was constructed from.
+//
+// _:field <in:version> "v8.11.0" .
+//
+func VersionStatements(statements []*rdf.Statement, version string) []*rdf.Statement {
+	v := rdf.Term{Value: term.Literal(version)}
+	for _, s := range statements {
+		if !vocab.IsPath.Match(s) {
+			continue
+		}
+		statements = append(statements, &rdf.Statement{
+			Subject:   s.Subject,
+			Predicate: vocab.InVersion.Term(),
+			Object:    v,
+		})
+	}
+	return statements
+}
+
+// Relabel returns statements with the canonical blank node labels offset
+// by the number of blank nodes in base so that the labels of canonicalized
+// statements do not collide with those of base. The statements are
+// modified in place.
+func Relabel(statements, base []*rdf.Statement) []*rdf.Statement {
+	blanks := make(map[string]bool)
+	for _, s := range base {
+		for _, t := range []rdf.Term{s.Subject, s.Object, s.Label} {
+			if strings.HasPrefix(t.Value, "_:") {
+				blanks[t.Value] = true
+			}
+		}
+	}
+	offset := len(blanks)
+	shift := func(t rdf.Term) rdf.Term {
+		n, err := strconv.Atoi(strings.TrimPrefix(t.Value, "_:c14n"))
+		if err != nil || !strings.HasPrefix(t.Value, "_:c14n") {
+			return t
+		}
+		return rdf.Term{Value: "_:c14n" + strconv.Itoa(n+offset)}
+	}
+	for _, s := range statements {
+		s.Subject = shift(s.Subject)
+		s.Object = shift(s.Object)
+		s.Label = shift(s.Label)
+	}
+	return statements
+}
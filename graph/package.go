@@ -0,0 +1,411 @@
+package graph
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+
+	"gonum.org/v1/gonum/graph/formats/rdf"
+	"gopkg.in/yaml.v3"
+
+	"github.com/efd6/ecsinrdf/agent"
+	"github.com/efd6/ecsinrdf/document"
+	"github.com/efd6/ecsinrdf/integration"
+	"github.com/efd6/ecsinrdf/kibana"
+	"github.com/efd6/ecsinrdf/ml"
+	"github.com/efd6/ecsinrdf/routing"
+	"github.com/efd6/ecsinrdf/transform"
+)
+
+// LoadPackage returns the canonicalized graph constructed from the package
+// or repository of packages held in fsys. The graph holds the statements
+// of the fields files, agent stream templates, data stream routing rules,
+// ML modules and transforms of the packages. Each field path is also held
+// in its canonical form as described by term.CanonicalPaths. Invalid
+// statements are omitted from the graph.
+//
+// File paths held in the graph are the slash-separated names of the files
+// in fsys.
+func LoadPackage(ctx context.Context, fsys fs.FS) (*rdf.Graph, error) {
+	var b Builder
+	err := b.AddIntegration(ctx, "package", fsys)
+	if err != nil {
+		return nil, err
+	}
+	return b.Build()
+}
+
+// PackageIndex holds the names of packages keyed by the slash-separated
+// directory holding their manifest.
+type PackageIndex map[string]string
+
+// PackagesIn returns the index of the package(s) in fsys. Package
+// manifests are distinguished from data stream manifests by their format
+// version.
+func PackagesIn(ctx context.Context, fsys fs.FS) (PackageIndex, error) {
+	idx := make(PackageIndex)
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil || d.IsDir() || d.Name() != "manifest.yml" {
+			return nil
+		}
+		var manifest struct {
+			FormatVersion string `yaml:"format_version"`
+			Name          string `yaml:"name"`
+		}
+		err = readManifest(fsys, name, &manifest)
+		if err != nil {
+			return err
+		}
+		if manifest.FormatVersion != "" && manifest.Name != "" {
+			idx[path.Dir(name)] = manifest.Name
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+// PackageOf returns the name of the indexed package holding the file with
+// the slash-separated name, or the empty string if it is not in an indexed
+// package.
+func (idx PackageIndex) PackageOf(name string) string {
+	return idx[idx.PackageDirOf(name)]
+}
+
+// PackageDirOf returns the root directory of the indexed package holding
+// the file with the slash-separated name, or the empty string if it is not
+// in an indexed package.
+func (idx PackageIndex) PackageDirOf(name string) string {
+	for dir := path.Dir(name); ; dir = path.Dir(dir) {
+		if _, ok := idx[dir]; ok {
+			return dir
+		}
+		if dir == path.Dir(dir) {
+			return ""
+		}
+	}
+}
+
+// DataStreamOf returns the name of the data stream holding the file with
+// the slash-separated name. If the index holds more than one package, data
+// streams are named package/data_stream so that data streams with the
+// same name in different packages are distinct, and files outside data
+// streams are placed in a data stream named for their package so that
+// results are grouped by package. Otherwise the name is the data stream
+// directory name, or the empty string if the file is not in a data stream.
+func (idx PackageIndex) DataStreamOf(name string) string {
+	ds := DataStreamOf(name)
+	if len(idx) < 2 {
+		return ds
+	}
+	pkg := idx.PackageOf(name)
+	switch {
+	case pkg == "":
+		return ds
+	case ds == "":
+		return pkg
+	default:
+		return pkg + "/" + ds
+	}
+}
+
+// DataStreamOf returns the name of the data stream holding the file with
+// the slash-separated name, or the empty string if the file is not in a
+// data stream.
+func DataStreamOf(name string) string {
+	for dir := path.Dir(name); dir != path.Dir(dir); dir = path.Dir(dir) {
+		if path.Base(path.Dir(dir)) == "data_stream" {
+			return path.Base(dir)
+		}
+	}
+	return ""
+}
+
+// FieldsFile is a package fields file.
+type FieldsFile struct {
+	// DataStream is the name of the data stream
+	// holding the fields file. It is empty for
+	// package-level fields.
+	DataStream string
+	// Path is the slash-separated name of the
+	// fields file.
+	Path string
+}
+
+// FieldsFiles returns the fields files in the package(s) in fsys in
+// lexical order. Data streams are named by idx.
+func FieldsFiles(ctx context.Context, fsys fs.FS, idx PackageIndex) ([]FieldsFile, error) {
+	var files []FieldsFile
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if path.Ext(name) != ".yml" || path.Base(path.Dir(name)) != "fields" {
+			return nil
+		}
+		files = append(files, FieldsFile{DataStream: idx.DataStreamOf(name), Path: name})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// FieldsStatements calls fn on the statements constructed from the fields
+// file contents b. The name of the file is recorded as the location of
+// each field's definition and the fields are placed in the named data
+// stream.
+func FieldsStatements(name, dataStream string, b []byte, fn func(*rdf.Statement, error)) error {
+	lines, err := integration.LinesOf(b)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	src := integration.Source{DataStream: dataStream, File: name, Lines: lines}
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	for {
+		var fields []integration.Field
+		err := dec.Decode(&fields)
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		integration.SourceStatements(src, "", fields, fn)
+	}
+}
+
+// TemplateStatements calls fn on the statements constructed from the
+// agent stream and input templates in the package(s) in fsys in lexical
+// order. Data streams are named by idx. Templates that are not valid YAML
+// until they are rendered are skipped.
+func TemplateStatements(ctx context.Context, fsys fs.FS, idx PackageIndex, fn func(*rdf.Statement, error)) error {
+	return fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil || d.IsDir() || !strings.HasSuffix(name, ".yml.hbs") {
+			return nil
+		}
+		dir := path.Dir(name)
+		if path.Base(path.Dir(dir)) != "agent" {
+			return nil
+		}
+		if kind := path.Base(dir); kind != "stream" && kind != "input" {
+			return nil
+		}
+		b, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		hints, err := agent.Hints(b)
+		if err != nil {
+			return nil
+		}
+		agent.DataStreamStatements(idx.DataStreamOf(name), hints, fn)
+		return nil
+	})
+}
+
+// RouteStatements calls fn on the statements constructed from the datasets
+// and routing rules of the data streams in the package(s) in fsys in
+// lexical order. The dataset of a data stream is the dataset in its
+// manifest or, if absent, the name of its package and data stream joined
+// by a dot. Data streams are named by idx.
+func RouteStatements(ctx context.Context, fsys fs.FS, idx PackageIndex, fn func(*rdf.Statement, error)) error {
+	return fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil || !d.IsDir() || path.Base(path.Dir(name)) != "data_stream" {
+			return nil
+		}
+		manifest := path.Join(name, "manifest.yml")
+		var dsManifest struct {
+			Dataset string `yaml:"dataset"`
+		}
+		err = readManifest(fsys, manifest, &dsManifest)
+		if err != nil {
+			return err
+		}
+		dataset := dsManifest.Dataset
+		if dataset == "" {
+			var pkgManifest struct {
+				Name string `yaml:"name"`
+			}
+			err = readManifest(fsys, path.Join(path.Dir(path.Dir(name)), "manifest.yml"), &pkgManifest)
+			if err != nil {
+				return err
+			}
+			if pkgManifest.Name != "" {
+				dataset = pkgManifest.Name + "." + path.Base(name)
+			}
+		}
+		var reroutes []routing.Reroute
+		rules := path.Join(name, "routing_rules.yml")
+		f, err := fsys.Open(rules)
+		switch {
+		case err == nil:
+			reroutes, err = routing.Decode(f)
+			f.Close()
+			if err != nil {
+				return fmt.Errorf("%s: %w", rules, err)
+			}
+		case !errors.Is(err, fs.ErrNotExist):
+			return err
+		}
+		routing.DataStreamStatements(idx.DataStreamOf(manifest), dataset, reroutes, fn)
+		return fs.SkipDir
+	})
+}
+
+// MLStatements calls fn on the statements constructed from the ML modules
+// held in the kibana/ml_module directories of the package(s) in fsys. The
+// index is not used.
+func MLStatements(ctx context.Context, fsys fs.FS, _ PackageIndex, fn func(*rdf.Statement, error)) error {
+	return fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		dir := path.Dir(name)
+		if path.Ext(name) != ".json" || path.Base(dir) != "ml_module" || path.Base(path.Dir(dir)) != "kibana" {
+			return nil
+		}
+		f, err := fsys.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		m, err := ml.Decode(f)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		ml.Statements(m, fn)
+		return nil
+	})
+}
+
+// TransformStatements calls fn on the statements constructed from the
+// transforms held in the elasticsearch/transform directories of the
+// package(s) in fsys in lexical order. Each transform is named for the
+// directory holding it. The index is not used.
+func TransformStatements(ctx context.Context, fsys fs.FS, _ PackageIndex, fn func(*rdf.Statement, error)) error {
+	return fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil || d.IsDir() || path.Base(name) != "transform.yml" {
+			return nil
+		}
+		dir := path.Dir(name)
+		if path.Base(path.Dir(dir)) != "transform" || path.Base(path.Dir(path.Dir(dir))) != "elasticsearch" {
+			return nil
+		}
+		f, err := fsys.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		t, err := transform.Decode(f)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		transform.Statements(path.Base(dir), t, fn)
+		return nil
+	})
+}
+
+// DocumentStatements calls fn on the statements constructed from the
+// sample and pipeline test expectation documents held in the package(s)
+// in fsys. Data streams are named by idx.
+func DocumentStatements(ctx context.Context, fsys fs.FS, idx PackageIndex, fn func(*rdf.Statement, error)) error {
+	return fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		base := path.Base(name)
+		if base != "sample_event.json" && !strings.HasSuffix(base, "-expected.json") {
+			return nil
+		}
+		f, err := fsys.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		found, err := document.Decode(f)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		dataStream := idx.DataStreamOf(name)
+		for _, doc := range found {
+			document.DataStreamStatements(dataStream, "", doc, fn)
+		}
+		return nil
+	})
+}
+
+// SavedObjectStatements calls fn on the statements constructed from the
+// Kibana saved objects held in the kibana directories of the package(s)
+// in fsys. The index is not used.
+func SavedObjectStatements(ctx context.Context, fsys fs.FS, _ PackageIndex, fn func(*rdf.Statement, error)) error {
+	return fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if path.Ext(name) != ".json" || path.Base(path.Dir(path.Dir(name))) != "kibana" {
+			return nil
+		}
+		f, err := fsys.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		obj, err := kibana.Decode(f)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		kibana.Statements(obj, fn)
+		return nil
+	})
+}
+
+// readManifest decodes the manifest with the slash-separated name in fsys
+// into dst. A missing manifest leaves dst unchanged.
+func readManifest(fsys fs.FS, name string, dst interface{}) error {
+	b, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	err = yaml.Unmarshal(b, dst)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+// Package graphml provides tools for serializing RDF statements as GraphML
+// for analysis in graph tools such as Gephi and yEd.
+package graphml
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"gonum.org/v1/gonum/graph/formats/rdf"
+
+	"github.com/efd6/ecsinrdf/term"
+	"github.com/efd6/ecsinrdf/vocab"
+)
+
+// attributes maps the predicates of statements that are written as node
+// attributes to the GraphML key of the attribute. Package fields declare
+// their type with <as:type> and ECS fields with <is:type>, so both are
+// written as the type attribute.
+var attributes = map[vocab.Predicate]string{
+	vocab.IsPath:      "path",
+	vocab.IsType:      "type",
+	vocab.AsType:      "type",
+	vocab.IsPublished: "published",
+}
+
+// keys holds the GraphML keys in the order they are declared.
+var keys = []struct {
+	id, typ string
+}{
+	{id: "path", typ: "string"},
+	{id: "type", typ: "string"},
+	{id: "published", typ: "boolean"},
+	{id: "predicate", typ: "string"},
+}
+
+// Encode writes the statements to w as a directed GraphML graph. Each
+// blank node and IRI is written as a node. The <is:path>, <is:type>,
+// <as:type> and <is:published> literals of a node are written as its path,
+// type and published attributes, with multiple distinct values joined by
+// commas, and each statement with a blank node or IRI object is written as
+// an edge with the statement's predicate as its predicate attribute. Other
+// statements with literal objects are omitted. Nodes and edges are sorted
+// so that the output is stable for a given set of statements. For example,
+// the statements
+//
+//  _:b0 <has:child> _:b1 .
+//  _:b1 <is:path> "source.ip" .
+//  _:b1 <is:type> "ip" .
+//
+// are encoded as the nodes and edge
+//
+//  <node id="_:b0"/>
+//  <node id="_:b1">
+//    <data key="path">source.ip</data>
+//    <data key="type">ip</data>
+//  </node>
+//  <edge source="_:b0" target="_:b1">
+//    <data key="predicate">has:child</data>
+//  </edge>
+//
+// with the key declarations and graph element around them. Graph labels
+// are not represented.
+func Encode(w io.Writer, statements []*rdf.Statement) error {
+	type edge struct {
+		from, to, pred string
+	}
+	nodes := make(map[string]map[string][]string)
+	node := func(n string) map[string][]string {
+		attrs, ok := nodes[n]
+		if !ok {
+			attrs = make(map[string][]string)
+			nodes[n] = attrs
+		}
+		return attrs
+	}
+	var edges []edge
+	for _, s := range statements {
+		attrs := node(s.Subject.Value)
+		_, _, kind, err := s.Object.Parts()
+		if err != nil {
+			return fmt.Errorf("%s: %w", s.Object.Value, err)
+		}
+		if kind != rdf.Literal {
+			node(s.Object.Value)
+			pred := strings.TrimSuffix(strings.TrimPrefix(s.Predicate.Value, "<"), ">")
+			edges = append(edges, edge{from: s.Subject.Value, to: s.Object.Value, pred: pred})
+			continue
+		}
+		key, ok := attributes[vocab.Of(s)]
+		if !ok {
+			continue
+		}
+		text, err := term.Text(s.Object.Value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", s, err)
+		}
+		attrs[key] = append(attrs[key], text)
+	}
+
+	ids := make([]string, 0, len(nodes))
+	for n := range nodes {
+		ids = append(ids, n)
+	}
+	sort.Strings(ids)
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].from != edges[j].from {
+			return edges[i].from < edges[j].from
+		}
+		if edges[i].to != edges[j].to {
+			return edges[i].to < edges[j].to
+		}
+		return edges[i].pred < edges[j].pred
+	})
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString(xml.Header)
+	bw.WriteString(`<graphml xmlns="http://graphml.graphdrawing.org/xmlns">` + "\n")
+	for _, k := range keys {
+		target := "node"
+		if k.id == "predicate" {
+			target = "edge"
+		}
+		fmt.Fprintf(bw, "  <key id=%q for=%q attr.name=%q attr.type=%q/>\n", k.id, target, k.id, k.typ)
+	}
+	bw.WriteString(`  <graph edgedefault="directed">` + "\n")
+	for _, n := range ids {
+		attrs := nodes[n]
+		if len(attrs) == 0 {
+			fmt.Fprintf(bw, "    <node id=\"%s\"/>\n", escape(n))
+			continue
+		}
+		fmt.Fprintf(bw, "    <node id=\"%s\">\n", escape(n))
+		for _, k := range keys {
+			vals := attrs[k.id]
+			if len(vals) == 0 {
+				continue
+			}
+			sort.Strings(vals)
+			uniq := vals[:1]
+			for _, v := range vals[1:] {
+				if v != uniq[len(uniq)-1] {
+					uniq = append(uniq, v)
+				}
+			}
+			vals = uniq
+			fmt.Fprintf(bw, "      <data key=%q>%s</data>\n", k.id, escape(strings.Join(vals, ",")))
+		}
+		bw.WriteString("    </node>\n")
+	}
+	for _, e := range edges {
+		fmt.Fprintf(bw, "    <edge source=\"%s\" target=\"%s\">\n", escape(e.from), escape(e.to))
+		fmt.Fprintf(bw, "      <data key=\"predicate\">%s</data>\n", escape(e.pred))
+		bw.WriteString("    </edge>\n")
+	}
+	bw.WriteString("  </graph>\n</graphml>\n")
+	return bw.Flush()
+}
+
+// escape returns s escaped for use as XML character data or as a quoted
+// attribute value.
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
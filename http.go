@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// httpServer hosts named graphs, each served by an rpcServer, over HTTP.
+// JSON-RPC requests are POSTed to /graphs/{name} and the response is
+// returned as the body of the reply. Package archives may be POSTed to
+// /check for analysis; see serveCheck.
+//
+// If token rules are configured, requests must carry a bearer token that
+// a rule permits for the named graph.
+//
+// Hosted graphs are managed by the server, so the initialize, shutdown and
+// rebuild methods are not permitted, and fieldAt only reads files within
+// the graph's package root.
+type httpServer struct {
+	base   *rpcServer
+	graphs map[string]*rpcServer
+	tokens []tokenRule
+	// validate specifies whether /check reports
+	// are validated against the report schema.
+	validate bool
+}
+
+// tokenRule is an access rule for a bearer token.
+type tokenRule struct {
+	// token is the bearer token.
+	token string
+	// graphs holds the names of graphs the token may
+	// access. The name "*" permits all graphs.
+	graphs []string
+}
+
+// newHTTPServer returns an httpServer hosting the graphs described by the
+// JSON object held in r. The object maps each graph name to the parameters
+// of an rpcServer initialize request. Each graph is built from base and
+// the provided parameters before newHTTPServer returns.
+func newHTTPServer(r io.Reader, base *rpcServer, tokens []tokenRule) (*httpServer, error) {
+	var params map[string]json.RawMessage
+	err := json.NewDecoder(r).Decode(&params)
+	if err != nil {
+		return nil, err
+	}
+	h := &httpServer{base: base, graphs: make(map[string]*rpcServer), tokens: tokens}
+	for name, p := range params {
+		srv := &rpcServer{cfg: base.cfg, exclude: base.exclude, limits: base.limits, rules: base.rules, packagePrefix: base.packagePrefix, metrics: base.metrics, confined: true}
+		_, rerr := srv.call(rpcRequest{JSONRPC: "2.0", Method: "initialize", Params: p})
+		if rerr != nil {
+			return nil, fmt.Errorf("%s: %v", name, rerr)
+		}
+		h.graphs[name] = srv
+	}
+	return h, nil
+}
+
+// parseTokens returns the token rules held in r. Each non-empty line holds
+// a token followed by the names of the graphs it may access separated by
+// white space. Text after a '#' is a comment.
+func parseTokens(r io.Reader) ([]tokenRule, error) {
+	var rules []tokenRule
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := sc.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		f := strings.Fields(line)
+		switch len(f) {
+		case 0:
+			continue
+		case 1:
+			return nil, fmt.Errorf("line %d: no graphs for token", n)
+		}
+		rules = append(rules, tokenRule{token: f[0], graphs: f[1:]})
+	}
+	return rules, sc.Err()
+}
+
+// permits returns whether the Authorization header value auth permits
+// access to the named graph.
+func (h *httpServer) permits(auth, name string) bool {
+	if h.tokens == nil {
+		return true
+	}
+	token := strings.TrimPrefix(auth, "Bearer ")
+	if token == auth || token == "" {
+		return false
+	}
+	for _, r := range h.tokens {
+		if subtle.ConstantTimeCompare([]byte(r.token), []byte(token)) != 1 {
+			continue
+		}
+		for _, g := range r.graphs {
+			if g == "*" || g == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (h *httpServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/graphs/")
+	if name == r.URL.Path || name == "" || strings.Contains(name, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.permits(r.Header.Get("Authorization"), name) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	srv, ok := h.graphs[name]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	resp := map[string]interface{}{"jsonrpc": "2.0"}
+	var req rpcRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		resp["id"] = nil
+		resp["error"] = &rpcError{Code: parseError, Message: err.Error()}
+	} else {
+		if req.Method == "initialize" || req.Method == "shutdown" || req.Method == "rebuild" {
+			// Hosted graphs are managed by the server,
+			// so tenants may not reconfigure, stop or
+			// rebuild them.
+			resp["id"] = req.ID
+			resp["error"] = &rpcError{Code: invalidRequest, Message: fmt.Sprintf("%s not permitted for hosted graphs", req.Method)}
+		} else {
+			result, rerr := srv.call(req)
+			if req.ID == nil {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			resp["id"] = req.ID
+			if rerr != nil {
+				resp["error"] = rerr
+			} else {
+				resp["result"] = result
+			}
+		}
+	}
+	b, err := json.Marshal(resp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
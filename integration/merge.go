@@ -0,0 +1,96 @@
+package integration
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Flatten returns the fields in schema, and all their descendants, with
+// names holding the full dotted path of the field and without child fields.
+// Fields are returned in the order their paths are first declared.
+//
+// Packages may declare the same field more than once, for example both as
+// a flat dotted name, a.b, and nested within the fields of its parent, a.
+// Duplicate declarations are merged into the first declaration of the path.
+// Attributes set in only one declaration are retained and a *ConflictError
+// is returned for each attribute that is set to different values, in which
+// case the first declaration's value is used.
+func Flatten(parent string, schema []Field) ([]Field, []error) {
+	var (
+		flat  []Field
+		index = make(map[string]int)
+		errs  []error
+	)
+	var walk func(parent string, schema []Field)
+	walk = func(parent string, schema []Field) {
+		for _, f := range schema {
+			if parent != "" {
+				f.Name = parent + "." + f.Name
+			}
+			children := f.Fields
+			f.Fields = nil
+			if i, ok := index[f.Name]; ok {
+				errs = append(errs, merge(&flat[i], f)...)
+			} else {
+				index[f.Name] = len(flat)
+				flat = append(flat, f)
+			}
+			walk(f.Name, children)
+		}
+	}
+	walk(parent, schema)
+	return flat, errs
+}
+
+// merge merges the attributes of the duplicate declaration src into dst,
+// returning an error for each conflicting attribute.
+func merge(dst *Field, src Field) []error {
+	var errs []error
+	d := reflect.ValueOf(dst).Elem()
+	s := reflect.ValueOf(src)
+	for i := 0; i < d.NumField(); i++ {
+		sf, df := s.Field(i), d.Field(i)
+		switch {
+		case sf.IsZero():
+		case df.IsZero():
+			df.Set(sf)
+		case !reflect.DeepEqual(df.Interface(), sf.Interface()):
+			attr := strings.Split(d.Type().Field(i).Tag.Get("yaml"), ",")[0]
+			errs = append(errs, &ConflictError{
+				Path:      dst.Name,
+				Attribute: attr,
+				First:     deref(df),
+				Second:    deref(sf),
+			})
+		}
+	}
+	return errs
+}
+
+// ConflictError is an attribute set to different values in duplicate
+// declarations of a field. It is a warning rather than an invalid
+// statement: the field's statements are still constructed, with the
+// first declaration's value.
+type ConflictError struct {
+	// Path is the full dotted path of the field.
+	Path string
+	// Attribute is the yaml name of the attribute.
+	Attribute string
+	// First and Second are the values of the
+	// attribute in the first declaration and in
+	// the conflicting declaration.
+	First, Second interface{}
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%s: conflicting %s in duplicate declarations: %v and %v", e.Path, e.Attribute, e.First, e.Second)
+}
+
+// deref returns the value held by v, following a non-nil pointer.
+func deref(v reflect.Value) interface{} {
+	if v.Kind() == reflect.Ptr {
+		return v.Elem().Interface()
+	}
+	return v.Interface()
+}
@@ -4,10 +4,20 @@ package integration
 
 import (
 	"crypto/sha1"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"hash"
+	"iter"
+	"net"
+	"strconv"
 	"strings"
+	"time"
 
 	"gonum.org/v1/gonum/graph/formats/rdf"
+
+	"github.com/efd6/ecsinrdf/term"
+	"github.com/efd6/ecsinrdf/vocab"
 )
 
 // integrationStatements calls fn on all RDF statements construct from data in the
@@ -31,55 +41,480 @@ import (
 // _:field <is:published> "true" .
 // _:field <external:type> "ecs" .
 //
-func Statements(parent string, schema []Field, fn func(*rdf.Statement, error)) {
-	h := sha1.New()
-	hash := func(s string) string {
-		h.Reset()
-		h.Write([]byte("package"))
-		h.Write([]byte(s))
-		return string(hex(h.Sum(nil)))
+// Fields without a type that are not defined externally may have a type
+// inferred from their example or value.
+//
+// _:field <inferred:type> "type" .
+//
+// Path elements that are a single "*" match any name. Nodes for these
+// elements are marked as wildcards.
+//
+// _:field <is:wildcard> "true" .
+//
+// Fields with mapping disabled, such as objects with enabled: false, are
+// marked so that data under them can be treated as intentionally unmapped.
+//
+// _:field <is:enabled> "false" .
+//
+// Object fields with an object_type are mapped by a dynamic template when
+// installed. The template's path_match pattern, the object type and the
+// optional match_mapping_type are recorded.
+//
+// _:field <is:path_match> "path.pattern.*" .
+// _:field <as:object_type> "type" .
+// _:field <is:match_mapping_type> "json_type" .
+//
+// Groups that are implied by the dotted path of a field but that are not
+// declared are marked as implicit.
+//
+// _:field <is:implicit> "true" .
+//
+// The presence of documentation metadata, and the unit, metric type and
+// dimension status of fields are also recorded.
+//
+// _:field <has:description> "true" .
+// _:field <is:description> "description" .
+// _:field <has:example> "true" .
+// _:field <is:example> "example" .
+// _:field <as:unit> "unit" .
+// _:field <as:metric_type> "metric_type" .
+// _:field <is:dimension> "true" .
+//
+// Fields with a list example, including an example written as a JSON
+// array as ECS writes them, are marked as arrays, as ECS marks fields
+// normalized to arrays.
+//
+// _:field <is:normalized> "array" .
+//
+// Analysis settings of fields and multi-fields are recorded when they are
+// set.
+//
+// _:field <as:analyzer> "analyzer" .
+// _:field <as:search_analyzer> "analyzer" .
+// _:field <is:norms> "true" .
+//
+// The lifecycle of fields is recorded from the versions at which they were
+// deprecated and are to be removed.
+//
+// _:field <deprecated:in> "version" .
+// _:field <removed:in> "version" .
+//
+// Duplicate declarations of a field are merged as described by Flatten and
+// fn is called with a nil statement and an error wrapping a *ConflictError
+// for each conflicting attribute. Conflicts do not omit statements.
+//
+// The options may omit families of predicates and change the construction
+// of the blank node labels of field nodes.
+func Statements(parent string, schema []Field, fn func(*rdf.Statement, error), opts ...Option) {
+	statements(Source{}, parent, schema, fn, opts)
+}
+
+// All returns an iterator over the statements constructed by Statements
+// from the schema with the provided parent. Invalid statements and
+// conflicting attributes are yielded with a nil statement and an error.
+//
+// Statements are constructed as they are yielded, so breaking out of the
+// iteration ends construction before the next field.
+func All(parent string, schema []Field, opts ...Option) iter.Seq2[*rdf.Statement, error] {
+	return func(yield func(*rdf.Statement, error) bool) {
+		var done bool
+		opts = append(opts[:len(opts):len(opts)], stopWhen(func() bool { return done }))
+		Statements(parent, schema, func(s *rdf.Statement, err error) {
+			if !done {
+				done = !yield(s, err)
+			}
+		}, opts...)
 	}
-	for _, props := range schema {
-		if parent != "" {
-			props.Name = parent + "." + props.Name
+}
+
+// Collect returns the statements constructed by Statements from the schema
+// with the provided parent and the errors for invalid statements and
+// conflicting attributes joined with errors.Join. Errors for invalid
+// statements of a field are *term.FieldError values holding the field's
+// path, and errors for conflicting attributes wrap *ConflictError values.
+// The valid statements are returned even when the error is not nil.
+func Collect(parent string, schema []Field, opts ...Option) ([]*rdf.Statement, error) {
+	var (
+		statements []*rdf.Statement
+		errs       []error
+	)
+	Statements(parent, schema, func(s *rdf.Statement, err error) {
+		if err != nil {
+			errs = append(errs, err)
+			return
 		}
-		Statements(props.Name, props.Fields, fn)
+		statements = append(statements, s)
+	}, opts...)
+	return statements, errors.Join(errs...)
+}
+
+// DataStreamStatements calls fn on all RDF statements construct from data
+// in the provided package field metadata for the named data stream.
+//
+// The statements are the same as those constructed by Statements, but field
+// nodes are distinct for each data stream and are linked to a data stream
+// context node.
+//
+// _:field <in:data_stream> _:context .
+// _:context <is:data_stream> "data_stream" .
+//
+func DataStreamStatements(dataStream, parent string, schema []Field, fn func(*rdf.Statement, error), opts ...Option) {
+	statements(Source{DataStream: dataStream}, parent, schema, fn, opts)
+}
+
+// Source is the origin of package field metadata.
+type Source struct {
+	// Package is the name of the package holding
+	// the fields. It is empty if field nodes are
+	// not distinct for each package.
+	Package string
+	// DataStream is the name of the data stream holding
+	// the fields. It is empty for package-level fields.
+	DataStream string
+	// File is the path to the fields file. It is
+	// hashed into field node labels, so it should be
+	// relative to the package root for labels that
+	// do not depend on where the package is.
+	File string
+	// Lines holds the line of the declaration of each
+	// field in the file, keyed by full dotted path.
+	Lines map[string]int
+}
+
+// SourceStatements calls fn on all RDF statements construct from data in
+// the provided package field metadata read from src.
+//
+// The statements are the same as those constructed by DataStreamStatements
+// for the source's data stream, but field nodes are distinct for each file
+// and are linked to the file that defines them. If the source names its
+// package, field nodes are also distinct for each package. The labels of
+// field nodes are given by Label.
+//
+// _:field <defined:in> "path/to/fields.yml" .
+//
+// If the source has line information, declared fields are also linked to
+// the line of their declaration.
+//
+// _:field <defined:at> "line" .
+//
+func SourceStatements(src Source, parent string, schema []Field, fn func(*rdf.Statement, error), opts ...Option) {
+	statements(src, parent, schema, fn, opts)
+}
 
+// Label returns the blank node label, without its "_:" prefix, of the
+// field node with the full dotted path in the statements constructed from
+// src with the options. Only the Namespace and Hash options change labels.
+//
+// The label is the lower case hex encoding of the hash of the namespace
+// followed by each non-empty element of the source's package name, data
+// stream and file, each terminated by a zero byte, and then the path.
+// Sources that differ in any of these elements do not share field nodes,
+// so setting the package name of sources keeps the fields of packages
+// that define the same path distinct.
+func Label(src Source, path string, opts ...Option) string {
+	cfg := newConfig(opts)
+	return label(cfg.hash(), cfg.namespace, src, path)
+}
+
+func label(h hash.Hash, namespace string, src Source, path string) string {
+	h.Reset()
+	h.Write([]byte(namespace))
+	for _, e := range []string{src.Package, src.DataStream, src.File} {
+		if e != "" {
+			h.Write([]byte(e))
+			h.Write([]byte{0})
+		}
+	}
+	h.Write([]byte(path))
+	return string(hex(h.Sum(nil)))
+}
+
+// ContextLabel returns the blank node label, without its "_:" prefix, of
+// the context node of the named data stream. The label is the lower case
+// hex encoding of the SHA-1 hash of "data_stream" followed by the name,
+// and is shared with the other sources of data stream statements.
+func ContextLabel(dataStream string) string {
+	return contextHash(dataStream)
+}
+
+// wildcard is the path element that matches any name.
+const wildcard = "*"
+
+func statements(src Source, parent string, schema []Field, fn func(*rdf.Statement, error), opts []Option) {
+	cfg := newConfig(opts)
+	fn = cfg.filter(fn)
+	h := cfg.hash()
+	hash := func(s string) string {
+		return label(h, cfg.namespace, src, s)
+	}
+	var hashContext string
+	var links []func(node string)
+	if src.DataStream != "" {
+		hashContext = contextHash(src.DataStream)
+		links = append(links, func(node string) {
+			fn(term.Triple(term.Blank(node), vocab.InDataStream.Term(), term.Blank(hashContext)), nil)
+		})
+		fn(term.Triple(term.Blank(hashContext), vocab.IsDataStream.Term(), term.LiteralTerm(src.DataStream)), nil)
+	}
+	if src.File != "" {
+		file := term.LiteralTerm(src.File)
+		links = append(links, func(node string) {
+			fn(term.Triple(term.Blank(node), vocab.DefinedIn.Term(), file), nil)
+		})
+	}
+	source := func(node string) {
+		for _, link := range links {
+			link(node)
+		}
+	}
+	fields, errs := Flatten(parent, schema)
+	for _, err := range errs {
+		if cfg.stopped() {
+			return
+		}
+		if src.File != "" {
+			err = fmt.Errorf("%s: %w", src.File, err)
+		}
+		fn(nil, err)
+	}
+	declared := make(map[string]bool, len(fields))
+	for _, props := range fields {
+		declared[props.Name] = true
+	}
+	for _, props := range fields {
+		if cfg.stopped() {
+			return
+		}
+		fn := fieldErrors(props.Name, fn)
 		path := strings.Split(props.Name, ".")
 		for i := range path[1:] {
 			sub := strings.Join(path[:i+1], ".")
 			hashSub := hash(sub)
 			obj := strings.Join(path[:i+2], ".")
 			hashObj := hash(obj)
-			fn(constructTriple(`_:%s <is:published> "true" .`, hashSub))
-			fn(constructTriple(`_:%s <as:type> "group" .`, hashSub))
-			fn(constructTriple(`_:%s <is:name> %q .`, hashSub, path[i]))
-			fn(constructTriple(`_:%s <is:path> %q .`, hashSub, sub))
-			fn(constructTriple(`_:%s <has:child> _:%s .`, hashSub, hashObj))
+			fn(term.Triple(term.Blank(hashSub), vocab.IsPublished.Term(), term.LiteralTerm("true")), nil)
+			fn(term.Triple(term.Blank(hashSub), vocab.AsType.Term(), term.LiteralTerm("group")), nil)
+			fn(term.Triple(term.Blank(hashSub), vocab.IsName.Term(), term.LiteralTerm(path[i])), nil)
+			fn(term.Triple(term.Blank(hashSub), vocab.IsPath.Term(), term.LiteralTerm(sub)), nil)
+			fn(term.Triple(term.Blank(hashSub), vocab.HasChild.Term(), term.Blank(hashObj)), nil)
+			if path[i] == wildcard {
+				fn(term.Triple(term.Blank(hashSub), vocab.IsWildcard.Term(), term.LiteralTerm("true")), nil)
+			}
+			if !declared[sub] {
+				fn(term.Triple(term.Blank(hashSub), vocab.IsImplicit.Term(), term.LiteralTerm("true")), nil)
+			}
+			source(hashSub)
 		}
 		hashField := hash(props.Name)
-		fn(constructTriple(`_:%s <is:published> "true" .`, hashField))
-		fn(constructTriple(`_:%s <is:name> %q .`, hashField, path[len(path)-1]))
-		fn(constructTriple(`_:%s <is:path> %q .`, hashField, props.Name))
+		source(hashField)
+		if line, ok := src.Lines[props.Name]; ok {
+			fn(term.Triple(term.Blank(hashField), vocab.DefinedAt.Term(), term.LiteralTerm(strconv.Itoa(line))), nil)
+		}
+		fn(term.Triple(term.Blank(hashField), vocab.IsPublished.Term(), term.LiteralTerm("true")), nil)
+		fn(term.Triple(term.Blank(hashField), vocab.IsName.Term(), term.LiteralTerm(path[len(path)-1])), nil)
+		if path[len(path)-1] == wildcard {
+			fn(term.Triple(term.Blank(hashField), vocab.IsWildcard.Term(), term.LiteralTerm("true")), nil)
+		}
+		fn(term.Triple(term.Blank(hashField), vocab.IsPath.Term(), term.LiteralTerm(props.Name)), nil)
 		if props.External != "" {
-			fn(constructTriple(`_:%s <external:type> %q .`, hashField, props.External))
+			fn(term.Triple(term.Blank(hashField), vocab.ExternalType.Term(), term.LiteralTerm(props.External)), nil)
 		}
 		if props.Type != "" {
-			fn(constructTriple(`_:%s <as:type> %q .`, hashField, props.Type))
+			fn(term.Triple(term.Blank(hashField), vocab.AsType.Term(), term.LiteralTerm(props.Type)), nil)
+		}
+		if props.Description != "" {
+			fn(term.Triple(term.Blank(hashField), vocab.HasDescription.Term(), term.LiteralTerm("true")), nil)
+			fn(term.Triple(term.Blank(hashField), vocab.IsDescription.Term(), term.LiteralTerm(props.Description)), nil)
+		}
+		if props.Example != nil {
+			fn(term.Triple(term.Blank(hashField), vocab.HasExample.Term(), term.LiteralTerm("true")), nil)
+			for _, ex := range exampleValues(props.Example) {
+				fn(term.Triple(term.Blank(hashField), vocab.IsExample.Term(), term.LiteralTerm(ex)), nil)
+			}
+			if arrayExample(props.Example) {
+				fn(term.Triple(term.Blank(hashField), vocab.IsNormalized.Term(), term.LiteralTerm("array")), nil)
+			}
+		}
+		if props.Unit != "" {
+			fn(term.Triple(term.Blank(hashField), vocab.AsUnit.Term(), term.LiteralTerm(props.Unit)), nil)
+		}
+		if props.MetricType != "" {
+			fn(term.Triple(term.Blank(hashField), vocab.AsMetricType.Term(), term.LiteralTerm(props.MetricType)), nil)
+		}
+		if props.Dimension != nil && *props.Dimension {
+			fn(term.Triple(term.Blank(hashField), vocab.IsDimension.Term(), term.LiteralTerm("true")), nil)
+		}
+		if props.Analyzer != "" {
+			fn(term.Triple(term.Blank(hashField), vocab.AsAnalyzer.Term(), term.LiteralTerm(props.Analyzer)), nil)
+		}
+		if props.SearchAnalyzer != "" {
+			fn(term.Triple(term.Blank(hashField), vocab.AsSearchAnalyzer.Term(), term.LiteralTerm(props.SearchAnalyzer)), nil)
+		}
+		if props.Norms {
+			fn(term.Triple(term.Blank(hashField), vocab.IsNorms.Term(), term.LiteralTerm("true")), nil)
+		}
+		if props.Deprecated != "" {
+			fn(term.Triple(term.Blank(hashField), vocab.DeprecatedIn.Term(), term.LiteralTerm(props.Deprecated)), nil)
+		}
+		if props.Removed != "" {
+			fn(term.Triple(term.Blank(hashField), vocab.RemovedIn.Term(), term.LiteralTerm(props.Removed)), nil)
+		}
+		if props.Type == "" && props.External == "" {
+			typ := InferType(props.Example)
+			if typ == "" && props.Value != "" {
+				typ = InferType(props.Value)
+			}
+			if typ != "" {
+				fn(term.Triple(term.Blank(hashField), vocab.InferredType.Term(), term.LiteralTerm(typ)), nil)
+			}
+		}
+		if props.ObjectType != "" {
+			// Fleet uses the field name as the path_match
+			// pattern, matching all children of the object
+			// unless a wildcard is given.
+			pattern := props.Name
+			if !strings.Contains(pattern, "*") {
+				pattern += ".*"
+			}
+			fn(term.Triple(term.Blank(hashField), vocab.IsPathMatch.Term(), term.LiteralTerm(pattern)), nil)
+			fn(term.Triple(term.Blank(hashField), vocab.AsObjectType.Term(), term.LiteralTerm(props.ObjectType)), nil)
+			if props.ObjectTypeMappingType != "" {
+				fn(term.Triple(term.Blank(hashField), vocab.IsMatchMappingType.Term(), term.LiteralTerm(props.ObjectTypeMappingType)), nil)
+			}
+		}
+		if props.Enabled != nil && !*props.Enabled {
+			fn(term.Triple(term.Blank(hashField), vocab.IsEnabled.Term(), term.LiteralTerm("false")), nil)
+		}
+		if cfg.omit[MultiFields] {
+			continue
 		}
 		for _, m := range props.MultiFields {
-			hashSub := hash(m.Name)
 			flatName := props.Name + "." + m.Name
 			hashFlat := hash(flatName)
-			fn(constructTriple(`_:%s <has:multi> _:%s .`, hashSub, hashFlat))
-			fn(constructTriple(`_:%s <is:published> "true" .`, hashFlat))
-			fn(constructTriple(`_:%s <as:type> %q .`, hashFlat, m.Type))
-			fn(constructTriple(`_:%s <is:name> %q .`, hashFlat, m.Name))
-			fn(constructTriple(`_:%s <is:path> %q .`, hashFlat, flatName))
+			fn(term.Triple(term.Blank(hashField), vocab.HasMulti.Term(), term.Blank(hashFlat)), nil)
+			fn(term.Triple(term.Blank(hashFlat), vocab.IsPublished.Term(), term.LiteralTerm("true")), nil)
+			fn(term.Triple(term.Blank(hashFlat), vocab.AsType.Term(), term.LiteralTerm(m.Type)), nil)
+			fn(term.Triple(term.Blank(hashFlat), vocab.IsName.Term(), term.LiteralTerm(m.Name)), nil)
+			fn(term.Triple(term.Blank(hashFlat), vocab.IsPath.Term(), term.LiteralTerm(flatName)), nil)
+			if m.Analyzer != "" {
+				fn(term.Triple(term.Blank(hashFlat), vocab.AsAnalyzer.Term(), term.LiteralTerm(m.Analyzer)), nil)
+			}
+			if m.Norms {
+				fn(term.Triple(term.Blank(hashFlat), vocab.IsNorms.Term(), term.LiteralTerm("true")), nil)
+			}
+			source(hashFlat)
 		}
 	}
 }
 
+// InferType returns a probable field type for the example value v. It
+// returns "ip", "date", "long", "double" or "boolean" when v is, or is a
+// string representation of, a value of that type, and the empty string
+// otherwise.
+func InferType(v interface{}) string {
+	switch v := v.(type) {
+	case bool:
+		return "boolean"
+	case int, int64, uint64:
+		return "long"
+	case float64:
+		return "double"
+	case time.Time:
+		return "date"
+	case string:
+		v = strings.TrimSpace(v)
+		if net.ParseIP(v) != nil {
+			return "ip"
+		}
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999", "2006-01-02 15:04:05"} {
+			if _, err := time.Parse(layout, v); err == nil {
+				return "date"
+			}
+		}
+		if _, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return "long"
+		}
+		if _, err := strconv.ParseFloat(v, 64); err == nil {
+			return "double"
+		}
+		if v == "true" || v == "false" {
+			return "boolean"
+		}
+	}
+	return ""
+}
+
+// exampleValues returns the text of the example value v. Each element of a
+// list example is returned separately. Packages declare examples with any
+// YAML type while ECS declares them as strings, writing array examples as
+// JSON text, so string examples holding a JSON array are also split into
+// their elements, giving the same values as the ECS statements.
+func exampleValues(v interface{}) []string {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case string:
+		if !strings.HasPrefix(strings.TrimSpace(v), "[") {
+			return []string{v}
+		}
+		dec := json.NewDecoder(strings.NewReader(v))
+		dec.UseNumber()
+		var elems []interface{}
+		if dec.Decode(&elems) != nil || dec.More() {
+			return []string{v}
+		}
+		return exampleValues(elems)
+	case []interface{}:
+		var vals []string
+		for _, e := range v {
+			vals = append(vals, exampleValues(e)...)
+		}
+		return vals
+	case map[string]interface{}:
+		// Object examples have no single value.
+		return nil
+	case json.Number:
+		return []string{v.String()}
+	case time.Time:
+		return []string{v.Format(time.RFC3339Nano)}
+	default:
+		return []string{fmt.Sprint(v)}
+	}
+}
+
+// arrayExample returns whether the example value v is an array, either as
+// a list or as a string holding a JSON array.
+func arrayExample(v interface{}) bool {
+	switch v := v.(type) {
+	case []interface{}:
+		return true
+	case string:
+		var elems []interface{}
+		return strings.HasPrefix(strings.TrimSpace(v), "[") && json.Unmarshal([]byte(v), &elems) == nil
+	default:
+		return false
+	}
+}
+
+// contextHash returns the blank node label for the named data stream
+// context. The label is shared with other sources of data stream
+// statements.
+func contextHash(dataStream string) string {
+	h := sha1.Sum([]byte("data_stream" + dataStream))
+	return string(hex(h[:]))
+}
+
+// fieldErrors returns a statement callback that calls fn with errors
+// wrapped in a *term.FieldError for the field with the full dotted path.
+func fieldErrors(path string, fn func(*rdf.Statement, error)) func(*rdf.Statement, error) {
+	return func(s *rdf.Statement, err error) {
+		if err != nil {
+			err = &term.FieldError{Path: path, Err: err}
+		}
+		fn(s, err)
+	}
+}
+
 func hex(data []byte) []byte {
 	const digit = "0123456789abcdef"
 	buf := make([]byte, 0, len(data)*2)
@@ -89,15 +524,6 @@ func hex(data []byte) []byte {
 	return buf
 }
 
-func constructTriple(format string, a ...interface{}) (*rdf.Statement, error) {
-	formatted := fmt.Sprintf(format, a...)
-	s, err := rdf.ParseNQuad(formatted)
-	if err != nil {
-		return nil, fmt.Errorf("%#q: %v", formatted, err)
-	}
-	return s, nil
-}
-
 type Field struct {
 	Name           string       `yaml:"name"`
 	Type           string       `yaml:"type"`
@@ -179,6 +605,8 @@ type Field struct {
 	PossibleValues []string `yaml:"possible_values,omitempty"`
 	// The version when the field was deprecated.
 	Deprecated string `yaml:"deprecated,omitempty"`
+	// The version when the field is to be removed.
+	Removed string `yaml:"removed,omitempty"`
 	// Same as Prefix in Properties?
 	Prefix string `yaml:"prefix,omitempty"`
 
@@ -0,0 +1,86 @@
+package integration
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"hash"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// countingHash counts the writes to a hash.
+type countingHash struct {
+	hash.Hash
+	writes *int
+}
+
+func (h countingHash) Write(p []byte) (int, error) {
+	*h.writes++
+	return h.Hash.Write(p)
+}
+
+func TestAllStopsEarly(t *testing.T) {
+	var fields []Field
+	for i := 0; i < 100; i++ {
+		fields = append(fields, Field{Name: fmt.Sprintf("group.field%d", i), Type: "keyword"})
+	}
+
+	var all, early int
+	for _, test := range []struct {
+		writes *int
+		limit  int
+	}{
+		{writes: &all, limit: -1},
+		{writes: &early, limit: 1},
+	} {
+		writes := test.writes
+		counted := Hash(func() hash.Hash { return countingHash{sha1.New(), writes} })
+		var n int
+		for _, err := range All("", fields, counted) {
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			n++
+			if n == test.limit {
+				break
+			}
+		}
+	}
+	if early == 0 || early*10 > all {
+		t.Errorf("construction did not stop early: %d hash writes after break, %d in full", early, all)
+	}
+}
+
+var inferTypeTests = []struct {
+	example string
+	want    string
+}{
+	{example: `2021-01-01T00:00:00Z`, want: "date"},
+	{example: `2021-01-01`, want: "date"},
+	{example: `"2021-01-01T00:00:00.000Z"`, want: "date"},
+	{example: `"2021-01-01 10:20:30"`, want: "date"},
+	{example: `10.1.2.3`, want: "ip"},
+	{example: `"::1"`, want: "ip"},
+	{example: `42`, want: "long"},
+	{example: `"42"`, want: "long"},
+	{example: `4.2`, want: "double"},
+	{example: `true`, want: "boolean"},
+	{example: `"false"`, want: "boolean"},
+	{example: `hello`, want: ""},
+	{example: `[1, 2]`, want: ""},
+}
+
+func TestInferType(t *testing.T) {
+	for _, test := range inferTypeTests {
+		var f Field
+		err := yaml.Unmarshal([]byte("name: a\nexample: "+test.example), &f)
+		if err != nil {
+			t.Fatalf("unexpected error decoding %s: %v", test.example, err)
+		}
+		got := InferType(f.Example)
+		if got != test.want {
+			t.Errorf("unexpected type for %s (%T): got:%q want:%q", test.example, f.Example, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package integration
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// PathAt returns the full dotted path of the innermost field whose
+// definition encloses the byte offset in the fields file held in src. A
+// field's definition extends from its first line to the last line of its
+// attributes and child fields. If no field encloses the offset, PathAt
+// returns false.
+func PathAt(src []byte, offset int) (path string, ok bool, err error) {
+	if offset < 0 || offset > len(src) {
+		return "", false, errors.New("offset out of range")
+	}
+	line := 1 + strings.Count(string(src[:offset]), "\n")
+
+	var doc yaml.Node
+	err = yaml.Unmarshal(src, &doc)
+	if err != nil {
+		return "", false, err
+	}
+	if len(doc.Content) == 0 {
+		return "", false, nil
+	}
+	var spans []span
+	collectSpans(doc.Content[0], "", 0, &spans)
+	sort.SliceStable(spans, func(i, j int) bool { return spans[i].depth > spans[j].depth })
+	for _, s := range spans {
+		if s.first <= line && line <= s.last {
+			return s.path, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// LinesOf returns the line of the first declaration of each field in the
+// fields file held in src, keyed by full dotted path.
+func LinesOf(src []byte) (map[string]int, error) {
+	var doc yaml.Node
+	err := yaml.Unmarshal(src, &doc)
+	if err != nil {
+		return nil, err
+	}
+	lines := make(map[string]int)
+	if len(doc.Content) == 0 {
+		return lines, nil
+	}
+	var spans []span
+	collectSpans(doc.Content[0], "", 0, &spans)
+	for _, s := range spans {
+		if _, ok := lines[s.path]; !ok {
+			lines[s.path] = s.first
+		}
+	}
+	return lines, nil
+}
+
+// span is the line extent of a field definition.
+type span struct {
+	path        string
+	depth       int
+	first, last int
+}
+
+// collectSpans appends the spans of the fields in the field sequence seq,
+// whose fields are under the path parent, to dst.
+func collectSpans(seq *yaml.Node, parent string, depth int, dst *[]span) {
+	if seq.Kind != yaml.SequenceNode {
+		return
+	}
+	for _, item := range seq.Content {
+		if item.Kind != yaml.MappingNode {
+			continue
+		}
+		var name string
+		var children *yaml.Node
+		for i := 0; i+1 < len(item.Content); i += 2 {
+			switch item.Content[i].Value {
+			case "name":
+				name = item.Content[i+1].Value
+			case "fields":
+				children = item.Content[i+1]
+			}
+		}
+		if name == "" {
+			continue
+		}
+		if parent != "" {
+			name = parent + "." + name
+		}
+		*dst = append(*dst, span{path: name, depth: depth, first: item.Line, last: lastLine(item)})
+		if children != nil {
+			collectSpans(children, name, depth+1, dst)
+		}
+	}
+}
+
+// lastLine returns the last line occupied by n and its descendants.
+func lastLine(n *yaml.Node) int {
+	last := n.Line
+	if n.Kind == yaml.ScalarNode && (n.Style&(yaml.LiteralStyle|yaml.FoldedStyle)) != 0 {
+		// Block scalars start on the line after their
+		// indicator.
+		last += strings.Count(strings.TrimRight(n.Value, "\n"), "\n") + 1
+	}
+	for _, c := range n.Content {
+		if l := lastLine(c); l > last {
+			last = l
+		}
+	}
+	return last
+}
@@ -0,0 +1,80 @@
+package integration
+
+import (
+	"gonum.org/v1/gonum/graph/formats/rdf"
+
+	"github.com/efd6/ecsinrdf/vocab"
+)
+
+// PruneGroupChains returns statements with chains of package group nodes
+// that have a single child collapsed. The is:name and has:child statements
+// of collapsed groups are removed and the nearest retained ancestor is
+// linked to the chain's final node with a has:descendant statement.
+//
+// _:field <has:descendant> _:descendant .
+//
+// Collapsed groups retain their other statements, including their path, so
+// they can still be found by path. Wildcard groups and groups without a
+// parent are never collapsed. Statements are expected to have been
+// constructed by Statements or DataStreamStatements and not yet
+// canonicalized. The ordering of the retained statements is preserved and
+// the backing array of statements is reused.
+func PruneGroupChains(statements []*rdf.Statement) []*rdf.Statement {
+	groups := make(map[string]bool)
+	wild := make(map[string]bool)
+	children := make(map[string]map[string]bool)
+	parents := make(map[string]map[string]bool)
+	for _, s := range statements {
+		subj, obj := s.Subject.Value, s.Object.Value
+		switch vocab.Of(s) {
+		case vocab.AsType:
+			if obj == vocab.Group {
+				groups[subj] = true
+			}
+		case vocab.IsWildcard:
+			wild[subj] = true
+		case vocab.HasChild:
+			if children[subj] == nil {
+				children[subj] = make(map[string]bool)
+			}
+			children[subj][obj] = true
+			if parents[obj] == nil {
+				parents[obj] = make(map[string]bool)
+			}
+			parents[obj][subj] = true
+		}
+	}
+	prunable := func(n string) bool {
+		return groups[n] && !wild[n] && len(children[n]) == 1 && len(parents[n]) == 1
+	}
+	only := func(set map[string]bool) string {
+		for n := range set {
+			return n
+		}
+		return ""
+	}
+
+	pruned := statements[:0]
+	var collapsed []*rdf.Statement
+	for _, s := range statements {
+		subj, pred, obj := s.Subject.Value, vocab.Of(s), s.Object.Value
+		switch {
+		case prunable(subj) && (pred == vocab.IsName || pred == vocab.HasChild):
+			continue
+		case pred == vocab.HasChild && prunable(obj):
+			// Follow the chain to its end and link the
+			// retained parent to the final node once.
+			for prunable(obj) {
+				obj = only(children[obj])
+			}
+			collapsed = append(collapsed, &rdf.Statement{
+				Subject:   s.Subject,
+				Predicate: vocab.HasDescendant.Term(),
+				Object:    rdf.Term{Value: obj},
+			})
+			continue
+		}
+		pruned = append(pruned, s)
+	}
+	return append(pruned, collapsed...)
+}
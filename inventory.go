@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+	"strings"
+
+	"gonum.org/v1/gonum/graph/formats/rdf"
+
+	"github.com/efd6/ecsinrdf/vocab"
+)
+
+// inventoryHeader holds the column names of a field inventory.
+var inventoryHeader = []string{"path", "name", "type", "published", "external", "source", "data_stream", "ecs_version"}
+
+// writeInventory writes an inventory of the ECS and package fields in g to
+// w as delimited text with the provided field delimiter, one row per field
+// node with a header row naming the columns in inventoryHeader. The source
+// column is ecs for ECS fields and package for package fields. The
+// data_stream column is only set for package fields and the ecs_version
+// column is only set for ECS fields of a graph built with its version.
+// Columns with more than one value hold the values joined by commas. Rows
+// are sorted by source, path, data stream and version.
+func writeInventory(w io.Writer, g *rdf.Graph, comma rune) error {
+	var rows [][]string
+	seen := make(map[rdf.Term]bool)
+	for it := g.AllStatements(); it.Next(); {
+		s := it.Statement()
+		if !vocab.IsName.Match(s) || seen[s.Subject] {
+			continue
+		}
+		seen[s.Subject] = true
+		values := make(map[vocab.Predicate][]string)
+		for to := g.FromSubject(s.Subject); to.Next(); {
+			o := to.Node().(rdf.Term)
+			for st := g.Statements(s.Subject.ID(), o.ID()); st.Next(); {
+				p := vocab.Of(st.Statement())
+				values[p] = append(values[p], o.Value)
+			}
+		}
+		for _, ds := range g.Query(s.Subject).Out(vocab.InDataStream.Match).Out(vocab.IsDataStream.Match).Unique().Result() {
+			values[vocab.IsDataStream] = append(values[vocab.IsDataStream], ds.Value)
+		}
+		source := "package"
+		if len(values[vocab.IsType]) != 0 {
+			source = "ecs"
+		}
+		var err error
+		value := func(predicates ...vocab.Predicate) string {
+			if err != nil {
+				return ""
+			}
+			var lits []string
+			for _, p := range predicates {
+				lits = append(lits, values[p]...)
+			}
+			var v string
+			v, err = inventoryValue(lits)
+			return v
+		}
+		row := []string{
+			value(vocab.IsPath),
+			value(vocab.IsName),
+			value(vocab.IsType, vocab.AsType),
+			value(vocab.IsPublished),
+			value(vocab.ExternalType),
+			source,
+			value(vocab.IsDataStream),
+			value(vocab.InVersion),
+		}
+		if err != nil {
+			return err
+		}
+		rows = append(rows, row)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		for _, c := range []int{5, 0, 6, 7} {
+			if rows[i][c] != rows[j][c] {
+				return rows[i][c] < rows[j][c]
+			}
+		}
+		return false
+	})
+
+	cw := csv.NewWriter(w)
+	cw.Comma = comma
+	cw.Write(inventoryHeader)
+	for _, r := range rows {
+		cw.Write(r)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// inventoryValue returns the unquoted values joined by commas in lexical
+// order, with duplicates removed.
+func inventoryValue(values []string) (string, error) {
+	text, err := unquote(values)
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(text)
+	var uniq []string
+	for i, t := range text {
+		if i == 0 || t != text[i-1] {
+			uniq = append(uniq, t)
+		}
+	}
+	return strings.Join(uniq, ","), nil
+}
@@ -0,0 +1,247 @@
+// Package jsonld provides tools for serializing RDF statements as JSON-LD.
+package jsonld
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"gonum.org/v1/gonum/graph/formats/rdf"
+)
+
+// Encode writes the statements to w as a JSON-LD document. Statements are
+// grouped by subject into node objects in a top-level @graph, and statements
+// with a graph label are grouped into named graphs. The node objects, their
+// properties and property values are sorted so that the output is stable for
+// a given set of statements.
+//
+// The document's @context is generated from the predicates of the statements.
+// Each predicate namespace, for example is: in
+//
+//  _:b0 <is:path> "source.ip" .
+//
+// is declared as a prefix so that properties may be written as compact IRIs,
+// and predicates whose objects are all IRIs or blank nodes are declared with
+// @id type coercion, so the statements
+//
+//  _:b0 <is:path> "source.ip" .
+//  _:b0 <has:child> _:b1 .
+//
+// are encoded with the context
+//
+//  {"has": "has:", "has:child": {"@type": "@id"}, "is": "is:"}
+//
+// as the node object
+//
+//  {"@id": "_:b0", "has:child": "_:b1", "is:path": "source.ip"}
+//
+// Predicates in namespaces ending with a fragment separator, such as
+// <https://ecsinrdf.dev/ns/is#path>, are given the last element of the
+// namespace path as their prefix, so they are written with the same
+// compact IRIs and the context
+//
+//  {"has": "https://ecsinrdf.dev/ns/has#", ..., "is": "https://ecsinrdf.dev/ns/is#"}
+func Encode(w io.Writer, statements []*rdf.Statement) error {
+	// Prefixes that would name more than one
+	// namespace are not used.
+	prefixes := make(map[string]string)
+	for _, s := range statements {
+		pred, _, kind, err := s.Predicate.Parts()
+		if err != nil {
+			return fmt.Errorf("%s: %w", s.Predicate.Value, err)
+		}
+		if kind != rdf.IRI {
+			return fmt.Errorf("%s: predicate is not an IRI", s.Predicate.Value)
+		}
+		if prefix, ns, _, ok := namespace(pred); ok {
+			if declared, ok := prefixes[prefix]; ok && declared != ns {
+				ns = ""
+			}
+			prefixes[prefix] = ns
+		}
+	}
+	ctx := make(map[string]interface{})
+	for prefix, ns := range prefixes {
+		if ns != "" {
+			ctx[prefix] = ns
+		}
+	}
+	compact := func(pred string) string {
+		prefix, ns, local, ok := namespace(pred)
+		if !ok || prefixes[prefix] != ns {
+			return pred
+		}
+		return prefix + ":" + local
+	}
+
+	coerce := make(map[string]bool)
+	for _, s := range statements {
+		pred, _, _, _ := s.Predicate.Parts()
+		pred = compact(pred)
+		_, _, kind, err := s.Object.Parts()
+		if err != nil {
+			return fmt.Errorf("%s: %w", s.Object.Value, err)
+		}
+		isNode := kind == rdf.IRI || kind == rdf.Blank
+		if c, ok := coerce[pred]; ok {
+			coerce[pred] = c && isNode
+		} else {
+			coerce[pred] = isNode
+		}
+	}
+	for pred, c := range coerce {
+		if c {
+			ctx[pred] = map[string]string{"@type": "@id"}
+		}
+	}
+
+	graphs := make(map[string]map[string]map[string][]interface{})
+	for _, s := range statements {
+		label := ""
+		if s.Label.Value != "" {
+			var err error
+			label, err = nodeID(s.Label)
+			if err != nil {
+				return err
+			}
+		}
+		subj, err := nodeID(s.Subject)
+		if err != nil {
+			return err
+		}
+		pred, _, _, _ := s.Predicate.Parts()
+		pred = compact(pred)
+		obj, err := value(s.Object, coerce[pred])
+		if err != nil {
+			return err
+		}
+
+		nodes, ok := graphs[label]
+		if !ok {
+			nodes = make(map[string]map[string][]interface{})
+			graphs[label] = nodes
+		}
+		props, ok := nodes[subj]
+		if !ok {
+			props = make(map[string][]interface{})
+			nodes[subj] = props
+		}
+		props[pred] = append(props[pred], obj)
+	}
+
+	top := nodeObjects(graphs[""])
+	for label, nodes := range graphs {
+		if label == "" {
+			continue
+		}
+		top = append(top, map[string]interface{}{"@id": label, "@graph": nodeObjects(nodes)})
+	}
+	sort.SliceStable(top, func(i, j int) bool {
+		return top[i]["@id"].(string) < top[j]["@id"].(string)
+	})
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(map[string]interface{}{"@context": ctx, "@graph": top})
+}
+
+// namespace returns the prefix, namespace IRI and local name of the
+// predicate IRI. IRIs with a fragment, such as
+// https://ecsinrdf.dev/ns/is#name, are in the namespace ending with the
+// fragment separator and are given the last element of the IRI's path as
+// their prefix. Other IRIs, such as is:name, are in the namespace of their
+// scheme.
+func namespace(iri string) (prefix, ns, local string, ok bool) {
+	if i := strings.LastIndex(iri, "#"); i > 0 {
+		prefix = iri[strings.LastIndex(iri[:i], "/")+1 : i]
+		ns, local = iri[:i+1], iri[i+1:]
+	} else {
+		i := strings.Index(iri, ":")
+		if i <= 0 {
+			return "", "", "", false
+		}
+		prefix, ns, local = iri[:i], iri[:i+1], iri[i+1:]
+	}
+	if prefix == "" || local == "" || strings.ContainsAny(prefix, ":/") {
+		return "", "", "", false
+	}
+	return prefix, ns, local, true
+}
+
+// nodeObjects returns the node objects for the subjects and properties in
+// nodes, sorted by @id. Property values are sorted by their JSON encoding
+// and single values are written without an enclosing array.
+func nodeObjects(nodes map[string]map[string][]interface{}) []map[string]interface{} {
+	objs := make([]map[string]interface{}, 0, len(nodes))
+	for id, props := range nodes {
+		obj := map[string]interface{}{"@id": id}
+		for pred, vals := range props {
+			sort.Slice(vals, func(i, j int) bool { return key(vals[i]) < key(vals[j]) })
+			if len(vals) == 1 {
+				obj[pred] = vals[0]
+			} else {
+				obj[pred] = vals
+			}
+		}
+		objs = append(objs, obj)
+	}
+	sort.Slice(objs, func(i, j int) bool {
+		return objs[i]["@id"].(string) < objs[j]["@id"].(string)
+	})
+	return objs
+}
+
+// key returns the sort key for the property value v.
+func key(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// nodeID returns the JSON-LD node identifier for the IRI or blank node t.
+func nodeID(t rdf.Term) (string, error) {
+	text, _, kind, err := t.Parts()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", t.Value, err)
+	}
+	switch kind {
+	case rdf.IRI:
+		return text, nil
+	case rdf.Blank:
+		return "_:" + text, nil
+	default:
+		return "", fmt.Errorf("%s: not a node", t.Value)
+	}
+}
+
+// value returns the JSON-LD property value for the object t. If coerced is
+// true, IRI and blank node objects are written as bare identifiers.
+func value(t rdf.Term, coerced bool) (interface{}, error) {
+	text, qual, kind, err := t.Parts()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", t.Value, err)
+	}
+	switch kind {
+	case rdf.IRI, rdf.Blank:
+		id, err := nodeID(t)
+		if err != nil {
+			return nil, err
+		}
+		if coerced {
+			return id, nil
+		}
+		return map[string]string{"@id": id}, nil
+	case rdf.Literal:
+		switch {
+		case qual == "":
+			return text, nil
+		case strings.HasPrefix(qual, "@"):
+			return map[string]string{"@value": text, "@language": qual[1:]}, nil
+		default:
+			return map[string]string{"@value": text, "@type": qual}, nil
+		}
+	default:
+		return nil, fmt.Errorf("%s: invalid term", t.Value)
+	}
+}
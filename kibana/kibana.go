@@ -0,0 +1,119 @@
+// Package kibana provides tools for constructing RDF statements
+// for fields referenced by Kibana saved objects.
+package kibana
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"gonum.org/v1/gonum/graph/formats/rdf"
+
+	"github.com/efd6/ecsinrdf/term"
+	"github.com/efd6/ecsinrdf/vocab"
+)
+
+// Object is a Kibana saved object as found in a package's kibana
+// directory.
+type Object struct {
+	ID         string                 `json:"id"`
+	Type       string                 `json:"type"`
+	Attributes map[string]interface{} `json:"attributes"`
+}
+
+// Decode returns the saved object held in r.
+func Decode(r io.Reader) (Object, error) {
+	var obj Object
+	err := json.NewDecoder(r).Decode(&obj)
+	if err != nil {
+		return Object{}, err
+	}
+	if obj.ID == "" || obj.Type == "" {
+		return Object{}, fmt.Errorf("missing saved object id or type")
+	}
+	return obj, nil
+}
+
+// fieldKeys are the attribute keys of saved objects and their embedded
+// state that hold field names.
+var fieldKeys = map[string]bool{
+	"field":       true, // Aggregation based visualizations and filters.
+	"fieldName":   true, // Controls.
+	"sourceField": true, // Lens columns.
+	"columns":     true, // Saved searches.
+	"terms_field": true, // TSVB.
+	"time_field":  true, // TSVB.
+}
+
+// Fields returns the paths of the fields referenced by obj in lexical order.
+// Field references are found by their attribute keys in the object and in
+// JSON state embedded in string attributes, such as visState and
+// searchSourceJSON. Field names in query strings are not found.
+func (obj Object) Fields() []string {
+	found := make(map[string]bool)
+	var walk func(key string, v interface{})
+	walk = func(key string, v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for k, e := range v {
+				walk(k, e)
+			}
+		case []interface{}:
+			for _, e := range v {
+				walk(key, e)
+			}
+		case string:
+			s := strings.TrimSpace(v)
+			if strings.HasPrefix(s, "{") || strings.HasPrefix(s, "[") {
+				var embedded interface{}
+				if json.Unmarshal([]byte(s), &embedded) == nil {
+					walk(key, embedded)
+					return
+				}
+			}
+			// Lens uses ___records___ for document counts.
+			if fieldKeys[key] && s != "" && !strings.HasPrefix(s, "___") {
+				found[s] = true
+			}
+		}
+	}
+	walk("", obj.Attributes)
+	fields := make([]string, 0, len(found))
+	for f := range found {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// Statements calls fn on all RDF statements constructed from the fields
+// referenced by the provided saved object.
+//
+// The graph that results has the following triples structure
+//
+// _:ref <is:path> "full.dotted.path.to.name" .
+// _:ref <referenced:by> "type/id" .
+//
+// Reference nodes are shared by all saved objects referring to the same
+// path.
+func Statements(obj Object, fn func(*rdf.Statement, error)) {
+	ref := term.LiteralTerm(obj.Type + "/" + obj.ID)
+	for _, path := range obj.Fields() {
+		h := sha1.Sum([]byte("kibana" + path))
+		hashRef := string(hex(h[:]))
+		fn(term.Triple(term.Blank(hashRef), vocab.IsPath.Term(), term.LiteralTerm(path)), nil)
+		fn(term.Triple(term.Blank(hashRef), vocab.ReferencedBy.Term(), ref), nil)
+	}
+}
+
+func hex(data []byte) []byte {
+	const digit = "0123456789abcdef"
+	buf := make([]byte, 0, len(data)*2)
+	for _, b := range data {
+		buf = append(buf, digit[b>>4], digit[b&0xf])
+	}
+	return buf
+}
@@ -2,199 +2,419 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"flag"
 	"fmt"
 	"io"
-	"io/fs"
-	"log"
+	"net/http"
 	"os"
-	"os/exec"
+	"path"
 	"path/filepath"
-	"strconv"
+	"sort"
 	"strings"
 
 	"gonum.org/v1/gonum/graph/formats/rdf"
 	"gopkg.in/yaml.v3"
 
-	"github.com/efd6/ecsinrdf/integration"
+	"github.com/efd6/ecsinrdf/gitrepo"
+	"github.com/efd6/ecsinrdf/graph"
 	"github.com/efd6/ecsinrdf/query"
-	"github.com/efd6/ecsinrdf/schema"
+	"github.com/efd6/ecsinrdf/rewrite"
+	"github.com/efd6/ecsinrdf/term"
+	"github.com/efd6/ecsinrdf/vocab"
 )
 
 func main() {
-	qry := flag.String("query", "", "specify a field path and type query path.to.field:type")
-	pkg := flag.String("pkg-path", ".", "specify the path to the root of the package(s) (ignored if query is not empty)")
-	root := flag.String("ecs-root", "", "specify the path to the root of the ecs repo")
-	version := flag.String("version", "", "specify the version of ECS to use (tag, branch or sha)")
+	verbose := flag.Bool("v", false, "log debug messages")
+	logFormat := flag.String("log-format", "text", "specify the format of log messages: text or json")
+	lang := flag.String("lang", defaultLanguage, "specify the language of reports: "+strings.Join(languages(), ", "))
+	flag.Usage = usage
 	flag.Parse()
-
-	if *root == "" || *version == "" || (*qry != "" && len(strings.Split(*qry, ":")) != 2) {
+	if flag.NArg() == 0 {
 		flag.Usage()
 		os.Exit(2)
 	}
-
-	ecs, err := ecsSpec(*root, *version)
+	err := setupLogging(*verbose, *logFormat)
+	if err == nil {
+		err = setLanguage(*lang)
+	}
 	if err != nil {
-		log.Fatal(err)
+		fmt.Fprintln(flag.CommandLine.Output(), err)
+		flag.Usage()
+		os.Exit(2)
+	}
+	name := flag.Arg(0)
+	args := flag.Args()[1:]
+	if name == "help" && len(args) == 1 {
+		// Show the command's usage.
+		name, args = args[0], []string{"-h"}
 	}
+	for _, c := range commands {
+		if c.name == name {
+			c.run(args)
+			return
+		}
+	}
+	fmt.Fprintf(flag.CommandLine.Output(), "unknown command: %s\n", name)
+	flag.Usage()
+	os.Exit(2)
+}
 
-	var statements []*rdf.Statement
-	dec := yaml.NewDecoder(ecs)
-	dec.KnownFields(true)
-	for {
-		var f map[string]schema.Field
-		err := dec.Decode(&f)
+// serveHTTP serves the graphs described by the file at the path graphs on
+// addr, using the token rules in the file at the path tokens if it is not
+// empty. Metrics and the JSON Schema of /check reports are served
+// unauthenticated at /metrics and /check/schema. If validate is true, /check
+// reports are validated against the schema before they are returned.
+func serveHTTP(addr, graphs, tokens string, base *rpcServer, validate bool) error {
+	var rules []tokenRule
+	if tokens != "" {
+		f, err := os.Open(tokens)
 		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			log.Fatal(err)
+			return err
 		}
-		schema.Statements("", f, func(s *rdf.Statement, err error) {
-			if err != nil {
-				log.Println(err)
-				return
-			}
-			statements = append(statements, s)
-		})
+		rules, err = parseTokens(f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		if rules == nil {
+			// An empty token file permits nothing
+			// rather than disabling authentication.
+			rules = []tokenRule{}
+		}
+	}
+	f, err := os.Open(graphs)
+	if err != nil {
+		return err
 	}
+	h, err := newHTTPServer(f, base, rules)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	h.validate = validate
+	mux := http.NewServeMux()
+	mux.Handle("/graphs/", h)
+	mux.HandleFunc("/check", h.serveCheck)
+	mux.HandleFunc("/check/schema", serveReportSchema)
+	mux.Handle("/metrics", base.metrics)
+	return http.ListenAndServe(addr, mux)
+}
 
-	if *qry == "" {
-		fr, err := fieldsReader(*pkg)
-		if err != nil {
-			log.Fatal(err)
+// serveREST builds the graph described by the configuration of srv and
+// serves REST lookups on it on addr. Metrics are served at /metrics.
+func serveREST(addr string, srv *rpcServer) error {
+	_, rerr := srv.call(rpcRequest{JSONRPC: "2.0", Method: "initialize"})
+	if rerr != nil {
+		return rerr
+	}
+	h := restServer{srv: srv}
+	mux := http.NewServeMux()
+	mux.Handle("/grafts", h)
+	mux.Handle("/field", h)
+	mux.Handle("/metrics", srv.metrics)
+	return http.ListenAndServe(addr, mux)
+}
+
+// writeAdoptionPlan writes a markdown migration plan for adopting the named
+// ECS field set to w.
+func writeAdoptionPlan(w io.Writer, fieldset string, plan []query.Adoption) {
+	var present, equivalent, similar, added []query.Adoption
+	for _, a := range plan {
+		switch {
+		case a.Present:
+			present = append(present, a)
+		case len(a.Equivalents) != 0:
+			equivalent = append(equivalent, a)
+		case len(a.Similar) != 0:
+			similar = append(similar, a)
+		default:
+			added = append(added, a)
 		}
-		dec = yaml.NewDecoder(fr)
-		dec.KnownFields(true)
-		for {
-			var f []integration.Field
-			err := dec.Decode(&f)
-			if err != nil {
-				if err == io.EOF {
-					break
-				}
-				log.Fatal(err)
+	}
+	fmt.Fprintf(w, "# %s\n", msg("adopt.title", fieldset))
+	section := func(title string, fields []query.Adoption, from func(query.Adoption) []string) {
+		if len(fields) == 0 {
+			return
+		}
+		fmt.Fprintf(w, "\n## %s\n\n", title)
+		for _, a := range fields {
+			fmt.Fprintf(w, "- %s (%s)", a.Path, a.Type)
+			if from != nil {
+				fmt.Fprintf(w, " %s", msg("adopt.from", strings.Join(from(a), ", ")))
 			}
-			integration.Statements("", f, func(s *rdf.Statement, err error) {
-				if err != nil {
-					log.Println(err)
-					return
-				}
-				statements = append(statements, s)
-			})
+			fmt.Fprintln(w)
 		}
 	}
+	section(msg("adopt.equivalent"), equivalent, func(a query.Adoption) []string { return a.Equivalents })
+	section(msg("adopt.similar"), similar, func(a query.Adoption) []string { return a.Similar })
+	section(msg("adopt.new"), added, nil)
+	section(msg("adopt.present"), present, nil)
+}
 
-	statements, err = rdf.URDNA2015(statements, statements)
+// stringList is a flag.Value holding a list of strings. Values may be
+// comma-separated and the flag may be repeated.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(s string) error {
+	for _, e := range strings.Split(s, ",") {
+		if e != "" {
+			*l = append(*l, e)
+		}
+	}
+	return nil
+}
+
+// contains returns whether the list holds s.
+func (l stringList) contains(s string) bool {
+	for _, e := range l {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+// isECSField returns whether the field with the provided full path is
+// defined by ECS in g.
+func isECSField(g *rdf.Graph, path string) bool {
+	n, ok := g.TermFor(term.Literal(path))
+	if !ok {
+		return false
+	}
+	typed := g.Query(n).In(vocab.IsPath.Match).Out(vocab.IsType.Match)
+	return len(typed.Result()) != 0
+}
+
+// applyGraft applies the graft from the package field path from to the ECS
+// field path to in the fields file at path, rewriting the file if the field
+// is defined in it. It returns whether the file was rewritten.
+func applyGraft(path, from, to string, alias bool) (bool, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	var doc yaml.Node
+	err = yaml.Unmarshal(b, &doc)
+	if err != nil {
+		return false, err
+	}
+	ok, err := rewrite.Graft(&doc, from, to, alias)
+	if !ok || err != nil {
+		return false, err
+	}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	err = enc.Encode(&doc)
 	if err != nil {
-		log.Fatal(err)
+		return false, err
 	}
-	statements = rdf.Deduplicate(statements)
-	g := rdf.NewGraph()
-	for _, s := range statements {
-		g.AddStatement(s)
+	err = enc.Close()
+	if err != nil {
+		return false, err
 	}
+	return true, os.WriteFile(path, buf.Bytes(), 0o644)
+}
+
+const (
+	nestedPath  = "generated/ecs/ecs_nested.yml"
+	flatPath    = "generated/ecs/ecs_flat.yml"
+	schemasPath = "schemas"
+)
+
+// ecsArtifacts holds the paths in the ECS repo of the ECS specification
+// artifacts that graphs can be built from. The schemas artifact is the
+// directory of hand-written source schemas, which is read as a single
+// stream of the YAML documents in its .yml files in lexical order.
+var ecsArtifacts = map[string]string{
+	"nested":  nestedPath,
+	"flat":    flatPath,
+	"schemas": schemasPath,
+}
 
-	if *qry != "" {
-		parts := strings.Split(*qry, ":")
-		if len(parts) != 2 {
-			flag.Usage()
-			os.Exit(2)
+// ecsSpec returns the ECS specification artifact held in the ECS repo at
+// path for the given version. The artifact is a key of ecsArtifacts. If
+// path is empty, the specification is fetched from GitHub. If path is a
+// release archive of the ECS repo, the specification is read from the
+// archive, which holds a single version.
+func ecsSpec(ctx context.Context, path, version, artifact string) (io.Reader, error) {
+	file, ok := ecsArtifacts[artifact]
+	if !ok {
+		return nil, fmt.Errorf("unknown ECS artifact: %s", artifact)
+	}
+	if path == "" {
+		return fetchSpec(ctx, version, file)
+	}
+	if isArchive(path) {
+		b, err := archiveSpec(path, file)
+		if err != nil {
+			return nil, err
 		}
-		cands, err := query.CandidateGraftsFor(g, strconv.Quote(parts[0]), strconv.Quote(parts[1]))
+		return bytes.NewReader(b), nil
+	}
+	repo, err := gitrepo.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer repo.Close()
+	if file == schemasPath {
+		names, err := repo.ReadDir(version, file)
 		if err != nil {
-			fmt.Println(err)
-			return
+			return nil, err
 		}
-		fmt.Println(cands)
-		return
-	}
-
-	// Do some actual work.
-	notGroup := func(s *rdf.Statement) bool {
-		return s.Predicate.Value == "<as:type>" && s.Object.Value != `"group"`
-	}
-	p := query.PublishedFieldsIn(g)
-	p = p.Out(notGroup).In(notGroup).And(p)
-	for _, f := range p.Result() {
-		paths := g.Query(f).Out(func(s *rdf.Statement) bool {
-			return s.Predicate.Value == "<is:path>"
-		})
-		for _, n := range paths.Result() {
-			cands, err := query.CandidateGraftsIn(g, n.Value)
-			if len(cands) != 0 || err != nil {
-				fmt.Printf("%s\n", n.Value)
+		var docs [][]byte
+		for _, name := range names {
+			if !strings.HasSuffix(name, ".yml") {
+				continue
 			}
+			b, err := repo.ReadFile(version, file+"/"+name)
 			if err != nil {
-				fmt.Printf("\t%s: %v\n", n.Value, err)
-			}
-			for _, c := range cands {
-				fmt.Printf("\t%s\n", c)
-			}
-			if len(cands) != 0 || err != nil {
-				fmt.Println()
+				return nil, err
 			}
+			docs = append(docs, b)
 		}
+		return bytes.NewReader(graph.YAMLStream(docs)), nil
+	}
+	b, err := repo.ReadFile(version, file)
+	if err != nil {
+		return nil, err
 	}
+	return bytes.NewReader(b), nil
 }
 
-const nestedPath = "generated/ecs/ecs_nested.yml"
+// fieldsFile is a package fields file.
+type fieldsFile struct {
+	// dataStream is the name of the data stream holding
+	// the fields file. It is empty for package-level
+	// fields.
+	dataStream string
+	path       string
+}
 
-func ecsSpec(path, version string) (io.Reader, error) {
-	cmd := exec.Command("git", "show", fmt.Sprintf("%s:"+nestedPath, version))
-	cmd.Dir = path
-	var buf bytes.Buffer
-	cmd.Stdout = &buf
-	err := cmd.Run()
+// fieldsFiles returns the fields files in the package(s) rooted at path
+// in lexical order. Data streams are named by idx, the index of the
+// package(s) relative to path.
+func fieldsFiles(ctx context.Context, path string, idx graph.PackageIndex) ([]fieldsFile, error) {
+	found, err := graph.FieldsFiles(ctx, os.DirFS(path), idx)
 	if err != nil {
 		return nil, err
 	}
-	return &buf, nil
+	files := make([]fieldsFile, len(found))
+	for i, f := range found {
+		files[i] = fieldsFile{dataStream: f.DataStream, path: filepath.Join(path, filepath.FromSlash(f.Path))}
+	}
+	return files, nil
 }
 
-func fieldsReader(path string) (io.Reader, error) {
-	var readers []io.Reader
-	err := filepath.WalkDir(path, func(path string, d fs.DirEntry, err error) error {
-		if err != nil || d.IsDir() {
-			return nil
+// matchFieldsFiles returns the fields files matching the glob patterns in
+// order of the patterns and then lexically. Files matched by more than
+// one pattern are only included once. The directory holding a file is not
+// required to be named fields. It is an error for a pattern to match no
+// files. Data streams are named by idx, which is keyed by slash-separated
+// paths as returned by packagesIn.
+func matchFieldsFiles(patterns []string, idx graph.PackageIndex) ([]fieldsFile, error) {
+	var files []fieldsFile
+	seen := make(map[string]bool)
+	for _, p := range patterns {
+		paths, err := filepath.Glob(p)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p, err)
 		}
-		if filepath.Ext(path) != ".yml" {
-			return nil
+		if len(paths) == 0 {
+			return nil, fmt.Errorf("no fields files match %s", p)
 		}
-		if filepath.Base(filepath.Dir(path)) != "fields" {
-			return nil
+		for _, path := range paths {
+			if seen[path] {
+				continue
+			}
+			seen[path] = true
+			files = append(files, fieldsFile{dataStream: idx.DataStreamOf(filepath.ToSlash(path)), path: path})
 		}
-		f := &lazyFile{path: path}
-		readers = append(readers, f)
-		return nil
-	})
+	}
+	return files, nil
+}
+
+// packageVersion returns the version declared in the manifest of the
+// package rooted at path.
+func packageVersion(path string) (string, error) {
+	b, err := os.ReadFile(filepath.Join(path, "manifest.yml"))
+	if err != nil {
+		return "", err
+	}
+	var manifest struct {
+		Version string `yaml:"version"`
+	}
+	err = yaml.Unmarshal(b, &manifest)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", path, err)
+	}
+	if manifest.Version == "" {
+		return "", fmt.Errorf("%s: no version in package manifest", path)
+	}
+	return manifest.Version, nil
+}
+
+// packageNames returns the names declared in the manifests of the
+// package(s) rooted at path, sorted lexically.
+func packageNames(path string) ([]string, error) {
+	idx, err := packagesIn(path)
 	if err != nil {
 		return nil, err
 	}
-	return io.MultiReader(readers...), nil
+	names := make([]string, 0, len(idx))
+	for _, name := range idx {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
 }
 
-type lazyFile struct {
-	path string
-	file *os.File
-	err  error
+// packagesIn returns the index of the package(s) rooted at root, keyed by
+// the slash-separated path of each package directory joined to root.
+// Package manifests are distinguished from data stream manifests by their
+// format version.
+func packagesIn(root string) (graph.PackageIndex, error) {
+	idx, err := graph.PackagesIn(context.Background(), os.DirFS(root))
+	if err != nil {
+		return nil, err
+	}
+	return rootedIndex(idx, root), nil
 }
 
-func (f *lazyFile) Read(b []byte) (int, error) {
-	if f.err != nil {
-		return 0, f.err
+// rootedIndex returns a copy of the package index idx of the package(s)
+// rooted at root with root joined to each package directory, so that it
+// can be used to look up the slash-separated forms of paths below root.
+func rootedIndex(idx graph.PackageIndex, root string) graph.PackageIndex {
+	rooted := make(graph.PackageIndex, len(idx))
+	for dir, name := range idx {
+		rooted[path.Join(filepath.ToSlash(root), dir)] = name
 	}
-	if f.file == nil {
-		f.file, f.err = os.Open(f.path)
-		if f.err != nil {
-			return 0, f.err
-		}
+	return rooted
+}
+
+// packageOfDataStream returns the package name part of a data stream name
+// returned by graph.PackageIndex.DataStreamOf for more than one package.
+func packageOfDataStream(ds string) string {
+	name, _, _ := strings.Cut(ds, "/")
+	return name
+}
+
+// pathRules returns rules with the names of the package(s) rooted at pkg
+// added as vendor prefixes if packagePrefix is true and pkg is not empty.
+func pathRules(rules query.PathRules, packagePrefix bool, pkg string) (query.PathRules, error) {
+	if !packagePrefix || pkg == "" {
+		return rules, nil
 	}
-	n, err := f.file.Read(b)
+	names, err := packageNames(pkg)
 	if err != nil {
-		f.file.Close()
-		f.file = nil
-		f.err = err
+		return query.PathRules{}, err
 	}
-	return n, err
+	// Do not modify the caller's prefixes.
+	rules.Prefixes = append(rules.Prefixes[:len(rules.Prefixes):len(rules.Prefixes)], names...)
+	return rules, nil
 }
@@ -0,0 +1,128 @@
+// Package mermaid provides tools for rendering field structure as Mermaid
+// flowcharts for embedding in Markdown documentation.
+package mermaid
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"gonum.org/v1/gonum/graph/formats/rdf"
+
+	"github.com/efd6/ecsinrdf/term"
+	"github.com/efd6/ecsinrdf/vocab"
+)
+
+// Encode writes the fields described by the statements to w as a Mermaid
+// flowchart. Each subject is written as a node labelled with its name and
+// type, taken from its <is:name> and <is:type> or <as:type> statements,
+// and each <has:child> and <has:multi> statement is written as an edge,
+// with multi-field edges dotted. Other statements are ignored. Nodes are
+// given identifiers in the order of their blank node labels, so the output
+// is stable for a given set of statements. For example, the statements
+//
+//  _:b0 <is:name> "user" .
+//  _:b0 <is:type> "group" .
+//  _:b0 <has:child> _:b1 .
+//  _:b1 <is:name> "name" .
+//  _:b1 <is:type> "keyword" .
+//
+// are encoded as
+//
+//  flowchart LR
+//  	n0["user: group"]
+//  	n1["name: keyword"]
+//  	n0 --> n1
+func Encode(w io.Writer, statements []*rdf.Statement) error {
+	names := make(map[string]string)
+	types := make(map[string]string)
+	nodes := make(map[string]bool)
+	type edge struct {
+		from, to string
+		multi    bool
+	}
+	var edges []edge
+	for _, s := range statements {
+		switch vocab.Of(s) {
+		case vocab.IsName:
+			nodes[s.Subject.Value] = true
+			text, err := term.Text(s.Object.Value)
+			if err != nil {
+				return fmt.Errorf("%s: %w", s, err)
+			}
+			names[s.Subject.Value] = text
+		case vocab.IsType, vocab.AsType:
+			nodes[s.Subject.Value] = true
+			text, err := term.Text(s.Object.Value)
+			if err != nil {
+				return fmt.Errorf("%s: %w", s, err)
+			}
+			types[s.Subject.Value] = text
+		case vocab.HasChild, vocab.HasMulti:
+			nodes[s.Subject.Value] = true
+			nodes[s.Object.Value] = true
+			edges = append(edges, edge{
+				from:  s.Subject.Value,
+				to:    s.Object.Value,
+				multi: vocab.HasMulti.Match(s),
+			})
+		}
+	}
+
+	labels := make([]string, 0, len(nodes))
+	for n := range nodes {
+		labels = append(labels, n)
+	}
+	sort.Strings(labels)
+	id := make(map[string]int, len(labels))
+	for i, n := range labels {
+		id[n] = i
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].from != edges[j].from {
+			return id[edges[i].from] < id[edges[j].from]
+		}
+		return id[edges[i].to] < id[edges[j].to]
+	})
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString("flowchart LR\n")
+	for _, n := range labels {
+		label := names[n]
+		if label == "" {
+			label = n
+		}
+		if typ := types[n]; typ != "" {
+			label += ": " + typ
+		}
+		fmt.Fprintf(bw, "\tn%d[\"%s\"]\n", id[n], Escape(label))
+	}
+	for _, e := range edges {
+		arrow := "-->"
+		if e.multi {
+			arrow = "-.->"
+		}
+		fmt.Fprintf(bw, "\tn%d %s n%d\n", id[e.from], arrow, id[e.to])
+	}
+	return bw.Flush()
+}
+
+// Escape returns s escaped for use in a quoted Mermaid node label. Quotes,
+// entity introducers, angle brackets and backticks are replaced by Mermaid
+// entity codes, and line breaks are replaced by spaces.
+func Escape(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+var labelEscaper = strings.NewReplacer(
+	"#", "#35;",
+	`"`, "#quot;",
+	"<", "#lt;",
+	">", "#gt;",
+	"`", "#96;",
+	"\r\n", " ",
+	"\n", " ",
+	"\r", " ",
+)
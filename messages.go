@@ -0,0 +1,86 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// messageFiles holds the report message catalogs, one JSON object for
+// each language mapping message keys to fmt format strings. Translations
+// may use explicit argument indexes to reorder arguments.
+//
+//go:embed messages/*.json
+var messageFiles embed.FS
+
+// defaultLanguage is the language of the catalog holding every message.
+const defaultLanguage = "en"
+
+// messages is the catalog used to render reports.
+var messages = mustCatalog(defaultLanguage)
+
+// msg returns the report message for key formatted with args.
+func msg(key string, args ...interface{}) string {
+	format, ok := messages[key]
+	if !ok {
+		// All keys are in the default catalog, so
+		// this only happens for programmer errors.
+		format = key
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// setLanguage sets the catalog used to render reports to the catalog for
+// lang. Messages missing from the catalog are taken from the default
+// language.
+func setLanguage(lang string) error {
+	c, err := catalog(lang)
+	if err != nil {
+		return err
+	}
+	merged := mustCatalog(defaultLanguage)
+	for k, v := range c {
+		if _, ok := merged[k]; ok {
+			merged[k] = v
+		}
+	}
+	messages = merged
+	return nil
+}
+
+// languages returns the languages with message catalogs, sorted lexically.
+func languages() []string {
+	files, _ := messageFiles.ReadDir("messages")
+	langs := make([]string, 0, len(files))
+	for _, f := range files {
+		langs = append(langs, strings.TrimSuffix(f.Name(), ".json"))
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// catalog returns the message catalog for lang.
+func catalog(lang string) (map[string]string, error) {
+	b, err := messageFiles.ReadFile(path.Join("messages", lang+".json"))
+	if err != nil {
+		return nil, fmt.Errorf("unknown language: %s (available: %s)", lang, strings.Join(languages(), ", "))
+	}
+	var c map[string]string
+	err = json.Unmarshal(b, &c)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s message catalog: %w", lang, err)
+	}
+	return c, nil
+}
+
+// mustCatalog returns the message catalog for lang, panicking on error.
+func mustCatalog(lang string) map[string]string {
+	c, err := catalog(lang)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
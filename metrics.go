@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"gonum.org/v1/gonum/graph/formats/rdf"
+
+	"github.com/efd6/ecsinrdf/term"
+)
+
+// latencyBuckets are the upper bounds in seconds of the request latency
+// histogram buckets.
+var latencyBuckets = []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+
+// serverMetrics holds the operational metrics of the server. Its methods
+// are safe for concurrent use.
+type serverMetrics struct {
+	mu sync.Mutex
+
+	builds        map[string]uint64
+	buildSeconds  float64
+	lastBuild     float64
+	statements    int
+	termHits      uint64
+	termMisses    uint64
+	requests      map[string]*histogram
+	requestErrors map[string]uint64
+}
+
+// histogram is a cumulative Prometheus histogram.
+type histogram struct {
+	counts []uint64 // counts holds a count for each latency bucket.
+	count  uint64
+	sum    float64
+}
+
+func newServerMetrics() *serverMetrics {
+	return &serverMetrics{
+		builds:        make(map[string]uint64),
+		requests:      make(map[string]*histogram),
+		requestErrors: make(map[string]uint64),
+	}
+}
+
+// observeBuild records a graph build that started at start, parsed
+// statements with store, and resulted in g and err.
+func (m *serverMetrics) observeBuild(start time.Time, store *term.Store, g *rdf.Graph, err error) {
+	d := time.Since(start).Seconds()
+	var n int
+	if err == nil {
+		for it := g.AllStatements(); it.Next(); {
+			n++
+		}
+	}
+
+	hits, misses := store.Stats()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.buildSeconds += d
+	m.termHits += hits
+	m.termMisses += misses
+	m.lastBuild = d
+	if err != nil {
+		m.builds["failure"]++
+		return
+	}
+	m.builds["success"]++
+	m.statements = n
+}
+
+// observeRequest records a request for the method that started at start
+// and resulted in err.
+func (m *serverMetrics) observeRequest(method string, start time.Time, err error) {
+	d := time.Since(start).Seconds()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h, ok := m.requests[method]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(latencyBuckets))}
+		m.requests[method] = h
+	}
+	for i, b := range latencyBuckets {
+		if d <= b {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += d
+	if err != nil {
+		m.requestErrors[method]++
+	}
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format.
+func (m *serverMetrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	m.write(w)
+}
+
+// write writes the metrics in the Prometheus text exposition format to w.
+func (m *serverMetrics) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP ecsinrdf_graph_builds_total Number of graph builds by result.")
+	fmt.Fprintln(w, "# TYPE ecsinrdf_graph_builds_total counter")
+	for _, result := range []string{"success", "failure"} {
+		fmt.Fprintf(w, "ecsinrdf_graph_builds_total{result=%q} %d\n", result, m.builds[result])
+	}
+	fmt.Fprintln(w, "# HELP ecsinrdf_graph_build_seconds_total Total time spent building graphs.")
+	fmt.Fprintln(w, "# TYPE ecsinrdf_graph_build_seconds_total counter")
+	fmt.Fprintf(w, "ecsinrdf_graph_build_seconds_total %g\n", m.buildSeconds)
+	fmt.Fprintln(w, "# HELP ecsinrdf_graph_last_build_seconds Duration of the most recent graph build.")
+	fmt.Fprintln(w, "# TYPE ecsinrdf_graph_last_build_seconds gauge")
+	fmt.Fprintf(w, "ecsinrdf_graph_last_build_seconds %g\n", m.lastBuild)
+	fmt.Fprintln(w, "# HELP ecsinrdf_graph_statements Number of statements in the most recently built graph.")
+	fmt.Fprintln(w, "# TYPE ecsinrdf_graph_statements gauge")
+	fmt.Fprintf(w, "ecsinrdf_graph_statements %d\n", m.statements)
+
+	methods := make([]string, 0, len(m.requests))
+	for method := range m.requests {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	fmt.Fprintln(w, "# HELP ecsinrdf_request_duration_seconds Latency of requests by method.")
+	fmt.Fprintln(w, "# TYPE ecsinrdf_request_duration_seconds histogram")
+	for _, method := range methods {
+		h := m.requests[method]
+		for i, b := range latencyBuckets {
+			fmt.Fprintf(w, "ecsinrdf_request_duration_seconds_bucket{method=%q,le=\"%g\"} %d\n", method, b, h.counts[i])
+		}
+		fmt.Fprintf(w, "ecsinrdf_request_duration_seconds_bucket{method=%q,le=\"+Inf\"} %d\n", method, h.count)
+		fmt.Fprintf(w, "ecsinrdf_request_duration_seconds_sum{method=%q} %g\n", method, h.sum)
+		fmt.Fprintf(w, "ecsinrdf_request_duration_seconds_count{method=%q} %d\n", method, h.count)
+	}
+	fmt.Fprintln(w, "# HELP ecsinrdf_request_errors_total Number of failed requests by method.")
+	fmt.Fprintln(w, "# TYPE ecsinrdf_request_errors_total counter")
+	for _, method := range methods {
+		fmt.Fprintf(w, "ecsinrdf_request_errors_total{method=%q} %d\n", method, m.requestErrors[method])
+	}
+
+	fmt.Fprintln(w, "# HELP ecsinrdf_term_cache_hits_total Number of statements constructed from interned terms.")
+	fmt.Fprintln(w, "# TYPE ecsinrdf_term_cache_hits_total counter")
+	fmt.Fprintf(w, "ecsinrdf_term_cache_hits_total %d\n", m.termHits)
+	fmt.Fprintln(w, "# HELP ecsinrdf_term_cache_misses_total Number of statements constructed with terms that were not interned.")
+	fmt.Fprintln(w, "# TYPE ecsinrdf_term_cache_misses_total counter")
+	fmt.Fprintf(w, "ecsinrdf_term_cache_misses_total %d\n", m.termMisses)
+}
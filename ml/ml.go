@@ -0,0 +1,159 @@
+// Package ml provides tools for constructing RDF statements for fields
+// referenced by the anomaly detection jobs of ML modules.
+package ml
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"gonum.org/v1/gonum/graph/formats/rdf"
+
+	"github.com/efd6/ecsinrdf/term"
+	"github.com/efd6/ecsinrdf/vocab"
+)
+
+// Module is an ML module as found in a package's kibana/ml_module
+// directory.
+type Module struct {
+	ID         string `json:"id"`
+	Attributes struct {
+		Jobs []Job `json:"jobs"`
+	} `json:"attributes"`
+}
+
+// Job is an anomaly detection job in an ML module.
+type Job struct {
+	ID     string `json:"id"`
+	Config struct {
+		AnalysisConfig struct {
+			Detectors               []Detector `json:"detectors"`
+			Influencers             []string   `json:"influencers"`
+			CategorizationFieldName string     `json:"categorization_field_name"`
+			SummaryCountFieldName   string     `json:"summary_count_field_name"`
+		} `json:"analysis_config"`
+		DataDescription struct {
+			TimeField string `json:"time_field"`
+		} `json:"data_description"`
+	} `json:"config"`
+}
+
+// Detector is an anomaly detection job detector.
+type Detector struct {
+	Function           string `json:"function"`
+	FieldName          string `json:"field_name"`
+	ByFieldName        string `json:"by_field_name"`
+	OverFieldName      string `json:"over_field_name"`
+	PartitionFieldName string `json:"partition_field_name"`
+}
+
+// Decode returns the ML module held in r.
+func Decode(r io.Reader) (Module, error) {
+	var m Module
+	err := json.NewDecoder(r).Decode(&m)
+	if err != nil {
+		return Module{}, err
+	}
+	if m.ID == "" {
+		return Module{}, fmt.Errorf("missing ML module id")
+	}
+	return m, nil
+}
+
+// Use is a field referenced by a job.
+type Use struct {
+	// Path is the full dotted path of the field.
+	Path string
+	// Requires is the class of types the field must
+	// have: "numeric", "date" or "aggregatable". It is
+	// empty if any type is accepted.
+	Requires string
+}
+
+// nonMetric holds the detector functions that do not require a numeric
+// field_name. Functions not listed here and taking a field_name analyze
+// its numeric value.
+var nonMetric = map[string]string{
+	"distinct_count":      "aggregatable",
+	"high_distinct_count": "aggregatable",
+	"low_distinct_count":  "aggregatable",
+	"info_content":        "aggregatable",
+	"high_info_content":   "aggregatable",
+	"low_info_content":    "aggregatable",
+	"lat_long":            "",
+}
+
+// Fields returns the fields referenced by the job, sorted by path and
+// requirement.
+func (j Job) Fields() []Use {
+	found := make(map[Use]bool)
+	add := func(path, requires string) {
+		if path != "" {
+			found[Use{Path: path, Requires: requires}] = true
+		}
+	}
+	cfg := j.Config.AnalysisConfig
+	for _, d := range cfg.Detectors {
+		requires, ok := nonMetric[d.Function]
+		if !ok {
+			requires = "numeric"
+		}
+		add(d.FieldName, requires)
+		add(d.ByFieldName, "aggregatable")
+		add(d.OverFieldName, "aggregatable")
+		add(d.PartitionFieldName, "aggregatable")
+	}
+	for _, f := range cfg.Influencers {
+		add(f, "aggregatable")
+	}
+	add(cfg.CategorizationFieldName, "")
+	add(cfg.SummaryCountFieldName, "numeric")
+	add(j.Config.DataDescription.TimeField, "date")
+	uses := make([]Use, 0, len(found))
+	for u := range found {
+		uses = append(uses, u)
+	}
+	sort.Slice(uses, func(i, j int) bool {
+		if uses[i].Path == uses[j].Path {
+			return uses[i].Requires < uses[j].Requires
+		}
+		return uses[i].Path < uses[j].Path
+	})
+	return uses
+}
+
+// Statements calls fn on all RDF statements constructed from the fields
+// referenced by the jobs of the provided ML module.
+//
+// The graph that results has the following triples structure
+//
+// _:use <is:path> "full.dotted.path.to.name" .
+// _:use <used:by> "ml-module/id/job" .
+// _:use <requires:type> "class" .
+//
+// The requirement is omitted for uses that accept any type.
+func Statements(m Module, fn func(*rdf.Statement, error)) {
+	for _, j := range m.Attributes.Jobs {
+		ref := "ml-module/" + m.ID + "/" + j.ID
+		for _, u := range j.Fields() {
+			h := sha1.Sum([]byte("ml" + ref + "\x00" + u.Path + "\x00" + u.Requires))
+			hashUse := string(hex(h[:]))
+			fn(term.Triple(term.Blank(hashUse), vocab.IsPath.Term(), term.LiteralTerm(u.Path)), nil)
+			fn(term.Triple(term.Blank(hashUse), vocab.UsedBy.Term(), term.LiteralTerm(ref)), nil)
+			if u.Requires != "" {
+				fn(term.Triple(term.Blank(hashUse), vocab.RequiresType.Term(), term.LiteralTerm(u.Requires)), nil)
+			}
+		}
+	}
+}
+
+func hex(data []byte) []byte {
+	const digit = "0123456789abcdef"
+	buf := make([]byte, 0, len(data)*2)
+	for _, b := range data {
+		buf = append(buf, digit[b>>4], digit[b&0xf])
+	}
+	return buf
+}
@@ -0,0 +1,109 @@
+// Package owner provides tools for constructing RDF statements
+// attributing fields to owning teams.
+package owner
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"gonum.org/v1/gonum/graph/formats/rdf"
+
+	"github.com/efd6/ecsinrdf/term"
+	"github.com/efd6/ecsinrdf/vocab"
+)
+
+// Rule is a CODEOWNERS-like ownership rule.
+type Rule struct {
+	// Pattern is the path prefix the rule applies to.
+	// A leading "/" anchors the prefix to the root;
+	// otherwise the prefix may start at any path
+	// element. The pattern "*" matches all paths.
+	Pattern string
+	// Owners is the list of owning teams.
+	Owners []string
+}
+
+// Parse returns the rules held in r. Each non-empty line holds a pattern
+// followed by its owners separated by white space. Text after a '#' is a
+// comment.
+func Parse(r io.Reader) ([]Rule, error) {
+	var rules []Rule
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := sc.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		f := strings.Fields(line)
+		switch len(f) {
+		case 0:
+			continue
+		case 1:
+			return nil, fmt.Errorf("line %d: no owners for %s", n, f[0])
+		}
+		rules = append(rules, Rule{Pattern: f[0], Owners: f[1:]})
+	}
+	return rules, sc.Err()
+}
+
+// Of returns the owners of the file at the slash-separated path p relative
+// to the root of the rules. As with CODEOWNERS, the last matching rule
+// takes precedence.
+func Of(rules []Rule, p string) []string {
+	p = path.Clean("/" + p)
+	for i := len(rules) - 1; i >= 0; i-- {
+		if matches(rules[i].Pattern, p) {
+			return rules[i].Owners
+		}
+	}
+	return nil
+}
+
+func matches(pattern, p string) bool {
+	if pattern == "*" {
+		return true
+	}
+	anchored := strings.HasPrefix(pattern, "/")
+	prefix := strings.TrimSuffix(path.Clean("/"+pattern), "/")
+	if prefix == "" {
+		return true
+	}
+	for {
+		if p == prefix || strings.HasPrefix(p, prefix+"/") {
+			return true
+		}
+		if anchored {
+			return false
+		}
+		// Try the prefix at the next path element.
+		i := strings.Index(p[1:], "/")
+		if i < 0 {
+			return false
+		}
+		p = p[i+1:]
+	}
+}
+
+// Statements returns a function that calls fn on each statement passed to
+// it and, for each field path statement, additionally calls fn with
+// statements attributing the field to the provided owners.
+//
+// _:field <owned:by> "team" .
+//
+func Statements(owners []string, fn func(*rdf.Statement, error)) func(*rdf.Statement, error) {
+	if len(owners) == 0 {
+		return fn
+	}
+	return func(s *rdf.Statement, err error) {
+		fn(s, err)
+		if err != nil || !vocab.IsPath.Match(s) {
+			return
+		}
+		for _, o := range owners {
+			fn(term.Triple(s.Subject, vocab.OwnedBy.Term(), term.LiteralTerm(o)), nil)
+		}
+	}
+}
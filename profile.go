@@ -0,0 +1,116 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+)
+
+// profileFlags are the names of flags that are not shown in usage.
+var profileFlags = map[string]bool{
+	"cpuprofile": true,
+	"memprofile": true,
+	"trace":      true,
+}
+
+// usage prints the top-level command usage.
+func usage() {
+	w := flag.CommandLine.Output()
+	fmt.Fprintf(w, "Usage: %s [-v] [-log-format text|json] [-lang language] <command> [flags] [arguments]\n\nCommands:\n", os.Args[0])
+	// Size the name column from the longest command
+	// name so that names are always separated from
+	// their summaries.
+	var width int
+	for _, c := range commands {
+		if len(c.name) > width {
+			width = len(c.name)
+		}
+	}
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-*s  %s\n", width, c.name, c.summary)
+	}
+	fmt.Fprintf(w, "\nFlags:\n")
+	printDefaults(flag.CommandLine)
+	fmt.Fprintf(w, "\nRun '%s help <command>' for the flags of a command.\n", os.Args[0])
+}
+
+// printDefaults prints the defaults of the flags in fs, omitting the
+// profiling flags.
+func printDefaults(fs *flag.FlagSet) {
+	shown := flag.NewFlagSet("", flag.ContinueOnError)
+	fs.VisitAll(func(f *flag.Flag) {
+		if !profileFlags[f.Name] {
+			shown.Var(f.Value, f.Name, f.Usage)
+			shown.Lookup(f.Name).DefValue = f.DefValue
+		}
+	})
+	shown.SetOutput(fs.Output())
+	shown.PrintDefaults()
+}
+
+// startProfiling starts CPU profiling and execution tracing if the cpu and
+// exec paths are not empty. The returned stop function ends the profiling
+// and writes a heap profile to the mem path if it is not empty.
+func startProfiling(cpu, mem, exec string) (stop func() error, err error) {
+	var stops []func() error
+	stop = func() error {
+		var err error
+		for i := len(stops) - 1; i >= 0; i-- {
+			if e := stops[i](); err == nil {
+				err = e
+			}
+		}
+		return err
+	}
+	if cpu != "" {
+		f, err := os.Create(cpu)
+		if err != nil {
+			return nil, err
+		}
+		err = pprof.StartCPUProfile(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		stops = append(stops, func() error {
+			pprof.StopCPUProfile()
+			return f.Close()
+		})
+	}
+	if exec != "" {
+		f, err := os.Create(exec)
+		if err != nil {
+			stop()
+			return nil, err
+		}
+		err = trace.Start(f)
+		if err != nil {
+			f.Close()
+			stop()
+			return nil, err
+		}
+		stops = append(stops, func() error {
+			trace.Stop()
+			return f.Close()
+		})
+	}
+	if mem != "" {
+		stops = append(stops, func() error {
+			f, err := os.Create(mem)
+			if err != nil {
+				return err
+			}
+			runtime.GC()
+			err = pprof.WriteHeapProfile(f)
+			if err != nil {
+				f.Close()
+				return err
+			}
+			return f.Close()
+		})
+	}
+	return stop, nil
+}
@@ -0,0 +1,78 @@
+package query
+
+import (
+	"errors"
+	"sort"
+
+	"gonum.org/v1/gonum/graph/formats/rdf"
+
+	"github.com/efd6/ecsinrdf/term"
+)
+
+// Adoption is the adoption state of an ECS field for a package.
+type Adoption struct {
+	// Path is the quoted full path of the ECS field.
+	Path string
+	// Type is the quoted type of the ECS field.
+	Type string
+	// Present is whether the package already declares
+	// the field.
+	Present bool
+	// Equivalents holds the quoted paths of published
+	// package fields with the same name and type as the
+	// ECS field.
+	Equivalents []string
+	// Similar holds the quoted paths of published package
+	// fields with the same name as the ECS field but a
+	// different type.
+	Similar []string
+}
+
+// AdoptionPlanFor returns the adoption state of each field in the named ECS
+// field set, sorted by path. Fields without equivalent or similar package
+// fields that are not already present would be new to the package.
+//
+// The graph g is expected to hold statements constructed by the schema and
+// integration packages in this repo.
+func AdoptionPlanFor(g *rdf.Graph, fieldset string) ([]Adoption, error) {
+	name, ok := g.TermFor(term.Literal(fieldset))
+	if !ok {
+		return nil, errors.New("field set not found")
+	}
+	fields := g.Query(name).In(inFieldset)
+	if len(fields.Result()) == 0 {
+		return nil, errors.New("field set not found")
+	}
+	p := PublishedFieldsIn(g)
+	var plan []Adoption
+	for _, f := range fields.Result() {
+		for _, path := range g.Query(f).Out(byPath).Result() {
+			for _, typ := range g.Query(f).Out(byType).Result() {
+				a := Adoption{Path: path.Value, Type: typ.Value}
+				a.Present = len(g.Query(path).In(byPath).And(p).Result()) != 0
+				named := g.Query(f).Out(byName).In(byName).And(p)
+				for _, n := range named.Result() {
+					same := false
+					for _, t := range g.Query(n).Out(byUsedType).Result() {
+						same = same || t.Value == typ.Value
+					}
+					for _, np := range g.Query(n).Out(byPath).Result() {
+						if np.Value == path.Value {
+							continue
+						}
+						if same {
+							a.Equivalents = append(a.Equivalents, np.Value)
+						} else {
+							a.Similar = append(a.Similar, np.Value)
+						}
+					}
+				}
+				a.Equivalents = unique(a.Equivalents)
+				a.Similar = unique(a.Similar)
+				plan = append(plan, a)
+			}
+		}
+	}
+	sort.Slice(plan, func(i, j int) bool { return plan[i].Path < plan[j].Path })
+	return plan, nil
+}
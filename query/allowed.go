@@ -0,0 +1,116 @@
+package query
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gonum.org/v1/gonum/graph/formats/rdf"
+
+	"github.com/efd6/ecsinrdf/term"
+)
+
+// AllowedValue is an allowed value of an ECS field.
+type AllowedValue struct {
+	// Value is the quoted value.
+	Value string
+	// Descriptions holds the quoted descriptions
+	// of the value.
+	Descriptions []string
+	// ExpectedEventTypes holds the quoted event.type
+	// values expected with the value.
+	ExpectedEventTypes []string
+}
+
+// AllowedValuesOf returns the allowed values of the ECS field with the
+// quoted full path, sorted by value. Values allowed by more than one ECS
+// version in the graph are merged.
+//
+// The graph g is expected to hold statements constructed by the schema
+// package in this repo.
+func AllowedValuesOf(g *rdf.Graph, full string) []AllowedValue {
+	path, ok := g.TermFor(full)
+	if !ok {
+		return nil
+	}
+	at := g.Query(path).In(byPath)
+	fields := at.Out(byType).In(byType).And(at)
+	descs := make(map[string][]string)
+	types := make(map[string][]string)
+	for _, v := range fields.Out(hasAllowedValue).Unique().Result() {
+		q := g.Query(v)
+		for _, val := range q.Out(byValue).Result() {
+			if _, ok := types[val.Value]; !ok {
+				types[val.Value] = nil
+			}
+			for _, d := range q.Out(byDescription).Result() {
+				descs[val.Value] = append(descs[val.Value], d.Value)
+			}
+			for _, t := range q.Out(expectsEventType).Result() {
+				types[val.Value] = append(types[val.Value], t.Value)
+			}
+		}
+	}
+	allowed := make([]AllowedValue, 0, len(types))
+	for val, typs := range types {
+		allowed = append(allowed, AllowedValue{
+			Value:              val,
+			Descriptions:       unique(descs[val]),
+			ExpectedEventTypes: unique(typs),
+		})
+	}
+	sort.Slice(allowed, func(i, j int) bool { return allowed[i].Value < allowed[j].Value })
+	return allowed
+}
+
+// CategorizationIssuesOf returns the problems with the categorization of
+// an event with the quoted event.category values categories and the quoted
+// event.type values types. Values that are not allowed values of their
+// field are reported, as are types that are not expected with any of the
+// categories. Fields without allowed values, as in ECS versions before
+// their introduction, do not constrain their values, and types are not
+// constrained if any category has no expected types.
+//
+// The graph g is expected to hold statements constructed by the schema
+// package in this repo.
+func CategorizationIssuesOf(g *rdf.Graph, categories, types []string) []string {
+	allowedCategories := AllowedValuesOf(g, term.Literal("event.category"))
+	allowedTypes := AllowedValuesOf(g, term.Literal("event.type"))
+
+	var issues []string
+	expected := make(map[string]bool)
+	var unconstrained bool
+	for _, c := range categories {
+		v, ok := allowedValue(allowedCategories, c)
+		if !ok {
+			if len(allowedCategories) != 0 {
+				issues = append(issues, fmt.Sprintf("%s is not an allowed event.category value", c))
+			}
+			continue
+		}
+		for _, t := range v.ExpectedEventTypes {
+			expected[t] = true
+		}
+		unconstrained = unconstrained || len(v.ExpectedEventTypes) == 0
+	}
+	for _, t := range types {
+		if _, ok := allowedValue(allowedTypes, t); !ok && len(allowedTypes) != 0 {
+			issues = append(issues, fmt.Sprintf("%s is not an allowed event.type value", t))
+			continue
+		}
+		if len(expected) != 0 && !unconstrained && !expected[t] {
+			issues = append(issues, fmt.Sprintf("%s is not an expected event.type for event.category %s", t, strings.Join(categories, ", ")))
+		}
+	}
+	return issues
+}
+
+// allowedValue returns the allowed value in allowed with the quoted value
+// val.
+func allowedValue(allowed []AllowedValue, val string) (AllowedValue, bool) {
+	i := sort.Search(len(allowed), func(i int) bool { return allowed[i].Value >= val })
+	if i < len(allowed) && allowed[i].Value == val {
+		return allowed[i], true
+	}
+	return AllowedValue{}, false
+}
@@ -0,0 +1,83 @@
+package query
+
+import (
+	"fmt"
+	"sort"
+
+	"gonum.org/v1/gonum/graph/formats/rdf"
+)
+
+// AnalysisDeviation is a published field with analysis settings that
+// deviate from ECS practice.
+type AnalysisDeviation struct {
+	// Path is the quoted full path of the field.
+	Path string
+	// Reasons holds descriptions of the deviations.
+	Reasons []string
+}
+
+// AnalysisDeviationsIn returns the published fields and multi-fields in the
+// graph that use a custom index or search analyzer, or that enable norms on
+// a field type other than text. ECS text fields use the standard analyzer,
+// and ECS does not enable norms on non-text fields since they are not
+// used for scoring. These settings are frequently retained unintentionally
+// when field definitions are copied from older Beats modules.
+//
+// The graph g is expected to hold statements constructed by the integration
+// package in this repo.
+func AnalysisDeviationsIn(g *rdf.Graph) []AnalysisDeviation {
+	p := PublishedFieldsIn(g)
+	analyzed := p.Out(byAnalyzer).In(byAnalyzer).And(p)
+	normed := p.Out(hasNorms).In(hasNorms).And(p)
+	reasons := make(map[string][]string)
+	for _, f := range analyzed.Or(normed).Unique().Result() {
+		var r []string
+		for _, a := range []struct {
+			name string
+			fn   func(*rdf.Statement) bool
+		}{
+			{name: "analyzer", fn: byIndexAnalyzer},
+			{name: "search_analyzer", fn: bySearchAnalyzer},
+		} {
+			for _, t := range g.Query(f).Out(a.fn).Result() {
+				if t.Value != `"standard"` {
+					r = append(r, fmt.Sprintf("custom %s %s", a.name, t.Value))
+				}
+			}
+		}
+		if len(g.Query(f).Out(hasNorms).Result()) != 0 {
+			text := false
+			for _, t := range g.Query(f).Out(byUsedType).Result() {
+				text = text || t.Value == `"text"` || t.Value == `"match_only_text"`
+			}
+			if !text {
+				r = append(r, "norms enabled on non-text field")
+			}
+		}
+		if len(r) == 0 {
+			continue
+		}
+		for _, path := range g.Query(f).Out(byPath).Result() {
+			reasons[path.Value] = append(reasons[path.Value], r...)
+		}
+	}
+
+	deviations := make([]AnalysisDeviation, 0, len(reasons))
+	for path, r := range reasons {
+		deviations = append(deviations, AnalysisDeviation{Path: path, Reasons: unique(r)})
+	}
+	sort.Slice(deviations, func(i, j int) bool { return deviations[i].Path < deviations[j].Path })
+	return deviations
+}
+
+// unique returns the sorted unique elements of s.
+func unique(s []string) []string {
+	sort.Strings(s)
+	u := s[:0]
+	for i, e := range s {
+		if i == 0 || e != s[i-1] {
+			u = append(u, e)
+		}
+	}
+	return u
+}
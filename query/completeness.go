@@ -0,0 +1,138 @@
+package query
+
+import (
+	"sort"
+
+	"gonum.org/v1/gonum/graph/formats/rdf"
+)
+
+// FieldCompleteness is the metadata completeness of a published field.
+type FieldCompleteness struct {
+	// Path is the quoted full path of the field.
+	Path string
+	// Score is the fraction of applicable metadata
+	// attributes that are present.
+	Score float64
+	// Missing holds the names of applicable metadata
+	// attributes that are absent.
+	Missing []string
+}
+
+// DataStreamCompleteness is the metadata completeness of the fields of a
+// data stream.
+type DataStreamCompleteness struct {
+	// DataStream is the quoted name of the data stream.
+	// It is empty for package-level fields.
+	DataStream string
+	// Score is the mean score of the fields.
+	Score float64
+	// Fields holds the completeness of each field,
+	// sorted by path.
+	Fields []FieldCompleteness
+}
+
+// numericTypes is the set of quoted numeric field types.
+var numericTypes = map[string]bool{
+	`"long"`:          true,
+	`"integer"`:       true,
+	`"short"`:         true,
+	`"byte"`:          true,
+	`"double"`:        true,
+	`"float"`:         true,
+	`"half_float"`:    true,
+	`"scaled_float"`:  true,
+	`"unsigned_long"`: true,
+}
+
+// dimensionTypes is the set of quoted field types that are commonly used
+// as time series dimensions.
+var dimensionTypes = map[string]bool{
+	`"keyword"`: true,
+	`"ip"`:      true,
+}
+
+// CompletenessIn returns the metadata completeness of the published fields
+// in the graph, grouped by data stream. Groups, multi-fields and fields
+// with an external definition are not scored.
+//
+// All fields are expected to have a description and an example. Numeric
+// fields are also expected to have a unit and a metric type, and keyword
+// and ip fields of data streams that declare metric fields are expected to
+// be marked as dimensions.
+//
+// The graph g is expected to hold statements constructed by the integration
+// package in this repo.
+func CompletenessIn(g *rdf.Graph) []DataStreamCompleteness {
+	p := PublishedFieldsIn(g)
+	typed := p.Out(byUsedType).In(byUsedType).And(p)
+	scored := typed.Not(typed.Out(isGroup).In(isGroup).And(typed)).
+		Not(typed.In(hasMulti).Out(hasMulti).And(typed)).
+		Not(typed.Out(isExternal).In(isExternal).And(typed))
+
+	metrics := make(map[string]bool)
+	for _, f := range p.Out(byMetricType).In(byMetricType).And(p).Result() {
+		metrics[dataStreamOf(g, f)] = true
+	}
+
+	byStream := make(map[string][]FieldCompleteness)
+	for _, f := range scored.Result() {
+		ds := dataStreamOf(g, f)
+		var applicable int
+		var missing []string
+		check := func(name string, ok bool) {
+			applicable++
+			if !ok {
+				missing = append(missing, name)
+			}
+		}
+		has := func(fn func(*rdf.Statement) bool) bool {
+			return len(g.Query(f).Out(fn).Result()) != 0
+		}
+		check("description", has(hasDescription))
+		check("example", has(hasExample))
+		var numeric, dimension bool
+		for _, t := range g.Query(f).Out(byUsedType).Result() {
+			numeric = numeric || numericTypes[t.Value]
+			dimension = dimension || dimensionTypes[t.Value]
+		}
+		if numeric {
+			check("unit", has(byUnit))
+			check("metric_type", has(byMetricType))
+		}
+		if dimension && metrics[ds] {
+			check("dimension", has(isDimension))
+		}
+		for _, path := range g.Query(f).Out(byPath).Result() {
+			byStream[ds] = append(byStream[ds], FieldCompleteness{
+				Path:    path.Value,
+				Score:   float64(applicable-len(missing)) / float64(applicable),
+				Missing: missing,
+			})
+		}
+	}
+
+	completeness := make([]DataStreamCompleteness, 0, len(byStream))
+	for ds, fields := range byStream {
+		sort.Slice(fields, func(i, j int) bool { return fields[i].Path < fields[j].Path })
+		var sum float64
+		for _, f := range fields {
+			sum += f.Score
+		}
+		completeness = append(completeness, DataStreamCompleteness{
+			DataStream: ds,
+			Score:      sum / float64(len(fields)),
+			Fields:     fields,
+		})
+	}
+	sort.Slice(completeness, func(i, j int) bool { return completeness[i].DataStream < completeness[j].DataStream })
+	return completeness
+}
+
+// dataStreamOf returns the quoted name of the data stream holding the field
+// node f, or the empty string if f is not in a data stream.
+func dataStreamOf(g *rdf.Graph, f rdf.Term) string {
+	for _, ds := range g.Query(f).Out(inDataStream).Out(isDataStream).Result() {
+		return ds.Value
+	}
+	return ""
+}
@@ -0,0 +1,148 @@
+package query
+
+import (
+	"sort"
+
+	"gonum.org/v1/gonum/graph/formats/rdf"
+
+	"github.com/efd6/ecsinrdf/vocab"
+)
+
+// FieldChange is an ECS field that differs between two ECS versions.
+type FieldChange struct {
+	// Path is the quoted full path of the field.
+	Path string
+	// Old and New hold the quoted types or field
+	// sets of the field in the old and new versions.
+	Old, New []string
+}
+
+// ECSDiff is the field-level difference between two ECS versions.
+type ECSDiff struct {
+	// Added and Removed hold the ECS fields only
+	// present in the new and old versions. The
+	// Old and New values of the changes are the
+	// field's types.
+	Added, Removed []FieldChange
+	// TypeChanged holds the ECS fields present in
+	// both versions with different types.
+	TypeChanged []FieldChange
+	// ReuseChanged holds the ECS fields present in
+	// both versions that are defined by different
+	// field sets, as happens when a field set is
+	// reused in a different place or a field moves
+	// between field sets.
+	ReuseChanged []FieldChange
+}
+
+// DiffECS returns the differences between the ECS fields in the old and
+// new graphs. Each list of changes is sorted by path. Group nodes are not
+// considered fields, so the addition of a field set is reported as the
+// addition of its fields.
+//
+// The graphs are expected to hold statements constructed by the schema
+// package in this repo.
+func DiffECS(old, new *rdf.Graph) ECSDiff {
+	before := ecsFieldsIn(old)
+	after := ecsFieldsIn(new)
+	var d ECSDiff
+	for path, a := range after {
+		b, ok := before[path]
+		if !ok {
+			d.Added = append(d.Added, FieldChange{Path: path, New: a.types})
+			continue
+		}
+		if !equalElements(b.types, a.types) {
+			d.TypeChanged = append(d.TypeChanged, FieldChange{Path: path, Old: b.types, New: a.types})
+		}
+		if !equalElements(b.fieldsets, a.fieldsets) {
+			d.ReuseChanged = append(d.ReuseChanged, FieldChange{Path: path, Old: b.fieldsets, New: a.fieldsets})
+		}
+	}
+	for path, b := range before {
+		if _, ok := after[path]; !ok {
+			d.Removed = append(d.Removed, FieldChange{Path: path, Old: b.types})
+		}
+	}
+	for _, changes := range [][]FieldChange{d.Added, d.Removed, d.TypeChanged, d.ReuseChanged} {
+		sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	}
+	return d
+}
+
+// ecsField is the types and field sets of an ECS field.
+type ecsField struct {
+	types, fieldsets []string
+}
+
+// ecsFieldsIn returns the quoted types and field sets of the ECS fields
+// in the graph, keyed by quoted full path. The types and field sets are
+// sorted.
+func ecsFieldsIn(g *rdf.Graph) map[string]ecsField {
+	fields := make(map[string]ecsField)
+	for it := g.AllStatements(); it.Next(); {
+		s := it.Statement()
+		if !byType(s) || s.Object.Value == vocab.Group {
+			continue
+		}
+		for _, n := range g.Query(s.Subject).Out(byPath).Result() {
+			f := fields[n.Value]
+			f.types = appendUnique(f.types, s.Object.Value)
+			for _, fs := range g.Query(s.Subject).Out(inFieldset).Result() {
+				f.fieldsets = appendUnique(f.fieldsets, fs.Value)
+			}
+			fields[n.Value] = f
+		}
+	}
+	for _, f := range fields {
+		sort.Strings(f.types)
+		sort.Strings(f.fieldsets)
+	}
+	return fields
+}
+
+// appendUnique returns s with v appended if it is not already held.
+func appendUnique(s []string, v string) []string {
+	for _, e := range s {
+		if e == v {
+			return s
+		}
+	}
+	return append(s, v)
+}
+
+// ExternalImpactIn returns the differences between the ECS fields in the
+// old and new graphs for the paths of published package fields in the old
+// graph that are declared as external ECS fields. Fields added by the new
+// version are only reported if they are declared external but absent from
+// the old version.
+//
+// The old graph is expected to hold statements constructed by the schema
+// and integration packages in this repo, and the new graph statements
+// constructed by the schema package.
+func ExternalImpactIn(old, new *rdf.Graph) ECSDiff {
+	external := make(map[string]bool)
+	node, ok := old.TermFor(`"ecs"`)
+	if ok {
+		p := PublishedFieldsIn(old)
+		for _, n := range old.Query(node).In(isExternal).And(p).Out(byPath).Unique().Result() {
+			external[n.Value] = true
+		}
+	}
+	d := DiffECS(old, new)
+	filter := func(changes []FieldChange) []FieldChange {
+		var kept []FieldChange
+		for _, c := range changes {
+			if external[c.Path] {
+				kept = append(kept, c)
+			}
+		}
+		return kept
+	}
+	return ECSDiff{
+		Added:        filter(d.Added),
+		Removed:      filter(d.Removed),
+		TypeChanged:  filter(d.TypeChanged),
+		ReuseChanged: filter(d.ReuseChanged),
+	}
+}
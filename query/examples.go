@@ -0,0 +1,58 @@
+package query
+
+import (
+	"gonum.org/v1/gonum/graph/formats/rdf"
+
+	"github.com/efd6/ecsinrdf/vocab"
+)
+
+// FieldsMissingExamplesIn returns a query holding published fields in the
+// graph that have no example. Groups, multi-fields and fields with an
+// external definition are not included since their examples are not
+// declared by the package.
+//
+// The graph g is expected to hold statements constructed by the integration
+// package in this repo.
+func FieldsMissingExamplesIn(g *rdf.Graph) rdf.Query {
+	p := PublishedFieldsIn(g)
+	groups := p.Out(isGroup).In(isGroup).And(p)
+	multis := p.In(hasMulti).Out(hasMulti).And(p)
+	external := p.Out(isExternal).In(isExternal).And(p)
+	exemplified := p.Out(hasExample).In(hasExample).And(p)
+	return p.Not(groups).Not(multis).Not(external).Not(exemplified)
+}
+
+// ECSFieldsMissingExamplesIn returns a query holding the ECS fields in the
+// graph that have no example. Groups and multi-fields are not included.
+//
+// The graph g is expected to hold statements constructed by the schema
+// package in this repo.
+func ECSFieldsMissingExamplesIn(g *rdf.Graph) rdf.Query {
+	var fields []rdf.Term
+	for it := g.AllStatements(); it.Next(); {
+		s := it.Statement()
+		if byType(s) && s.Object.Value != vocab.Group {
+			fields = append(fields, s.Subject)
+		}
+	}
+	f := g.Query(fields...).Unique()
+	multis := f.In(hasMulti).Out(hasMulti).And(f)
+	exemplified := f.Out(byExample).In(byExample).And(f)
+	return f.Not(multis).Not(exemplified)
+}
+
+// CandidateExamples returns the quoted examples of the ECS field that the
+// field with the quoted full path would be grafted to at the quoted graft
+// candidate cand, sorted lexically. The ECS field is found as described
+// by CandidateDestination. There are no examples if the ECS field has
+// none or cannot be found.
+//
+// The graph g is expected to hold statements constructed by the schema
+// package in this repo.
+func CandidateExamples(g *rdf.Graph, full, cand string, rules PathRules) ([]string, error) {
+	f, ok, err := CandidateDestination(g, full, cand, rules)
+	if !ok || err != nil {
+		return nil, err
+	}
+	return f.Examples, nil
+}
@@ -4,87 +4,544 @@ package query
 import (
 	"errors"
 	"fmt"
-	"strconv"
+	"sort"
 	"strings"
+	"time"
 
 	"gonum.org/v1/gonum/graph/formats/rdf"
+
+	"github.com/efd6/ecsinrdf/template"
+	"github.com/efd6/ecsinrdf/term"
+	"github.com/efd6/ecsinrdf/vocab"
 )
 
 // PublishedFieldsIn returns a query holding published fields in the graph.
 func PublishedFieldsIn(g *rdf.Graph) rdf.Query {
 	// Selecting the true node is redundant with the
 	// isPublished helper, but reduces the search space.
-	node, ok := g.TermFor(`"true"`)
+	node, ok := g.TermFor(vocab.True)
 	if !ok {
 		return rdf.Query{}
 	}
 	return g.Query(node).In(isPublished).Unique()
 }
 
+// ObservedFieldsIn returns a query holding fields observed in documents
+// in the graph.
+func ObservedFieldsIn(g *rdf.Graph) rdf.Query {
+	node, ok := g.TermFor(vocab.True)
+	if !ok {
+		return rdf.Query{}
+	}
+	return g.Query(node).In(isObserved).Unique()
+}
+
+// UnobservedFieldsIn returns a query holding published fields in the graph
+// that do not appear in any observed document. Groups and multi-fields are
+// not included since they are never present in documents.
+//
+// The graph g is expected to hold statements constructed by the integration
+// and document packages in this repo.
+func UnobservedFieldsIn(g *rdf.Graph) rdf.Query {
+	p := PublishedFieldsIn(g)
+	groups := p.Out(isGroup).In(isGroup).And(p)
+	multis := p.In(hasMulti).Out(hasMulti).And(p)
+	observed := ObservedFieldsIn(g).Out(byPath).In(byPath).And(p)
+	return p.Not(groups).Not(multis).Not(observed)
+}
+
+// UndeclaredFieldsIn returns a query holding observed fields in the graph
+// that have no published declaration. Fields under a declared object with
+// mapping disabled are intentionally unmapped and fields covered by a
+// dynamic template implied by a declared object field are mapped on
+// ingest, so neither are included. Fields added by agent processors are
+// weakly declared and are also not included.
+//
+// The graph g is expected to hold statements constructed by the integration
+// and document packages in this repo, and optionally the agent package.
+func UndeclaredFieldsIn(g *rdf.Graph) (rdf.Query, error) {
+	o := ObservedFieldsIn(g)
+	declared := PublishedFieldsIn(g).Out(byPath).In(byPath).And(o)
+	disabled, err := DisabledPathsIn(g)
+	if err != nil {
+		return rdf.Query{}, err
+	}
+	templates, err := DynamicTemplatesIn(g)
+	if err != nil {
+		return rdf.Query{}, err
+	}
+	wildcards, err := WildcardPathsIn(g)
+	if err != nil {
+		return rdf.Query{}, err
+	}
+	hinted, hintedObjects, err := hintedPathsIn(g)
+	if err != nil {
+		return rdf.Query{}, err
+	}
+	var undeclared []rdf.Term
+	for _, f := range o.Not(declared).Result() {
+		var kind string
+		if k := g.Query(f).Out(byValueType).Result(); len(k) != 0 {
+			kind, err = term.Text(k[0].Value)
+			if err != nil {
+				return rdf.Query{}, err
+			}
+		}
+		for _, p := range g.Query(f).Out(byPath).Result() {
+			path, err := term.Text(p.Value)
+			if err != nil {
+				return rdf.Query{}, err
+			}
+			if isUnder(path, disabled) || matchesAny(path, wildcards) || hinted[path] || isUnder(path, hintedObjects) {
+				continue
+			}
+			_, ok, err := firstMatch(templates, path, kind)
+			if err != nil {
+				return rdf.Query{}, err
+			}
+			if !ok {
+				undeclared = append(undeclared, f)
+			}
+		}
+	}
+	return g.Query(undeclared...).Unique(), nil
+}
+
+// WildcardPathsIn returns the unquoted full paths of published fields in the
+// graph that have a wildcard path element. The fields are found by walking
+// the children and collapsed descendants of wildcard nodes.
+func WildcardPathsIn(g *rdf.Graph) ([]string, error) {
+	node, ok := g.TermFor(vocab.True)
+	if !ok {
+		return nil, nil
+	}
+	p := PublishedFieldsIn(g)
+	q := g.Query(node).In(isWildcard).And(p)
+	fields := q
+	for len(q.Result()) != 0 {
+		q = q.Out(hasChildOrDescendant).Unique()
+		fields = fields.Or(q)
+	}
+	var paths []string
+	for _, t := range fields.And(p).Out(byPath).Unique().Result() {
+		path, err := term.Text(t.Value)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// matchesAny returns whether path matches any of the provided patterns
+// where a "*" pattern path element matches any single path element.
+func matchesAny(path string, patterns []string) bool {
+	elems := strings.Split(path, ".")
+	for _, p := range patterns {
+		pElems := strings.Split(p, ".")
+		if len(pElems) != len(elems) {
+			continue
+		}
+		match := true
+		for i, e := range pElems {
+			if e != wildcard && e != elems[i] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// DisabledPathsIn returns the unquoted full paths of published fields in the
+// graph that have mapping disabled.
+func DisabledPathsIn(g *rdf.Graph) ([]string, error) {
+	node, ok := g.TermFor(vocab.False)
+	if !ok {
+		return nil, nil
+	}
+	var paths []string
+	p := PublishedFieldsIn(g)
+	for _, t := range g.Query(node).In(isDisabled).And(p).Out(byPath).Unique().Result() {
+		path, err := term.Text(t.Value)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// isUnder returns whether path is strictly under any of the provided parent
+// paths.
+func isUnder(path string, parents []string) bool {
+	for _, p := range parents {
+		if strings.HasPrefix(path, p+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// OwnersOf returns the unquoted names of the teams owning published fields
+// with the provided full path, sorted lexically. The full path is expected
+// to be quoted as an unqualified RDF literal.
+//
+// The graph g is expected to hold statements constructed by the owner
+// package in this repo.
+func OwnersOf(g *rdf.Graph, full string) []string {
+	node, ok := g.TermFor(full)
+	if !ok {
+		return nil
+	}
+	p := PublishedFieldsIn(g)
+	var owners []string
+	for _, o := range g.Query(node).In(byPath).And(p).Out(ownedBy).Unique().Result() {
+		name, err := term.Text(o.Value)
+		if err != nil {
+			continue
+		}
+		owners = append(owners, name)
+	}
+	sort.Strings(owners)
+	return owners
+}
+
+// DataStreamsOf returns the quoted names of the data streams declaring
+// published fields with the provided full path, sorted lexically. The full
+// path is expected to be quoted as an unqualified RDF literal.
+//
+// The graph g is expected to hold statements constructed by
+// integration.DataStreamStatements.
+func DataStreamsOf(g *rdf.Graph, full string) []string {
+	node, ok := g.TermFor(full)
+	if !ok {
+		return nil
+	}
+	p := PublishedFieldsIn(g)
+	var streams []string
+	for _, ds := range g.Query(node).In(byPath).And(p).Out(inDataStream).Out(isDataStream).Unique().Result() {
+		streams = append(streams, ds.Value)
+	}
+	sort.Strings(streams)
+	return streams
+}
+
+// ReferencesTo returns the unquoted Kibana saved objects, as "type/id",
+// that refer to the field with the provided full path or to fields below
+// it, sorted lexically. The full path is expected to be quoted as an
+// unqualified RDF literal.
+//
+// The graph g is expected to hold statements constructed by the kibana
+// package in this repo.
+func ReferencesTo(g *rdf.Graph, full string) []string {
+	prefix, err := term.Text(full)
+	if err != nil {
+		return nil
+	}
+	seen := make(map[string]bool)
+	var refs []string
+	for it := g.AllStatements(); it.Next(); {
+		s := it.Statement()
+		if !referencedBy(s) {
+			continue
+		}
+		for _, p := range g.Query(s.Subject).Out(byPath).Result() {
+			path, err := term.Text(p.Value)
+			if err != nil || (path != prefix && !strings.HasPrefix(path, prefix+".")) {
+				continue
+			}
+			ref, err := term.Text(s.Object.Value)
+			if err != nil || seen[ref] {
+				continue
+			}
+			seen[ref] = true
+			refs = append(refs, ref)
+		}
+	}
+	sort.Strings(refs)
+	return refs
+}
+
+// Conflict is a field path that is declared with different types in
+// different data streams.
+type Conflict struct {
+	// Path is the quoted full path of the field.
+	Path string
+	// Types maps each quoted type declared for the
+	// path to the quoted names of the data streams
+	// declaring it.
+	Types map[string][]string
+	// Destinations holds the quoted datasets that
+	// receive documents holding the path with more
+	// than one type, either from their own data
+	// streams or by rerouting.
+	Destinations []string
+}
+
+// DataStreamConflictsIn returns the field paths in the graph that are
+// declared with different types in different data streams. Fields are
+// joined on their path and only fields in a data stream context are
+// considered. Conflicting data streams whose documents may be indexed
+// into the same dataset, directly or through reroutes, are reported as
+// conflict destinations.
+//
+// The graph g is expected to hold statements constructed by
+// integration.DataStreamStatements and routing.DataStreamStatements.
+func DataStreamConflictsIn(g *rdf.Graph) []Conflict {
+	p := PublishedFieldsIn(g)
+	inContext := p.Out(inDataStream).In(inDataStream).And(p)
+	destinations := make(map[rdf.Term][]string)
+	for _, ctx := range inContext.Out(inDataStream).Unique().Result() {
+		destinations[ctx] = destinationsOf(g, ctx)
+	}
+	var conflicts []Conflict
+	for _, path := range inContext.Out(byPath).Unique().Result() {
+		types := make(map[string][]string)
+		destTypes := make(map[string]map[string]bool)
+		for _, f := range g.Query(path).In(byPath).And(inContext).Result() {
+			contexts := g.Query(f).Out(inDataStream).Result()
+			streams := g.Query(contexts...).Out(isDataStream).Result()
+			for _, t := range g.Query(f).Out(byUsedType).Result() {
+				for _, ds := range streams {
+					types[t.Value] = append(types[t.Value], ds.Value)
+				}
+				for _, ctx := range contexts {
+					for _, d := range destinations[ctx] {
+						if destTypes[d] == nil {
+							destTypes[d] = make(map[string]bool)
+						}
+						destTypes[d][t.Value] = true
+					}
+				}
+			}
+		}
+		if len(types) < 2 {
+			continue
+		}
+		for _, streams := range types {
+			sort.Strings(streams)
+		}
+		c := Conflict{Path: path.Value, Types: types}
+		for d, t := range destTypes {
+			if len(t) > 1 {
+				c.Destinations = append(c.Destinations, d)
+			}
+		}
+		sort.Strings(c.Destinations)
+		conflicts = append(conflicts, c)
+	}
+	sort.Slice(conflicts, func(i, j int) bool { return conflicts[i].Path < conflicts[j].Path })
+	return conflicts
+}
+
+// destinationsOf returns the quoted datasets that documents of the data
+// stream context ctx may be indexed into: the data stream's own dataset
+// and the datasets reachable from it by reroutes.
+func destinationsOf(g *rdf.Graph, ctx rdf.Term) []string {
+	seen := make(map[rdf.Term]bool)
+	next := g.Query(ctx).Out(inDataset).Result()
+	for len(next) != 0 {
+		var unseen []rdf.Term
+		for _, d := range next {
+			if !seen[d] {
+				seen[d] = true
+				unseen = append(unseen, d)
+			}
+		}
+		if len(unseen) == 0 {
+			break
+		}
+		next = g.Query(unseen...).Out(reroutesTo).Result()
+	}
+	var names []string
+	for d := range seen {
+		for _, n := range g.Query(d).Out(isDataset).Result() {
+			names = append(names, n.Value)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
 // CandidateGrafts returns a list of potential ECS graft candidate
 // destinations for the field with the provided full path. The field
 // must already be in the the graph. Candidates will have the same type
-// as the query field and will have matching path suffixes.
+// as the query field and will have matching path suffixes. A "*" path
+// element matches any name.
 //
 // The full path is expected to be quoted as an unqualified RDF literal.
+// The path is rewritten by the rules before it is walked.
 //
 // The graph g is expected to be an ECS graph with statements relating
 // to the ECS and package field constructed by the schema and integration
 // packages in this repo.
-func CandidateGraftsIn(g *rdf.Graph, full string) ([]string, error) {
+//
+// If the field has no type but has a type inferred from its example, the
+// inferred type is used. InferredTypeOf can be used to determine whether
+// this is the case.
+func CandidateGraftsIn(g *rdf.Graph, full string, rules PathRules) ([]string, error) {
+	cands, _, err := LimitedCandidateGraftsIn(g, full, rules, Limits{})
+	return cands, err
+}
+
+// LimitedCandidateGraftsIn is CandidateGraftsIn with the work done bounded
+// by lim. If a limit is reached, the candidates found so far are returned
+// and truncated is true.
+func LimitedCandidateGraftsIn(g *rdf.Graph, full string, rules PathRules, lim Limits) (cands []string, truncated bool, err error) {
 	node, ok := g.TermFor(full)
 	if !ok {
-		return nil, errors.New("not found")
+		return nil, false, errors.New("not found")
 	}
-	full, err := strconv.Unquote(full)
+	full, err = term.Text(full)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
-	path := strings.Split(full, ".")
+	path := rules.Apply(strings.Split(full, "."))
 
 	// Select nodes that that are the right full path.
 	q := g.Query(node).In(byPath)
 	// Confirm it is published and get its type. There should be exactly one.
-	typs := q.Out(isPublished).In(isPublished).And(q).Out(byUsedType).Unique().Result()
+	published := q.Out(isPublished).In(isPublished).And(q)
+	typs := published.Out(byUsedType).Unique().Result()
+	if len(typs) == 0 {
+		// Fall back to a type inferred from examples.
+		typs = published.Out(byInferredType).Unique().Result()
+	}
 	switch len(typs) {
 	case 0:
-		return nil, errors.New("no type")
+		return nil, false, errors.New("no type")
 	case 1:
 	default:
-		typeNames := make([]string, len(typs))
-		for i, s := range typs {
-			typeNames[i] = s.Value
-		}
-		return nil, fmt.Errorf("found multiple types: %v", typeNames)
+		return nil, false, &MultipleTypesError{Path: full, Sources: TypeSourcesOf(g, node.Value)}
 	}
 
 	// Get all the other nodes with the same name.
 	q = q.Out(byName).In(byName).Not(q)
 
 	// Walk the path.
-	paths := walkMatchingPath(q, typs[0], path)
-	return paths, nil
+	cands, truncated = walkMatchingPath(g, q, typs[0], path, rules, lim)
+	return cands, truncated, nil
+}
+
+// MultipleTypesError is the error returned by CandidateGraftsIn when a
+// field is declared with more than one type.
+type MultipleTypesError struct {
+	// Path is the unquoted full path of the field.
+	Path string
+	// Sources maps each quoted type declared for
+	// the field to the sources declaring it as
+	// returned by TypeSourcesOf.
+	Sources map[string][]string
+}
+
+func (e *MultipleTypesError) Error() string {
+	typs := make([]string, 0, len(e.Sources))
+	for t := range e.Sources {
+		typs = append(typs, t)
+	}
+	sort.Strings(typs)
+	var buf strings.Builder
+	buf.WriteString("found multiple types:")
+	for i, t := range typs {
+		if i != 0 {
+			buf.WriteByte(';')
+		}
+		fmt.Fprintf(&buf, " %s from %s", t, strings.Join(e.Sources[t], ", "))
+	}
+	return buf.String()
+}
+
+// TypeSourcesOf returns the quoted types declared for published fields with
+// the provided full path mapped to descriptions of the sources declaring
+// them. A source is described by its file and data stream when these are
+// known. The full path is expected to be quoted as an unqualified RDF
+// literal.
+//
+// The graph g is expected to hold statements constructed by
+// integration.SourceStatements.
+func TypeSourcesOf(g *rdf.Graph, full string) map[string][]string {
+	node, ok := g.TermFor(full)
+	if !ok {
+		return nil
+	}
+	q := g.Query(node).In(byPath)
+	published := q.Out(isPublished).In(isPublished).And(q)
+	sources := make(map[string][]string)
+	for _, f := range published.Result() {
+		var desc []string
+		for _, file := range g.Query(f).Out(definedIn).Result() {
+			desc = append(desc, file.Value)
+		}
+		for _, ds := range g.Query(f).Out(inDataStream).Out(isDataStream).Result() {
+			desc = append(desc, "data stream "+ds.Value)
+		}
+		src := "unknown source"
+		if len(desc) != 0 {
+			src = strings.Join(desc, " in ")
+		}
+		for _, t := range g.Query(f).Out(byUsedType).Result() {
+			sources[t.Value] = append(sources[t.Value], src)
+		}
+	}
+	for _, s := range sources {
+		sort.Strings(s)
+	}
+	return sources
+}
+
+// InferredTypeOf returns the quoted type inferred from the example of the
+// published field with the provided full path when the field has no
+// declared type. The full path is expected to be quoted as an unqualified
+// RDF literal.
+func InferredTypeOf(g *rdf.Graph, full string) (string, bool) {
+	node, ok := g.TermFor(full)
+	if !ok {
+		return "", false
+	}
+	q := g.Query(node).In(byPath)
+	published := q.Out(isPublished).In(isPublished).And(q)
+	if len(published.Out(byUsedType).Result()) != 0 {
+		return "", false
+	}
+	typs := published.Out(byInferredType).Unique().Result()
+	if len(typs) != 1 {
+		return "", false
+	}
+	return typs[0].Value, true
 }
 
 // CandidateGraftsFor returns a list of potential ECS graft candidate
 // destinations for the field with the provided full path and typ.
 // Candidates will have the same type as the query field and will have
-// matching path suffixes.
+// matching path suffixes. A "*" path element matches any name.
 //
 // The full path and typ are expected to be quoted as unqualified RDF literals.
+// The path is rewritten by the rules before it is walked.
 //
 // The graph g is expected to be an ECS graph with statements relating
 // to the ECS field constructed by the schema packages in this repo.
 // It may contain statements relating to integration fields.
-func CandidateGraftsFor(g *rdf.Graph, full, typ string) ([]string, error) {
-	full, err := strconv.Unquote(full)
+func CandidateGraftsFor(g *rdf.Graph, full, typ string, rules PathRules) ([]string, error) {
+	cands, _, err := LimitedCandidateGraftsFor(g, full, typ, rules, Limits{})
+	return cands, err
+}
+
+// LimitedCandidateGraftsFor is CandidateGraftsFor with the work done
+// bounded by lim. If a limit is reached, the candidates found so far are
+// returned and truncated is true.
+func LimitedCandidateGraftsFor(g *rdf.Graph, full, typ string, rules PathRules, lim Limits) (cands []string, truncated bool, err error) {
+	full, err = term.Text(full)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
-	path := strings.Split(full, ".")
-	node, ok := g.TermFor(strconv.Quote(path[len(path)-1]))
+	path := rules.Apply(strings.Split(full, "."))
+	node, ok := g.TermFor(term.Literal(path[len(path)-1]))
 	if !ok {
-		return nil, errors.New("path not found")
+		return nil, false, errors.New("path not found")
 	}
 
 	// Select nodes that that are the right name.
@@ -92,31 +549,335 @@ func CandidateGraftsFor(g *rdf.Graph, full, typ string) ([]string, error) {
 	// Get the typ node.
 	typs, ok := g.TermFor(typ)
 	if !ok {
-		return nil, errors.New("type not found")
+		return nil, false, errors.New("type not found")
 	}
 
 	// Walk the path.
-	paths := walkMatchingPath(q, typs, path)
-	return paths, nil
+	cands, truncated = walkMatchingPath(g, q, typs, path, rules, lim)
+	return cands, truncated, nil
+}
+
+// Limits bound the work done by a graft candidate query so that a
+// pathological query, such as one with many wildcard elements over the
+// graph of a repo of packages, cannot consume the process. The zero value
+// imposes no limits.
+type Limits struct {
+	// FanOut is the maximum number of nodes held
+	// at each step of a path walk. Nodes beyond
+	// the limit are dropped in label order.
+	FanOut int
+	// Results is the maximum number of candidates
+	// returned. The shallowest candidates, and then
+	// the lexically first, are retained.
+	Results int
+	// Timeout is the maximum time spent walking
+	// a path. When it is reached, the walk stops
+	// with the candidates of the last completed
+	// step. The first step is always completed.
+	Timeout time.Duration
+}
+
+// bound returns the nodes in q limited to lim.FanOut and whether any were
+// dropped.
+func (lim Limits) bound(g *rdf.Graph, q rdf.Query) (rdf.Query, bool) {
+	if lim.FanOut <= 0 {
+		return q, false
+	}
+	nodes := q.Result()
+	if len(nodes) <= lim.FanOut {
+		return q, false
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Value < nodes[j].Value })
+	return g.Query(nodes[:lim.FanOut]...), true
+}
+
+// PathRules describe how package paths are rewritten before they are
+// matched against ECS paths, and which ECS fields they may match.
+// Rewriting only affects matching; reported package paths retain the
+// elements that were removed.
+type PathRules struct {
+	// Prefixes holds dotted vendor prefixes,
+	// such as "cisco.asa", that are removed from
+	// the start of paths. Only the longest
+	// matching prefix is removed.
+	Prefixes []string
+	// Transparent holds dotted path segments
+	// that are skipped wherever they appear in
+	// paths as described by SkipTransparent.
+	Transparent []string
+	// Levels holds the ECS maturity levels,
+	// such as "core", of the ECS fields that
+	// paths may match. If it is empty, fields
+	// at any level may match.
+	Levels []string
+	// ReusePoints restricts candidates to the
+	// locations of ECS field sets: the locations
+	// of top level field sets and the locations
+	// field sets are expected to be reused at.
+	ReusePoints bool
+}
+
+// Apply returns the elements of path with the longest matching vendor
+// prefix removed and then the transparent segments skipped. The last
+// element of path, the field's name, is never removed. The path slice is
+// not modified.
+func (r PathRules) Apply(path []string) []string {
+	return SkipTransparent(StripPrefix(path, r.Prefixes), r.Transparent)
+}
+
+// StripPrefix returns the elements of path with the longest of the dotted
+// prefixes that path starts with removed. The last element of path, the
+// field's name, is never removed. The path slice is not modified.
+func StripPrefix(path, prefixes []string) []string {
+	var longest int
+	for _, p := range prefixes {
+		prefix := strings.Split(p, ".")
+		if len(prefix) > longest && len(prefix) < len(path) && equalElements(path[:len(prefix)], prefix) {
+			longest = len(prefix)
+		}
+	}
+	return path[longest:]
+}
+
+// SkipTransparent returns the elements of path with runs of elements
+// matching any of the dotted transparent segments removed, so that
+// "cisco.asa.json.source.ip" with transparent segments "cisco.asa" and
+// "json" is walked as "source.ip". The last element of path, the field's
+// name, is never removed. The path slice is not modified.
+func SkipTransparent(path, transparent []string) []string {
+	if len(transparent) == 0 || len(path) < 2 {
+		return path
+	}
+	segments := make([][]string, len(transparent))
+	for i, t := range transparent {
+		segments[i] = strings.Split(t, ".")
+	}
+	name := len(path) - 1
+	kept := make([]string, 0, len(path))
+outer:
+	for i := 0; i < name; {
+		for _, seg := range segments {
+			if i+len(seg) <= name && equalElements(path[i:i+len(seg)], seg) {
+				i += len(seg)
+				continue outer
+			}
+		}
+		kept = append(kept, path[i])
+		i++
+	}
+	return append(kept, path[name])
+}
+
+// equalElements returns whether the path elements in a and b are equal.
+func equalElements(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// ExcludeCandidates returns the candidates in cands whose unquoted path does
+// not match any of the provided destination path patterns. A "*" in a pattern
+// matches any sequence of characters, so "host.*" excludes all destinations
+// under host. The candidates are expected to be quoted as returned by
+// CandidateGraftsIn and CandidateGraftsFor.
+func ExcludeCandidates(cands, patterns []string) ([]string, error) {
+	if len(patterns) == 0 {
+		return cands, nil
+	}
+	var kept []string
+	for _, c := range cands {
+		path, err := term.Text(c)
+		if err != nil {
+			return nil, err
+		}
+		excluded := false
+		for _, p := range patterns {
+			if template.SimpleMatch(p, path) {
+				excluded = true
+				break
+			}
+		}
+		if !excluded {
+			kept = append(kept, c)
+		}
+	}
+	return kept, nil
+}
+
+// Candidate is a graft candidate destination.
+type Candidate struct {
+	// Path is the quoted full path of the destination.
+	Path string
+	// MultiFields holds the quoted names of the
+	// destination's multi-fields that were also
+	// candidates.
+	MultiFields []string
+	// Evidence holds the quoted paths of ECS fields
+	// used by the package that support the candidate.
+	// It is only set by callers with package context.
+	Evidence []string
+	// Examples holds the quoted examples of the ECS
+	// field the package field would be grafted to,
+	// as returned by CandidateExamples. It is only
+	// set by callers that report them.
+	Examples []string
 }
 
-func walkMatchingPath(q rdf.Query, typ rdf.Term, path []string) []string {
+// String returns the candidate's path annotated with its multi-fields.
+func (c Candidate) String() string {
+	if len(c.MultiFields) == 0 {
+		return c.Path
+	}
+	return fmt.Sprintf("%s (multi_fields: %s)", c.Path, strings.Join(c.MultiFields, ", "))
+}
+
+// CollapseMultiFields returns the candidates in cands for the field with
+// the quoted full path annotated with the multi-fields of the ECS field
+// that the field would be grafted to at each candidate, found as described
+// by CandidateDestination with the rules. Candidates whose destination is
+// a multi-field of another candidate's destination, such as message.text
+// of message, are collapsed into that candidate. The candidates are
+// expected to be quoted as returned by CandidateGraftsIn and
+// CandidateGraftsFor, and their order is retained.
+func CollapseMultiFields(g *rdf.Graph, full string, cands []string, rules PathRules) ([]Candidate, error) {
+	dsts := make([]rdf.Query, len(cands))
+	index := make(map[string]int)
+	for i, c := range cands {
+		f, ok, err := CandidateDestination(g, full, c, rules)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		node, ok := g.TermFor(f.Path)
+		if !ok {
+			continue
+		}
+		dsts[i] = g.Query(node).In(byPath)
+		if _, ok := index[f.Path]; !ok {
+			index[f.Path] = i
+		}
+	}
+	multis := make(map[int][]string)
+	folded := make(map[int]bool)
+	for i, m := range dsts {
+		if len(m.Result()) == 0 {
+			continue
+		}
+		for _, name := range m.Out(hasMulti).Out(byName).Unique().Result() {
+			multis[i] = append(multis[i], name.Value)
+		}
+		for _, parent := range m.In(hasMulti).Out(byPath).Unique().Result() {
+			j, ok := index[parent.Value]
+			if !ok || j == i {
+				continue
+			}
+			for _, name := range m.Out(byName).Unique().Result() {
+				multis[j] = append(multis[j], name.Value)
+			}
+			folded[i] = true
+			break
+		}
+	}
+	collapsed := make([]Candidate, 0, len(cands)-len(folded))
+	for i, c := range cands {
+		if folded[i] {
+			continue
+		}
+		collapsed = append(collapsed, Candidate{Path: c, MultiFields: unique(multis[i])})
+	}
+	return collapsed, nil
+}
+
+// CandidateDestination returns the ECS field that the field with the
+// quoted full path would be grafted to at the quoted graft candidate cand.
+// The candidate is expected to have been returned by CandidateGraftsIn or
+// CandidateGraftsFor for the field with the same rules. The ECS field is
+// the candidate's descendant at the elements of the rewritten path below
+// the element matching the candidate, so the candidate source.user of
+// myapp.user.name gives source.user.name. It returns false if there is no
+// such ECS field.
+//
+// The graph g is expected to hold statements constructed by the schema
+// package in this repo.
+func CandidateDestination(g *rdf.Graph, full, cand string, rules PathRules) (ECSField, bool, error) {
+	full, err := term.Text(full)
+	if err != nil {
+		return ECSField{}, false, err
+	}
+	dst, err := term.Text(cand)
+	if err != nil {
+		return ECSField{}, false, err
+	}
+	path := rules.Apply(strings.Split(full, "."))
+	last := dst[strings.LastIndex(dst, ".")+1:]
+	// Candidates are found at the shallowest matching
+	// element of the path, so try the shallowest first.
+	for i, e := range path[:len(path)-1] {
+		if e != last && e != wildcard {
+			continue
+		}
+		f, ok := ECSFieldOf(g, term.Literal(dst+"."+strings.Join(path[i+1:], ".")))
+		if ok {
+			return f, true, nil
+		}
+	}
+	return ECSField{}, false, nil
+}
+
+func walkMatchingPath(g *rdf.Graph, q rdf.Query, typ rdf.Term, path []string, rules PathRules, lim Limits) (paths []string, truncated bool) {
+	var deadline time.Time
+	if lim.Timeout > 0 {
+		deadline = time.Now().Add(lim.Timeout)
+	}
+
 	// Filter start by type.
 	matchingType := func(s *rdf.Statement) bool {
-		return s.Predicate.Value == "<is:type>" && s.Object.Value == typ.Value
+		return vocab.IsType.MatchObject(s, typ.Value)
 	}
 	q = q.Out(matchingType).In(matchingType).And(q)
+	if len(rules.Levels) != 0 {
+		// Filter start by maturity level.
+		quoted := make(map[string]bool, len(rules.Levels))
+		for _, l := range rules.Levels {
+			quoted[term.Literal(l)] = true
+		}
+		matchingLevel := func(s *rdf.Statement) bool {
+			return byLevel(s) && quoted[s.Object.Value]
+		}
+		q = q.Out(matchingLevel).In(matchingLevel).And(q)
+	}
+	q, truncated = lim.bound(g, q)
 
 	// Walk the path.
 	var final []rdf.Term
 	for i := len(path) - 2; i >= 0; i-- {
+		if final != nil && !deadline.IsZero() && time.Now().After(deadline) {
+			truncated = true
+			break
+		}
 		c := q.In(hasChild)
 
-		quotedName := strconv.Quote(path[i])
-		matchingName := func(s *rdf.Statement) bool {
-			return s.Predicate.Value == "<is:name>" && s.Object.Value == quotedName
+		if path[i] == wildcard {
+			// A wildcard element matches any name.
+			q = c.Unique()
+		} else {
+			quotedName := term.Literal(path[i])
+			matchingName := func(s *rdf.Statement) bool {
+				return vocab.IsName.MatchObject(s, quotedName)
+			}
+			q = c.Out(matchingName).In(matchingName).And(c)
 		}
-		q = c.Out(matchingName).In(matchingName).And(c)
+		var cut bool
+		q, cut = lim.bound(g, q)
+		truncated = truncated || cut
 
 		r := q.Out(byPath).Unique().Result()
 		if len(r) == 0 {
@@ -126,36 +887,356 @@ func walkMatchingPath(q rdf.Query, typ rdf.Term, path []string) []string {
 	}
 
 	// Collate the results.
-	paths := make([]string, len(final))
-	for i, v := range final {
-		paths[i] = v.Value
+	paths = make([]string, 0, len(final))
+	for _, v := range final {
+		if rules.ReusePoints && !isReusePoint(g, v) {
+			continue
+		}
+		paths = append(paths, v.Value)
+	}
+	if lim.Results > 0 && len(paths) > lim.Results {
+		sortByDepth(paths)
+		paths = paths[:lim.Results]
+		truncated = true
+	}
+	return paths, truncated
+}
+
+// isReusePoint returns whether the path term p is the location of a top
+// level field set or a location a field set is expected to be reused or
+// nested at.
+func isReusePoint(g *rdf.Graph, p rdf.Term) bool {
+	at := g.Query(p).In(byPath)
+	if len(at.In(reusedAt).Result()) != 0 || len(at.In(hasNesting).Result()) != 0 {
+		return true
 	}
-	return paths
+	// Field set names are held as the same
+	// literal terms as the paths of their
+	// locations.
+	if len(g.Query(p).In(inFieldset).Result()) == 0 {
+		return false
+	}
+	return len(at.Out(isNotTopLevel).Result()) == 0
 }
 
+// wildcard is the path element that matches any name.
+const wildcard = "*"
+
 // Predicate helpers.
 
 // byUsedType filters statements on the used type.
 func byUsedType(s *rdf.Statement) bool {
-	return s.Predicate.Value == "<as:type>"
+	return vocab.AsType.Match(s)
+}
+
+// byInferredType filters statements on the type inferred from examples.
+func byInferredType(s *rdf.Statement) bool {
+	return vocab.InferredType.Match(s)
+}
+
+// byType filters statements on the ECS defined type.
+func byType(s *rdf.Statement) bool {
+	return vocab.IsType.Match(s)
+}
+
+// byValueType filters statements on the observed JSON value type.
+func byValueType(s *rdf.Statement) bool {
+	return vocab.IsValueType.Match(s)
+}
+
+// byPathMatch filters statements on dynamic template path_match patterns.
+func byPathMatch(s *rdf.Statement) bool {
+	return vocab.IsPathMatch.Match(s)
+}
+
+// byMatchMappingType filters statements on dynamic template
+// match_mapping_type values.
+func byMatchMappingType(s *rdf.Statement) bool {
+	return vocab.IsMatchMappingType.Match(s)
+}
+
+// byObjectType filters statements on the object type of object fields.
+func byObjectType(s *rdf.Statement) bool {
+	return vocab.AsObjectType.Match(s)
 }
 
 // isPublished filters statements on the published attribute.
 func isPublished(s *rdf.Statement) bool {
-	return s.Predicate.Value == "<is:published>" && s.Object.Value == `"true"`
+	return vocab.IsPublished.MatchObject(s, vocab.True)
+}
+
+// hasDescription filters statements on the presence of a description.
+func hasDescription(s *rdf.Statement) bool {
+	return vocab.HasDescription.MatchObject(s, vocab.True)
+}
+
+// byDescription filters statements referring to description.
+func byDescription(s *rdf.Statement) bool {
+	return vocab.IsDescription.Match(s)
+}
+
+// byShort filters statements referring to the short form of an ECS
+// description.
+func byShort(s *rdf.Statement) bool {
+	return vocab.IsShort.Match(s)
+}
+
+// hasExample filters statements on the presence of an example.
+func hasExample(s *rdf.Statement) bool {
+	return vocab.HasExample.MatchObject(s, vocab.True)
+}
+
+// byExample filters statements referring to example.
+func byExample(s *rdf.Statement) bool {
+	return vocab.IsExample.Match(s)
+}
+
+// byUnit filters statements referring to unit.
+func byUnit(s *rdf.Statement) bool {
+	return vocab.AsUnit.Match(s)
+}
+
+// byMetricType filters statements referring to metric type.
+func byMetricType(s *rdf.Statement) bool {
+	return vocab.AsMetricType.Match(s)
+}
+
+// isDimension filters statements on the dimension attribute.
+func isDimension(s *rdf.Statement) bool {
+	return vocab.IsDimension.MatchObject(s, vocab.True)
+}
+
+// isExternal filters statements referring to an external definition.
+func isExternal(s *rdf.Statement) bool {
+	return vocab.ExternalType.Match(s)
+}
+
+// byAnalyzer filters statements referring to index or search analyzers.
+func byAnalyzer(s *rdf.Statement) bool {
+	return vocab.AsAnalyzer.Match(s) || vocab.AsSearchAnalyzer.Match(s)
+}
+
+// byIndexAnalyzer filters statements referring to index analyzers.
+func byIndexAnalyzer(s *rdf.Statement) bool {
+	return vocab.AsAnalyzer.Match(s)
+}
+
+// bySearchAnalyzer filters statements referring to search analyzers.
+func bySearchAnalyzer(s *rdf.Statement) bool {
+	return vocab.AsSearchAnalyzer.Match(s)
+}
+
+// hasNorms filters statements on enabled norms.
+func hasNorms(s *rdf.Statement) bool {
+	return vocab.IsNorms.MatchObject(s, vocab.True)
+}
+
+// byNormalization filters statements referring to the normalization of a
+// field's values.
+func byNormalization(s *rdf.Statement) bool {
+	return vocab.IsNormalized.Match(s)
+}
+
+// isArray filters statements on normalization to an array.
+func isArray(s *rdf.Statement) bool {
+	return vocab.IsNormalized.MatchObject(s, vocab.Array)
+}
+
+// reusedAt filters statements referring to the locations a field set is
+// expected to be reused at.
+func reusedAt(s *rdf.Statement) bool {
+	return vocab.ReusedAt.Match(s)
+}
+
+// reusedFrom filters statements linking reuse locations and reused fields
+// to the field sets and fields they are reused from.
+func reusedFrom(s *rdf.Statement) bool {
+	return vocab.ReusedFrom.Match(s)
+}
+
+// hasNesting filters statements linking field sets to the locations that
+// field sets are nested at within them.
+func hasNesting(s *rdf.Statement) bool {
+	return vocab.HasNesting.Match(s)
+}
+
+// isNotTopLevel filters statements marking field sets that are only
+// expected at their reuse locations.
+func isNotTopLevel(s *rdf.Statement) bool {
+	return vocab.IsTopLevel.MatchObject(s, vocab.False)
+}
+
+// byLevel filters statements referring to the ECS maturity level of a
+// field.
+func byLevel(s *rdf.Statement) bool {
+	return vocab.IsLevel.Match(s)
+}
+
+// hasAllowedValue filters statements referring to the allowed values of a
+// field.
+func hasAllowedValue(s *rdf.Statement) bool {
+	return vocab.HasAllowedValue.Match(s)
+}
+
+// byValue filters statements referring to the value of an allowed value.
+func byValue(s *rdf.Statement) bool {
+	return vocab.IsValue.Match(s)
+}
+
+// expectsEventType filters statements referring to the event types
+// expected with an allowed value.
+func expectsEventType(s *rdf.Statement) bool {
+	return vocab.ExpectsEventType.Match(s)
+}
+
+// deprecatedIn filters statements referring to the version a field was
+// deprecated in.
+func deprecatedIn(s *rdf.Statement) bool {
+	return vocab.DeprecatedIn.Match(s)
+}
+
+// removedIn filters statements referring to the version a field is removed
+// in.
+func removedIn(s *rdf.Statement) bool {
+	return vocab.RemovedIn.Match(s)
+}
+
+// inFieldset filters statements referring to ECS field set membership.
+func inFieldset(s *rdf.Statement) bool {
+	return vocab.InFieldset.Match(s)
+}
+
+// isImplicit filters statements on the implicit group attribute.
+func isImplicit(s *rdf.Statement) bool {
+	return vocab.IsImplicit.MatchObject(s, vocab.True)
+}
+
+// isObserved filters statements on the observed attribute.
+func isObserved(s *rdf.Statement) bool {
+	return vocab.IsObserved.MatchObject(s, vocab.True)
+}
+
+// isDisabled filters statements on a disabled mapping.
+func isDisabled(s *rdf.Statement) bool {
+	return vocab.IsEnabled.MatchObject(s, vocab.False)
+}
+
+// isWildcard filters statements on the wildcard attribute.
+func isWildcard(s *rdf.Statement) bool {
+	return vocab.IsWildcard.MatchObject(s, vocab.True)
+}
+
+// isGroup filters statements on the used group type.
+func isGroup(s *rdf.Statement) bool {
+	return vocab.AsType.MatchObject(s, vocab.Group)
+}
+
+// inDataStream filters statements referring to data stream membership.
+func inDataStream(s *rdf.Statement) bool {
+	return vocab.InDataStream.Match(s)
+}
+
+// isDataStream filters statements referring to data stream names.
+func isDataStream(s *rdf.Statement) bool {
+	return vocab.IsDataStream.Match(s)
+}
+
+// inDataset filters statements referring to dataset membership.
+func inDataset(s *rdf.Statement) bool {
+	return vocab.InDataset.Match(s)
+}
+
+// isDataset filters statements referring to dataset names.
+func isDataset(s *rdf.Statement) bool {
+	return vocab.IsDataset.Match(s)
+}
+
+// reroutesTo filters statements referring to reroute destinations.
+func reroutesTo(s *rdf.Statement) bool {
+	return vocab.ReroutesTo.Match(s)
 }
 
 // byName filters statements referring to name.
 func byName(s *rdf.Statement) bool {
-	return s.Predicate.Value == "<is:name>"
+	return vocab.IsName.Match(s)
 }
 
 // byPath filters statements referring to path.
 func byPath(s *rdf.Statement) bool {
-	return s.Predicate.Value == "<is:path>"
+	return vocab.IsPath.Match(s)
+}
+
+// byCanonicalPath filters statements referring to the canonical form of
+// path.
+func byCanonicalPath(s *rdf.Statement) bool {
+	return vocab.IsCanonicalPath.Match(s)
 }
 
 // hasChild filters statements referring to path relationships.
 func hasChild(s *rdf.Statement) bool {
-	return s.Predicate.Value == "<has:child>"
+	return vocab.HasChild.Match(s)
+}
+
+// hasChildOrDescendant filters statements referring to path relationships
+// including relationships collapsed by integration.PruneGroupChains.
+func hasChildOrDescendant(s *rdf.Statement) bool {
+	return vocab.HasChild.Match(s) || vocab.HasDescendant.Match(s)
+}
+
+// definedIn filters statements referring to the file defining a field.
+func definedIn(s *rdf.Statement) bool {
+	return vocab.DefinedIn.Match(s)
+}
+
+// definedAt filters statements referring to the line declaring a field.
+func definedAt(s *rdf.Statement) bool {
+	return vocab.DefinedAt.Match(s)
+}
+
+// referencedBy filters statements referring to a referring saved object.
+func referencedBy(s *rdf.Statement) bool {
+	return vocab.ReferencedBy.Match(s)
+}
+
+// usedBy filters statements referring to the ML job or transform reading
+// a field.
+func usedBy(s *rdf.Statement) bool {
+	return vocab.UsedBy.Match(s)
+}
+
+// producedBy filters statements referring to the transform writing a
+// field.
+func producedBy(s *rdf.Statement) bool {
+	return vocab.ProducedBy.Match(s)
+}
+
+// requiresType filters statements on the class of types a use accepts.
+func requiresType(s *rdf.Statement) bool {
+	return vocab.RequiresType.Match(s)
+}
+
+// isHinted filters statements referring to the processor adding a field.
+func isHinted(s *rdf.Statement) bool {
+	return vocab.IsHinted.Match(s)
+}
+
+// isHintedObject filters statements on fields added as objects with
+// unknown children.
+func isHintedObject(s *rdf.Statement) bool {
+	return vocab.IsHintedObject.MatchObject(s, vocab.True)
+}
+
+// ownedBy filters statements referring to field ownership.
+func ownedBy(s *rdf.Statement) bool {
+	return vocab.OwnedBy.Match(s)
+}
+
+// inVersion filters statements referring to the ECS version of a field.
+func inVersion(s *rdf.Statement) bool {
+	return vocab.InVersion.Match(s)
+}
+
+// hasMulti filters statements referring to multi-field relationships.
+func hasMulti(s *rdf.Statement) bool {
+	return vocab.HasMulti.Match(s)
 }
@@ -0,0 +1,100 @@
+package query_test
+
+import (
+	"reflect"
+	"testing"
+
+	"gonum.org/v1/gonum/graph/formats/rdf"
+
+	"github.com/efd6/ecsinrdf/query"
+	"github.com/efd6/ecsinrdf/schema"
+	"github.com/efd6/ecsinrdf/term"
+)
+
+// ecsGraph returns the graph of the statements constructed from the
+// nested ECS schema.
+func ecsGraph(t *testing.T, nested map[string]schema.Field) *rdf.Graph {
+	t.Helper()
+	g := rdf.NewGraph()
+	var errs []error
+	schema.Statements("", nested, term.CanonicalPaths(func(s *rdf.Statement, err error) {
+		if err != nil {
+			errs = append(errs, err)
+			return
+		}
+		g.AddStatement(s)
+	}))
+	if len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	return g
+}
+
+var multiFieldsSchema = map[string]schema.Field{
+	"process": {
+		Fields: map[string]schema.Field{
+			"process.command_line": {
+				Type: "wildcard",
+				MultiFields: []schema.MultiField{
+					{Type: "match_only_text", Name: "text", FlatName: "process.command_line.text"},
+				},
+			},
+			"process.name": {
+				Type: "keyword",
+			},
+		},
+	},
+}
+
+var collapseMultiFieldsTests = []struct {
+	name string
+	path string
+	typ  string
+	want []query.Candidate
+}{
+	{
+		name: "multi-field destination",
+		path: "myapp.process.command_line",
+		typ:  "wildcard",
+		want: []query.Candidate{
+			{Path: `"process"`, MultiFields: []string{`"text"`}},
+		},
+	},
+	{
+		name: "destination without multi-fields",
+		path: "myapp.process.name",
+		typ:  "keyword",
+		want: []query.Candidate{
+			{Path: `"process"`},
+		},
+	},
+}
+
+func TestCollapseMultiFields(t *testing.T) {
+	g := ecsGraph(t, multiFieldsSchema)
+	for _, test := range collapseMultiFieldsTests {
+		t.Run(test.name, func(t *testing.T) {
+			full := term.Literal(test.path)
+			cands, err := query.CandidateGraftsFor(g, full, term.Literal(test.typ), query.PathRules{})
+			if err != nil {
+				t.Fatalf("unexpected error finding candidates: %v", err)
+			}
+			got, err := query.CollapseMultiFields(g, full, cands, query.PathRules{})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("unexpected candidates:\ngot: %#v\nwant:%#v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCandidateString(t *testing.T) {
+	c := query.Candidate{Path: `"process"`, MultiFields: []string{`"text"`}}
+	got := c.String()
+	want := `"process" (multi_fields: "text")`
+	if got != want {
+		t.Errorf("unexpected string: got:%s want:%s", got, want)
+	}
+}
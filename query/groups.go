@@ -0,0 +1,47 @@
+package query
+
+import (
+	"sort"
+
+	"gonum.org/v1/gonum/graph/formats/rdf"
+
+	"github.com/efd6/ecsinrdf/vocab"
+)
+
+// GroupMismatch is an implicit package group whose path is defined by ECS
+// with a type that is not mapped as a plain object.
+type GroupMismatch struct {
+	// Path is the quoted full path of the group.
+	Path string
+	// Type is the quoted ECS type of the path.
+	Type string
+}
+
+// ImplicitGroupMismatchesIn returns the implicit groups of published fields
+// in the graph whose path ECS defines as a nested field or as a field with
+// a leaf type, sorted by path. An implicit group is mapped as an object, so
+// documents following ECS will be mapped differently by the package.
+//
+// The graph g is expected to hold statements constructed by the schema and
+// integration packages in this repo.
+func ImplicitGroupMismatchesIn(g *rdf.Graph) []GroupMismatch {
+	p := PublishedFieldsIn(g)
+	implicit := p.Out(isImplicit).In(isImplicit).And(p)
+	var mismatches []GroupMismatch
+	for _, path := range implicit.Out(byPath).Unique().Result() {
+		for _, typ := range g.Query(path).In(byPath).Out(byType).Unique().Result() {
+			switch typ.Value {
+			case vocab.Group, `"object"`:
+				continue
+			}
+			mismatches = append(mismatches, GroupMismatch{Path: path.Value, Type: typ.Value})
+		}
+	}
+	sort.Slice(mismatches, func(i, j int) bool {
+		if mismatches[i].Path == mismatches[j].Path {
+			return mismatches[i].Type < mismatches[j].Type
+		}
+		return mismatches[i].Path < mismatches[j].Path
+	})
+	return mismatches
+}
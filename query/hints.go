@@ -0,0 +1,57 @@
+package query
+
+import (
+	"gonum.org/v1/gonum/graph/formats/rdf"
+
+	"github.com/efd6/ecsinrdf/term"
+)
+
+// HintedFieldsIn returns a query holding fields in the graph that are
+// added to events by agent processors.
+//
+// The graph g is expected to hold statements constructed by the agent
+// package in this repo.
+func HintedFieldsIn(g *rdf.Graph) rdf.Query {
+	var hinted []rdf.Term
+	for it := g.AllStatements(); it.Next(); {
+		s := it.Statement()
+		if isHinted(s) {
+			hinted = append(hinted, s.Subject)
+		}
+	}
+	return g.Query(hinted...).Unique()
+}
+
+// WeaklyDeclaredFieldsIn returns a query holding fields in the graph that
+// are added to events by agent processors but have no published
+// declaration.
+//
+// The graph g is expected to hold statements constructed by the agent and
+// integration packages in this repo.
+func WeaklyDeclaredFieldsIn(g *rdf.Graph) rdf.Query {
+	h := HintedFieldsIn(g)
+	declared := PublishedFieldsIn(g).Out(byPath).In(byPath).And(h)
+	return h.Not(declared)
+}
+
+// hintedPathsIn returns the unquoted full paths of fields added to events
+// by agent processors. Paths of objects whose children are not known are
+// returned in objects and all others in leaves.
+func hintedPathsIn(g *rdf.Graph) (leaves map[string]bool, objects []string, err error) {
+	leaves = make(map[string]bool)
+	for _, f := range HintedFieldsIn(g).Result() {
+		object := len(g.Query(f).Out(isHintedObject).Result()) != 0
+		for _, p := range g.Query(f).Out(byPath).Result() {
+			path, err := term.Text(p.Value)
+			if err != nil {
+				return nil, nil, err
+			}
+			if object {
+				objects = append(objects, path)
+			} else {
+				leaves[path] = true
+			}
+		}
+	}
+	return leaves, objects, nil
+}
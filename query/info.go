@@ -0,0 +1,189 @@
+package query
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+
+	"gonum.org/v1/gonum/graph/formats/rdf"
+
+	"github.com/efd6/ecsinrdf/term"
+)
+
+// FieldInfo is the information held for a published package field.
+type FieldInfo struct {
+	// Path is the quoted full path of the field.
+	Path string
+	// File is the quoted path of the file defining
+	// the field.
+	File string
+	// DataStream is the quoted name of the data stream
+	// holding the field. It is empty for package-level
+	// fields.
+	DataStream string
+	// Types holds the quoted declared types of the field.
+	Types []string
+	// InferredTypes holds the quoted types inferred from
+	// the field's example.
+	InferredTypes []string
+	// Owners holds the quoted owners of the field.
+	Owners []string
+}
+
+// FieldDefinedIn returns the information for the published field with the
+// quoted full path defined in the file with the quoted path.
+//
+// The graph g is expected to hold statements constructed by the integration
+// package in this repo with source provenance.
+func FieldDefinedIn(g *rdf.Graph, full, file string) (FieldInfo, error) {
+	path, ok := g.TermFor(full)
+	if !ok {
+		return FieldInfo{}, errors.New("not found")
+	}
+	src, ok := g.TermFor(file)
+	if !ok {
+		return FieldInfo{}, errors.New("file not found")
+	}
+	p := PublishedFieldsIn(g)
+	q := g.Query(path).In(byPath).And(g.Query(src).In(definedIn)).And(p)
+	nodes := q.Result()
+	if len(nodes) == 0 {
+		return FieldInfo{}, errors.New("not found")
+	}
+	info := FieldInfo{Path: full, File: file}
+	for _, ds := range q.Out(inDataStream).Out(isDataStream).Unique().Result() {
+		info.DataStream = ds.Value
+	}
+	for _, t := range q.Out(byUsedType).Unique().Result() {
+		info.Types = append(info.Types, t.Value)
+	}
+	for _, t := range q.Out(byInferredType).Unique().Result() {
+		info.InferredTypes = append(info.InferredTypes, t.Value)
+	}
+	for _, o := range q.Out(ownedBy).Unique().Result() {
+		info.Owners = append(info.Owners, o.Value)
+	}
+	sort.Strings(info.Types)
+	sort.Strings(info.InferredTypes)
+	sort.Strings(info.Owners)
+	return info, nil
+}
+
+// Definition is the location of a package field declaration.
+type Definition struct {
+	// File is the path of the file declaring the field.
+	File string
+	// Line is the line of the declaration, or zero if
+	// it is not known.
+	Line int
+}
+
+// DefinitionsOf returns the locations of the declarations of the published
+// field with the quoted full path, sorted by file and line.
+//
+// The graph g is expected to hold statements constructed by the integration
+// package in this repo with source provenance.
+func DefinitionsOf(g *rdf.Graph, full string) ([]Definition, error) {
+	path, ok := g.TermFor(full)
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	p := PublishedFieldsIn(g)
+	var defs []Definition
+	for _, f := range g.Query(path).In(byPath).And(p).Result() {
+		var line int
+		for _, l := range g.Query(f).Out(definedAt).Result() {
+			text, err := term.Text(l.Value)
+			if err != nil {
+				return nil, err
+			}
+			line, err = strconv.Atoi(text)
+			if err != nil {
+				return nil, err
+			}
+		}
+		for _, file := range g.Query(f).Out(definedIn).Result() {
+			text, err := term.Text(file.Value)
+			if err != nil {
+				return nil, err
+			}
+			defs = append(defs, Definition{File: text, Line: line})
+		}
+	}
+	sort.Slice(defs, func(i, j int) bool {
+		if defs[i].File == defs[j].File {
+			return defs[i].Line < defs[j].Line
+		}
+		return defs[i].File < defs[j].File
+	})
+	return defs, nil
+}
+
+// ECSField is the information held for an ECS field.
+type ECSField struct {
+	// Path is the quoted full path of the field.
+	Path string
+	// Types holds the quoted types of the field.
+	Types []string
+	// Fieldsets holds the quoted names of the field
+	// sets defining the field.
+	Fieldsets []string
+	// Descriptions holds the quoted descriptions of
+	// the field.
+	Descriptions []string
+	// Examples holds the quoted example values of
+	// the field.
+	Examples []string
+	// Normalizations holds the quoted normalizations
+	// ECS expects of the field's values, such as
+	// array.
+	Normalizations []string
+	// Originals holds the quoted full paths of the
+	// fields in their original field sets that the
+	// field is a reuse of, such as user.name for
+	// destination.user.name.
+	Originals []string
+}
+
+// ECSFieldOf returns the information for the ECS field with the quoted full
+// path. It returns false if the path is not an ECS field.
+//
+// The graph g is expected to hold statements constructed by the schema
+// package in this repo.
+func ECSFieldOf(g *rdf.Graph, full string) (ECSField, bool) {
+	path, ok := g.TermFor(full)
+	if !ok {
+		return ECSField{}, false
+	}
+	at := g.Query(path).In(byPath)
+	q := at.Out(byType).In(byType).And(at)
+	if len(q.Result()) == 0 {
+		return ECSField{}, false
+	}
+	info := ECSField{Path: full}
+	for _, t := range q.Out(byType).Unique().Result() {
+		info.Types = append(info.Types, t.Value)
+	}
+	for _, f := range q.Out(inFieldset).Unique().Result() {
+		info.Fieldsets = append(info.Fieldsets, f.Value)
+	}
+	for _, d := range q.Out(byDescription).Unique().Result() {
+		info.Descriptions = append(info.Descriptions, d.Value)
+	}
+	sort.Strings(info.Types)
+	sort.Strings(info.Fieldsets)
+	for _, e := range q.Out(byExample).Unique().Result() {
+		info.Examples = append(info.Examples, e.Value)
+	}
+	sort.Strings(info.Descriptions)
+	for _, n := range q.Out(byNormalization).Unique().Result() {
+		info.Normalizations = append(info.Normalizations, n.Value)
+	}
+	for _, o := range q.Out(reusedFrom).Out(byPath).Unique().Result() {
+		info.Originals = append(info.Originals, o.Value)
+	}
+	sort.Strings(info.Examples)
+	sort.Strings(info.Normalizations)
+	sort.Strings(info.Originals)
+	return info, true
+}
@@ -0,0 +1,135 @@
+package query
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"gonum.org/v1/gonum/graph/formats/rdf"
+
+	"github.com/efd6/ecsinrdf/term"
+)
+
+// RemovedField is a published package field that is still declared after
+// the version it was to be removed in.
+type RemovedField struct {
+	// Path is the quoted full path of the field.
+	Path string
+	// Deprecated is the quoted version the field was
+	// deprecated in. It is empty if it is not known.
+	Deprecated string
+	// Removed is the quoted version the field was to
+	// be removed in.
+	Removed string
+	// Version is the quoted version of the package
+	// declaring the field.
+	Version string
+}
+
+// RemovedFieldsIn returns the published package fields in the graph with a
+// removal version at or before the version of the package declaring them,
+// sorted by path. The version of a field's package is returned by
+// versionOf for the unquoted path of the file the field is defined in;
+// fields in files for which versionOf returns an empty version are not
+// checked. Versions are compared as dot-separated numbers, ignoring a
+// leading "v" and any pre-release or build suffix.
+//
+// The graph g is expected to hold statements constructed by the integration
+// package in this repo.
+func RemovedFieldsIn(g *rdf.Graph, versionOf func(file string) (string, error)) ([]RemovedField, error) {
+	p := PublishedFieldsIn(g)
+	var found []RemovedField
+	seen := make(map[RemovedField]bool)
+	for _, f := range p.Out(removedIn).In(removedIn).And(p).Result() {
+		var versions []string
+		for _, file := range g.Query(f).Out(definedIn).Result() {
+			path, err := term.Text(file.Value)
+			if err != nil {
+				return nil, err
+			}
+			v, err := versionOf(path)
+			if err != nil {
+				return nil, err
+			}
+			if v != "" {
+				versions = append(versions, v)
+			}
+		}
+		for _, r := range g.Query(f).Out(removedIn).Result() {
+			removed, err := term.Text(r.Value)
+			if err != nil {
+				return nil, err
+			}
+			var deprecated string
+			for _, d := range g.Query(f).Out(deprecatedIn).Result() {
+				deprecated = d.Value
+			}
+			for _, version := range versions {
+				if compareVersions(removed, version) > 0 {
+					continue
+				}
+				for _, path := range g.Query(f).Out(byPath).Result() {
+					rf := RemovedField{Path: path.Value, Deprecated: deprecated, Removed: r.Value, Version: term.Literal(version)}
+					if seen[rf] {
+						continue
+					}
+					seen[rf] = true
+					found = append(found, rf)
+				}
+			}
+		}
+	}
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].Path != found[j].Path {
+			return found[i].Path < found[j].Path
+		}
+		if found[i].Removed != found[j].Removed {
+			return found[i].Removed < found[j].Removed
+		}
+		return found[i].Version < found[j].Version
+	})
+	return found, nil
+}
+
+// compareVersions returns -1, 0 or 1 if version a is less than, equal to or
+// greater than version b. Missing elements are treated as zero and
+// non-numeric elements are compared lexically.
+func compareVersions(a, b string) int {
+	ae := versionElements(a)
+	be := versionElements(b)
+	for len(ae) < len(be) {
+		ae = append(ae, "0")
+	}
+	for len(be) < len(ae) {
+		be = append(be, "0")
+	}
+	for i := range ae {
+		an, aErr := strconv.Atoi(ae[i])
+		bn, bErr := strconv.Atoi(be[i])
+		switch {
+		case aErr == nil && bErr == nil:
+			if an != bn {
+				if an < bn {
+					return -1
+				}
+				return 1
+			}
+		case ae[i] != be[i]:
+			if ae[i] < be[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// versionElements returns the dot-separated elements of the version v
+// without a leading "v" or pre-release or build suffix.
+func versionElements(v string) []string {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+	return strings.Split(v, ".")
+}
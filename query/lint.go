@@ -0,0 +1,272 @@
+package query
+
+import (
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gonum.org/v1/gonum/graph/formats/rdf"
+
+	"github.com/efd6/ecsinrdf/term"
+)
+
+// maxShortLength is the length beyond which ECS requires a field to have a
+// separate short description.
+const maxShortLength = 120
+
+// DescriptionIssue is a documentation problem with published package
+// fields.
+type DescriptionIssue struct {
+	// Path is the quoted full path of the field.
+	Path string
+	// Issues holds descriptions of the problems.
+	Issues []string
+}
+
+// DescriptionIssuesIn returns the documentation problems of the published
+// package fields in the graph, sorted by path. Descriptions are checked for
+// being blank, having trailing white space, lacking a final period, having
+// a first line too long to be used as a short description and being copied
+// verbatim from the ECS field with the same path, in which case declaring
+// the field as external would be preferable.
+//
+// The graph g is expected to hold statements constructed by the schema and
+// integration packages in this repo.
+func DescriptionIssuesIn(g *rdf.Graph) ([]DescriptionIssue, error) {
+	p := PublishedFieldsIn(g)
+	described := p.Out(byDescription).In(byDescription).And(p)
+	issues := make(map[string][]string)
+	for _, f := range described.Result() {
+		for _, path := range g.Query(f).Out(byPath).Result() {
+			var ecs []string
+			at := g.Query(path).In(byPath)
+			for _, d := range at.Out(byType).In(byType).And(at).Out(byDescription).Result() {
+				text, err := term.Text(d.Value)
+				if err != nil {
+					return nil, err
+				}
+				ecs = append(ecs, strings.TrimSpace(text))
+			}
+			for _, d := range g.Query(f).Out(byDescription).Result() {
+				text, err := term.Text(d.Value)
+				if err != nil {
+					return nil, err
+				}
+				issues[path.Value] = append(issues[path.Value], lintDescription(text, ecs)...)
+			}
+		}
+	}
+
+	var found []DescriptionIssue
+	for path, i := range issues {
+		if len(i) == 0 {
+			continue
+		}
+		found = append(found, DescriptionIssue{Path: path, Issues: unique(i)})
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].Path < found[j].Path })
+	return found, nil
+}
+
+// DescriptionDivergence is a published package field with a description
+// that differs from the descriptions of the ECS field with the same path.
+type DescriptionDivergence struct {
+	// Path is the quoted full path of the field.
+	Path string
+	// Descriptions holds the quoted descriptions
+	// of the package field.
+	Descriptions []string
+	// ECS holds the quoted descriptions of the
+	// ECS field.
+	ECS []string
+}
+
+// DescriptionDivergencesIn returns the published package fields in the
+// graph that are described differently to the ECS field with the same
+// path, sorted by path. Descriptions are compared with runs of white space
+// collapsed, and a package description matching either the full or the
+// short ECS description does not diverge. Package fields without a
+// description are not reported.
+//
+// The graph g is expected to hold statements constructed by the schema and
+// integration packages in this repo.
+func DescriptionDivergencesIn(g *rdf.Graph) ([]DescriptionDivergence, error) {
+	p := PublishedFieldsIn(g)
+	described := p.Out(byDescription).In(byDescription).And(p)
+	type divergence struct {
+		descriptions, ecs []string
+	}
+	found := make(map[string]*divergence)
+	for _, f := range described.Result() {
+		for _, path := range g.Query(f).Out(byPath).Result() {
+			at := g.Query(path).In(byPath)
+			ecs := at.Out(byType).In(byType).And(at)
+			ecsDescriptions := ecs.Out(byDescription).Result()
+			if len(ecsDescriptions) == 0 {
+				continue
+			}
+			same := make(map[string]bool)
+			for _, d := range append(ecsDescriptions, ecs.Out(byShort).Result()...) {
+				text, err := term.Text(d.Value)
+				if err != nil {
+					return nil, err
+				}
+				same[strings.Join(strings.Fields(text), " ")] = true
+			}
+			for _, d := range g.Query(f).Out(byDescription).Result() {
+				text, err := term.Text(d.Value)
+				if err != nil {
+					return nil, err
+				}
+				if same[strings.Join(strings.Fields(text), " ")] {
+					continue
+				}
+				div, ok := found[path.Value]
+				if !ok {
+					div = &divergence{}
+					found[path.Value] = div
+				}
+				div.descriptions = append(div.descriptions, d.Value)
+				for _, e := range ecsDescriptions {
+					div.ecs = append(div.ecs, e.Value)
+				}
+			}
+		}
+	}
+
+	divergences := make([]DescriptionDivergence, 0, len(found))
+	for path, div := range found {
+		divergences = append(divergences, DescriptionDivergence{
+			Path:         path,
+			Descriptions: unique(div.descriptions),
+			ECS:          unique(div.ecs),
+		})
+	}
+	sort.Slice(divergences, func(i, j int) bool { return divergences[i].Path < divergences[j].Path })
+	return divergences, nil
+}
+
+// lintDescription returns the problems with the description d of a field
+// whose ECS descriptions are ecs.
+func lintDescription(d string, ecs []string) []string {
+	trimmed := strings.TrimSpace(d)
+	if trimmed == "" {
+		return []string{"description is blank"}
+	}
+	var issues []string
+	for _, l := range strings.Split(strings.TrimSuffix(d, "\n"), "\n") {
+		if strings.TrimRight(l, " \t") != l {
+			issues = append(issues, "description has trailing white space")
+			break
+		}
+	}
+	if !strings.HasSuffix(trimmed, ".") {
+		issues = append(issues, "description does not end with a period")
+	}
+	if first := strings.SplitN(trimmed, "\n", 2)[0]; len(first) > maxShortLength {
+		issues = append(issues, "description first line is too long for a short description")
+	}
+	for _, e := range ecs {
+		if e == trimmed {
+			issues = append(issues, "description is copied from ECS; declare the field as external: ecs")
+			break
+		}
+	}
+	return issues
+}
+
+// ExampleMismatch is a published package field with examples that are not
+// valid values of its declared type.
+type ExampleMismatch struct {
+	// Path is the quoted full path of the field.
+	Path string
+	// Type is the quoted declared type of the field.
+	Type string
+	// Examples holds the quoted invalid examples.
+	Examples []string
+}
+
+// ExampleMismatchesIn returns the published package fields in the graph
+// with an ip, date, boolean or numeric type that have examples which do not
+// parse as that type, sorted by path and type. Mismatches frequently
+// indicate that the declared type is wrong rather than the example.
+//
+// The graph g is expected to hold statements constructed by the integration
+// package in this repo.
+func ExampleMismatchesIn(g *rdf.Graph) ([]ExampleMismatch, error) {
+	p := PublishedFieldsIn(g)
+	typed := p.Out(byExample).In(byExample).And(p)
+	type key struct{ path, typ string }
+	bad := make(map[key][]string)
+	for _, f := range typed.Result() {
+		for _, t := range g.Query(f).Out(byUsedType).Result() {
+			typ, err := term.Text(t.Value)
+			if err != nil {
+				return nil, err
+			}
+			for _, ex := range g.Query(f).Out(byExample).Result() {
+				text, err := term.Text(ex.Value)
+				if err != nil {
+					return nil, err
+				}
+				if validExample(typ, text) {
+					continue
+				}
+				for _, path := range g.Query(f).Out(byPath).Result() {
+					k := key{path: path.Value, typ: t.Value}
+					bad[k] = append(bad[k], ex.Value)
+				}
+			}
+		}
+	}
+
+	var found []ExampleMismatch
+	for k, ex := range bad {
+		found = append(found, ExampleMismatch{Path: k.path, Type: k.typ, Examples: unique(ex)})
+	}
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].Path == found[j].Path {
+			return found[i].Type < found[j].Type
+		}
+		return found[i].Path < found[j].Path
+	})
+	return found, nil
+}
+
+// validExample returns whether the example text is a valid value for the
+// field type typ. Types that are not checked are always valid.
+func validExample(typ, text string) bool {
+	text = strings.TrimSpace(text)
+	switch typ {
+	case "ip":
+		if net.ParseIP(text) != nil {
+			return true
+		}
+		_, _, err := net.ParseCIDR(text)
+		return err == nil
+	case "date":
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999", "2006-01-02 15:04:05", "2006-01-02"} {
+			if _, err := time.Parse(layout, text); err == nil {
+				return true
+			}
+		}
+		// Dates may also be given as epoch milliseconds.
+		_, err := strconv.ParseInt(text, 10, 64)
+		return err == nil
+	case "long", "integer", "short", "byte":
+		_, err := strconv.ParseInt(text, 10, 64)
+		return err == nil
+	case "unsigned_long":
+		_, err := strconv.ParseUint(text, 10, 64)
+		return err == nil
+	case "double", "float", "half_float", "scaled_float":
+		_, err := strconv.ParseFloat(text, 64)
+		return err == nil
+	case "boolean":
+		return text == "true" || text == "false"
+	default:
+		return true
+	}
+}
@@ -0,0 +1,233 @@
+package query
+
+import (
+	"errors"
+	"sort"
+
+	"gonum.org/v1/gonum/graph/formats/rdf"
+
+	"github.com/efd6/ecsinrdf/template"
+	"github.com/efd6/ecsinrdf/term"
+)
+
+// FieldMapping is the simulated effective mapping of a field.
+type FieldMapping struct {
+	// Path is the quoted full path of the field.
+	Path string
+	// Type is the quoted effective type of the field.
+	Type string
+	// Template is the name of the dynamic template that
+	// maps a gained field or that is shadowed by a
+	// declared field.
+	Template string
+	// TemplateType is the quoted type a shadowed dynamic
+	// template would have mapped the field to.
+	TemplateType string
+}
+
+// MappingSimulation is the simulated effective mapping of a data stream,
+// approximating the result of the Elasticsearch _index_template/_simulate
+// API.
+type MappingSimulation struct {
+	// Declared holds fields mapped by the package's
+	// field definitions.
+	Declared []FieldMapping
+	// Gained holds observed fields that are not declared
+	// and are mapped by a dynamic template.
+	Gained []FieldMapping
+	// Dynamic holds observed fields that are neither
+	// declared nor matched by a dynamic template, and
+	// so are mapped by default dynamic mapping.
+	Dynamic []FieldMapping
+	// Shadowed holds declared fields that a dynamic
+	// template would have mapped to a different type.
+	Shadowed []FieldMapping
+	// Unmapped holds observed fields under a declared
+	// object with mapping disabled. Their type is the
+	// quoted detected JSON type.
+	Unmapped []FieldMapping
+}
+
+// SimulateMapping returns the simulated effective mapping for the named
+// data stream when the package's declared fields are combined with the
+// provided dynamic templates. Templates are considered in order and the
+// first matching template applies, as is the case in Elasticsearch.
+// Dynamic templates implied by the data stream's object fields precede
+// the provided templates.
+//
+// Declared fields without a type, such as fields with an external ECS
+// definition, are given the type of the ECS field with the same path.
+//
+// The graph g is expected to hold statements constructed by the schema
+// package and the data stream statements of the integration and document
+// packages in this repo.
+func SimulateMapping(g *rdf.Graph, dataStream string, templates []template.Dynamic) (MappingSimulation, error) {
+	name, ok := g.TermFor(term.Literal(dataStream))
+	if !ok {
+		return MappingSimulation{}, errors.New("data stream not found")
+	}
+	members := g.Query(name).In(isDataStream).In(inDataStream)
+
+	// Collect the detected JSON types of observed fields by path.
+	observed := members.And(ObservedFieldsIn(g))
+	kinds := make(map[string][]string)
+	for _, f := range observed.Result() {
+		for _, p := range g.Query(f).Out(byPath).Result() {
+			for _, k := range g.Query(f).Out(byValueType).Result() {
+				kind, err := term.Text(k.Value)
+				if err != nil {
+					return MappingSimulation{}, err
+				}
+				kinds[p.Value] = append(kinds[p.Value], kind)
+			}
+		}
+	}
+	for _, k := range kinds {
+		sort.Strings(k)
+	}
+
+	var sim MappingSimulation
+	p := members.And(PublishedFieldsIn(g))
+	declaredTemplates, err := dynamicTemplatesOf(g, p)
+	if err != nil {
+		return sim, err
+	}
+	templates = append(declaredTemplates, templates...)
+	declared := p.Not(p.Out(isGroup).In(isGroup).And(p))
+	declaredPaths := make(map[string]bool)
+	for _, f := range declared.Result() {
+		for _, path := range g.Query(f).Out(byPath).Result() {
+			declaredPaths[path.Value] = true
+			typs := g.Query(f).Out(byUsedType).Result()
+			if len(typs) == 0 {
+				typs = g.Query(path).In(byPath).Out(byType).Unique().Result()
+			}
+			for _, typ := range typs {
+				m := FieldMapping{Path: path.Value, Type: typ.Value}
+				sim.Declared = append(sim.Declared, m)
+
+				full, err := term.Text(path.Value)
+				if err != nil {
+					return sim, err
+				}
+				if len(g.Query(f).Out(byPathMatch).Result()) != 0 {
+					// The field defines a dynamic template
+					// rather than being subject to one.
+					continue
+				}
+				var kind string
+				if k := kinds[path.Value]; len(k) != 0 {
+					kind = k[0]
+				}
+				t, ok, err := firstMatch(templates, full, kind)
+				if err != nil {
+					return sim, err
+				}
+				if !ok {
+					continue
+				}
+				tTyp := t.Type(kind)
+				if tTyp == "" || term.Literal(tTyp) == typ.Value {
+					continue
+				}
+				m.Template = t.Name
+				m.TemplateType = term.Literal(tTyp)
+				sim.Shadowed = append(sim.Shadowed, m)
+			}
+		}
+	}
+
+	disabled, err := DisabledPathsIn(g)
+	if err != nil {
+		return sim, err
+	}
+	for path, k := range kinds {
+		if declaredPaths[path] {
+			continue
+		}
+		full, err := term.Text(path)
+		if err != nil {
+			return sim, err
+		}
+		if isUnder(full, disabled) {
+			sim.Unmapped = append(sim.Unmapped, FieldMapping{Path: path, Type: term.Literal(k[0])})
+			continue
+		}
+		t, ok, err := firstMatch(templates, full, k[0])
+		if err != nil {
+			return sim, err
+		}
+		if !ok {
+			sim.Dynamic = append(sim.Dynamic, FieldMapping{Path: path, Type: term.Literal(template.DefaultType(k[0]))})
+			continue
+		}
+		sim.Gained = append(sim.Gained, FieldMapping{Path: path, Type: term.Literal(t.Type(k[0])), Template: t.Name})
+	}
+
+	for _, l := range [][]FieldMapping{sim.Declared, sim.Gained, sim.Dynamic, sim.Shadowed, sim.Unmapped} {
+		sort.Slice(l, func(i, j int) bool { return l[i].Path < l[j].Path })
+	}
+	return sim, nil
+}
+
+// DynamicTemplatesIn returns the dynamic templates implied by published
+// object fields with an object_type in the graph, sorted by name. The
+// name of each template is its path_match pattern.
+//
+// The graph g is expected to hold statements constructed by the integration
+// package in this repo.
+func DynamicTemplatesIn(g *rdf.Graph) ([]template.Dynamic, error) {
+	return dynamicTemplatesOf(g, PublishedFieldsIn(g))
+}
+
+// dynamicTemplatesOf returns the dynamic templates implied by the fields
+// in q.
+func dynamicTemplatesOf(g *rdf.Graph, q rdf.Query) ([]template.Dynamic, error) {
+	var templates []template.Dynamic
+	seen := make(map[string]bool)
+	for _, f := range q.Out(byPathMatch).In(byPathMatch).And(q).Unique().Result() {
+		for _, p := range g.Query(f).Out(byPathMatch).Result() {
+			pattern, err := term.Text(p.Value)
+			if err != nil {
+				return nil, err
+			}
+			if seen[pattern] {
+				continue
+			}
+			seen[pattern] = true
+			t := template.Dynamic{Name: pattern, PathMatch: []string{pattern}}
+			for _, m := range g.Query(f).Out(byMatchMappingType).Result() {
+				mappingType, err := term.Text(m.Value)
+				if err != nil {
+					return nil, err
+				}
+				t.MatchMappingType = append(t.MatchMappingType, mappingType)
+			}
+			for _, o := range g.Query(f).Out(byObjectType).Result() {
+				typ, err := term.Text(o.Value)
+				if err != nil {
+					return nil, err
+				}
+				t.Mapping = map[string]interface{}{"type": typ}
+			}
+			templates = append(templates, t)
+		}
+	}
+	sort.Slice(templates, func(i, j int) bool { return templates[i].Name < templates[j].Name })
+	return templates, nil
+}
+
+// firstMatch returns the first template in templates that matches the field
+// with the provided full path and detected JSON type.
+func firstMatch(templates []template.Dynamic, full, kind string) (template.Dynamic, bool, error) {
+	for _, t := range templates {
+		ok, err := t.Matches(full, kind)
+		if err != nil {
+			return template.Dynamic{}, false, err
+		}
+		if ok {
+			return t, true, nil
+		}
+	}
+	return template.Dynamic{}, false, nil
+}
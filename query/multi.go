@@ -0,0 +1,79 @@
+package query
+
+import (
+	"sort"
+	"strings"
+
+	"gonum.org/v1/gonum/graph/formats/rdf"
+
+	"github.com/efd6/ecsinrdf/term"
+)
+
+// MultiFieldIssue is a multi-field node that is not attached to the field
+// that defines it.
+type MultiFieldIssue struct {
+	// Path is the quoted full path of the multi-field.
+	Path string
+	// Issues holds descriptions of the problems.
+	Issues []string
+}
+
+// MultiFieldIssuesIn returns the multi-fields in the graph that are
+// orphaned from their parent field or attached to the wrong node, sorted by
+// path. A multi-field is orphaned when no node holding it has a path, and
+// mis-attached when a node holding it has a path that is not the parent of
+// the multi-field's path. Graphs built by earlier versions of the
+// integration package attached package multi-fields to a node identified
+// by the bare multi-field name, which this detects.
+//
+// The graph g is expected to hold statements constructed by the schema or
+// integration packages in this repo.
+func MultiFieldIssuesIn(g *rdf.Graph) ([]MultiFieldIssue, error) {
+	parents := make(map[rdf.Term][]rdf.Term)
+	for it := g.AllStatements(); it.Next(); {
+		s := it.Statement()
+		if hasMulti(s) {
+			parents[s.Object] = append(parents[s.Object], s.Subject)
+		}
+	}
+
+	issues := make(map[string][]string)
+	for m, holders := range parents {
+		var attached []string
+		for _, h := range holders {
+			for _, p := range g.Query(h).Out(byPath).Result() {
+				attached = append(attached, p.Value)
+			}
+		}
+		for _, path := range g.Query(m).Out(byPath).Result() {
+			if len(attached) == 0 {
+				issues[path.Value] = append(issues[path.Value], "orphaned from its parent field")
+				continue
+			}
+			text, err := term.Text(path.Value)
+			if err != nil {
+				return nil, err
+			}
+			var want string
+			if i := strings.LastIndex(text, "."); i >= 0 {
+				want = text[:i]
+			}
+			for _, p := range attached {
+				parent, err := term.Text(p)
+				if err != nil {
+					return nil, err
+				}
+				if parent != want {
+					issues[path.Value] = append(issues[path.Value], "attached to "+parent)
+				}
+			}
+		}
+	}
+
+	found := make([]MultiFieldIssue, 0, len(issues))
+	for path, i := range issues {
+		found = append(found, MultiFieldIssue{Path: path, Issues: unique(i)})
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].Path < found[j].Path })
+	return found, nil
+}
@@ -0,0 +1,60 @@
+package query
+
+import (
+	"sort"
+
+	"gonum.org/v1/gonum/graph/formats/rdf"
+
+	"github.com/efd6/ecsinrdf/vocab"
+)
+
+// PreferNormalization returns the quoted candidate paths in cands for the
+// field with the quoted full path with the candidates whose destination
+// ECS normalizes to an array moved before the others when the field holds
+// arrays. The field holds arrays if a package declaration or an observed
+// document marks it as an array. Package fields are rarely declared as
+// arrays, so fields that are not known to hold arrays do not reorder the
+// candidates. Destinations are found as described by CandidateDestination,
+// and candidates without a destination are placed with the arrays. The
+// order of the candidates is otherwise retained. The cands slice is sorted
+// in place.
+//
+// The graph g is expected to hold statements constructed by the schema,
+// integration and document packages in this repo.
+func PreferNormalization(g *rdf.Graph, full string, cands []string, rules PathRules) ([]string, error) {
+	if !holdsArrays(g, full) {
+		return cands, nil
+	}
+	incompatible := make(map[string]bool, len(cands))
+	for _, c := range cands {
+		f, ok, err := CandidateDestination(g, full, c, rules)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		var normalized bool
+		for _, n := range f.Normalizations {
+			normalized = normalized || n == vocab.Array
+		}
+		incompatible[c] = !normalized
+	}
+	sort.SliceStable(cands, func(i, j int) bool {
+		return !incompatible[cands[i]] && incompatible[cands[j]]
+	})
+	return cands, nil
+}
+
+// holdsArrays returns whether a package field or observed field with the
+// quoted full path is marked as an array. ECS fields with the path are not
+// considered.
+func holdsArrays(g *rdf.Graph, full string) bool {
+	node, ok := g.TermFor(full)
+	if !ok {
+		return false
+	}
+	at := g.Query(node).In(byPath)
+	ecs := at.Out(byType).In(byType).And(at)
+	return len(at.Not(ecs).Out(isArray).Result()) != 0
+}
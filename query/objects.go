@@ -0,0 +1,154 @@
+package query
+
+import (
+	"sort"
+	"strings"
+
+	"gonum.org/v1/gonum/graph/formats/rdf"
+
+	"github.com/efd6/ecsinrdf/term"
+	"github.com/efd6/ecsinrdf/vocab"
+)
+
+// ObjectGraft is a package object whose fields all have ECS equivalents
+// under a common ECS object.
+type ObjectGraft struct {
+	// Path is the quoted full path of the package
+	// object.
+	Path string
+	// Candidates holds the quoted full paths of the
+	// ECS objects that hold an equivalent of every
+	// field of the package object, in lexical order.
+	Candidates []string
+	// Fields holds the quoted full paths of the
+	// package fields under the object.
+	Fields []string
+}
+
+// ObjectGraftsIn returns the package objects in the graph whose published
+// fields all have ECS fields with the same type at the same relative path
+// under a common ECS object, sorted by path. Only objects with at least
+// two fields that are not themselves ECS objects are considered, and
+// objects under another object graft are not returned. Package fields
+// whose path is declared with more than one type are not considered.
+//
+// The graph g is expected to hold statements constructed by the schema and
+// integration packages in this repo.
+func ObjectGraftsIn(g *rdf.Graph) ([]ObjectGraft, error) {
+	ecs, err := ecsTypesIn(g)
+	if err != nil {
+		return nil, err
+	}
+
+	p := PublishedFieldsIn(g)
+	multi := p.In(hasMulti).Out(hasMulti)
+	leaves := make(map[string]string)
+	ambiguous := make(map[string]bool)
+	for _, f := range p.Not(multi).Result() {
+		for _, t := range g.Query(f).Out(byUsedType).Result() {
+			if t.Value == vocab.Group {
+				continue
+			}
+			for _, n := range g.Query(f).Out(byPath).Result() {
+				path, err := term.Text(n.Value)
+				if err != nil {
+					return nil, err
+				}
+				if typ, ok := leaves[path]; ok && typ != t.Value {
+					ambiguous[path] = true
+				}
+				leaves[path] = t.Value
+			}
+		}
+	}
+
+	// Collect the fields under each object path.
+	objects := make(map[string][]string)
+	for path := range leaves {
+		if ambiguous[path] {
+			continue
+		}
+		for i := strings.LastIndexByte(path, '.'); i > 0; i = strings.LastIndexByte(path[:i], '.') {
+			objects[path[:i]] = append(objects[path[:i]], path)
+		}
+	}
+
+	var found []ObjectGraft
+	for obj, fields := range objects {
+		if _, ok := ecs[obj]; ok || len(fields) < 2 {
+			// ECS objects are already in place.
+			continue
+		}
+		sort.Strings(fields)
+		var cands []string
+		for _, dst := range ecsObjectsFor(ecs, obj, fields[0], leaves[fields[0]]) {
+			ok := true
+			for _, f := range fields[1:] {
+				if ecs[dst+strings.TrimPrefix(f, obj)] != leaves[f] {
+					ok = false
+					break
+				}
+			}
+			if ok {
+				cands = append(cands, term.Literal(dst))
+			}
+		}
+		if len(cands) == 0 {
+			continue
+		}
+		sort.Strings(cands)
+		og := ObjectGraft{Path: term.Literal(obj), Candidates: cands}
+		for _, f := range fields {
+			og.Fields = append(og.Fields, term.Literal(f))
+		}
+		found = append(found, og)
+	}
+
+	// Retain only the outermost object grafts.
+	sort.Slice(found, func(i, j int) bool { return found[i].Path < found[j].Path })
+	var outer []ObjectGraft
+	var last string
+	for _, og := range found {
+		path, _ := term.Text(og.Path)
+		if last != "" && strings.HasPrefix(path, last+".") {
+			continue
+		}
+		outer = append(outer, og)
+		last = path
+	}
+	return outer, nil
+}
+
+// ecsObjectsFor returns the paths of the ECS objects that hold a field
+// with the given type at the path of the package field relative to the
+// package object obj.
+func ecsObjectsFor(ecs map[string]string, obj, field, typ string) []string {
+	rel := strings.TrimPrefix(field, obj)
+	var dsts []string
+	for path, t := range ecs {
+		if t == typ && strings.HasSuffix(path, rel) && len(path) > len(rel) {
+			dsts = append(dsts, strings.TrimSuffix(path, rel))
+		}
+	}
+	return dsts
+}
+
+// ecsTypesIn returns the quoted type of each unquoted ECS field path in
+// the graph.
+func ecsTypesIn(g *rdf.Graph) (map[string]string, error) {
+	types := make(map[string]string)
+	for it := g.AllStatements(); it.Next(); {
+		s := it.Statement()
+		if !byType(s) {
+			continue
+		}
+		for _, n := range g.Query(s.Subject).Out(byPath).Result() {
+			path, err := term.Text(n.Value)
+			if err != nil {
+				return nil, err
+			}
+			types[path] = s.Object.Value
+		}
+	}
+	return types, nil
+}
@@ -0,0 +1,150 @@
+package query
+
+import (
+	"sort"
+	"strings"
+
+	"gonum.org/v1/gonum/graph/formats/rdf"
+
+	"github.com/efd6/ecsinrdf/term"
+)
+
+// Placement is the analysis of where a field with a path and type belongs
+// in ECS.
+type Placement struct {
+	// Exact is the ECS field with the field's path.
+	// It is nil if there is none. Its types may
+	// differ from the field's type.
+	Exact *ECSField
+	// Renames holds the graft candidates with the
+	// field's type, ordered by depth and then
+	// lexically.
+	Renames []Rename
+	// Coerced holds the graft candidates with a
+	// type in the same family as the field's type,
+	// such as wildcard for keyword or integer for
+	// long, sorted by path and then type.
+	Coerced []Coercion
+}
+
+// Rename is a graft candidate and the other candidates that are reuses of
+// it.
+type Rename struct {
+	// Path is the quoted candidate path.
+	Path string
+	// Reuses holds the quoted candidate paths that
+	// end with the candidate path, such as
+	// source.user for user, sorted lexically.
+	Reuses []string
+}
+
+// Coercion is a graft candidate with a type that differs from the field's.
+type Coercion struct {
+	// Path is the quoted candidate path.
+	Path string
+	// Type is the quoted type of the candidate.
+	Type string
+}
+
+// PlacementOf returns the placement of a field with the provided full path
+// and typ, which need not be in the graph. The full path and typ are
+// expected to be quoted as unqualified RDF literals. The path is rewritten
+// by the rules before candidates are found, as for CandidateGraftsFor.
+//
+// The graph g is expected to hold statements constructed by the schema
+// package in this repo.
+func PlacementOf(g *rdf.Graph, full, typ string, rules PathRules) (Placement, error) {
+	var p Placement
+	if f, ok := ECSFieldOf(g, full); ok {
+		p.Exact = &f
+	}
+
+	cands, err := placementCandidates(g, full, typ, rules)
+	if err != nil {
+		return Placement{}, err
+	}
+	sortByDepth(cands)
+	isCand := make(map[string]bool, len(cands))
+	for _, c := range cands {
+		isCand[c] = true
+	}
+	reused := make(map[string]bool)
+	for _, c := range cands {
+		if reused[c] {
+			continue
+		}
+		r := Rename{Path: c}
+		suffix := "." + strings.Trim(c, `"`) + `"`
+		for _, other := range cands {
+			if other != c && strings.HasSuffix(other, suffix) {
+				r.Reuses = append(r.Reuses, other)
+				reused[other] = true
+			}
+		}
+		sort.Strings(r.Reuses)
+		p.Renames = append(p.Renames, r)
+	}
+
+	for _, family := range typeFamilies {
+		if !family[typ] {
+			continue
+		}
+		for t := range family {
+			if t == typ {
+				continue
+			}
+			cands, err := placementCandidates(g, full, t, rules)
+			if err != nil {
+				return Placement{}, err
+			}
+			for _, c := range cands {
+				p.Coerced = append(p.Coerced, Coercion{Path: c, Type: t})
+			}
+		}
+	}
+	sort.Slice(p.Coerced, func(i, j int) bool {
+		if p.Coerced[i].Path != p.Coerced[j].Path {
+			return p.Coerced[i].Path < p.Coerced[j].Path
+		}
+		return p.Coerced[i].Type < p.Coerced[j].Type
+	})
+	return p, nil
+}
+
+// placementCandidates returns the graft candidates for the full path and
+// typ. A path or type that is not in the graph has no candidates.
+func placementCandidates(g *rdf.Graph, full, typ string, rules PathRules) ([]string, error) {
+	if _, ok := g.TermFor(typ); !ok {
+		return nil, nil
+	}
+	text, err := term.Text(full)
+	if err != nil {
+		return nil, err
+	}
+	path := rules.Apply(strings.Split(text, "."))
+	if _, ok := g.TermFor(term.Literal(path[len(path)-1])); !ok {
+		return nil, nil
+	}
+	return CandidateGraftsFor(g, full, typ, rules)
+}
+
+// sortByDepth sorts the quoted paths by depth, shallowest first, and then
+// lexically.
+func sortByDepth(paths []string) {
+	sort.Slice(paths, func(i, j int) bool {
+		di, dj := strings.Count(paths[i], "."), strings.Count(paths[j], ".")
+		if di != dj {
+			return di < dj
+		}
+		return paths[i] < paths[j]
+	})
+}
+
+// typeFamilies holds sets of quoted field types that a field may be
+// coerced between when it is grafted.
+var typeFamilies = []map[string]bool{
+	{`"keyword"`: true, `"constant_keyword"`: true, `"wildcard"`: true},
+	{`"text"`: true, `"match_only_text"`: true},
+	{`"date"`: true, `"date_nanos"`: true},
+	numericTypes,
+}
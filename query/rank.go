@@ -0,0 +1,114 @@
+package query
+
+import (
+	"sort"
+	"strings"
+
+	"gonum.org/v1/gonum/graph/formats/rdf"
+
+	"github.com/efd6/ecsinrdf/term"
+)
+
+// PathContext holds the quoted paths of the ECS fields used by a package
+// under each object path, keyed by unquoted object path.
+type PathContext map[string][]string
+
+// PackageContextIn returns the path context of the published package
+// fields in the graph that are ECS fields.
+//
+// The graph g is expected to hold statements constructed by the schema
+// and integration packages in this repo.
+func PackageContextIn(g *rdf.Graph) (PathContext, error) {
+	ctx := make(PathContext)
+	seen := make(map[string]bool)
+	for _, n := range PublishedFieldsIn(g).Out(byPath).Unique().Result() {
+		if len(g.Query(n).In(byPath).Out(byType).Result()) == 0 {
+			// Not an ECS field.
+			continue
+		}
+		path, err := term.Text(n.Value)
+		if err != nil {
+			return nil, err
+		}
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+		for i := strings.LastIndexByte(path, '.'); i > 0; i = strings.LastIndexByte(path[:i], '.') {
+			ctx[path[:i]] = append(ctx[path[:i]], n.Value)
+		}
+	}
+	for _, paths := range ctx {
+		sort.Strings(paths)
+	}
+	return ctx, nil
+}
+
+// Rank returns the quoted candidate paths in cands ordered by their
+// plausibility in the context. A candidate scores the number of ECS
+// fields used by the package under each of its ancestors and itself, so
+// the presence of source.* fields ranks source.user above
+// destination.user. Candidates
+// with equal scores are ordered by depth, shallowest first, so a field
+// set's own location ranks above its reuses, and then lexically. The
+// cands slice is sorted in place.
+func (c PathContext) Rank(cands []string) ([]string, error) {
+	score := make(map[string]int, len(cands))
+	depth := make(map[string]int, len(cands))
+	for _, cand := range cands {
+		path, err := term.Text(cand)
+		if err != nil {
+			return nil, err
+		}
+		parts := strings.Split(path, ".")
+		depth[cand] = len(parts)
+		for i := range parts {
+			score[cand] += len(c[strings.Join(parts[:i+1], ".")])
+		}
+	}
+	sort.SliceStable(cands, func(i, j int) bool {
+		a, b := cands[i], cands[j]
+		switch {
+		case score[a] != score[b]:
+			return score[a] > score[b]
+		case depth[a] != depth[b]:
+			return depth[a] < depth[b]
+		default:
+			return a < b
+		}
+	})
+	return cands, nil
+}
+
+// Evidence returns the quoted paths of the ECS fields used by the package
+// that support the quoted candidate path cand: those under the candidate's
+// top-level field set, in lexical order.
+func (c PathContext) Evidence(cand string) ([]string, error) {
+	path, err := term.Text(cand)
+	if err != nil {
+		return nil, err
+	}
+	if i := strings.IndexByte(path, '.'); i >= 0 {
+		path = path[:i]
+	}
+	return c[path], nil
+}
+
+// WithEvidence returns the candidates in cands that have evidence in the
+// context if any do, and otherwise all of cands.
+func (c PathContext) WithEvidence(cands []Candidate) ([]Candidate, error) {
+	var supported []Candidate
+	for _, cand := range cands {
+		ev, err := c.Evidence(cand.Path)
+		if err != nil {
+			return nil, err
+		}
+		if len(ev) != 0 {
+			supported = append(supported, cand)
+		}
+	}
+	if len(supported) == 0 {
+		return cands, nil
+	}
+	return supported, nil
+}
@@ -0,0 +1,129 @@
+package query
+
+import (
+	"sort"
+
+	"gonum.org/v1/gonum/graph/formats/rdf"
+)
+
+// UseIssue is a field read or written by an ML job or transform that is
+// not declared, or is declared with a type the use does not accept.
+type UseIssue struct {
+	// Path is the quoted full path of the field.
+	Path string
+	// By is the quoted reference to the job or
+	// transform using the field.
+	By string
+	// Destination is whether the field is written
+	// by a transform rather than read.
+	Destination bool
+	// Requires is the quoted class of types the use
+	// accepts. It is empty if any type is accepted.
+	Requires string
+	// Types holds the quoted types declared for the
+	// path. It is empty if the field is not declared.
+	Types []string
+}
+
+// UseIssuesIn returns the problems with the fields used by ML jobs and
+// transforms in the graph, sorted by path and user. Fields read by a job
+// or transform must be declared by ECS or a package, and fields written by
+// a transform must be declared by a package. All declared types must be
+// in the class of types the use requires.
+//
+// The graph g is expected to hold statements constructed by the ml,
+// transform, schema and integration packages in this repo.
+func UseIssuesIn(g *rdf.Graph) []UseIssue {
+	p := PublishedFieldsIn(g)
+	var issues []UseIssue
+	seen := make(map[string]bool)
+	for it := g.AllStatements(); it.Next(); {
+		s := it.Statement()
+		destination := producedBy(s)
+		if !destination && !usedBy(s) {
+			continue
+		}
+		var requires string
+		for _, r := range g.Query(s.Subject).Out(requiresType).Result() {
+			requires = r.Value
+		}
+		for _, path := range g.Query(s.Subject).Out(byPath).Result() {
+			declared := g.Query(path).In(byPath)
+			typs := declared.And(p).Out(byUsedType)
+			if !destination {
+				typs = typs.Or(declared.Out(byType))
+			}
+			var types []string
+			ok := true
+			for _, t := range typs.Unique().Result() {
+				types = append(types, t.Value)
+				if !acceptsType(requires, t.Value) {
+					ok = false
+				}
+			}
+			if ok && len(types) != 0 {
+				continue
+			}
+			sort.Strings(types)
+			key := path.Value + "\x00" + s.Object.Value + "\x00" + requires
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			issues = append(issues, UseIssue{
+				Path:        path.Value,
+				By:          s.Object.Value,
+				Destination: destination,
+				Requires:    requires,
+				Types:       types,
+			})
+		}
+	}
+	sort.Slice(issues, func(i, j int) bool {
+		switch {
+		case issues[i].Path != issues[j].Path:
+			return issues[i].Path < issues[j].Path
+		case issues[i].By != issues[j].By:
+			return issues[i].By < issues[j].By
+		default:
+			return issues[i].Requires < issues[j].Requires
+		}
+	})
+	return issues
+}
+
+// acceptsType returns whether the quoted class of types accepts the quoted
+// field type typ. The empty class accepts any type.
+func acceptsType(class, typ string) bool {
+	switch class {
+	case "":
+		return true
+	case `"numeric"`:
+		return numericTypes[typ]
+	case `"date"`:
+		return dateTypes[typ]
+	case `"ordered"`:
+		return numericTypes[typ] || dateTypes[typ]
+	case `"aggregatable"`:
+		return !unaggregatableTypes[typ]
+	default:
+		return false
+	}
+}
+
+// dateTypes is the set of quoted date field types.
+var dateTypes = map[string]bool{
+	`"date"`:       true,
+	`"date_nanos"`: true,
+}
+
+// unaggregatableTypes is the set of quoted field types that cannot be
+// aggregated on.
+var unaggregatableTypes = map[string]bool{
+	`"text"`:            true,
+	`"match_only_text"`: true,
+	`"annotated_text"`:  true,
+	`"object"`:          true,
+	`"nested"`:          true,
+	`"group"`:           true,
+}
@@ -0,0 +1,49 @@
+package query
+
+import (
+	"sort"
+
+	"gonum.org/v1/gonum/graph/formats/rdf"
+)
+
+// PathVariant is a set of field paths that differ only in spelling.
+type PathVariant struct {
+	// Canonical is the quoted canonical form of
+	// the paths.
+	Canonical string
+	// Paths holds the quoted paths, sorted lexically.
+	Paths []string
+}
+
+// PathVariantsIn returns the canonical paths in the graph that are held by
+// fields with more than one literal path, sorted by canonical path. These
+// are fields, possibly from different sources, that refer to the same
+// field with different case or word separators, such as "EventID" and
+// "event_id".
+//
+// The graph g is expected to hold statements passed through
+// term.CanonicalPaths.
+func PathVariantsIn(g *rdf.Graph) []PathVariant {
+	canonical := make(map[rdf.Term]bool)
+	for it := g.AllStatements(); it.Next(); {
+		s := it.Statement()
+		if byCanonicalPath(s) {
+			canonical[s.Object] = true
+		}
+	}
+	var variants []PathVariant
+	for c := range canonical {
+		paths := g.Query(c).In(byCanonicalPath).Out(byPath).Unique().Result()
+		if len(paths) < 2 {
+			continue
+		}
+		v := PathVariant{Canonical: c.Value, Paths: make([]string, len(paths))}
+		for i, p := range paths {
+			v.Paths[i] = p.Value
+		}
+		sort.Strings(v.Paths)
+		variants = append(variants, v)
+	}
+	sort.Slice(variants, func(i, j int) bool { return variants[i].Canonical < variants[j].Canonical })
+	return variants
+}
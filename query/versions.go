@@ -0,0 +1,120 @@
+package query
+
+import (
+	"sort"
+
+	"gonum.org/v1/gonum/graph/formats/rdf"
+
+	"github.com/efd6/ecsinrdf/term"
+)
+
+// FieldVersions is an ECS field path that is not present in every ECS
+// version in a graph.
+type FieldVersions struct {
+	// Path is the quoted full path of the field.
+	Path string
+	// Versions holds the quoted ECS versions that
+	// have the field, in version order.
+	Versions []string
+}
+
+// VersionedFieldsIn returns the ECS field paths in the graph that are not
+// present in all of the graph's ECS versions, sorted by path. The first
+// of a field's versions is when the field appeared, and a field missing
+// from later versions has been removed.
+//
+// The graph g is expected to hold ECS statements tagged with their version
+// by the main package of this repo.
+func VersionedFieldsIn(g *rdf.Graph) ([]FieldVersions, error) {
+	all := make(map[string]bool)
+	paths := make(map[string]map[string]bool)
+	for it := g.AllStatements(); it.Next(); {
+		s := it.Statement()
+		if !inVersion(s) {
+			continue
+		}
+		all[s.Object.Value] = true
+		for _, p := range g.Query(s.Subject).Out(byPath).Result() {
+			if paths[p.Value] == nil {
+				paths[p.Value] = make(map[string]bool)
+			}
+			paths[p.Value][s.Object.Value] = true
+		}
+	}
+	var found []FieldVersions
+	for p, versions := range paths {
+		if len(versions) == len(all) {
+			continue
+		}
+		v := make([]string, 0, len(versions))
+		for ver := range versions {
+			v = append(v, ver)
+		}
+		err := sortVersions(v)
+		if err != nil {
+			return nil, err
+		}
+		found = append(found, FieldVersions{Path: p, Versions: v})
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].Path < found[j].Path })
+	return found, nil
+}
+
+// VersionsOf returns the quoted ECS versions in the graph that have a
+// field with the provided full path, in version order. The full path is
+// expected to be quoted as an unqualified RDF literal.
+func VersionsOf(g *rdf.Graph, full string) ([]string, error) {
+	node, ok := g.TermFor(full)
+	if !ok {
+		return nil, nil
+	}
+	var versions []string
+	for _, v := range g.Query(node).In(byPath).Out(inVersion).Unique().Result() {
+		versions = append(versions, v.Value)
+	}
+	return versions, sortVersions(versions)
+}
+
+// PreferVersion returns the quoted candidate paths in cands with the
+// candidates present in the given unquoted ECS version moved before those
+// that are only present in other versions of ECS in the graph. The order
+// of the candidates is otherwise retained. The cands slice is sorted in
+// place.
+func PreferVersion(g *rdf.Graph, cands []string, version string) []string {
+	v, ok := g.TermFor(term.Literal(version))
+	if !ok {
+		return cands
+	}
+	present := make(map[string]bool, len(cands))
+	for _, c := range cands {
+		node, ok := g.TermFor(c)
+		if !ok {
+			continue
+		}
+		present[c] = len(g.Query(node).In(byPath).Out(inVersion).And(g.Query(v)).Result()) != 0
+	}
+	sort.SliceStable(cands, func(i, j int) bool {
+		return present[cands[i]] && !present[cands[j]]
+	})
+	return cands
+}
+
+// sortVersions sorts the quoted versions in version order as described by
+// RemovedFieldsIn, and then lexically.
+func sortVersions(versions []string) error {
+	text := make(map[string]string, len(versions))
+	for _, v := range versions {
+		t, err := term.Text(v)
+		if err != nil {
+			return err
+		}
+		text[v] = t
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		if c := compareVersions(text[versions[i]], text[versions[j]]); c != 0 {
+			return c < 0
+		}
+		return versions[i] < versions[j]
+	})
+	return nil
+}
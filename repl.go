@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"gonum.org/v1/gonum/graph/formats/rdf"
+
+	"github.com/efd6/ecsinrdf/query"
+	"github.com/efd6/ecsinrdf/term"
+	"github.com/efd6/ecsinrdf/vocab"
+)
+
+// replHelp describes the commands accepted by the repl.
+const replHelp = `Commands:
+  path.to.field:type  report the ECS graft candidates for a field with the path and type
+  graft path          report the graft candidates for the package field with the path
+  show path           write the statements of the nodes with the path
+  children [path]     list the paths of the children of the nodes with the path, or the
+                      top-level paths if no path is given
+  reload              rebuild the graph, picking up changes to the package
+  help                show this help
+  quit                leave the repl
+`
+
+func replCommand(args []string) {
+	fs := newFlagSet("repl", "", "Build the graph once and answer queries read interactively from stdin. Run help in the repl for its commands")
+	gf := addGraphFlags(fs, true)
+	var exclude stringList
+	fs.Var(&exclude, "exclude", "specify a comma-separated list of graft destination path patterns to exclude (may be repeated)")
+	paths := addPathRuleFlags(fs, true)
+	limits := addLimitFlags(fs)
+	documents := fs.Bool("documents", false, "include statements for sample and test documents")
+	fs.Parse(args)
+	gf.requireECS(fs)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	defer gf.profile()()
+
+	cfg, err := gf.config(*documents)
+	if err != nil {
+		log.Fatal(err)
+	}
+	rules, err := paths.rules(cfg.pkg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	r := repl{
+		cfg:     cfg,
+		exclude: exclude,
+		rules:   rules,
+		limits:  *limits,
+	}
+	err = r.reload()
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = r.run(os.Stdin, isTerminal(os.Stdin))
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// repl is an interactive query session on a graph.
+type repl struct {
+	cfg     graphConfig
+	exclude []string
+	rules   query.PathRules
+	limits  query.Limits
+
+	g *rdf.Graph
+}
+
+// run reads commands from in until it is exhausted or a quit command is
+// read, writing the results to stdout. A prompt is written before each
+// command if prompt is true.
+func (r *repl) run(in io.Reader, prompt bool) error {
+	sc := bufio.NewScanner(in)
+	for {
+		if prompt {
+			fmt.Print("> ")
+		}
+		if !sc.Scan() {
+			if prompt {
+				fmt.Println()
+			}
+			return sc.Err()
+		}
+		cmd, arg, _ := strings.Cut(strings.TrimSpace(sc.Text()), " ")
+		arg = strings.TrimSpace(arg)
+		switch {
+		case cmd == "" || strings.HasPrefix(cmd, "#"):
+		case cmd == "quit" || cmd == "exit":
+			return nil
+		case cmd == "help":
+			fmt.Print(replHelp)
+		case cmd == "reload":
+			start := time.Now()
+			err := r.reload()
+			if err != nil {
+				// Keep the previous graph.
+				fmt.Println(err)
+				continue
+			}
+			fmt.Println(msg("repl.reloaded", time.Since(start).Round(time.Millisecond)))
+		case cmd == "graft" && arg != "":
+			r.graft(arg)
+		case cmd == "show" && arg != "":
+			r.show(arg)
+		case cmd == "children":
+			r.children(arg)
+		case arg == "" && validQuery(cmd):
+			writeQuery(r.g, cmd, r.exclude, r.rules, r.limits, false)
+		default:
+			fmt.Println(msg("repl.unknown", cmd))
+		}
+	}
+}
+
+// reload rebuilds the repl's graph from its configuration.
+func (r *repl) reload() error {
+	g, _, err := buildGraph(context.Background(), r.cfg)
+	if err != nil {
+		return err
+	}
+	r.g = g
+	return nil
+}
+
+// graft writes the ranked graft candidates for the package field with the
+// path.
+func (r *repl) graft(path string) {
+	cands, truncated, err := query.LimitedCandidateGraftsIn(r.g, term.Literal(path), r.rules, r.limits)
+	if err == nil {
+		cands, err = query.ExcludeCandidates(cands, r.exclude)
+	}
+	var ctx query.PathContext
+	if err == nil {
+		ctx, err = query.PackageContextIn(r.g)
+	}
+	if err == nil {
+		cands, err = ctx.Rank(cands)
+	}
+	if err == nil {
+		cands, err = query.PreferNormalization(r.g, term.Literal(path), cands, r.rules)
+	}
+	if err != nil {
+		fmt.Printf("%s: %v\n", path, err)
+		return
+	}
+	cands = query.PreferVersion(r.g, cands, r.cfg.version)
+	collapsed, err := query.CollapseMultiFields(r.g, term.Literal(path), cands, r.rules)
+	if err != nil {
+		fmt.Printf("%s: %v\n", path, err)
+		return
+	}
+	if truncated {
+		fmt.Printf("%v %s\n", collapsed, msg("query.truncated"))
+		return
+	}
+	fmt.Printf("%v\n", collapsed)
+}
+
+// show writes the statements with the nodes with the path as their
+// subject, sorted, with the nodes separated by blank lines.
+func (r *repl) show(path string) {
+	nodes := r.nodesWith(path)
+	if len(nodes) == 0 {
+		fmt.Println(msg("repl.not_found", path))
+		return
+	}
+	for i, n := range nodes {
+		if i != 0 {
+			fmt.Println()
+		}
+		var lines []string
+		for to := r.g.FromSubject(n); to.Next(); {
+			o := to.Node().(rdf.Term)
+			for it := r.g.Statements(n.ID(), o.ID()); it.Next(); {
+				lines = append(lines, it.Statement().String())
+			}
+		}
+		sort.Strings(lines)
+		for _, l := range lines {
+			fmt.Println(l)
+		}
+	}
+}
+
+// children writes the sorted paths of the children and collapsed
+// descendants of the nodes with the path, or of the nodes that are not a
+// child or multi-field of another node if path is empty.
+func (r *repl) children(path string) {
+	isPath := vocab.IsPath.Match
+	isChild := func(s *rdf.Statement) bool {
+		return vocab.HasChild.Match(s) || vocab.HasDescendant.Match(s)
+	}
+	var children rdf.Query
+	if path == "" {
+		var roots []rdf.Term
+		for it := r.g.AllStatements(); it.Next(); {
+			s := it.Statement()
+			if !isPath(s) {
+				continue
+			}
+			parents := r.g.Query(s.Subject).In(func(s *rdf.Statement) bool {
+				return isChild(s) || vocab.HasMulti.Match(s)
+			})
+			if len(parents.Result()) == 0 {
+				roots = append(roots, s.Subject)
+			}
+		}
+		children = r.g.Query(roots...)
+	} else {
+		nodes := r.nodesWith(path)
+		if len(nodes) == 0 {
+			fmt.Println(msg("repl.not_found", path))
+			return
+		}
+		children = r.g.Query(nodes...).Out(isChild)
+	}
+	var paths []string
+	for _, p := range children.Out(isPath).Unique().Result() {
+		paths = append(paths, p.Value)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		fmt.Println(p)
+	}
+}
+
+// nodesWith returns the nodes with the path, sorted by label.
+func (r *repl) nodesWith(path string) []rdf.Term {
+	lit, ok := r.g.TermFor(term.Literal(path))
+	if !ok {
+		return nil
+	}
+	nodes := r.g.Query(lit).In(vocab.IsPath.Match).Unique().Result()
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Value < nodes[j].Value })
+	return nodes
+}
+
+// isTerminal returns whether f is a terminal.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
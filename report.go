@@ -0,0 +1,867 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"gonum.org/v1/gonum/graph/formats/rdf"
+
+	"github.com/efd6/ecsinrdf/query"
+	"github.com/efd6/ecsinrdf/term"
+	"github.com/efd6/ecsinrdf/vocab"
+)
+
+// graftSuggestion is the graft report for a published package field or
+// object. Paths and types are quoted.
+type graftSuggestion struct {
+	path         string
+	inferredType string
+	owners       []string
+	err          error
+	candidates   []query.Candidate
+
+	// fields holds the fields of an object graft.
+	// It is empty for field grafts.
+	fields []string
+}
+
+// graftSuggestionsIn returns the graft reports for published package fields
+// in g that have a type and either have graft candidates not matching the
+// exclude patterns or could not be resolved. Package paths are rewritten
+// by the rules before they are matched.
+// Objects whose fields can all be grafted to a common ECS object are
+// reported as a single object graft in place of their fields. Candidates
+// are ranked by their plausibility for the package's other fields and hold
+// the package's ECS usage that supports them as evidence. Field candidates
+// whose ECS field is normalized to an array are placed before the others
+// when the package field holds arrays, and hold the examples of the ECS
+// field that the package field would be grafted to. If
+// evidenceOnly is true, candidates without evidence are omitted when
+// others for the same field have evidence. When g holds more than one ECS
+// version, candidates present in the package's ECS version are placed
+// before the others. The reports are sorted by path.
+func graftSuggestionsIn(g *rdf.Graph, version string, exclude []string, rules query.PathRules, evidenceOnly bool) ([]graftSuggestion, error) {
+	notGroup := func(s *rdf.Statement) bool {
+		return vocab.AsType.Match(s) && s.Object.Value != vocab.Group
+	}
+	inferred := vocab.InferredType.Match
+	p := query.PublishedFieldsIn(g)
+	p = p.Out(notGroup).In(notGroup).And(p).Or(p.Out(inferred).In(inferred).And(p))
+	// Fields with the same path in different data streams
+	// are distinct nodes, so collect the unique paths.
+	paths := p.Out(vocab.IsPath.Match).Unique()
+	objects, err := query.ObjectGraftsIn(g)
+	if err != nil {
+		return nil, err
+	}
+	ctx, err := query.PackageContextIn(g)
+	if err != nil {
+		return nil, err
+	}
+	var suggestions []graftSuggestion
+	inObject := make(map[string]bool)
+	for _, o := range objects {
+		cands, err := query.ExcludeCandidates(o.Candidates, exclude)
+		if err == nil {
+			cands, err = ctx.Rank(cands)
+		}
+		if err != nil {
+			return nil, err
+		}
+		cands = query.PreferVersion(g, cands, version)
+		if len(cands) == 0 {
+			continue
+		}
+		s := graftSuggestion{path: o.Path, owners: query.OwnersOf(g, o.Path), fields: o.Fields}
+		for _, c := range cands {
+			s.candidates = append(s.candidates, query.Candidate{Path: c})
+		}
+		s.candidates, err = withEvidence(ctx, s.candidates, evidenceOnly)
+		if err != nil {
+			return nil, err
+		}
+		suggestions = append(suggestions, s)
+		for _, f := range o.Fields {
+			inObject[f] = true
+		}
+	}
+	for _, n := range paths.Result() {
+		if inObject[n.Value] {
+			continue
+		}
+		cands, err := query.CandidateGraftsIn(g, n.Value, rules)
+		if err == nil {
+			cands, err = query.ExcludeCandidates(cands, exclude)
+		}
+		if err == nil {
+			cands, err = ctx.Rank(cands)
+		}
+		if err == nil {
+			cands, err = query.PreferNormalization(g, n.Value, cands, rules)
+		}
+		if len(cands) == 0 && err == nil {
+			continue
+		}
+		cands = query.PreferVersion(g, cands, version)
+		collapsed, cerr := query.CollapseMultiFields(g, n.Value, cands, rules)
+		if cerr != nil {
+			return nil, cerr
+		}
+		s := graftSuggestion{
+			path:       n.Value,
+			owners:     query.OwnersOf(g, n.Value),
+			err:        err,
+			candidates: collapsed,
+		}
+		if typ, ok := query.InferredTypeOf(g, n.Value); ok {
+			s.inferredType = typ
+		}
+		s.candidates, err = withEvidence(ctx, s.candidates, evidenceOnly)
+		if err != nil {
+			return nil, err
+		}
+		for i, c := range s.candidates {
+			s.candidates[i].Examples, err = query.CandidateExamples(g, n.Value, c.Path, rules)
+			if err != nil {
+				return nil, err
+			}
+		}
+		suggestions = append(suggestions, s)
+	}
+	sort.Slice(suggestions, func(i, j int) bool { return suggestions[i].path < suggestions[j].path })
+	return suggestions, nil
+}
+
+// withEvidence returns cands with their evidence in ctx. If evidenceOnly
+// is true and any candidate has evidence, candidates without evidence are
+// omitted.
+func withEvidence(ctx query.PathContext, cands []query.Candidate, evidenceOnly bool) ([]query.Candidate, error) {
+	for i, c := range cands {
+		var err error
+		cands[i].Evidence, err = ctx.Evidence(c.Path)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !evidenceOnly {
+		return cands, nil
+	}
+	return ctx.WithEvidence(cands)
+}
+
+// findingLines returns the graft findings in suggestions as sorted lines
+// of space-separated fields with unquoted values. Each line is either
+//
+//  graft <path> <destination> [multi_fields=<name>,...]
+//
+// for a graft candidate,
+//
+//  graft_object <path> <destination>
+//
+// for an object graft candidate or
+//
+//  error <path> <message>
+//
+// for a field that could not be resolved. The lines are stable for a given
+// set of findings so that changes in findings are shown clearly by a line
+// diff.
+func findingLines(suggestions []graftSuggestion) ([]string, error) {
+	var lines []string
+	for _, s := range suggestions {
+		errLine, graftLines, err := suggestionLines(s)
+		if err != nil {
+			return nil, err
+		}
+		if errLine != "" {
+			lines = append(lines, errLine)
+		}
+		lines = append(lines, graftLines...)
+	}
+	sort.Strings(lines)
+	return lines, nil
+}
+
+// suggestionLines returns the finding lines for s as described by
+// findingLines. The graft lines correspond to the candidates of s.
+func suggestionLines(s graftSuggestion) (errLine string, graftLines []string, err error) {
+	path, err := term.Text(s.path)
+	if err != nil {
+		return "", nil, err
+	}
+	if s.err != nil {
+		// Keep multi-line errors on a single line.
+		msg := strings.Join(strings.Fields(s.err.Error()), " ")
+		errLine = fmt.Sprintf("error %s %s", path, msg)
+	}
+	for _, c := range s.candidates {
+		dst, err := term.Text(c.Path)
+		if err != nil {
+			return "", nil, err
+		}
+		kind := "graft"
+		if len(s.fields) != 0 {
+			kind = "graft_object"
+		}
+		line := fmt.Sprintf("%s %s %s", kind, path, dst)
+		if len(c.MultiFields) != 0 {
+			multi := make([]string, len(c.MultiFields))
+			for i, m := range c.MultiFields {
+				multi[i], err = term.Text(m)
+				if err != nil {
+					return "", nil, err
+				}
+			}
+			line += " multi_fields=" + strings.Join(multi, ",")
+		}
+		graftLines = append(graftLines, line)
+	}
+	return errLine, graftLines, nil
+}
+
+// packageSuggestions is the graft suggestions for the fields declared by
+// a package.
+type packageSuggestions struct {
+	name        string
+	suggestions []graftSuggestion
+}
+
+// suggestionsByPackage returns the suggestions grouped by the packages
+// declaring their fields, sorted by package name. The graph is expected to
+// be built from more than one package so that its data streams are named
+// by package. A suggestion is held by each package declaring its fields.
+func suggestionsByPackage(g *rdf.Graph, suggestions []graftSuggestion) ([]packageSuggestions, error) {
+	index := make(map[string]int)
+	var groups []packageSuggestions
+	for _, s := range suggestions {
+		paths := s.fields
+		if len(paths) == 0 {
+			paths = []string{s.path}
+		}
+		seen := make(map[string]bool)
+		for _, p := range paths {
+			for _, ds := range query.DataStreamsOf(g, p) {
+				name, err := term.Text(ds)
+				if err != nil {
+					return nil, err
+				}
+				name = packageOfDataStream(name)
+				if seen[name] {
+					continue
+				}
+				seen[name] = true
+				i, ok := index[name]
+				if !ok {
+					i = len(groups)
+					index[name] = i
+					groups = append(groups, packageSuggestions{name: name})
+				}
+				groups[i].suggestions = append(groups[i].suggestions, s)
+			}
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].name < groups[j].name })
+	return groups, nil
+}
+
+// writeAnnotations writes the findings in suggestions to w as GitHub
+// Actions workflow commands annotating the declarations of each field.
+// Unresolved fields are reported as errors and graft candidates as
+// warnings. Object graft candidates annotate the declarations of each
+// field of the object. Declarations are located below the package root
+// pkg.
+func writeAnnotations(w io.Writer, g *rdf.Graph, pkg string, suggestions []graftSuggestion) error {
+	for _, s := range suggestions {
+		path, err := term.Text(s.path)
+		if err != nil {
+			return err
+		}
+		title := msg("annotation.grafts", path)
+		var defs []query.Definition
+		if len(s.fields) == 0 {
+			defs, err = query.DefinitionsOf(g, s.path)
+			if err != nil {
+				return err
+			}
+		} else {
+			title = msg("annotation.object_grafts", path)
+			for _, f := range s.fields {
+				d, err := query.DefinitionsOf(g, f)
+				if err != nil {
+					return err
+				}
+				defs = append(defs, d...)
+			}
+		}
+		var cands []string
+		for _, c := range s.candidates {
+			dst, err := term.Text(c.Path)
+			if err != nil {
+				return err
+			}
+			cands = append(cands, dst)
+		}
+		for _, d := range defs {
+			loc := "file=" + escapeProperty(packageFile(pkg, d.File))
+			if d.Line != 0 {
+				loc += fmt.Sprintf(",line=%d", d.Line)
+			}
+			if s.err != nil {
+				fmt.Fprintf(w, "::error %s,title=%s::%s\n", loc, escapeProperty(msg("annotation.unresolved", path)), escapeData(s.err.Error()))
+			}
+			if len(cands) != 0 {
+				fmt.Fprintf(w, "::warning %s,title=%s::%s\n", loc, escapeProperty(title), escapeData(strings.Join(cands, ", ")))
+			}
+		}
+	}
+	return nil
+}
+
+// markdownSection is the findings for a single data stream in a markdown
+// report. Paths and types are unquoted.
+type markdownSection struct {
+	grafts    []string
+	conflicts []string
+}
+
+// writeMarkdown writes the graft findings in suggestions and the type
+// conflicts to w as a markdown report for the package at pkg analyzed
+// against the given ECS version. Findings are grouped by the data streams
+// declaring their fields, with package-level fields first, and graft
+// candidates are rendered as a table in rank order.
+func writeMarkdown(w io.Writer, g *rdf.Graph, version, pkg string, suggestions []graftSuggestion, conflicts []query.Conflict) error {
+	sections := make(map[string]*markdownSection)
+	section := func(ds string) *markdownSection {
+		s, ok := sections[ds]
+		if !ok {
+			s = &markdownSection{}
+			sections[ds] = s
+		}
+		return s
+	}
+	streamsOf := func(paths ...string) ([]string, error) {
+		seen := make(map[string]bool)
+		var streams []string
+		for _, p := range paths {
+			for _, ds := range query.DataStreamsOf(g, p) {
+				if seen[ds] {
+					continue
+				}
+				seen[ds] = true
+				name, err := term.Text(ds)
+				if err != nil {
+					return nil, err
+				}
+				streams = append(streams, name)
+			}
+		}
+		if len(streams) == 0 {
+			// Package-level fields.
+			streams = []string{""}
+		}
+		return streams, nil
+	}
+
+	for _, s := range suggestions {
+		row, err := markdownGraftRow(s)
+		if err != nil {
+			return err
+		}
+		paths := s.fields
+		if len(paths) == 0 {
+			paths = []string{s.path}
+		}
+		streams, err := streamsOf(paths...)
+		if err != nil {
+			return err
+		}
+		for _, ds := range streams {
+			section(ds).grafts = append(section(ds).grafts, row)
+		}
+	}
+	for _, c := range conflicts {
+		path, err := term.Text(c.Path)
+		if err != nil {
+			return err
+		}
+		var dsts []string
+		for _, d := range c.Destinations {
+			dst, err := term.Text(d)
+			if err != nil {
+				return err
+			}
+			dsts = append(dsts, markdownCode(dst))
+		}
+		types := make([]string, 0, len(c.Types))
+		for typ := range c.Types {
+			types = append(types, typ)
+		}
+		sort.Strings(types)
+		for _, typ := range types {
+			t, err := term.Text(typ)
+			if err != nil {
+				return err
+			}
+			var others []string
+			for _, other := range types {
+				if other == typ {
+					continue
+				}
+				o, err := term.Text(other)
+				if err != nil {
+					return err
+				}
+				var streams []string
+				for _, ds := range c.Types[other] {
+					name, err := term.Text(ds)
+					if err != nil {
+						return err
+					}
+					streams = append(streams, name)
+				}
+				others = append(others, fmt.Sprintf("%s (%s)", markdownCode(o), markdownEscape(strings.Join(streams, ", "))))
+			}
+			row := fmt.Sprintf("| %s | %s | %s | %s |", markdownCode(path), markdownCode(t), strings.Join(others, "<br>"), strings.Join(dsts, ", "))
+			for _, ds := range c.Types[typ] {
+				name, err := term.Text(ds)
+				if err != nil {
+					return err
+				}
+				section(name).conflicts = append(section(name).conflicts, row)
+			}
+		}
+	}
+
+	fmt.Fprintf(w, "# %s\n", msg("markdown.title"))
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "- %s\n", msg("markdown.version", markdownCode(version)))
+	fmt.Fprintf(w, "- %s\n", msg("markdown.package", markdownCode(pkg)))
+	if len(sections) == 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, msg("markdown.no_findings"))
+		return nil
+	}
+	streams := make([]string, 0, len(sections))
+	for ds := range sections {
+		streams = append(streams, ds)
+	}
+	sort.Strings(streams)
+	for _, ds := range streams {
+		s := sections[ds]
+		fmt.Fprintln(w)
+		if ds == "" {
+			fmt.Fprintf(w, "## %s\n", msg("markdown.package_fields"))
+		} else {
+			fmt.Fprintf(w, "## %s\n", msg("markdown.data_stream", markdownCode(ds)))
+		}
+		if len(s.grafts) != 0 {
+			fmt.Fprintln(w)
+			fmt.Fprintf(w, "### %s\n", msg("markdown.grafts"))
+			fmt.Fprintln(w)
+			fmt.Fprintf(w, "| %s | %s | %s |\n", msg("markdown.field"), msg("markdown.candidates"), msg("markdown.notes"))
+			fmt.Fprintln(w, "| --- | --- | --- |")
+			for _, r := range s.grafts {
+				fmt.Fprintln(w, r)
+			}
+		}
+		if len(s.conflicts) != 0 {
+			fmt.Fprintln(w)
+			fmt.Fprintf(w, "### %s\n", msg("markdown.conflicts"))
+			fmt.Fprintln(w)
+			fmt.Fprintf(w, "| %s | %s | %s | %s |\n", msg("markdown.field"), msg("markdown.type"), msg("markdown.other_types"), msg("markdown.destinations"))
+			fmt.Fprintln(w, "| --- | --- | --- | --- |")
+			for _, r := range s.conflicts {
+				fmt.Fprintln(w, r)
+			}
+		}
+	}
+	return nil
+}
+
+// markdownGraftRow returns the markdown table row for s. Candidates are
+// listed in rank order with their multi-fields, evidence and examples.
+func markdownGraftRow(s graftSuggestion) (string, error) {
+	path, err := term.Text(s.path)
+	if err != nil {
+		return "", err
+	}
+	var cands []string
+	for _, c := range s.candidates {
+		dst, err := term.Text(c.Path)
+		if err != nil {
+			return "", err
+		}
+		cand := markdownCode(dst)
+		if len(c.MultiFields) != 0 {
+			var multi []string
+			for _, m := range c.MultiFields {
+				name, err := term.Text(m)
+				if err != nil {
+					return "", err
+				}
+				multi = append(multi, markdownCode(name))
+			}
+			cand = msg("graft.multi_fields", cand, strings.Join(multi, ", "))
+		}
+		var candNotes []string
+		if len(c.Evidence) != 0 {
+			var evidence []string
+			for _, e := range c.Evidence {
+				name, err := term.Text(e)
+				if err != nil {
+					return "", err
+				}
+				evidence = append(evidence, name)
+			}
+			candNotes = append(candNotes, msg("graft.evidence", markdownEscape(evidenceSummary(evidence))))
+		}
+		if len(c.Examples) != 0 {
+			var examples []string
+			for _, e := range c.Examples {
+				text, err := term.Text(e)
+				if err != nil {
+					return "", err
+				}
+				examples = append(examples, markdownCode(text))
+			}
+			candNotes = append(candNotes, msg("graft.examples", strings.Join(examples, ", ")))
+		}
+		if len(candNotes) != 0 {
+			cand += " (" + strings.Join(candNotes, "; ") + ")"
+		}
+		cands = append(cands, cand)
+	}
+	var notes []string
+	if len(s.fields) != 0 {
+		notes = append(notes, msg("graft.object", len(s.fields)))
+	}
+	if s.inferredType != "" {
+		typ, err := term.Text(s.inferredType)
+		if err != nil {
+			return "", err
+		}
+		notes = append(notes, msg("graft.inferred", markdownCode(typ)))
+	}
+	if len(s.owners) != 0 {
+		notes = append(notes, msg("graft.owners", markdownEscape(strings.Join(s.owners, ", "))))
+	}
+	if s.err != nil {
+		// Keep multi-line errors in a single cell.
+		notes = append(notes, msg("graft.error", markdownEscape(strings.Join(strings.Fields(s.err.Error()), " "))))
+	}
+	return fmt.Sprintf("| %s | %s | %s |", markdownCode(path), strings.Join(cands, "<br>"), strings.Join(notes, "; ")), nil
+}
+
+// markdownCode returns s as a markdown code span for use in a table cell.
+func markdownCode(s string) string {
+	return "`" + strings.ReplaceAll(s, "|", `\|`) + "`"
+}
+
+// markdownEscape escapes s for use as text in a markdown table cell.
+func markdownEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "|", `\|`, "*", `\*`, "_", `\_`, "`", "\\`", "<", "&lt;").Replace(s)
+}
+
+// writeECSDiff writes the changes in d to w, one per line with unquoted
+// paths, types and field sets. Each line is one of
+//
+//  added <path> <type>
+//  removed <path> <type>
+//  type_changed <path> <old type> -> <new type>
+//  reuse_changed <path> <old field sets> -> <new field sets>
+//
+// where multiple types or field sets are comma-separated and an empty set
+// is written as "-".
+func writeECSDiff(w io.Writer, d query.ECSDiff) error {
+	for _, section := range []struct {
+		kind    string
+		changes []query.FieldChange
+	}{
+		{kind: "added", changes: d.Added},
+		{kind: "removed", changes: d.Removed},
+		{kind: "type_changed", changes: d.TypeChanged},
+		{kind: "reuse_changed", changes: d.ReuseChanged},
+	} {
+		for _, c := range section.changes {
+			path, err := term.Text(c.Path)
+			if err != nil {
+				return err
+			}
+			old, err := unquote(c.Old)
+			if err != nil {
+				return err
+			}
+			new, err := unquote(c.New)
+			if err != nil {
+				return err
+			}
+			switch section.kind {
+			case "added":
+				fmt.Fprintf(w, "%s %s %s\n", section.kind, path, strings.Join(new, ","))
+			case "removed":
+				fmt.Fprintf(w, "%s %s %s\n", section.kind, path, strings.Join(old, ","))
+			default:
+				fmt.Fprintf(w, "%s %s %s -> %s\n", section.kind, path, diffList(old), diffList(new))
+			}
+		}
+	}
+	return nil
+}
+
+// diffList returns the comma-separated values in l, or "-" if l is empty.
+func diffList(l []string) string {
+	if len(l) == 0 {
+		return "-"
+	}
+	return strings.Join(l, ",")
+}
+
+// escapeData escapes s for use as a workflow command message.
+func escapeData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+// escapeProperty escapes s for use as a workflow command property value.
+func escapeProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
+
+// readBaseline returns the set of finding lines held in the baseline file
+// at path. Empty lines and lines starting with '#' are ignored.
+func readBaseline(path string) (map[string]bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	baseline := make(map[string]bool)
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		baseline[line] = true
+	}
+	return baseline, sc.Err()
+}
+
+// writeBaseline writes the finding lines for suggestions to a baseline file
+// at path.
+func writeBaseline(path string, suggestions []graftSuggestion) error {
+	lines, err := findingLines(suggestions)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	buf.WriteString("# ecsinrdf baseline: findings listed here are not reported.\n")
+	for _, l := range lines {
+		buf.WriteString(l)
+		buf.WriteByte('\n')
+	}
+	return os.WriteFile(path, buf.Bytes(), 0o644)
+}
+
+// newFindings returns the findings in suggestions that are not held in
+// the baseline. Suggestions left without findings are omitted.
+func newFindings(suggestions []graftSuggestion, baseline map[string]bool) ([]graftSuggestion, error) {
+	var found []graftSuggestion
+	for _, s := range suggestions {
+		errLine, graftLines, err := suggestionLines(s)
+		if err != nil {
+			return nil, err
+		}
+		if baseline[errLine] {
+			s.err = nil
+		}
+		var cands []query.Candidate
+		for i, l := range graftLines {
+			if !baseline[l] {
+				cands = append(cands, s.candidates[i])
+			}
+		}
+		s.candidates = cands
+		if s.err == nil && len(s.candidates) == 0 {
+			continue
+		}
+		found = append(found, s)
+	}
+	return found, nil
+}
+
+// packageReport is the full analysis report for a package. All paths,
+// types and names are unquoted.
+type packageReport struct {
+	Grafts         []graftReport        `json:"grafts"`
+	Conflicts      []conflictReport     `json:"conflicts"`
+	Undeclared     []string             `json:"undeclared"`
+	Unobserved     []string             `json:"unobserved"`
+	Completeness   []completenessReport `json:"completeness"`
+	Analysis       []analysisReport     `json:"analysis"`
+	ImplicitGroups []groupReport        `json:"implicit_groups"`
+	Docs           []docsReport         `json:"docs"`
+	Examples       []exampleReport      `json:"examples"`
+}
+
+type graftReport struct {
+	Path         string            `json:"path"`
+	InferredType string            `json:"inferred_type,omitempty"`
+	Owners       []string          `json:"owners,omitempty"`
+	Error        string            `json:"error,omitempty"`
+	Candidates   []candidateReport `json:"candidates,omitempty"`
+	Fields       []string          `json:"object_fields,omitempty"`
+}
+
+type candidateReport struct {
+	Path        string   `json:"path"`
+	MultiFields []string `json:"multi_fields,omitempty"`
+	Evidence    []string `json:"evidence,omitempty"`
+	Examples    []string `json:"examples,omitempty"`
+}
+
+type conflictReport struct {
+	Path         string              `json:"path"`
+	Types        map[string][]string `json:"types"`
+	Destinations []string            `json:"destinations,omitempty"`
+}
+
+type completenessReport struct {
+	DataStream string              `json:"data_stream"`
+	Score      float64             `json:"score"`
+	Fields     []fieldCompleteness `json:"fields"`
+}
+
+type fieldCompleteness struct {
+	Path    string   `json:"path"`
+	Score   float64  `json:"score"`
+	Missing []string `json:"missing,omitempty"`
+}
+
+type analysisReport struct {
+	Path    string   `json:"path"`
+	Reasons []string `json:"reasons"`
+}
+
+type docsReport struct {
+	Path   string   `json:"path"`
+	Issues []string `json:"issues"`
+}
+
+type exampleReport struct {
+	Path     string   `json:"path"`
+	Type     string   `json:"type"`
+	Examples []string `json:"examples"`
+}
+
+type groupReport struct {
+	Path string `json:"path"`
+	Type string `json:"ecs_type"`
+}
+
+// analyzePackage returns the full analysis report for the package
+// statements in g using the ECS version. The graph is expected to include
+// sample and test documents. Graft destinations matching the exclude
+// patterns are omitted and package paths are rewritten by the rules before
+// they are matched.
+func analyzePackage(g *rdf.Graph, version string, exclude []string, rules query.PathRules) (*packageReport, error) {
+	var (
+		r       packageReport
+		textErr error
+	)
+	text := func(lit string) string {
+		if textErr != nil {
+			return ""
+		}
+		var t string
+		t, textErr = term.Text(lit)
+		return t
+	}
+	texts := func(lits []string) []string {
+		var t []string
+		for _, l := range lits {
+			t = append(t, text(l))
+		}
+		return t
+	}
+
+	suggestions, err := graftSuggestionsIn(g, version, exclude, rules, false)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range suggestions {
+		gr := graftReport{Path: text(s.path), Owners: texts(s.owners), Fields: texts(s.fields)}
+		if s.inferredType != "" {
+			gr.InferredType = text(s.inferredType)
+		}
+		if s.err != nil {
+			gr.Error = s.err.Error()
+		}
+		for _, c := range s.candidates {
+			gr.Candidates = append(gr.Candidates, candidateReport{Path: text(c.Path), MultiFields: texts(c.MultiFields), Evidence: texts(c.Evidence), Examples: texts(c.Examples)})
+		}
+		r.Grafts = append(r.Grafts, gr)
+	}
+
+	for _, c := range query.DataStreamConflictsIn(g) {
+		cr := conflictReport{Path: text(c.Path), Types: make(map[string][]string), Destinations: texts(c.Destinations)}
+		for typ, streams := range c.Types {
+			cr.Types[text(typ)] = texts(streams)
+		}
+		r.Conflicts = append(r.Conflicts, cr)
+	}
+
+	byPath := vocab.IsPath.Match
+	undeclared, err := query.UndeclaredFieldsIn(g)
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range undeclared.Out(byPath).Unique().Result() {
+		r.Undeclared = append(r.Undeclared, text(n.Value))
+	}
+	for _, n := range query.UnobservedFieldsIn(g).Out(byPath).Unique().Result() {
+		r.Unobserved = append(r.Unobserved, text(n.Value))
+	}
+
+	for _, ds := range query.CompletenessIn(g) {
+		cr := completenessReport{Score: ds.Score}
+		if ds.DataStream != "" {
+			cr.DataStream = text(ds.DataStream)
+		}
+		for _, f := range ds.Fields {
+			cr.Fields = append(cr.Fields, fieldCompleteness{Path: text(f.Path), Score: f.Score, Missing: f.Missing})
+		}
+		r.Completeness = append(r.Completeness, cr)
+	}
+
+	for _, d := range query.AnalysisDeviationsIn(g) {
+		r.Analysis = append(r.Analysis, analysisReport{Path: text(d.Path), Reasons: d.Reasons})
+	}
+
+	for _, m := range query.ImplicitGroupMismatchesIn(g) {
+		r.ImplicitGroups = append(r.ImplicitGroups, groupReport{Path: text(m.Path), Type: text(m.Type)})
+	}
+
+	issues, err := query.DescriptionIssuesIn(g)
+	if err != nil {
+		return nil, err
+	}
+	for _, i := range issues {
+		r.Docs = append(r.Docs, docsReport{Path: text(i.Path), Issues: i.Issues})
+	}
+	mismatches, err := query.ExampleMismatchesIn(g)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range mismatches {
+		r.Examples = append(r.Examples, exampleReport{Path: text(m.Path), Type: text(m.Type), Examples: texts(m.Examples)})
+	}
+
+	if textErr != nil {
+		return nil, textErr
+	}
+	return &r, nil
+}
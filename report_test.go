@@ -0,0 +1,25 @@
+package main
+
+import (
+	"testing"
+
+	"gonum.org/v1/gonum/graph/formats/rdf"
+
+	"github.com/efd6/ecsinrdf/query"
+	"github.com/efd6/ecsinrdf/term"
+	"github.com/efd6/ecsinrdf/vocab"
+)
+
+func TestAnalyzePackageTextError(t *testing.T) {
+	g := rdf.NewGraph()
+	for _, s := range []*rdf.Statement{
+		term.Triple(term.Blank("field"), vocab.IsPublished.Term(), rdf.Term{Value: vocab.True}),
+		term.Triple(term.Blank("field"), vocab.IsPath.Term(), rdf.Term{Value: "<not:literal>"}),
+	} {
+		g.AddStatement(s)
+	}
+	r, err := analyzePackage(g, "", nil, query.PathRules{})
+	if err == nil {
+		t.Errorf("expected error for non-literal path, got report: %+v", r)
+	}
+}
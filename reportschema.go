@@ -0,0 +1,166 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// reportSchema is the JSON Schema of the JSON package analysis report.
+//
+//go:embed report.schema.json
+var reportSchema []byte
+
+// serveReportSchema responds with the JSON Schema of the JSON package
+// analysis report.
+func serveReportSchema(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/schema+json")
+	w.Write(reportSchema)
+}
+
+// schemaNode is the subset of JSON Schema used by reportSchema.
+type schemaNode struct {
+	Ref                  string                 `json:"$ref"`
+	Type                 schemaTypes            `json:"type"`
+	Required             []string               `json:"required"`
+	Properties           map[string]*schemaNode `json:"properties"`
+	AdditionalProperties json.RawMessage        `json:"additionalProperties"`
+	Items                *schemaNode            `json:"items"`
+	Defs                 map[string]*schemaNode `json:"$defs"`
+}
+
+// schemaTypes is a JSON Schema type keyword, either a single type or a
+// list of types.
+type schemaTypes []string
+
+func (t *schemaTypes) UnmarshalJSON(b []byte) error {
+	var one string
+	if json.Unmarshal(b, &one) == nil {
+		*t = schemaTypes{one}
+		return nil
+	}
+	return json.Unmarshal(b, (*[]string)(t))
+}
+
+// validateReport returns an error describing the first place the JSON
+// report in b does not conform to reportSchema.
+func validateReport(b []byte) error {
+	var root schemaNode
+	err := json.Unmarshal(reportSchema, &root)
+	if err != nil {
+		return fmt.Errorf("invalid report schema: %w", err)
+	}
+	var v interface{}
+	err = json.Unmarshal(b, &v)
+	if err != nil {
+		return err
+	}
+	return root.validate(&root, "$", v)
+}
+
+// validate returns an error if v at the JSON path at does not conform to
+// n. References are resolved against root.
+func (n *schemaNode) validate(root *schemaNode, at string, v interface{}) error {
+	if n.Ref != "" {
+		name := strings.TrimPrefix(n.Ref, "#/$defs/")
+		def, ok := root.Defs[name]
+		if !ok {
+			return fmt.Errorf("invalid report schema: unknown reference %s", n.Ref)
+		}
+		return def.validate(root, at, v)
+	}
+	if len(n.Type) != 0 && !n.Type.allows(v) {
+		return fmt.Errorf("%s: %s is not %s", at, jsonType(v), strings.Join(n.Type, " or "))
+	}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for _, r := range n.Required {
+			if _, ok := v[r]; !ok {
+				return fmt.Errorf("%s: missing %s", at, r)
+			}
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if p, ok := n.Properties[k]; ok {
+				err := p.validate(root, at+"."+k, v[k])
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			switch string(n.AdditionalProperties) {
+			case "":
+			case "false":
+				return fmt.Errorf("%s: unexpected %s", at, k)
+			default:
+				var extra schemaNode
+				err := json.Unmarshal(n.AdditionalProperties, &extra)
+				if err != nil {
+					return fmt.Errorf("invalid report schema: %w", err)
+				}
+				err = extra.validate(root, at+"."+k, v[k])
+				if err != nil {
+					return err
+				}
+			}
+		}
+	case []interface{}:
+		if n.Items == nil {
+			return nil
+		}
+		for i, e := range v {
+			err := n.Items.validate(root, fmt.Sprintf("%s[%d]", at, i), e)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// allows returns whether the JSON value v has one of the types in t.
+func (t schemaTypes) allows(v interface{}) bool {
+	typ := jsonType(v)
+	for _, e := range t {
+		if e == typ || (e == "number" && typ == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonType returns the JSON Schema type name of the decoded JSON value v.
+// Numbers are reported as integers if they have no fractional part.
+func jsonType(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if v == float64(int64(v)) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+)
+
+// restServer exposes graft and field lookups on the graph held by an
+// rpcServer as REST endpoints. The endpoints are
+//
+//  GET /grafts?path=path.to.field&type=type
+//  POST /grafts
+//  GET /field?path=path.to.field
+//
+// The /grafts endpoint returns the graft candidates for the path and type
+// as the query method does, or for the package field with the path as the
+// graftCandidates method does if type is absent. A POST to /grafts takes a
+// JSON object holding a list of path and type objects in its queries field
+// and returns the result of the batchQuery method. The /field endpoint
+// returns the result of the field method. Results are returned as JSON.
+// Missing parameters are reported with a 400 status and failed lookups
+// with a 422 status, with a JSON object holding an error message.
+type restServer struct {
+	srv *rpcServer
+}
+
+// maxBatchSize is the maximum size of a POST /grafts request body.
+const maxBatchSize = 1 << 20
+
+func (h restServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost && r.URL.Path == "/grafts" {
+		p, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBatchSize))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		h.call(w, "batchQuery", p)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	var (
+		method string
+		params = map[string]string{"path": q.Get("path")}
+	)
+	switch r.URL.Path {
+	case "/grafts":
+		method = "graftCandidates"
+		if typ := q.Get("type"); typ != "" {
+			method = "query"
+			params["type"] = typ
+		}
+	case "/field":
+		method = "field"
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	p, err := json.Marshal(params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.call(w, method, p)
+}
+
+// call writes the JSON result of the named method called with the params
+// p to w.
+func (h restServer) call(w http.ResponseWriter, method string, p json.RawMessage) {
+	result, rerr := h.srv.call(rpcRequest{JSONRPC: "2.0", Method: method, Params: p})
+	status := http.StatusOK
+	var body interface{} = result
+	if rerr != nil {
+		status = http.StatusUnprocessableEntity
+		if rerr.Code == invalidParams {
+			status = http.StatusBadRequest
+		}
+		body = map[string]string{"error": rerr.Message}
+	}
+	b, err := json.Marshal(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(b)
+}
@@ -0,0 +1,155 @@
+// Package rewrite provides tools for applying graft suggestions to
+// package fields files.
+package rewrite
+
+import (
+	"errors"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Graft moves the definition of the field with the full path from in the
+// fields document doc to the ECS field with the full path to. The field's
+// definition is removed and an external ECS field declaration for to is
+// added to the document if it is not already present. Groups that are left
+// empty by the removal are also removed.
+//
+// If alias is true, the definition is instead replaced by an alias field at
+// the old path pointing to the new ECS destination so that existing queries
+// and dashboards continue to work.
+//
+// Graft returns false if the field is not defined in doc. The document is
+// expected to be a fields file decoded into a yaml.Node.
+func Graft(doc *yaml.Node, from, to string, alias bool) (bool, error) {
+	seq, err := fieldList(doc)
+	if err != nil {
+		return false, err
+	}
+	ok := graft(seq, "", from, to, alias)
+	if !ok {
+		return false, nil
+	}
+	if !hasField(seq, "", to) {
+		seq.Content = append(seq.Content, mapping("name", to, "external", "ecs"))
+	}
+	return true, nil
+}
+
+// fieldList returns the top-level field sequence of the fields document.
+func fieldList(doc *yaml.Node) (*yaml.Node, error) {
+	n := doc
+	if n.Kind == yaml.DocumentNode {
+		if len(n.Content) != 1 {
+			return nil, errors.New("invalid fields document")
+		}
+		n = n.Content[0]
+	}
+	if n.Kind != yaml.SequenceNode {
+		return nil, errors.New("fields document is not a sequence")
+	}
+	return n, nil
+}
+
+// graft performs the graft within the field sequence seq whose fields are
+// under the path parent. It returns whether the field was found.
+func graft(seq *yaml.Node, parent, from, to string, alias bool) bool {
+	for i, item := range seq.Content {
+		name := value(item, "name")
+		if name == "" {
+			continue
+		}
+		full := name
+		if parent != "" {
+			full = parent + "." + name
+		}
+		switch {
+		case full == from:
+			if alias {
+				seq.Content[i] = mapping("name", name, "type", "alias", "path", to)
+			} else {
+				remove(seq, i)
+			}
+			return true
+		case strings.HasPrefix(from, full+"."):
+			children := child(item, "fields")
+			if children == nil || children.Kind != yaml.SequenceNode {
+				continue
+			}
+			if !graft(children, full, from, to, alias) {
+				continue
+			}
+			if len(children.Content) == 0 {
+				remove(seq, i)
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// remove removes the ith item of seq. A head comment on the removed item
+// is retained by moving it to the following item.
+func remove(seq *yaml.Node, i int) {
+	item := seq.Content[i]
+	if item.HeadComment != "" && i+1 < len(seq.Content) && seq.Content[i+1].HeadComment == "" {
+		seq.Content[i+1].HeadComment = item.HeadComment
+	}
+	seq.Content = append(seq.Content[:i], seq.Content[i+1:]...)
+}
+
+// hasField returns whether the field with the full path is declared in seq
+// whose fields are under the path parent.
+func hasField(seq *yaml.Node, parent, path string) bool {
+	for _, item := range seq.Content {
+		name := value(item, "name")
+		if name == "" {
+			continue
+		}
+		full := name
+		if parent != "" {
+			full = parent + "." + name
+		}
+		if full == path {
+			return true
+		}
+		if strings.HasPrefix(path, full+".") {
+			children := child(item, "fields")
+			if children != nil && hasField(children, full, path) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// child returns the value node for key in the mapping node m.
+func child(m *yaml.Node, key string) *yaml.Node {
+	if m.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// value returns the scalar value for key in the mapping node m.
+func value(m *yaml.Node, key string) string {
+	v := child(m, key)
+	if v == nil || v.Kind != yaml.ScalarNode {
+		return ""
+	}
+	return v.Value
+}
+
+// mapping returns a mapping node holding the provided key and value pairs.
+func mapping(kv ...string) *yaml.Node {
+	m := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for _, s := range kv {
+		m.Content = append(m.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: s})
+	}
+	return m
+}
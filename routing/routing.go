@@ -0,0 +1,134 @@
+// Package routing provides tools for constructing RDF statements for the
+// datasets of data streams and the reroutes configured in their routing
+// rules.
+package routing
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"gonum.org/v1/gonum/graph/formats/rdf"
+	"gopkg.in/yaml.v3"
+
+	"github.com/efd6/ecsinrdf/term"
+	"github.com/efd6/ecsinrdf/vocab"
+)
+
+// Reroute is a routing rule target for documents of a source dataset.
+type Reroute struct {
+	// Source is the dataset the rule applies to.
+	Source string
+	// Target is the dataset documents are rerouted
+	// to when the rule matches.
+	Target string
+}
+
+// ruleSet is the serialized form of an entry in a routing_rules.yml file.
+type ruleSet struct {
+	SourceDataset string `yaml:"source_dataset"`
+	Rules         []struct {
+		TargetDataset stringList `yaml:"target_dataset"`
+	} `yaml:"rules"`
+}
+
+// stringList is a YAML string or list of strings.
+type stringList []string
+
+func (l *stringList) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		*l = stringList{n.Value}
+		return nil
+	}
+	var s []string
+	err := n.Decode(&s)
+	*l = s
+	return err
+}
+
+// Decode returns the reroutes held in the routing_rules.yml data in r,
+// sorted by source and target. Targets that are field references resolved
+// at ingest time, such as "{{labels.dataset}}", are not known and are
+// omitted.
+func Decode(r io.Reader) ([]Reroute, error) {
+	var sets []ruleSet
+	err := yaml.NewDecoder(r).Decode(&sets)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	found := make(map[Reroute]bool)
+	for _, set := range sets {
+		if set.SourceDataset == "" {
+			return nil, fmt.Errorf("missing source_dataset")
+		}
+		for _, rule := range set.Rules {
+			for _, target := range rule.TargetDataset {
+				if target == "" || strings.Contains(target, "{{") {
+					continue
+				}
+				found[Reroute{Source: set.SourceDataset, Target: target}] = true
+			}
+		}
+	}
+	reroutes := make([]Reroute, 0, len(found))
+	for r := range found {
+		reroutes = append(reroutes, r)
+	}
+	sort.Slice(reroutes, func(i, j int) bool {
+		if reroutes[i].Source == reroutes[j].Source {
+			return reroutes[i].Target < reroutes[j].Target
+		}
+		return reroutes[i].Source < reroutes[j].Source
+	})
+	return reroutes, nil
+}
+
+// DataStreamStatements calls fn on all RDF statements constructed from the
+// dataset of the named data stream and the reroutes held in its routing
+// rules.
+//
+// The graph that results has the following triples structure
+//
+// _:context <is:data_stream> "data_stream" .
+// _:context <in:dataset> _:dataset .
+// _:dataset <is:dataset> "dataset" .
+//
+// Reroutes link their source and target datasets.
+//
+// _:source <reroutes:to> _:target .
+// _:source <is:dataset> "source.dataset" .
+// _:target <is:dataset> "target.dataset" .
+//
+// Dataset nodes are shared by all data streams, so reroutes from one
+// package may be followed to the data streams of another.
+func DataStreamStatements(dataStream, dataset string, reroutes []Reroute, fn func(*rdf.Statement, error)) {
+	if dataStream != "" && dataset != "" {
+		h := sha1.Sum([]byte("data_stream" + dataStream))
+		hashContext := string(hex(h[:]))
+		fn(term.Triple(term.Blank(hashContext), vocab.IsDataStream.Term(), term.LiteralTerm(dataStream)), nil)
+		fn(term.Triple(term.Blank(hashContext), vocab.InDataset.Term(), term.Blank(datasetNode(dataset, fn))), nil)
+	}
+	for _, r := range reroutes {
+		fn(term.Triple(term.Blank(datasetNode(r.Source, fn)), vocab.ReroutesTo.Term(), term.Blank(datasetNode(r.Target, fn))), nil)
+	}
+}
+
+// datasetNode calls fn on the statement naming the node for the dataset
+// and returns the node's label.
+func datasetNode(dataset string, fn func(*rdf.Statement, error)) string {
+	h := sha1.Sum([]byte("dataset" + dataset))
+	hashDataset := string(hex(h[:]))
+	fn(term.Triple(term.Blank(hashDataset), vocab.IsDataset.Term(), term.LiteralTerm(dataset)), nil)
+	return hashDataset
+}
+
+func hex(data []byte) []byte {
+	const digit = "0123456789abcdef"
+	buf := make([]byte, 0, len(data)*2)
+	for _, b := range data {
+		buf = append(buf, digit[b>>4], digit[b&0xf])
+	}
+	return buf
+}
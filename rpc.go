@@ -0,0 +1,643 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gonum.org/v1/gonum/graph/formats/rdf"
+
+	"github.com/efd6/ecsinrdf/integration"
+	"github.com/efd6/ecsinrdf/query"
+	"github.com/efd6/ecsinrdf/term"
+)
+
+// JSON-RPC error codes. The codes below -32099 are defined by JSON-RPC 2.0
+// and the remainder by the Language Server Protocol.
+const (
+	parseError           = -32700
+	invalidRequest       = -32600
+	methodNotFound       = -32601
+	invalidParams        = -32602
+	serverNotInitialized = -32002
+	requestFailed        = -32803
+)
+
+// rpcRequest is a JSON-RPC 2.0 request or notification.
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// rpcError is a JSON-RPC 2.0 error object.
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string { return e.Message }
+
+// rpcServer is a JSON-RPC server holding a loaded graph. When serving
+// over stdin and stdout, messages are framed with Content-Length headers
+// as in the Language Server Protocol. Servers may also be hosted over HTTP
+// by an httpServer, in which case notifications are not sent.
+//
+// The methods are:
+//
+//  - initialize: build the graph from the optional ecsRoot, version and
+//    pkgPath parameters, defaulting to the command's flags. Without an
+//    ECS root, the ECS spec is fetched from GitHub.
+//  - query: return the graft candidates for the path and type parameters.
+//  - graftCandidates: return the graft candidates for the package field
+//    with the path parameter.
+//  - batchQuery: return the results of the query method, or of the
+//    graftCandidates method for queries without a type, for each path
+//    and type pair in the queries parameter, in order. Failed queries
+//    are reported in their result rather than failing the request.
+//  - fieldAt: return the information and graft candidates for the field
+//    enclosing the byte offset parameter in the package fields file
+//    with the file parameter. For graphs hosted over HTTP, the file must
+//    be within the graph's package root.
+//  - field: return the ECS information, package declarations, owners and
+//    graft candidates for the field with the path parameter.
+//  - rebuild: rebuild the graph in the background with the configuration
+//    used by initialize. Requests continue to be answered from the
+//    current graph until the rebuild is complete, when a graph/rebuilt
+//    notification is sent with an error parameter if the build failed.
+//  - shutdown: stop serving stdio after responding.
+//
+// Candidate paths are returned unquoted and destinations matching the
+// exclude patterns are omitted. Package paths are rewritten by the path
+// rules before they are matched. Candidate lookups are bounded by the
+// limits; a lookup that reaches a limit returns the candidates found so
+// far with a truncated field set to true.
+type rpcServer struct {
+	cfg     graphConfig
+	exclude []string
+	limits  query.Limits
+	metrics *serverMetrics
+	// rules and packagePrefix describe the path
+	// rules for packages, with the names of the
+	// active packages added as vendor prefixes
+	// if packagePrefix is true.
+	rules         query.PathRules
+	packagePrefix bool
+	// confined specifies whether fieldAt may only
+	// read files within the active package root, as
+	// for graphs hosted for token holders.
+	confined bool
+
+	graph       snapshot
+	active      graphConfig
+	activeRules query.PathRules
+	shutdown    bool
+
+	mu sync.Mutex // mu serializes writes to w.
+	w  io.Writer
+}
+
+// serve reads requests from r and writes responses to w until a shutdown
+// request has been handled, an exit notification is received or r is
+// exhausted.
+func (s *rpcServer) serve(r io.Reader, w io.Writer) error {
+	s.w = w
+	tr := textproto.NewReader(bufio.NewReader(r))
+	for !s.shutdown {
+		msg, err := readMessage(tr)
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		var req rpcRequest
+		err = json.Unmarshal(msg, &req)
+		if err != nil {
+			err = s.write(nil, nil, &rpcError{Code: parseError, Message: err.Error()})
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if req.Method == "exit" {
+			return nil
+		}
+		result, rerr := s.call(req)
+		if req.ID == nil {
+			// Notifications are not responded to.
+			continue
+		}
+		err = s.write(req.ID, result, rerr)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// call returns the result of the request, recording request metrics.
+func (s *rpcServer) call(req rpcRequest) (interface{}, *rpcError) {
+	start := time.Now()
+	result, err := s.handle(req)
+	method := req.Method
+	var rerr *rpcError
+	if errors.As(err, &rerr) && rerr.Code == methodNotFound {
+		// Bound the cardinality of the method label.
+		method = "unknown"
+	}
+	s.metrics.observeRequest(method, start, err)
+	if err != nil && rerr == nil {
+		rerr = &rpcError{Code: requestFailed, Message: err.Error()}
+	}
+	return result, rerr
+}
+
+// handle returns the result of the request.
+func (s *rpcServer) handle(req rpcRequest) (interface{}, error) {
+	if req.JSONRPC != "2.0" {
+		return nil, &rpcError{Code: invalidRequest, Message: "unsupported JSON-RPC version"}
+	}
+	// Hold the graph for the duration of the request so
+	// that it is answered consistently during a rebuild.
+	g := s.graph.load()
+	if g == nil && req.Method != "initialize" && req.Method != "shutdown" {
+		return nil, &rpcError{Code: serverNotInitialized, Message: "server not initialized"}
+	}
+	switch req.Method {
+	case "initialize":
+		var params struct {
+			ECSRoot string `json:"ecsRoot"`
+			Version string `json:"version"`
+			PkgPath string `json:"pkgPath"`
+		}
+		err := decodeParams(req.Params, &params)
+		if err != nil {
+			return nil, err
+		}
+		cfg := s.cfg
+		if params.ECSRoot != "" {
+			cfg.root = params.ECSRoot
+		}
+		if params.Version != "" {
+			cfg.version = params.Version
+		}
+		if params.PkgPath != "" {
+			cfg.pkg = params.PkgPath
+		}
+		if cfg.version == "" {
+			return nil, &rpcError{Code: invalidParams, Message: "missing version"}
+		}
+		// Use absolute paths for provenance so that
+		// clients can refer to files unambiguously.
+		if cfg.pkg != "" {
+			cfg.pkg, err = filepath.Abs(cfg.pkg)
+			if err != nil {
+				return nil, err
+			}
+		}
+		rules, err := pathRules(s.rules, s.packagePrefix, cfg.pkg)
+		if err != nil {
+			return nil, err
+		}
+		g, err := s.build(context.Background(), cfg)
+		if err != nil {
+			return nil, err
+		}
+		s.graph.store(g)
+		s.active = cfg
+		s.activeRules = rules
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"methods": []string{"query", "graftCandidates", "batchQuery", "fieldAt", "field", "rebuild", "shutdown"},
+			},
+		}, nil
+
+	case "query":
+		var params struct {
+			Path string `json:"path"`
+			Type string `json:"type"`
+		}
+		err := decodeParams(req.Params, &params)
+		if err != nil {
+			return nil, err
+		}
+		if params.Path == "" || params.Type == "" {
+			return nil, &rpcError{Code: invalidParams, Message: "missing path or type"}
+		}
+		cands, truncated, err := query.LimitedCandidateGraftsFor(g, term.Literal(params.Path), term.Literal(params.Type), s.activeRules, s.limits)
+		return s.candidates(g, cands, truncated, err)
+
+	case "graftCandidates":
+		var params struct {
+			Path string `json:"path"`
+		}
+		err := decodeParams(req.Params, &params)
+		if err != nil {
+			return nil, err
+		}
+		if params.Path == "" {
+			return nil, &rpcError{Code: invalidParams, Message: "missing path"}
+		}
+		cands, truncated, err := query.LimitedCandidateGraftsIn(g, term.Literal(params.Path), s.activeRules, s.limits)
+		return s.candidates(g, cands, truncated, err)
+
+	case "batchQuery":
+		var params struct {
+			Queries []batchQuery `json:"queries"`
+		}
+		err := decodeParams(req.Params, &params)
+		if err != nil {
+			return nil, err
+		}
+		if len(params.Queries) == 0 {
+			return nil, &rpcError{Code: invalidParams, Message: "missing queries"}
+		}
+		return s.batch(g, params.Queries)
+
+	case "fieldAt":
+		var params struct {
+			File   string `json:"file"`
+			Offset int    `json:"offset"`
+		}
+		err := decodeParams(req.Params, &params)
+		if err != nil {
+			return nil, err
+		}
+		if params.File == "" {
+			return nil, &rpcError{Code: invalidParams, Message: "missing file"}
+		}
+		return s.fieldAt(g, params.File, params.Offset)
+
+	case "field":
+		var params struct {
+			Path string `json:"path"`
+		}
+		err := decodeParams(req.Params, &params)
+		if err != nil {
+			return nil, err
+		}
+		if params.Path == "" {
+			return nil, &rpcError{Code: invalidParams, Message: "missing path"}
+		}
+		return s.field(g, params.Path)
+
+	case "rebuild":
+		cfg := s.active
+		started := s.graph.rebuild(func() (*rdf.Graph, error) {
+			return s.build(context.Background(), cfg)
+		}, func(err error) {
+			params := map[string]interface{}{}
+			if err != nil {
+				params["error"] = err.Error()
+			}
+			err = s.notify("graph/rebuilt", params)
+			if err != nil {
+				slog.Error("failed to send notification", "method", "graph/rebuilt", "error", err)
+			}
+		})
+		return map[string]interface{}{"started": started}, nil
+
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+
+	default:
+		return nil, &rpcError{Code: methodNotFound, Message: fmt.Sprintf("method not found: %s", req.Method)}
+	}
+}
+
+// build returns the graph described by cfg, recording build metrics.
+func (s *rpcServer) build(ctx context.Context, cfg graphConfig) (*rdf.Graph, error) {
+	start := time.Now()
+	cfg.store = term.NewStore()
+	g, _, err := buildGraph(ctx, cfg)
+	s.metrics.observeBuild(start, cfg.store, g, err)
+	return g, err
+}
+
+// batchQuery is a query in a batchQuery request.
+type batchQuery struct {
+	Path string `json:"path"`
+	Type string `json:"type,omitempty"`
+}
+
+// batchResult is the result of a query in a batchQuery request.
+type batchResult struct {
+	batchQuery
+	Candidates []string `json:"candidates,omitempty"`
+	Truncated  bool     `json:"truncated,omitempty"`
+	Error      string   `json:"error,omitempty"`
+}
+
+// batch returns a result holding the candidates for each of the queries
+// in g, in order.
+func (s *rpcServer) batch(g *rdf.Graph, queries []batchQuery) (interface{}, error) {
+	// Rank all queries in the same context rather
+	// than finding it for each query.
+	ctx, err := query.PackageContextIn(g)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]batchResult, len(queries))
+	for i, q := range queries {
+		results[i].batchQuery = q
+		if q.Path == "" {
+			results[i].Error = "missing path"
+			continue
+		}
+		var (
+			cands []string
+			err   error
+		)
+		if q.Type == "" {
+			cands, results[i].Truncated, err = query.LimitedCandidateGraftsIn(g, term.Literal(q.Path), s.activeRules, s.limits)
+		} else {
+			cands, results[i].Truncated, err = query.LimitedCandidateGraftsFor(g, term.Literal(q.Path), term.Literal(q.Type), s.activeRules, s.limits)
+		}
+		if err == nil {
+			results[i].Candidates, err = s.rankedPaths(ctx, cands)
+		}
+		if err != nil {
+			results[i].Error = err.Error()
+		}
+	}
+	return map[string]interface{}{"results": results}, nil
+}
+
+// candidates returns a result holding the unquoted candidate paths in
+// cands, omitting excluded destinations, ranked for the package fields
+// in g, and whether the candidates were truncated by the limits.
+func (s *rpcServer) candidates(g *rdf.Graph, cands []string, truncated bool, err error) (interface{}, error) {
+	paths, err := s.candidatePaths(g, cands, err)
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]interface{}{"candidates": paths}
+	if truncated {
+		result["truncated"] = true
+	}
+	return result, nil
+}
+
+// candidatePaths returns the unquoted candidate paths in cands, omitting
+// excluded destinations, ranked for the package fields in g.
+func (s *rpcServer) candidatePaths(g *rdf.Graph, cands []string, err error) ([]string, error) {
+	if err != nil {
+		return nil, err
+	}
+	ctx, err := query.PackageContextIn(g)
+	if err != nil {
+		return nil, err
+	}
+	return s.rankedPaths(ctx, cands)
+}
+
+// rankedPaths returns the unquoted candidate paths in cands, omitting
+// excluded destinations, ranked in the context.
+func (s *rpcServer) rankedPaths(ctx query.PathContext, cands []string) ([]string, error) {
+	cands, err := query.ExcludeCandidates(cands, s.exclude)
+	if err != nil {
+		return nil, err
+	}
+	cands, err = ctx.Rank(cands)
+	if err != nil {
+		return nil, err
+	}
+	return unquote(cands)
+}
+
+// fieldAt returns the information and graft candidates for the field
+// enclosing the byte offset in the fields file at path.
+func (s *rpcServer) fieldAt(g *rdf.Graph, path string, offset int) (interface{}, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if s.confined && !within(s.active.pkg, path) {
+		return nil, &rpcError{Code: invalidParams, Message: fmt.Sprintf("%s is not within the package root", path)}
+	}
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	full, ok, err := integration.PathAt(src, offset)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, nil
+	}
+	info, err := query.FieldDefinedIn(g, term.Literal(full), term.Literal(fieldsFileName(s.active.pkg, path)))
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]interface{}{"path": full, "file": path}
+	if info.DataStream != "" {
+		result["dataStream"], err = term.Text(info.DataStream)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for key, l := range map[string][]string{
+		"types":         info.Types,
+		"inferredTypes": info.InferredTypes,
+		"owners":        info.Owners,
+	} {
+		result[key], err = unquote(l)
+		if err != nil {
+			return nil, err
+		}
+	}
+	cands, truncated, err := query.LimitedCandidateGraftsIn(g, term.Literal(full), s.activeRules, s.limits)
+	paths, err := s.candidatePaths(g, cands, err)
+	if err != nil {
+		// The field's information is still useful
+		// without candidates.
+		result["error"] = err.Error()
+	} else {
+		result["candidates"] = paths
+		if truncated {
+			result["truncated"] = true
+		}
+	}
+	return result, nil
+}
+
+// field returns the ECS information, package declarations, owners and graft
+// candidates for the field with the full path.
+func (s *rpcServer) field(g *rdf.Graph, full string) (interface{}, error) {
+	lit := term.Literal(full)
+	result := map[string]interface{}{"path": full}
+	ecs, isECS := query.ECSFieldOf(g, lit)
+	if isECS {
+		info := make(map[string]interface{})
+		for key, l := range map[string][]string{
+			"types":          ecs.Types,
+			"fieldsets":      ecs.Fieldsets,
+			"descriptions":   ecs.Descriptions,
+			"examples":       ecs.Examples,
+			"normalizations": ecs.Normalizations,
+			"originals":      ecs.Originals,
+		} {
+			var err error
+			info[key], err = unquote(l)
+			if err != nil {
+				return nil, err
+			}
+		}
+		result["ecs"] = info
+	}
+	defs, err := query.DefinitionsOf(g, lit)
+	if err != nil && !isECS {
+		return nil, err
+	}
+	if len(defs) == 0 {
+		if !isECS {
+			return nil, errors.New("not found")
+		}
+		return result, nil
+	}
+	var declared []map[string]interface{}
+	for _, d := range defs {
+		decl := map[string]interface{}{"file": packageFile(s.active.pkg, d.File)}
+		if d.Line != 0 {
+			decl["line"] = d.Line
+		}
+		declared = append(declared, decl)
+	}
+	result["definitions"] = declared
+	if owners := query.OwnersOf(g, lit); len(owners) != 0 {
+		result["owners"] = owners
+	}
+	cands, truncated, err := query.LimitedCandidateGraftsIn(g, lit, s.activeRules, s.limits)
+	paths, err := s.candidatePaths(g, cands, err)
+	if err != nil {
+		result["error"] = err.Error()
+	} else {
+		result["candidates"] = paths
+		if truncated {
+			result["truncated"] = true
+		}
+	}
+	return result, nil
+}
+
+// unquote returns the text of the quoted literals in l.
+func unquote(l []string) ([]string, error) {
+	text := make([]string, len(l))
+	for i, lit := range l {
+		var err error
+		text[i], err = term.Text(lit)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return text, nil
+}
+
+// decodeParams decodes the request parameters into dst.
+func decodeParams(params json.RawMessage, dst interface{}) error {
+	if len(params) == 0 {
+		return nil
+	}
+	err := json.Unmarshal(params, dst)
+	if err != nil {
+		return &rpcError{Code: invalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+// maxMessageLength is the largest message body that readMessage accepts.
+const maxMessageLength = 16 << 20
+
+// readMessage returns the body of the next message read from r.
+func readMessage(r *textproto.Reader) ([]byte, error) {
+	h, err := r.ReadMIMEHeader()
+	if err != nil {
+		if err == io.EOF && len(h) == 0 {
+			return nil, io.EOF
+		}
+		return nil, err
+	}
+	l := h.Get("Content-Length")
+	if l == "" {
+		return nil, errors.New("missing Content-Length")
+	}
+	n, err := strconv.Atoi(l)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Content-Length: %w", err)
+	}
+	if n < 0 || n > maxMessageLength {
+		return nil, fmt.Errorf("invalid Content-Length: %d outside [0, %d]", n, maxMessageLength)
+	}
+	msg := make([]byte, n)
+	_, err = io.ReadFull(r.R, msg)
+	return msg, err
+}
+
+// within returns whether the file at path is within the directory root
+// once symbolic links are resolved. Paths that cannot be resolved are not
+// within root.
+func within(root, path string) bool {
+	if root == "" {
+		return false
+	}
+	root, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return false
+	}
+	path, err = filepath.EvalSymlinks(path)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && !filepath.IsAbs(rel)
+}
+
+// write writes a response with the provided id and either result or rerr.
+func (s *rpcServer) write(id json.RawMessage, result interface{}, rerr *rpcError) error {
+	resp := map[string]interface{}{"jsonrpc": "2.0", "id": id}
+	if rerr != nil {
+		resp["error"] = rerr
+	} else {
+		resp["result"] = result
+	}
+	return s.writeMessage(resp)
+}
+
+// notify writes a notification for the method with the provided params.
+// Notifications are only sent when serving stdio.
+func (s *rpcServer) notify(method string, params interface{}) error {
+	if s.w == nil {
+		return nil
+	}
+	return s.writeMessage(map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params})
+}
+
+// writeMessage writes msg framed with a Content-Length header.
+func (s *rpcServer) writeMessage(msg interface{}) error {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = fmt.Fprintf(s.w, "Content-Length: %d\r\n\r\n%s", len(b), b)
+	return err
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+var readMessageTests = []struct {
+	name    string
+	in      string
+	want    string
+	wantErr bool
+}{
+	{
+		name: "valid",
+		in:   "Content-Length: 2\r\n\r\n{}",
+		want: "{}",
+	},
+	{
+		name: "empty body",
+		in:   "Content-Length: 0\r\n\r\n",
+		want: "",
+	},
+	{
+		name:    "missing length",
+		in:      "Content-Type: application/json\r\n\r\n{}",
+		wantErr: true,
+	},
+	{
+		name:    "negative length",
+		in:      "Content-Length: -1\r\n\r\n",
+		wantErr: true,
+	},
+	{
+		name:    "huge length",
+		in:      "Content-Length: 1099511627776\r\n\r\n",
+		wantErr: true,
+	},
+	{
+		name:    "invalid length",
+		in:      "Content-Length: two\r\n\r\n{}",
+		wantErr: true,
+	},
+	{
+		name:    "short body",
+		in:      "Content-Length: 10\r\n\r\n{}",
+		wantErr: true,
+	},
+	{
+		name:    "malformed header",
+		in:      "Content-Length 2\r\n\r\n{}",
+		wantErr: true,
+	},
+}
+
+func TestReadMessage(t *testing.T) {
+	for _, test := range readMessageTests {
+		t.Run(test.name, func(t *testing.T) {
+			r := textproto.NewReader(bufio.NewReader(strings.NewReader(test.in)))
+			got, err := readMessage(r)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("unexpected error: got:%v want error:%t", err, test.wantErr)
+			}
+			if err == nil && string(got) != test.want {
+				t.Errorf("unexpected message: got:%q want:%q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestReadMessageEOF(t *testing.T) {
+	r := textproto.NewReader(bufio.NewReader(strings.NewReader("")))
+	_, err := readMessage(r)
+	if err != io.EOF {
+		t.Errorf("unexpected error: got:%v want:%v", err, io.EOF)
+	}
+}
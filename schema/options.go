@@ -0,0 +1,122 @@
+package schema
+
+import (
+	"crypto/sha1"
+	"hash"
+
+	"gonum.org/v1/gonum/graph/formats/rdf"
+
+	"github.com/efd6/ecsinrdf/vocab"
+)
+
+// Families of predicates that can be omitted from the constructed
+// statements with Omit.
+const (
+	// Descriptions is the <is:description>
+	// and <is:short> statements of fields.
+	Descriptions = "descriptions"
+	// Examples is the <is:example> statements
+	// of fields.
+	Examples = "examples"
+	// Allowed is the <has:allowed_value>
+	// statements of fields and the statements
+	// of their allowed values.
+	Allowed = "allowed_values"
+	// MultiFields is the <has:multi> statements
+	// of fields and the statements of their
+	// multi-fields.
+	MultiFields = "multi_fields"
+)
+
+// families holds the predicates of each family that is omitted by
+// filtering statements.
+var families = map[string][]vocab.Predicate{
+	Descriptions: {vocab.IsDescription, vocab.IsShort},
+	Examples:     {vocab.IsExample},
+}
+
+// Option is an option for the construction of statements.
+type Option func(*config)
+
+// config is the statement construction configuration.
+type config struct {
+	omit      map[string]bool
+	namespace string
+	hash      func() hash.Hash
+	// stop reports whether construction should
+	// end, as when an iterator's loop has ended.
+	stop func() bool
+}
+
+// newConfig returns the configuration described by the options.
+func newConfig(opts []Option) config {
+	cfg := config{
+		omit:      make(map[string]bool),
+		namespace: "schema",
+		hash:      sha1.New,
+	}
+	for _, o := range opts {
+		o(&cfg)
+	}
+	return cfg
+}
+
+// Omit omits the statements of the predicate families, such as
+// Descriptions, for smaller graphs. Unknown families are ignored.
+func Omit(families ...string) Option {
+	return func(cfg *config) {
+		for _, f := range families {
+			cfg.omit[f] = true
+		}
+	}
+}
+
+// Namespace sets the namespace that is hashed with field paths to give the
+// blank node labels of field nodes. The default namespace is "schema".
+// Statements constructed in different namespaces do not share nodes.
+func Namespace(ns string) Option {
+	return func(cfg *config) {
+		cfg.namespace = ns
+	}
+}
+
+// Hash sets the hash function used to construct blank node labels. The
+// default is SHA-1.
+func Hash(fn func() hash.Hash) Option {
+	return func(cfg *config) {
+		cfg.hash = fn
+	}
+}
+
+// stopWhen ends the construction of statements when stop returns true.
+// It is checked before each field is constructed.
+func stopWhen(stop func() bool) Option {
+	return func(cfg *config) {
+		cfg.stop = stop
+	}
+}
+
+// stopped returns whether the construction of statements should end.
+func (cfg config) stopped() bool {
+	return cfg.stop != nil && cfg.stop()
+}
+
+// filter returns fn wrapped to drop the statements of omitted predicate
+// families.
+func (cfg config) filter(fn func(*rdf.Statement, error)) func(*rdf.Statement, error) {
+	drop := make(map[vocab.Predicate]bool)
+	for f := range cfg.omit {
+		for _, p := range families[f] {
+			drop[p] = true
+		}
+	}
+	if len(drop) == 0 {
+		return fn
+	}
+	return func(s *rdf.Statement, err error) {
+		if s != nil && drop[vocab.Of(s)] {
+			return
+		}
+		fn(s, err)
+	}
+}
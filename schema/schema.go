@@ -3,11 +3,18 @@
 package schema
 
 import (
-	"crypto/sha1"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"hash"
+	"iter"
 	"strings"
 
 	"gonum.org/v1/gonum/graph/formats/rdf"
+	"gopkg.in/yaml.v3"
+
+	"github.com/efd6/ecsinrdf/term"
+	"github.com/efd6/ecsinrdf/vocab"
 )
 
 // Statements calls fn on all RDF statements construct from data in the
@@ -24,20 +31,87 @@ import (
 // Where _:child and _:multichild are have the same behaviour as _:field
 // with the exception that _:multichild is only the subject of is: statements.
 //
+// Fields are also linked to the name of the field set that defines them,
+// and to their description and its short form.
+//
+// _:field <in:fieldset> "fieldset" .
+// _:field <is:description> "description" .
+// _:field <is:short> "short description" .
+//
+// Fields with an ECS maturity level are linked to it, and fields with an
+// example are linked to each of its values. ECS writes array examples as
+// JSON text, so these are split into their elements. Fields are also
+// linked to the normalizations ECS expects of their values, such as array.
+//
+// _:field <is:level> "core" .
+// _:field <is:example> "example" .
+// _:field <is:normalized> "array" .
+//
+// The allowed values of fields are nodes holding the value, its
+// description and the event types expected with it.
+//
+// _:field <has:allowed_value> _:value .
+// _:value <is:value> "value" .
+// _:value <is:description> "description" .
+// _:value <expects:event_type> "event_type" .
+//
+// Reusable field sets are linked from the node with the field set's name
+// as its path to each location they are expected to be reused at, and
+// each location is linked to the name the field set is reused as there.
+// Field sets that are only expected at their reuse locations are marked
+// as not top level.
+//
+// _:fieldset <reused:at> _:location .
+// _:location <reused:as> "name" .
+// _:fieldset <is:top_level> "false" .
+//
+// Field sets are also linked to each location that another field set is
+// reused at within them, and that location is linked to the reused field
+// set. Fields copied into a reuse location are linked to the field they
+// are copied from in their original field set, so destination.user.name
+// is linked to user.name.
+//
+// _:fieldset <reused:here> _:location .
+// _:location <reused:from> _:original .
+// _:field <reused:from> _:original_field .
+//
+// Field sets are linked to each location that a field set is nested at
+// within them, as listed in their nestings.
+//
+// _:fieldset <has:nesting> _:location .
+//
 // Statements assumes the yaml field keys are always full dotted paths.
-func Statements(parent string, schema map[string]Field, fn func(*rdf.Statement, error)) {
-	h := sha1.New()
+//
+// The options may omit families of predicates and change the construction
+// of blank node labels.
+func Statements(parent string, schema map[string]Field, fn func(*rdf.Statement, error), opts ...Option) {
+	cfg := newConfig(opts)
+	statements(parent, schema, cfg.filter(fn), cfg)
+}
+
+func statements(parent string, schema map[string]Field, fn func(*rdf.Statement, error), cfg config) {
+	h := cfg.hash()
 	hash := func(s string) string {
-		h.Reset()
-		h.Write([]byte("schema"))
-		h.Write([]byte(s))
-		return string(hex(h.Sum(nil)))
+		return label(h, cfg.namespace, s)
 	}
 	for field, props := range schema {
-		Statements(field, props.Fields, fn)
+		if cfg.stopped() {
+			return
+		}
+		statements(field, props.Fields, fn, cfg)
+		if cfg.stopped() {
+			return
+		}
 		if parent == "" {
+			reuses(field, props.Reusable, hash, fieldErrors(field, fn))
+			reusedHere(field, props, schema, hash, fn)
+			for _, n := range props.Nestings {
+				fn := fieldErrors(field, fn)
+				fn(term.Triple(term.Blank(hash(field)), vocab.HasNesting.Term(), term.Blank(hash(n))), nil)
+			}
 			continue
 		}
+		fn := fieldErrors(field, fn)
 
 		path := strings.Split(field, ".")
 		for i := range path[1:] {
@@ -45,24 +119,263 @@ func Statements(parent string, schema map[string]Field, fn func(*rdf.Statement,
 			hashSub := hash(sub)
 			obj := strings.Join(path[:i+2], ".")
 			hashObj := hash(obj)
-			fn(constructTriple(`_:%s <is:type> "group" .`, hashSub))
-			fn(constructTriple(`_:%s <is:name> %q .`, hashSub, path[i]))
-			fn(constructTriple(`_:%s <is:path> %q .`, hashSub, sub))
-			fn(constructTriple(`_:%s <has:child> _:%s .`, hashSub, hashObj))
+			fn(term.Triple(term.Blank(hashSub), vocab.IsType.Term(), term.LiteralTerm("group")), nil)
+			fn(term.Triple(term.Blank(hashSub), vocab.IsName.Term(), term.LiteralTerm(path[i])), nil)
+			fn(term.Triple(term.Blank(hashSub), vocab.IsPath.Term(), term.LiteralTerm(sub)), nil)
+			fn(term.Triple(term.Blank(hashSub), vocab.HasChild.Term(), term.Blank(hashObj)), nil)
 		}
 		hashField := hash(field)
-		fn(constructTriple(`_:%s <is:type> %q .`, hashField, props.Type))
-		fn(constructTriple(`_:%s <is:name> %q .`, hashField, path[len(path)-1]))
-		fn(constructTriple(`_:%s <is:path> %q .`, hashField, field))
+		fn(term.Triple(term.Blank(hashField), vocab.IsType.Term(), term.LiteralTerm(props.Type)), nil)
+		fn(term.Triple(term.Blank(hashField), vocab.IsName.Term(), term.LiteralTerm(path[len(path)-1])), nil)
+		fn(term.Triple(term.Blank(hashField), vocab.IsPath.Term(), term.LiteralTerm(field)), nil)
+		fn(term.Triple(term.Blank(hashField), vocab.InFieldset.Term(), term.LiteralTerm(parent)), nil)
+		if props.Description != "" {
+			fn(term.Triple(term.Blank(hashField), vocab.IsDescription.Term(), term.LiteralTerm(props.Description)), nil)
+		}
+		if props.Short != "" {
+			fn(term.Triple(term.Blank(hashField), vocab.IsShort.Term(), term.LiteralTerm(props.Short)), nil)
+		}
+		if props.Level != "" {
+			fn(term.Triple(term.Blank(hashField), vocab.IsLevel.Term(), term.LiteralTerm(props.Level)), nil)
+		}
+		for _, ex := range exampleValues(props.Example) {
+			fn(term.Triple(term.Blank(hashField), vocab.IsExample.Term(), term.LiteralTerm(ex)), nil)
+		}
+		for _, n := range props.Normalize {
+			fn(term.Triple(term.Blank(hashField), vocab.IsNormalized.Term(), term.LiteralTerm(n)), nil)
+		}
+		if !cfg.omit[Allowed] {
+			for _, v := range props.AllowedValues {
+				// Paths never hold a NUL, so value
+				// labels are distinct from field labels.
+				hashValue := hash(field + "\x00" + v.Name)
+				fn(term.Triple(term.Blank(hashField), vocab.HasAllowedValue.Term(), term.Blank(hashValue)), nil)
+				fn(term.Triple(term.Blank(hashValue), vocab.IsValue.Term(), term.LiteralTerm(v.Name)), nil)
+				if v.Description != "" {
+					fn(term.Triple(term.Blank(hashValue), vocab.IsDescription.Term(), term.LiteralTerm(v.Description)), nil)
+				}
+				for _, t := range v.ExpectedEventTypes {
+					fn(term.Triple(term.Blank(hashValue), vocab.ExpectsEventType.Term(), term.LiteralTerm(t)), nil)
+				}
+			}
+		}
+		if cfg.omit[MultiFields] {
+			continue
+		}
 		for _, m := range props.MultiFields {
 			sub := m.FlatName[:strings.LastIndex(m.FlatName, ".")]
 			hashSub := hash(sub)
 			hashFlat := hash(m.FlatName)
-			fn(constructTriple(`_:%s <has:multi> _:%s .`, hashSub, hashFlat))
-			fn(constructTriple(`_:%s <is:type> %q .`, hashFlat, m.Type))
-			fn(constructTriple(`_:%s <is:name> %q .`, hashFlat, m.Name))
-			fn(constructTriple(`_:%s <is:path> %q .`, hashFlat, m.FlatName))
+			fn(term.Triple(term.Blank(hashSub), vocab.HasMulti.Term(), term.Blank(hashFlat)), nil)
+			fn(term.Triple(term.Blank(hashFlat), vocab.IsType.Term(), term.LiteralTerm(m.Type)), nil)
+			fn(term.Triple(term.Blank(hashFlat), vocab.IsName.Term(), term.LiteralTerm(m.Name)), nil)
+			fn(term.Triple(term.Blank(hashFlat), vocab.IsPath.Term(), term.LiteralTerm(m.FlatName)), nil)
+		}
+	}
+}
+
+// reuses calls fn on the statements describing the reuse of the named
+// field set.
+func reuses(fieldset string, r Reusable, hash func(string) string, fn func(*rdf.Statement, error)) {
+	if len(r.Expected) == 0 {
+		return
+	}
+	hashFieldset := hash(fieldset)
+	if r.TopLevel != nil && !*r.TopLevel {
+		fn(term.Triple(term.Blank(hashFieldset), vocab.IsTopLevel.Term(), term.LiteralTerm("false")), nil)
+	}
+	for _, e := range r.Expected {
+		as := e.As
+		if as == "" {
+			as = fieldset
+		}
+		full := e.Full
+		if full == "" {
+			full = e.At + "." + as
+		}
+		hashFull := hash(full)
+		fn(term.Triple(term.Blank(hashFieldset), vocab.ReusedAt.Term(), term.Blank(hashFull)), nil)
+		fn(term.Triple(term.Blank(hashFull), vocab.ReusedAs.Term(), term.LiteralTerm(as)), nil)
+	}
+}
+
+// reusedHere calls fn on the statements linking the reuse locations within
+// the named field set, and the fields copied into them, to the field sets
+// and fields they are reused from. The original field of a copied field is
+// the field of its original field set with the longest path that ends the
+// copied field's path and is not itself a copy.
+func reusedHere(fieldset string, props Field, schema map[string]Field, hash func(string) string, fn func(*rdf.Statement, error)) {
+	hashFieldset := hash(fieldset)
+	for _, r := range props.ReusedHere {
+		fn := fieldErrors(r.Full, fn)
+		hashFull := hash(r.Full)
+		fn(term.Triple(term.Blank(hashFieldset), vocab.ReusedHere.Term(), term.Blank(hashFull)), nil)
+		fn(term.Triple(term.Blank(hashFull), vocab.ReusedFrom.Term(), term.Blank(hash(r.SchemaName))), nil)
+	}
+	for field, f := range props.Fields {
+		if f.OriginalFieldset == "" {
+			continue
+		}
+		original, ok := originalField(field, f.OriginalFieldset, schema[f.OriginalFieldset].Fields)
+		if !ok {
+			continue
+		}
+		fn := fieldErrors(field, fn)
+		fn(term.Triple(term.Blank(hash(field)), vocab.ReusedFrom.Term(), term.Blank(hash(original))), nil)
+	}
+}
+
+// originalField returns the path of the field of the named original field
+// set, with the provided fields, that the field with the provided path is
+// copied from.
+func originalField(path, fieldset string, fields map[string]Field) (string, bool) {
+	elems := strings.Split(path, ".")
+	for i := 1; i < len(elems); i++ {
+		original := fieldset + "." + strings.Join(elems[i:], ".")
+		if f, ok := fields[original]; ok && f.OriginalFieldset == "" {
+			return original, true
+		}
+	}
+	return "", false
+}
+
+// All returns an iterator over the statements constructed by Statements
+// from the schema with the provided parent. Invalid statements are yielded
+// with a nil statement and an error.
+//
+// Statements are constructed as they are yielded, so breaking out of the
+// iteration ends construction before the next field.
+func All(parent string, schema map[string]Field, opts ...Option) iter.Seq2[*rdf.Statement, error] {
+	return func(yield func(*rdf.Statement, error) bool) {
+		var done bool
+		opts = append(opts[:len(opts):len(opts)], stopWhen(func() bool { return done }))
+		Statements(parent, schema, func(s *rdf.Statement, err error) {
+			if !done {
+				done = !yield(s, err)
+			}
+		}, opts...)
+	}
+}
+
+// Collect returns the statements constructed by Statements from the schema
+// with the provided parent and the errors for invalid statements joined
+// with errors.Join. Errors for the statements of a field are
+// *term.FieldError values holding the field's path. The valid statements
+// are returned even when the error is not nil.
+func Collect(parent string, schema map[string]Field, opts ...Option) ([]*rdf.Statement, error) {
+	var (
+		statements []*rdf.Statement
+		errs       []error
+	)
+	Statements(parent, schema, func(s *rdf.Statement, err error) {
+		if err != nil {
+			errs = append(errs, err)
+			return
+		}
+		statements = append(statements, s)
+	}, opts...)
+	return statements, errors.Join(errs...)
+}
+
+// FlatStatements calls fn on all RDF statements construct from data in the
+// provided flat schema, as held in the ecs_flat.yml artifact, keyed by the
+// full dotted path of each field.
+//
+// The statements are the same as those constructed by Statements for the
+// equivalent nested schema. The flat schema does not record the field set
+// defining each field, so it is taken to be the first element of the
+// field's path, or base for fields with a single element path. The fields
+// of the tracing field set, which is not namespaced under its name, are
+// recognized by their paths.
+func FlatStatements(schema map[string]Field, fn func(*rdf.Statement, error), opts ...Option) {
+	fieldsets := make(map[string]map[string]Field)
+	for field, props := range schema {
+		fs := flatFieldset(field)
+		if fieldsets[fs] == nil {
+			fieldsets[fs] = make(map[string]Field)
 		}
+		fieldsets[fs][field] = props
+	}
+	for fs, fields := range fieldsets {
+		Statements(fs, fields, fn, opts...)
+	}
+}
+
+// rootFieldsets holds the field sets whose fields are not namespaced under
+// the field set name, other than base, keyed by the first element of their
+// fields' paths.
+var rootFieldsets = map[string]string{
+	"span":        "tracing",
+	"trace":       "tracing",
+	"transaction": "tracing",
+}
+
+// flatFieldset returns the name of the field set defining the field with
+// the full dotted path.
+func flatFieldset(path string) string {
+	first, _, ok := strings.Cut(path, ".")
+	if !ok {
+		return "base"
+	}
+	if fs, ok := rootFieldsets[first]; ok {
+		return fs
+	}
+	return first
+}
+
+// Label returns the blank node label, without its "_:" prefix, of the
+// field node with the full dotted path in the statements constructed with
+// the options. Only the Namespace and Hash options change labels. The
+// label is the lower case hex encoding of the hash of the namespace
+// followed by the path.
+func Label(path string, opts ...Option) string {
+	cfg := newConfig(opts)
+	return label(cfg.hash(), cfg.namespace, path)
+}
+
+func label(h hash.Hash, namespace, path string) string {
+	h.Reset()
+	h.Write([]byte(namespace))
+	h.Write([]byte(path))
+	return string(hex(h.Sum(nil)))
+}
+
+// exampleValues returns the values of an ECS example. Examples that are
+// JSON arrays are split into their scalar elements; all other examples are
+// a single value.
+func exampleValues(example string) []string {
+	if example == "" {
+		return nil
+	}
+	if !strings.HasPrefix(strings.TrimSpace(example), "[") {
+		return []string{example}
+	}
+	dec := json.NewDecoder(strings.NewReader(example))
+	dec.UseNumber()
+	var elems []interface{}
+	if dec.Decode(&elems) != nil || dec.More() {
+		return []string{example}
+	}
+	var vals []string
+	for _, e := range elems {
+		switch e.(type) {
+		case nil, []interface{}, map[string]interface{}:
+			// Nested and null elements have no single value.
+		default:
+			vals = append(vals, fmt.Sprint(e))
+		}
+	}
+	return vals
+}
+
+// fieldErrors returns a statement callback that calls fn with errors
+// wrapped in a *term.FieldError for the field with the full dotted path.
+func fieldErrors(path string, fn func(*rdf.Statement, error)) func(*rdf.Statement, error) {
+	return func(s *rdf.Statement, err error) {
+		if err != nil {
+			err = &term.FieldError{Path: path, Err: err}
+		}
+		fn(s, err)
 	}
 }
 
@@ -75,15 +388,6 @@ func hex(data []byte) []byte {
 	return buf
 }
 
-func constructTriple(format string, a ...interface{}) (*rdf.Statement, error) {
-	formatted := fmt.Sprintf(format, a...)
-	s, err := rdf.ParseNQuad(formatted)
-	if err != nil {
-		return nil, fmt.Errorf("%#q: %v", formatted, err)
-	}
-	return s, nil
-}
-
 // See https://github.com/elastic/ecs/blob/main/schemas/README.md
 type Field struct {
 	// Name of the field set.
@@ -207,6 +511,12 @@ type Reusable struct {
 	// Expected is the list of places the field set's
 	// fields are expected.
 	Expected []Expected `yaml:"expected,omitempty"`
+	// Order is the phase in which the field set is
+	// reused. Field sets reused in the first phase
+	// are included in the reuse of field sets that
+	// they are reused in. Zero should be interpreted
+	// as two.
+	Order int `yaml:"order"`
 }
 
 type Expected struct {
@@ -226,6 +536,17 @@ type Expected struct {
 	Beta string `yaml:"beta"`
 }
 
+// UnmarshalYAML allows a reuse location to be given as the bare location,
+// as it may be in the ECS source schemas.
+func (e *Expected) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		*e = Expected{At: n.Value}
+		return nil
+	}
+	type plain Expected
+	return n.Decode((*plain)(e))
+}
+
 type ReusedHere struct {
 	// Introduced in https://github.com/elastic/ecs/pull/864
 	Full       string `yaml:"full"`
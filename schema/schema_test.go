@@ -0,0 +1,54 @@
+package schema
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"hash"
+	"testing"
+)
+
+// countingHash counts the writes to a hash.
+type countingHash struct {
+	hash.Hash
+	writes *int
+}
+
+func (h countingHash) Write(p []byte) (int, error) {
+	*h.writes++
+	return h.Hash.Write(p)
+}
+
+func TestAllStopsEarly(t *testing.T) {
+	nested := make(map[string]Field)
+	for i := 0; i < 100; i++ {
+		fs := fmt.Sprintf("fieldset%d", i)
+		nested[fs] = Field{Fields: map[string]Field{
+			fs + ".field": {Type: "keyword"},
+		}}
+	}
+
+	var all, early int
+	for _, test := range []struct {
+		writes *int
+		limit  int
+	}{
+		{writes: &all, limit: -1},
+		{writes: &early, limit: 1},
+	} {
+		writes := test.writes
+		counted := Hash(func() hash.Hash { return countingHash{sha1.New(), writes} })
+		var n int
+		for _, err := range All("", nested, counted) {
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			n++
+			if n == test.limit {
+				break
+			}
+		}
+	}
+	if early == 0 || early*10 > all {
+		t.Errorf("construction did not stop early: %d hash writes after break, %d in full", early, all)
+	}
+}
@@ -0,0 +1,163 @@
+package schema
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Fieldset is a field set as declared in the hand-written ECS source
+// schemas held in the schemas directory of the ECS repo.
+//
+// See https://github.com/elastic/ecs/blob/main/schemas/README.md
+type Fieldset struct {
+	// Name of the field set.
+	Name string `yaml:"name"`
+	// Capitalized name of the field set.
+	Title string `yaml:"title"`
+	// Group is used to sort field sets against one another.
+	Group int `yaml:"group"`
+	// Short version of the description to display
+	// in small spaces.
+	Short string `yaml:"short"`
+	// Description of the field set.
+	Description string `yaml:"description"`
+	// Type of the field set.
+	Type string `yaml:"type"`
+	// Whether or not the fields of this field set
+	// should be namespaced under the field set name.
+	Root bool `yaml:"root"`
+	// Adds a beta marker for the entire fieldset.
+	Beta string `yaml:"beta"`
+	// Reusable describes where the field set is
+	// expected to be reused.
+	Reusable Reusable `yaml:"reusable"`
+	// Fields is the list of fields in the field set.
+	// The names of the fields are relative to the
+	// field set.
+	Fields []Field `yaml:"fields"`
+}
+
+// Expand returns the nested schema for the source field sets, keyed by
+// field set name, in the form held in the ecs_nested.yml artifact and
+// expected by Statements. Field names are expanded to full dotted paths
+// and the fields of reusable field sets are copied to each of their
+// expected locations, with the reuse recorded in the destination field
+// set.
+//
+// Reuse is performed in order of the field sets' reuse order and then
+// their names, so field sets reused in the first phase are carried into
+// the locations of the field sets they are reused in, along with their
+// reuse records. A field set reused within itself, such as
+// process.parent, does not carry its own reuses.
+func Expand(fieldsets []Fieldset) (map[string]Field, error) {
+	nested := make(map[string]Field, len(fieldsets))
+	for _, fs := range fieldsets {
+		if _, ok := nested[fs.Name]; ok {
+			return nil, fmt.Errorf("field set %s declared more than once", fs.Name)
+		}
+		prefix := fs.Name + "."
+		if fs.Root {
+			prefix = ""
+		}
+		fields := make(map[string]Field, len(fs.Fields))
+		for _, f := range fs.Fields {
+			f.FlatName = prefix + f.Name
+			f.MultiFields = flatMultiFields(f.FlatName, f.MultiFields)
+			fields[f.FlatName] = f
+		}
+		reusable := fs.Reusable
+		reusable.Expected = append([]Expected(nil), reusable.Expected...)
+		nested[fs.Name] = Field{
+			Name:        fs.Name,
+			Title:       fs.Title,
+			Group:       fs.Group,
+			Short:       fs.Short,
+			Description: fs.Description,
+			Type:        fs.Type,
+			Root:        fs.Root,
+			Beta:        fs.Beta,
+			Reusable:    reusable,
+			Fields:      fields,
+		}
+	}
+
+	var reused []string
+	for _, fs := range fieldsets {
+		if len(fs.Reusable.Expected) != 0 {
+			reused = append(reused, fs.Name)
+		}
+	}
+	sort.Slice(reused, func(i, j int) bool {
+		oi, oj := reuseOrder(nested[reused[i]]), reuseOrder(nested[reused[j]])
+		if oi != oj {
+			return oi < oj
+		}
+		return reused[i] < reused[j]
+	})
+	for _, name := range reused {
+		src := nested[name]
+		fields := make(map[string]Field, len(src.Fields))
+		for path, f := range src.Fields {
+			fields[path] = f
+		}
+		carried := append([]ReusedHere(nil), src.ReusedHere...)
+		for i, e := range src.Reusable.Expected {
+			as := e.As
+			if as == "" {
+				as = name
+			}
+			full := e.At + "." + as
+			dstName, _, _ := strings.Cut(e.At, ".")
+			dst, ok := nested[dstName]
+			if !ok {
+				return nil, fmt.Errorf("field set %s reused at unknown field set %s", name, e.At)
+			}
+			for path, f := range fields {
+				f.FlatName = full + "." + strings.TrimPrefix(path, name+".")
+				f.MultiFields = flatMultiFields(f.FlatName, f.MultiFields)
+				if f.OriginalFieldset == "" {
+					f.OriginalFieldset = name
+				}
+				dst.Fields[f.FlatName] = f
+			}
+			short := e.ShortOverride
+			if short == "" {
+				short = src.Short
+			}
+			dst.ReusedHere = append(dst.ReusedHere, ReusedHere{Full: full, SchemaName: name, Short: short, Beta: e.Beta})
+			dst.Nestings = append(dst.Nestings, full)
+			for _, r := range carried {
+				r.Full = full + "." + strings.TrimPrefix(r.Full, name+".")
+				dst.ReusedHere = append(dst.ReusedHere, r)
+				dst.Nestings = append(dst.Nestings, r.Full)
+			}
+			sort.Strings(dst.Nestings)
+			nested[dstName] = dst
+			src.Reusable.Expected[i].Full = full
+		}
+	}
+	return nested, nil
+}
+
+// reuseOrder returns the reuse phase of the field set f.
+func reuseOrder(f Field) int {
+	if f.Reusable.Order == 0 {
+		return 2
+	}
+	return f.Reusable.Order
+}
+
+// flatMultiFields returns a copy of multi with flat names under the field
+// with the full dotted path.
+func flatMultiFields(path string, multi []MultiField) []MultiField {
+	if len(multi) == 0 {
+		return nil
+	}
+	flat := make([]MultiField, len(multi))
+	for i, m := range multi {
+		m.FlatName = path + "." + m.Name
+		flat[i] = m
+	}
+	return flat
+}
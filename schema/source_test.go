@@ -0,0 +1,186 @@
+package schema
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// expandSchemas are source schemas with a first phase reuse, group at
+// user, carried into a second phase reuse, user at source.
+const expandSchemas = `
+- name: group
+  title: Group
+  short: User's group relevant to the event.
+  description: The group fields are meant to represent groups.
+  type: group
+  reusable:
+    top_level: true
+    order: 1
+    expected:
+      - at: user
+        as: group
+  fields:
+    - name: id
+      level: extended
+      type: keyword
+      description: Unique identifier for the group.
+- name: user
+  title: User
+  short: Fields to describe the user.
+  description: The user fields describe information about the user.
+  type: group
+  reusable:
+    top_level: true
+    expected:
+      - at: source
+        as: user
+  fields:
+    - name: name
+      level: core
+      type: keyword
+      description: Short name or login of the user.
+- name: source
+  title: Source
+  short: Fields about the source side of a network connection.
+  description: Source fields capture details about the sender.
+  type: group
+  fields:
+    - name: ip
+      level: core
+      type: ip
+      description: IP address of the source.
+`
+
+// expandNested is the nested artifact for expandSchemas.
+const expandNested = `
+group:
+  name: group
+  title: Group
+  short: User's group relevant to the event.
+  description: The group fields are meant to represent groups.
+  type: group
+  reusable:
+    top_level: true
+    order: 1
+    expected:
+      - at: user
+        as: group
+        full: user.group
+  fields:
+    group.id:
+      name: id
+      flat_name: group.id
+      level: extended
+      type: keyword
+      description: Unique identifier for the group.
+user:
+  name: user
+  title: User
+  short: Fields to describe the user.
+  description: The user fields describe information about the user.
+  type: group
+  reusable:
+    top_level: true
+    expected:
+      - at: source
+        as: user
+        full: source.user
+  nestings:
+    - user.group
+  reused_here:
+    - full: user.group
+      schema_name: group
+      short: User's group relevant to the event.
+  fields:
+    user.name:
+      name: name
+      flat_name: user.name
+      level: core
+      type: keyword
+      description: Short name or login of the user.
+    user.group.id:
+      name: id
+      flat_name: user.group.id
+      level: extended
+      type: keyword
+      description: Unique identifier for the group.
+      original_fieldset: group
+source:
+  name: source
+  title: Source
+  short: Fields about the source side of a network connection.
+  description: Source fields capture details about the sender.
+  type: group
+  nestings:
+    - source.user
+    - source.user.group
+  reused_here:
+    - full: source.user
+      schema_name: user
+      short: Fields to describe the user.
+    - full: source.user.group
+      schema_name: group
+      short: User's group relevant to the event.
+  fields:
+    source.ip:
+      name: ip
+      flat_name: source.ip
+      level: core
+      type: ip
+      description: IP address of the source.
+    source.user.name:
+      name: name
+      flat_name: source.user.name
+      level: core
+      type: keyword
+      description: Short name or login of the user.
+      original_fieldset: user
+    source.user.group.id:
+      name: id
+      flat_name: source.user.group.id
+      level: extended
+      type: keyword
+      description: Unique identifier for the group.
+      original_fieldset: group
+`
+
+func TestExpandMatchesNested(t *testing.T) {
+	var fieldsets []Fieldset
+	err := yaml.Unmarshal([]byte(expandSchemas), &fieldsets)
+	if err != nil {
+		t.Fatalf("unexpected error decoding schemas: %v", err)
+	}
+	expanded, err := Expand(fieldsets)
+	if err != nil {
+		t.Fatalf("unexpected error expanding schemas: %v", err)
+	}
+	var nested map[string]Field
+	err = yaml.Unmarshal([]byte(expandNested), &nested)
+	if err != nil {
+		t.Fatalf("unexpected error decoding nested: %v", err)
+	}
+
+	got := nquads(t, expanded)
+	want := nquads(t, nested)
+	if got != want {
+		t.Errorf("expanded schemas do not match nested artifact:\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+// nquads returns the sorted statements constructed from the nested schema.
+func nquads(t *testing.T, nested map[string]Field) string {
+	t.Helper()
+	statements, err := Collect("", nested)
+	if err != nil {
+		t.Fatalf("unexpected error constructing statements: %v", err)
+	}
+	lines := make([]string, len(statements))
+	for i, s := range statements {
+		lines[i] = s.String()
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"gonum.org/v1/gonum/graph/formats/rdf"
+)
+
+// snapshot holds a read-only analysis graph that may be replaced while it
+// is in use. Readers obtain a consistent graph with load and may continue
+// to use it after it has been replaced. Replacement graphs are built
+// separately and swapped in atomically, so queries are never answered
+// from a partially built graph.
+type snapshot struct {
+	graph atomic.Value // *rdf.Graph
+
+	mu sync.Mutex
+	// generation counts the graphs stored with
+	// store. Rebuilds requested in an earlier
+	// generation are discarded.
+	generation uint64
+	rebuilding bool
+	pending    *rebuildRequest
+}
+
+// rebuildRequest is a requested rebuild of a snapshot's graph.
+type rebuildRequest struct {
+	build      func() (*rdf.Graph, error)
+	done       func(error)
+	generation uint64
+}
+
+// errStaleRebuild is the error passed to the done function of a rebuild
+// whose graph was discarded because a graph was stored while it was built.
+var errStaleRebuild = errors.New("rebuild discarded: graph was replaced during the rebuild")
+
+// load returns the current graph, or nil if no graph has been stored.
+func (s *snapshot) load() *rdf.Graph {
+	g, _ := s.graph.Load().(*rdf.Graph)
+	return g
+}
+
+// store replaces the current graph with g and starts a new generation, so
+// that rebuilds requested before the call are discarded.
+func (s *snapshot) store(g *rdf.Graph) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.generation++
+	s.graph.Store(g)
+}
+
+// rebuild builds a replacement graph with build in the background and
+// stores it when it is complete, then calls done with the build error. If
+// the build fails the current graph is retained. If store is called while
+// the graph is built, the graph is discarded and done is called with
+// errStaleRebuild, since build may describe a replaced configuration. If
+// a rebuild is already in progress, rebuild returns false and a single
+// further rebuild, with the latest build and done, is run when it
+// completes.
+func (s *snapshot) rebuild(build func() (*rdf.Graph, error), done func(error)) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	req := &rebuildRequest{build: build, done: done, generation: s.generation}
+	if s.rebuilding {
+		s.pending = req
+		return false
+	}
+	s.rebuilding = true
+	go func() {
+		for req != nil {
+			g, err := req.build()
+			s.mu.Lock()
+			if err == nil {
+				if req.generation == s.generation {
+					s.graph.Store(g)
+				} else {
+					err = errStaleRebuild
+				}
+			}
+			s.mu.Unlock()
+			req.done(err)
+
+			s.mu.Lock()
+			req, s.pending = s.pending, nil
+			if req == nil {
+				s.rebuilding = false
+			}
+			s.mu.Unlock()
+		}
+	}()
+	return true
+}
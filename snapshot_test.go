@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+
+	"gonum.org/v1/gonum/graph/formats/rdf"
+)
+
+func TestSnapshotStaleRebuild(t *testing.T) {
+	var s snapshot
+	initial := &rdf.Graph{}
+	s.store(initial)
+
+	building := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan error, 1)
+	started := s.rebuild(func() (*rdf.Graph, error) {
+		close(building)
+		<-release
+		return &rdf.Graph{}, nil
+	}, func(err error) {
+		done <- err
+	})
+	if !started {
+		t.Fatal("rebuild did not start")
+	}
+
+	// Replace the graph while the rebuild is in progress,
+	// as initialize does.
+	<-building
+	replacement := &rdf.Graph{}
+	s.store(replacement)
+	close(release)
+
+	err := <-done
+	if err != errStaleRebuild {
+		t.Errorf("unexpected error: got:%v want:%v", err, errStaleRebuild)
+	}
+	if s.load() != replacement {
+		t.Error("stale rebuild replaced the stored graph")
+	}
+}
+
+func TestSnapshotRebuild(t *testing.T) {
+	var s snapshot
+	s.store(&rdf.Graph{})
+
+	rebuilt := &rdf.Graph{}
+	done := make(chan error, 1)
+	s.rebuild(func() (*rdf.Graph, error) {
+		return rebuilt, nil
+	}, func(err error) {
+		done <- err
+	})
+	err := <-done
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if s.load() != rebuilt {
+		t.Error("rebuild did not replace the stored graph")
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"gonum.org/v1/gonum/graph/formats/rdf"
+
+	"github.com/efd6/ecsinrdf/vocab"
+)
+
+// sourceStatements calls fn on the statements emitted by the external
+// schema source command. The command is split on white space and run
+// with the environment of the process extended with
+//
+//  ECSINRDF_ECS_VERSION: the ECS version of the graph
+//  ECSINRDF_PKG_PATH: the path to the root of the package(s), if any
+//
+// The command must write N-Quads to its standard output, one statement
+// per line. Blank lines and lines starting with # are ignored. Invalid
+// statements are passed to fn as errors. The standard error of the
+// command is passed through, and the command failing is an error.
+//
+// Blank node labels are rewritten to be distinct for each source command
+// so that sources cannot share blank nodes with each other or with the
+// statements constructed by this repo's packages. Sources should link to
+// package and ECS fields through their quoted paths, as in
+//
+//  _:inventory <is:path> "source.ip" .
+//  _:inventory <owned:by> "team-network" .
+//
+// Predicates may be written in their short forms, as above, or in their
+// canonical forms, which are rewritten to their short forms.
+func sourceStatements(ctx context.Context, command string, cfg graphConfig, fn func(*rdf.Statement, error)) error {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return fmt.Errorf("empty schema source command")
+	}
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Env = append(os.Environ(),
+		"ECSINRDF_ECS_VERSION="+cfg.version,
+		"ECSINRDF_PKG_PATH="+cfg.pkg,
+	)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	err = cmd.Start()
+	if err != nil {
+		return fmt.Errorf("source %s: %w", args[0], err)
+	}
+
+	sum := sha1.Sum([]byte(command))
+	prefix := "_:source" + hex.EncodeToString(sum[:8])
+	blank := func(t rdf.Term) rdf.Term {
+		if !strings.HasPrefix(t.Value, "_:") {
+			return t
+		}
+		return rdf.Term{Value: prefix + t.Value[len("_:"):]}
+	}
+	sc := bufio.NewScanner(out)
+	sc.Buffer(nil, 1<<20)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		s, err := cfg.store.Parse(text)
+		if err != nil {
+			fn(nil, fmt.Errorf("source %s:%d: %w", args[0], line, err))
+			continue
+		}
+		s = &rdf.Statement{
+			Subject:   blank(s.Subject),
+			Predicate: vocab.Short(s.Predicate),
+			Object:    blank(s.Object),
+			Label:     blank(s.Label),
+		}
+		fn(s, nil)
+	}
+	scanErr := sc.Err()
+	if scanErr != nil {
+		// Let the command exit rather than block on a full pipe.
+		io.Copy(io.Discard, out)
+	}
+	err = cmd.Wait()
+	if err != nil {
+		return fmt.Errorf("source %s: %w", args[0], err)
+	}
+	if scanErr != nil {
+		return fmt.Errorf("source %s: %w", args[0], scanErr)
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+// Package template provides tools for simulating the application of
+// Elasticsearch dynamic templates to fields.
+package template
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Dynamic is an Elasticsearch dynamic template.
+//
+// See https://www.elastic.co/guide/en/elasticsearch/reference/current/dynamic-templates.html
+type Dynamic struct {
+	// Name is the name of the dynamic template.
+	Name string `json:"-"`
+
+	// Match and Unmatch are patterns matched against
+	// the last element of the field's path.
+	Match   patterns `json:"match"`
+	Unmatch patterns `json:"unmatch"`
+	// PathMatch and PathUnmatch are patterns matched
+	// against the field's full dotted path.
+	PathMatch   patterns `json:"path_match"`
+	PathUnmatch patterns `json:"path_unmatch"`
+	// MatchPattern is "regex" if the patterns are regular
+	// expressions. Otherwise they are simple wildcard patterns.
+	MatchPattern string `json:"match_pattern"`
+	// MatchMappingType is the list of detected JSON
+	// types the template applies to.
+	MatchMappingType patterns `json:"match_mapping_type"`
+
+	// Mapping is the mapping applied to matching fields.
+	Mapping map[string]interface{} `json:"mapping"`
+}
+
+// patterns is a list of patterns that may be represented in JSON as either
+// a single string or an array of strings.
+type patterns []string
+
+func (p *patterns) UnmarshalJSON(b []byte) error {
+	var s string
+	err := json.Unmarshal(b, &s)
+	if err == nil {
+		*p = patterns{s}
+		return nil
+	}
+	return json.Unmarshal(b, (*[]string)(p))
+}
+
+// Decode returns the dynamic templates held in r. The JSON in r may be a
+// composable index or component template, a mappings object or an object
+// holding a "dynamic_templates" array.
+func Decode(r io.Reader) ([]Dynamic, error) {
+	var doc struct {
+		Template struct {
+			Mappings struct {
+				DynamicTemplates []map[string]Dynamic `json:"dynamic_templates"`
+			} `json:"mappings"`
+		} `json:"template"`
+		Mappings struct {
+			DynamicTemplates []map[string]Dynamic `json:"dynamic_templates"`
+		} `json:"mappings"`
+		DynamicTemplates []map[string]Dynamic `json:"dynamic_templates"`
+	}
+	err := json.NewDecoder(r).Decode(&doc)
+	if err != nil {
+		return nil, err
+	}
+	var named []map[string]Dynamic
+	switch {
+	case doc.Template.Mappings.DynamicTemplates != nil:
+		named = doc.Template.Mappings.DynamicTemplates
+	case doc.Mappings.DynamicTemplates != nil:
+		named = doc.Mappings.DynamicTemplates
+	case doc.DynamicTemplates != nil:
+		named = doc.DynamicTemplates
+	default:
+		return nil, errors.New("no dynamic templates found")
+	}
+	templates := make([]Dynamic, 0, len(named))
+	for _, m := range named {
+		if len(m) != 1 {
+			return nil, fmt.Errorf("invalid dynamic template: %d names", len(m))
+		}
+		for name, t := range m {
+			t.Name = name
+			templates = append(templates, t)
+		}
+	}
+	return templates, nil
+}
+
+// Matches returns whether the template applies to a field with the
+// provided full dotted path and detected JSON mapping type. If
+// mappingType is empty, the template's match_mapping_type is not
+// considered.
+func (t Dynamic) Matches(path, mappingType string) (bool, error) {
+	name := path[strings.LastIndex(path, ".")+1:]
+	for _, c := range []struct {
+		patterns patterns
+		value    string
+		negate   bool
+	}{
+		{patterns: t.Match, value: name},
+		{patterns: t.Unmatch, value: name, negate: true},
+		{patterns: t.PathMatch, value: path},
+		{patterns: t.PathUnmatch, value: path, negate: true},
+	} {
+		if len(c.patterns) == 0 {
+			continue
+		}
+		ok, err := t.matchAny(c.patterns, c.value)
+		if err != nil {
+			return false, err
+		}
+		if ok == c.negate {
+			return false, nil
+		}
+	}
+	if mappingType == "" || len(t.MatchMappingType) == 0 {
+		return true, nil
+	}
+	for _, m := range t.MatchMappingType {
+		if m == "*" || m == mappingType {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (t Dynamic) matchAny(patterns []string, s string) (bool, error) {
+	for _, p := range patterns {
+		if t.MatchPattern == "regex" {
+			ok, err := regexp.MatchString(p, s)
+			if err != nil {
+				return false, fmt.Errorf("%s: %w", t.Name, err)
+			}
+			if ok {
+				return true, nil
+			}
+			continue
+		}
+		if SimpleMatch(p, s) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// SimpleMatch implements Elasticsearch's simple wildcard pattern matching
+// where '*' matches any sequence of characters.
+func SimpleMatch(pattern, s string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == s
+	}
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+	for _, p := range parts[1 : len(parts)-1] {
+		i := strings.Index(s, p)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(p):]
+	}
+	return strings.HasSuffix(s, parts[len(parts)-1])
+}
+
+// Type returns the field type the template maps a field with the provided
+// detected JSON mapping type to. If the template does not specify a type
+// the Elasticsearch default for the mapping type is returned.
+func (t Dynamic) Type(mappingType string) string {
+	typ, _ := t.Mapping["type"].(string)
+	switch typ {
+	case "", "{dynamic_type}":
+		return DefaultType(mappingType)
+	default:
+		return typ
+	}
+}
+
+// DefaultType returns the field type Elasticsearch dynamic mapping uses
+// for a field with the provided detected JSON mapping type.
+func DefaultType(mappingType string) string {
+	switch mappingType {
+	case "string":
+		return "text"
+	case "double":
+		return "float"
+	default:
+		return mappingType
+	}
+}
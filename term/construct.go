@@ -0,0 +1,30 @@
+package term
+
+import "gonum.org/v1/gonum/graph/formats/rdf"
+
+// Blank returns the blank node term with the label. The label must be
+// valid blank node label text, such as a hex digest.
+func Blank(label string) rdf.Term {
+	return rdf.Term{Value: "_:" + label}
+}
+
+// IRI returns the IRI term for iri. The IRI must be valid and hold no
+// characters that need escaping, as is the case for the predicates of the
+// statements constructed in this repo.
+func IRI(iri string) rdf.Term {
+	return rdf.Term{Value: "<" + iri + ">"}
+}
+
+// LiteralTerm returns the unqualified literal term holding text, escaped as
+// described by Literal.
+func LiteralTerm(text string) rdf.Term {
+	return rdf.Term{Value: Literal(text)}
+}
+
+// Triple returns the statement subj pred obj. The terms must be valid for
+// their positions; they are not checked. Triple retains nothing, so it may
+// be used by concurrent builders; the predicate terms of the vocabulary are
+// constant strings and are shared without interning.
+func Triple(subj, pred, obj rdf.Term) *rdf.Statement {
+	return &rdf.Statement{Subject: subj, Predicate: pred, Object: obj}
+}
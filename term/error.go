@@ -0,0 +1,14 @@
+package term
+
+// FieldError is an error in the construction of the statements of a field.
+type FieldError struct {
+	// Path is the full dotted path of the field.
+	Path string
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *FieldError) Error() string { return e.Path + ": " + e.Err.Error() }
+
+// Unwrap returns the underlying error.
+func (e *FieldError) Unwrap() error { return e.Err }
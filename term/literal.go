@@ -0,0 +1,90 @@
+package term
+
+import (
+	"fmt"
+	"strings"
+
+	"gonum.org/v1/gonum/graph/formats/rdf"
+)
+
+// Literal returns the N-Quads text of an unqualified RDF literal holding
+// text in canonical form. Backspace, tab, line feed, form feed, carriage
+// return, quotation mark and backslash are escaped with their single
+// character escapes, the other C0 control characters and DEL are escaped
+// with four digit \u escapes, and all other characters are written as they
+// are. Invalid UTF-8 is replaced with U+FFFD.
+//
+// Literal should be used in preference to Go quoting, which produces
+// escape sequences that are not valid in N-Quads, and the same text always
+// has the same literal so that literals can be compared as terms.
+func Literal(text string) string {
+	var b strings.Builder
+	b.Grow(len(text) + 2)
+	b.WriteByte('"')
+	for _, r := range text {
+		switch r {
+		case '\b':
+			b.WriteString(`\b`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&b, `\u%04X`, r)
+				continue
+			}
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// CanonicalLiteral returns the N-Quads literal lit with its text escaped
+// in the canonical form used by Literal. Language tags and datatypes are
+// retained. Literals read from N-Quads text may use other escapes for the
+// same text, such as \u0009 for a tab, so they are made canonical before
+// they are compared with constructed literals.
+func CanonicalLiteral(lit string) (string, error) {
+	text, qual, kind, err := rdf.Term{Value: lit}.Parts()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", lit, err)
+	}
+	if kind != rdf.Literal {
+		return "", fmt.Errorf("%s: not a literal: %v", lit, kind)
+	}
+	switch {
+	case qual == "":
+		return Literal(text), nil
+	case strings.HasPrefix(qual, "@"):
+		return Literal(text) + qual, nil
+	default:
+		iri, err := rdf.NewIRITerm(qual)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", lit, err)
+		}
+		return Literal(text) + "^^" + iri.Value, nil
+	}
+}
+
+// Text returns the unescaped text of the N-Quads literal, lit. It is the
+// inverse of Literal. Text returns an error if lit is not a literal.
+func Text(lit string) (string, error) {
+	text, _, kind, err := rdf.Term{Value: lit}.Parts()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", lit, err)
+	}
+	if kind != rdf.Literal {
+		return "", fmt.Errorf("%s: not a literal: %v", lit, kind)
+	}
+	return text, nil
+}
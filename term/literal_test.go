@@ -0,0 +1,116 @@
+package term
+
+import (
+	"testing"
+
+	"gonum.org/v1/gonum/graph/formats/rdf"
+)
+
+var literalTests = []struct {
+	name string
+	text string
+	want string
+	// invalid is true if the text is not valid UTF-8,
+	// so it does not round-trip.
+	invalid bool
+}{
+	{name: "plain", text: "source.ip", want: `"source.ip"`},
+	{name: "empty", text: "", want: `""`},
+	{name: "quotes", text: `say "hi"`, want: `"say \"hi\""`},
+	{name: "backslashes", text: `C:\Windows\`, want: `"C:\\Windows\\"`},
+	{name: "escaped quote", text: `\"`, want: `"\\\""`},
+	{name: "single character escapes", text: "\b\t\n\f\r", want: `"\b\t\n\f\r"`},
+	{name: "other control characters", text: "\x00\x01\x1f\x7f", want: `"\u0000\u0001\u001F\u007F"`},
+	{name: "non-ASCII", text: "café ☕ 𝄞", want: `"café ☕ 𝄞"`},
+	{name: "invalid UTF-8", text: "a\xffb", want: "\"a\uFFFDb\"", invalid: true},
+	{name: "truncated UTF-8", text: "\xe2\x98", want: "\"\uFFFD\uFFFD\"", invalid: true},
+}
+
+func TestLiteral(t *testing.T) {
+	for _, test := range literalTests {
+		t.Run(test.name, func(t *testing.T) {
+			got := Literal(test.text)
+			if got != test.want {
+				t.Fatalf("unexpected literal: got:%s want:%s", got, test.want)
+			}
+
+			// Literals must be valid N-Quads terms.
+			nquad := "_:a <is:path> " + got + " ."
+			s, err := rdf.ParseNQuad(nquad)
+			if err != nil {
+				t.Fatalf("literal is not valid N-Quads: %v", err)
+			}
+			if s.Object.Value != got {
+				t.Errorf("unexpected parsed literal: got:%s want:%s", s.Object.Value, got)
+			}
+
+			text, err := Text(got)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !test.invalid && text != test.text {
+				t.Errorf("literal did not round-trip: got:%q want:%q", text, test.text)
+			}
+			canon, err := CanonicalLiteral(got)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if canon != got {
+				t.Errorf("literal is not canonical: got:%s want:%s", canon, got)
+			}
+		})
+	}
+}
+
+var canonicalLiteralTests = []struct {
+	name    string
+	lit     string
+	want    string
+	wantErr bool
+}{
+	{name: "canonical", lit: `"a\tb"`, want: `"a\tb"`},
+	{name: "long tab escape", lit: `"a\u0009b"`, want: `"a\tb"`},
+	{name: "escaped letter", lit: `"\u0061"`, want: `"a"`},
+	{name: "long escape", lit: `"\U0001D11E"`, want: `"𝄞"`},
+	{name: "lower case hex", lit: `"\u001f"`, want: `"\u001F"`},
+	{name: "language tag", lit: `"chat"@fr`, want: `"chat"@fr`},
+	{name: "datatype", lit: `"1"^^<http://www.w3.org/2001/XMLSchema#integer>`, want: `"1"^^<http://www.w3.org/2001/XMLSchema#integer>`},
+	{name: "IRI", lit: `<is:path>`, wantErr: true},
+	{name: "blank node", lit: `_:a`, wantErr: true},
+}
+
+func TestCanonicalLiteral(t *testing.T) {
+	for _, test := range canonicalLiteralTests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := CanonicalLiteral(test.lit)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("unexpected error: got:%v want error:%t", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("unexpected literal: got:%s want:%s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestStoreParseCanonicalizes(t *testing.T) {
+	s := NewStore()
+	for _, nquad := range []string{
+		`_:a <is:description> "a\u0009b" .`,
+		`_:a <is:description> "a\tb" .`,
+		// Seen text is found without parsing.
+		`_:a <is:description> "a\u0009b" .`,
+	} {
+		st, err := s.Parse(nquad)
+		if err != nil {
+			t.Fatalf("unexpected error parsing %s: %v", nquad, err)
+		}
+		if want := `"a\tb"`; st.Object.Value != want {
+			t.Errorf("unexpected object for %s: got:%s want:%s", nquad, st.Object.Value, want)
+		}
+	}
+	hits, misses := s.Stats()
+	if hits != 1 || misses != 2 {
+		t.Errorf("unexpected stats: got hits:%d misses:%d want hits:1 misses:2", hits, misses)
+	}
+}
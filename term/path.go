@@ -0,0 +1,85 @@
+package term
+
+import (
+	"strings"
+	"unicode"
+
+	"gonum.org/v1/gonum/graph/formats/rdf"
+
+	"github.com/efd6/ecsinrdf/vocab"
+)
+
+// CanonicalPath returns the canonical form of the dotted field path. Each
+// path element is converted from camel case to lower snake case and
+// hyphens and spaces are replaced with underscores, so that "EventID",
+// "eventId", "event-id" and "event_id" have the same canonical form,
+// "event_id". Dots are preserved.
+func CanonicalPath(path string) string {
+	elems := strings.Split(path, ".")
+	for i, e := range elems {
+		elems[i] = canonicalElem(e)
+	}
+	return strings.Join(elems, ".")
+}
+
+func canonicalElem(e string) string {
+	r := []rune(e)
+	var b strings.Builder
+	for i, c := range r {
+		switch {
+		case c == '-' || c == ' ':
+			c = '_'
+		case unicode.IsUpper(c):
+			if i > 0 && wordBreak(r[i-1], r[i+1:]) {
+				b.WriteByte('_')
+			}
+			c = unicode.ToLower(c)
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// wordBreak returns whether an upper case letter preceded by prev and
+// followed by next starts a new word. This is the case after a lower case
+// letter or digit, and at the last upper case letter of an initialism
+// that is followed by a lower case letter, as in "HTTPRequest".
+func wordBreak(prev rune, next []rune) bool {
+	switch {
+	case unicode.IsLower(prev) || unicode.IsDigit(prev):
+		return true
+	case unicode.IsUpper(prev):
+		return len(next) != 0 && unicode.IsLower(next[0])
+	default:
+		return false
+	}
+}
+
+// CanonicalPaths returns a function that calls fn on each statement passed
+// to it and, for each field path statement, additionally calls fn with a
+// statement holding the canonical form of the path. The literal path is
+// retained, so reports can use the original spelling while joins between
+// sources can use the canonical form.
+//
+// _:field <is:canonical_path> "canonical.dotted.path" .
+//
+func CanonicalPaths(fn func(*rdf.Statement, error)) func(*rdf.Statement, error) {
+	return func(s *rdf.Statement, err error) {
+		fn(s, err)
+		if err != nil || !vocab.IsPath.Match(s) {
+			return
+		}
+		path, err := Text(s.Object.Value)
+		if err != nil {
+			// Paths from external sources may
+			// not be literals.
+			return
+		}
+		fn(&rdf.Statement{
+			Subject:   s.Subject,
+			Predicate: vocab.IsCanonicalPath.Term(),
+			Object:    rdf.Term{Value: Literal(CanonicalPath(path))},
+			Label:     s.Label,
+		}, nil)
+	}
+}
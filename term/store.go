@@ -0,0 +1,160 @@
+// Package term provides shared construction of RDF terms and statements
+// for the statement builders in this repo.
+package term
+
+import (
+	"strings"
+	"sync"
+
+	"gonum.org/v1/gonum/graph/formats/rdf"
+)
+
+// blockSize is the number of statements allocated at a time by a Store.
+const blockSize = 1024
+
+// Store interns the terms of constructed and parsed statements and
+// allocates statements in blocks. Graph construction repeats a small set
+// of predicates and literals, and each field's blank node, many times, so
+// interning avoids re-parsing and retaining duplicate term text. A Store
+// holds every term it has seen until it is released, so each graph build
+// should use its own Store and drop it with the graph. A Store is safe for
+// concurrent use.
+type Store struct {
+	mu sync.Mutex
+	// terms holds the interned terms for each statement
+	// position so that a term is only reused in a position
+	// it has been validated for.
+	terms [3]map[string]rdf.Term
+	block []rdf.Statement
+
+	// hits and misses count statements constructed
+	// only from interned terms and statements that
+	// added terms or were parsed.
+	hits, misses uint64
+}
+
+// NewStore returns a new Store.
+func NewStore() *Store {
+	return &Store{terms: [3]map[string]rdf.Term{
+		make(map[string]rdf.Term),
+		make(map[string]rdf.Term),
+		make(map[string]rdf.Term),
+	}}
+}
+
+// Parse returns the statement represented by the provided N-Quad. Statements
+// whose terms have all been seen by the Store are constructed from the
+// interned terms without parsing. Literal objects are held in the canonical
+// form described by CanonicalLiteral. The terms of returned statements do
+// not have the UID set.
+func (s *Store) Parse(nquad string) (*rdf.Statement, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	subj, pred, obj, ok := split(nquad)
+	if ok {
+		st, ok := s.lookup(subj, pred, obj)
+		if ok {
+			s.hits++
+			return st, nil
+		}
+	}
+	s.misses++
+	st, err := rdf.ParseNQuad(nquad)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(st.Object.Value, `"`) {
+		st.Object.Value, err = CanonicalLiteral(st.Object.Value)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if st.Label.Value != "" || !ok {
+		return st, nil
+	}
+	// Terms are interned by their text in the N-Quad so
+	// that literals written with other escapes are found
+	// without parsing and held in canonical form.
+	keys := [3]string{subj, pred, obj}
+	for i, t := range []rdf.Term{st.Subject, st.Predicate, st.Object} {
+		if _, ok := s.terms[i][keys[i]]; !ok {
+			s.terms[i][keys[i]] = rdf.Term{Value: t.Value}
+		}
+	}
+	st, _ = s.lookup(subj, pred, obj)
+	return st, nil
+}
+
+// Statement returns a statement allocated from the Store's block holding
+// subj, pred and obj, with the terms interned. The terms must be valid for
+// their positions; they are not checked. The terms of returned statements
+// do not have the UID set.
+func (s *Store) Statement(subj, pred, obj rdf.Term) *rdf.Statement {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, ok := s.lookup(subj.Value, pred.Value, obj.Value)
+	if ok {
+		s.hits++
+		return st
+	}
+	s.misses++
+	for i, t := range []rdf.Term{subj, pred, obj} {
+		if _, ok := s.terms[i][t.Value]; !ok {
+			s.terms[i][t.Value] = rdf.Term{Value: t.Value}
+		}
+	}
+	st, _ = s.lookup(subj.Value, pred.Value, obj.Value)
+	return st
+}
+
+// lookup returns a statement allocated from the Store's block holding the
+// interned terms for subj, pred and obj, and whether all the terms were
+// found.
+func (s *Store) lookup(subj, pred, obj string) (*rdf.Statement, bool) {
+	st, ok := s.terms[0][subj]
+	if !ok {
+		return nil, false
+	}
+	pt, ok := s.terms[1][pred]
+	if !ok {
+		return nil, false
+	}
+	ot, ok := s.terms[2][obj]
+	if !ok {
+		return nil, false
+	}
+	if len(s.block) == 0 {
+		s.block = make([]rdf.Statement, blockSize)
+	}
+	stmt := &s.block[0]
+	s.block = s.block[1:]
+	*stmt = rdf.Statement{Subject: st, Predicate: pt, Object: ot}
+	return stmt, true
+}
+
+// Stats returns the number of statements the Store has constructed only
+// from interned terms and the number that added terms or were parsed.
+func (s *Store) Stats() (hits, misses uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.hits, s.misses
+}
+
+// split returns the subject, predicate and object text of an N-Quad without
+// a graph label. The subject and predicate may not contain spaces, so the
+// object is the remaining text before the terminating " .". If the N-Quad
+// does not have this form, ok is false.
+func split(nquad string) (subj, pred, obj string, ok bool) {
+	nquad = strings.TrimSpace(nquad)
+	if !strings.HasSuffix(nquad, " .") {
+		return "", "", "", false
+	}
+	nquad = strings.TrimSuffix(nquad, " .")
+	parts := strings.SplitN(nquad, " ", 3)
+	if len(parts) != 3 {
+		return "", "", "", false
+	}
+	return parts[0], parts[1], parts[2], true
+}
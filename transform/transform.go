@@ -0,0 +1,262 @@
+// Package transform provides tools for constructing RDF statements for
+// fields read and written by transforms shipped in packages.
+package transform
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"sort"
+
+	"gonum.org/v1/gonum/graph/formats/rdf"
+	"gopkg.in/yaml.v3"
+
+	"github.com/efd6/ecsinrdf/term"
+	"github.com/efd6/ecsinrdf/vocab"
+)
+
+// Transform is a transform as found in the transform.yml file of a
+// package's elasticsearch/transform directory.
+type Transform struct {
+	Pivot *struct {
+		GroupBy      map[string]map[string]interface{} `yaml:"group_by"`
+		Aggregations map[string]interface{}            `yaml:"aggregations"`
+		Aggs         map[string]interface{}            `yaml:"aggs"`
+	} `yaml:"pivot"`
+	Latest *struct {
+		UniqueKey []string `yaml:"unique_key"`
+		Sort      string   `yaml:"sort"`
+	} `yaml:"latest"`
+	Sync struct {
+		Time struct {
+			Field string `yaml:"field"`
+		} `yaml:"time"`
+	} `yaml:"sync"`
+}
+
+// Decode returns the transform held in r.
+func Decode(r io.Reader) (Transform, error) {
+	var t Transform
+	err := yaml.NewDecoder(r).Decode(&t)
+	if err != nil {
+		return Transform{}, err
+	}
+	if t.Pivot == nil && t.Latest == nil {
+		return Transform{}, fmt.Errorf("transform has neither pivot nor latest")
+	}
+	return t, nil
+}
+
+// Use is a field read or written by a transform.
+type Use struct {
+	// Path is the full dotted path of the field.
+	Path string
+	// Requires is the class of types the field must
+	// have: "numeric", "date", "ordered" for numeric
+	// or date types, or "aggregatable". It is empty if
+	// any type is accepted.
+	Requires string
+}
+
+// groupSource and groupDestination hold the type requirements of the
+// source and destination fields of pivot group_by sources. Group sources
+// not listed accept any type.
+var (
+	groupSource = map[string]string{
+		"terms":          "aggregatable",
+		"histogram":      "numeric",
+		"date_histogram": "date",
+	}
+	groupDestination = map[string]string{
+		"histogram":      "numeric",
+		"date_histogram": "date",
+	}
+)
+
+// aggSource and aggDestination hold the type requirements of the source
+// and destination fields of pivot aggregations. Aggregations not listed in
+// aggSource accept any type and those not listed in aggDestination write
+// objects or values whose type is not known, and are not checked.
+var (
+	aggSource = map[string]string{
+		"avg":                       "numeric",
+		"sum":                       "numeric",
+		"median_absolute_deviation": "numeric",
+		"percentiles":               "numeric",
+		"stats":                     "numeric",
+		"extended_stats":            "numeric",
+		"min":                       "ordered",
+		"max":                       "ordered",
+		"value_count":               "aggregatable",
+		"cardinality":               "aggregatable",
+		"terms":                     "aggregatable",
+	}
+	aggDestination = map[string]string{
+		"avg":                       "numeric",
+		"sum":                       "numeric",
+		"median_absolute_deviation": "numeric",
+		"value_count":               "numeric",
+		"cardinality":               "numeric",
+		"bucket_script":             "numeric",
+		"min":                       "ordered",
+		"max":                       "ordered",
+	}
+)
+
+// Sources returns the source fields read by the transform, sorted by path
+// and requirement.
+func (t Transform) Sources() []Use {
+	found := make(map[Use]bool)
+	add := func(path, requires string) {
+		if path != "" {
+			found[Use{Path: path, Requires: requires}] = true
+		}
+	}
+	if t.Pivot != nil {
+		for _, group := range t.Pivot.GroupBy {
+			for kind, cfg := range group {
+				add(fieldOf(cfg), groupSource[kind])
+			}
+		}
+		walkAggs("", t.Pivot.Aggregations, t.Pivot.Aggs, func(_, kind string, cfg interface{}) {
+			add(fieldOf(cfg), aggSource[kind])
+			if kind == "top_metrics" {
+				m, _ := cfg.(map[string]interface{})
+				metrics, _ := m["metrics"].([]interface{})
+				for _, e := range metrics {
+					add(fieldOf(e), "")
+				}
+			}
+		})
+	}
+	if t.Latest != nil {
+		for _, k := range t.Latest.UniqueKey {
+			add(k, "aggregatable")
+		}
+		add(t.Latest.Sort, "ordered")
+	}
+	add(t.Sync.Time.Field, "date")
+	return sortUses(found)
+}
+
+// Destinations returns the destination fields written by a pivot
+// transform whose types are known, sorted by path and requirement.
+// Fields written by latest transforms are copies of their source
+// documents and are not returned.
+func (t Transform) Destinations() []Use {
+	if t.Pivot == nil {
+		return nil
+	}
+	found := make(map[Use]bool)
+	for name, group := range t.Pivot.GroupBy {
+		for kind := range group {
+			found[Use{Path: name, Requires: groupDestination[kind]}] = true
+		}
+	}
+	walkAggs("", t.Pivot.Aggregations, t.Pivot.Aggs, func(path, kind string, _ interface{}) {
+		requires, ok := aggDestination[kind]
+		if ok {
+			found[Use{Path: path, Requires: requires}] = true
+		}
+	})
+	return sortUses(found)
+}
+
+// walkAggs calls fn on each aggregation in aggs and alt, and their
+// sub-aggregations, with the destination path of the aggregation, its kind
+// and its configuration.
+func walkAggs(parent string, aggs, alt map[string]interface{}, fn func(path, kind string, cfg interface{})) {
+	for _, set := range []map[string]interface{}{aggs, alt} {
+		for name, v := range set {
+			if parent != "" {
+				name = parent + "." + name
+			}
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			var subAggs, subAlt map[string]interface{}
+			for kind, cfg := range m {
+				switch kind {
+				case "aggregations":
+					subAggs, _ = cfg.(map[string]interface{})
+				case "aggs":
+					subAlt, _ = cfg.(map[string]interface{})
+				case "meta":
+				default:
+					fn(name, kind, cfg)
+				}
+			}
+			if subAggs != nil || subAlt != nil {
+				walkAggs(name, subAggs, subAlt, fn)
+			}
+		}
+	}
+}
+
+// fieldOf returns the field named in the aggregation or group source
+// configuration cfg.
+func fieldOf(cfg interface{}) string {
+	m, ok := cfg.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	f, _ := m["field"].(string)
+	return f
+}
+
+func sortUses(found map[Use]bool) []Use {
+	uses := make([]Use, 0, len(found))
+	for u := range found {
+		uses = append(uses, u)
+	}
+	sort.Slice(uses, func(i, j int) bool {
+		if uses[i].Path == uses[j].Path {
+			return uses[i].Requires < uses[j].Requires
+		}
+		return uses[i].Path < uses[j].Path
+	})
+	return uses
+}
+
+// Statements calls fn on all RDF statements constructed from the fields
+// read and written by the named transform.
+//
+// The graph that results has the following triples structure
+//
+// _:use <is:path> "full.dotted.path.to.name" .
+// _:use <used:by> "transform/name" .
+// _:use <requires:type> "class" .
+//
+// Destination fields are linked to the transform that writes them.
+//
+// _:dest <is:path> "full.dotted.path.to.name" .
+// _:dest <produced:by> "transform/name" .
+// _:dest <requires:type> "class" .
+//
+// The requirement is omitted for fields that accept any type.
+func Statements(name string, t Transform, fn func(*rdf.Statement, error)) {
+	ref := term.LiteralTerm("transform/" + name)
+	emit := func(kind string, pred vocab.Predicate, uses []Use) {
+		for _, u := range uses {
+			h := sha1.Sum([]byte("transform" + name + "\x00" + kind + "\x00" + u.Path + "\x00" + u.Requires))
+			hashUse := string(hex(h[:]))
+			fn(term.Triple(term.Blank(hashUse), vocab.IsPath.Term(), term.LiteralTerm(u.Path)), nil)
+			fn(term.Triple(term.Blank(hashUse), pred.Term(), ref), nil)
+			if u.Requires != "" {
+				fn(term.Triple(term.Blank(hashUse), vocab.RequiresType.Term(), term.LiteralTerm(u.Requires)), nil)
+			}
+		}
+	}
+	emit("source", vocab.UsedBy, t.Sources())
+	emit("dest", vocab.ProducedBy, t.Destinations())
+}
+
+func hex(data []byte) []byte {
+	const digit = "0123456789abcdef"
+	buf := make([]byte, 0, len(data)*2)
+	for _, b := range data {
+		buf = append(buf, digit[b>>4], digit[b&0xf])
+	}
+	return buf
+}
@@ -0,0 +1,163 @@
+// Package turtle provides tools for serializing RDF statements as Turtle.
+package turtle
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"gonum.org/v1/gonum/graph/formats/rdf"
+)
+
+// Encode writes the statements to w as a Turtle document. Statements are
+// grouped by subject and predicate, and each predicate namespace is declared
+// as a prefix so that predicates may be written as prefixed names. Subjects,
+// predicates and objects are sorted so that the output is stable for a given
+// set of statements. For example, the statements
+//
+//  _:b0 <is:path> "source.ip" .
+//  _:b0 <has:child> _:b1 .
+//  _:b0 <has:child> _:b2 .
+//
+// are encoded as
+//
+//  @prefix has: <has:> .
+//  @prefix is: <is:> .
+//
+//  _:b0
+//  	has:child _:b1, _:b2 ;
+//  	is:path "source.ip" .
+//
+// and predicates in namespaces ending with a fragment separator, such as
+// <https://ecsinrdf.dev/ns/is#path>, are given the last element of the
+// namespace path as their prefix.
+//
+//  @prefix is: <https://ecsinrdf.dev/ns/is#> .
+//
+// Turtle cannot represent named graphs, so Encode returns an error if any
+// statement has a graph label.
+func Encode(w io.Writer, statements []*rdf.Statement) error {
+	// Prefixes that would name more than one
+	// namespace are not used.
+	prefixes := make(map[string]string)
+	for _, s := range statements {
+		pred, _, kind, err := s.Predicate.Parts()
+		if err != nil || kind != rdf.IRI {
+			continue
+		}
+		if prefix, ns, _, ok := prefixed(pred); ok {
+			if declared, ok := prefixes[prefix]; ok && declared != ns {
+				ns = ""
+			}
+			prefixes[prefix] = ns
+		}
+	}
+	for p, ns := range prefixes {
+		if ns == "" {
+			delete(prefixes, p)
+		}
+	}
+	subjects := make(map[string]map[string][]string)
+	for _, s := range statements {
+		if s.Label.Value != "" {
+			return fmt.Errorf("%s: turtle cannot represent named graphs", s)
+		}
+		pred, _, kind, err := s.Predicate.Parts()
+		if err != nil {
+			return fmt.Errorf("%s: %w", s.Predicate.Value, err)
+		}
+		if kind != rdf.IRI {
+			return fmt.Errorf("%s: predicate is not an IRI", s.Predicate.Value)
+		}
+		name := s.Predicate.Value
+		if prefix, ns, local, ok := prefixed(pred); ok && prefixes[prefix] == ns {
+			name = prefix + ":" + local
+		}
+		preds, ok := subjects[s.Subject.Value]
+		if !ok {
+			preds = make(map[string][]string)
+			subjects[s.Subject.Value] = preds
+		}
+		preds[name] = append(preds[name], s.Object.Value)
+	}
+
+	bw := bufio.NewWriter(w)
+	ps := make([]string, 0, len(prefixes))
+	for p := range prefixes {
+		ps = append(ps, p)
+	}
+	sort.Strings(ps)
+	for _, p := range ps {
+		fmt.Fprintf(bw, "@prefix %s: <%s> .\n", p, prefixes[p])
+	}
+	subjs := make([]string, 0, len(subjects))
+	for subj := range subjects {
+		subjs = append(subjs, subj)
+	}
+	sort.Strings(subjs)
+	for _, subj := range subjs {
+		fmt.Fprintf(bw, "\n%s", subj)
+		preds := subjects[subj]
+		names := make([]string, 0, len(preds))
+		for name := range preds {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for i, name := range names {
+			objs := preds[name]
+			sort.Strings(objs)
+			fmt.Fprintf(bw, "\n\t%s %s", name, strings.Join(objs, ", "))
+			if i < len(names)-1 {
+				bw.WriteString(" ;")
+			} else {
+				bw.WriteString(" .\n")
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// prefixed returns the prefix, namespace IRI and local name for writing
+// iri as a prefixed name. IRIs with a fragment, such as
+// https://ecsinrdf.dev/ns/is#name, are in the namespace ending with the
+// fragment separator and are given the last element of the IRI's path as
+// their prefix. Other IRIs, such as is:name, are in the namespace of their
+// scheme. It returns false if the IRI cannot be written as a prefixed name
+// with a simple prefix and local name.
+func prefixed(iri string) (prefix, ns, local string, ok bool) {
+	if i := strings.LastIndex(iri, "#"); i > 0 {
+		ns, local = iri[:i+1], iri[i+1:]
+		prefix = iri[strings.LastIndex(iri[:i], "/")+1 : i]
+	} else {
+		i := strings.Index(iri, ":")
+		if i <= 0 {
+			return "", "", "", false
+		}
+		prefix, ns, local = iri[:i], iri[:i+1], iri[i+1:]
+	}
+	if !isName(prefix) || !isName(local) || !isLetter(rune(prefix[0])) {
+		return "", "", "", false
+	}
+	return prefix, ns, local, true
+}
+
+// isName returns whether s is a non-empty ASCII name made of letters,
+// digits and underscores. Names of this form are valid Turtle prefixes
+// and local names when they start with a letter.
+func isName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !isLetter(r) && (r < '0' || '9' < r) && r != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+func isLetter(r rune) bool {
+	return ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z')
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/efd6/ecsinrdf/term"
+)
+
+const (
+	// maxUploadSize is the maximum size of an uploaded
+	// package archive.
+	maxUploadSize = 64 << 20
+	// maxExtractedSize is the maximum total size of the
+	// files extracted from an uploaded package archive.
+	maxExtractedSize = 256 << 20
+)
+
+// serveCheck builds a graph for the package zip archive POSTed as the
+// request body and responds with the JSON analysis report for the package.
+// The package is analyzed against the ECS version of the server's base
+// configuration unless a version query parameter is provided. If token
+// rules are configured, the request must carry a bearer token permitted
+// for the graph name "check".
+func (h *httpServer) serveCheck(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.permits(r.Header.Get("Authorization"), "check") {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	b, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxUploadSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	dir, err := os.MkdirTemp("", "ecsinrdf-check-")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(dir)
+	err = extractZip(zr, dir, maxExtractedSize)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	cfg := h.base.cfg
+	cfg.pkg = dir
+	cfg.documents = true
+	cfg.rules = nil
+	if v := r.URL.Query().Get("version"); v != "" {
+		cfg.version = v
+	}
+	start := time.Now()
+	cfg.store = term.NewStore()
+	g, _, err := buildGraph(r.Context(), cfg)
+	h.base.metrics.observeBuild(start, cfg.store, g, err)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rules, err := pathRules(h.base.rules, h.base.packagePrefix, cfg.pkg)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	report, err := analyzePackage(g, cfg.version, h.base.exclude, rules)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	b, err = json.Marshal(report)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if h.validate {
+		err = validateReport(b)
+		if err != nil {
+			slog.Error("invalid report", "error", err)
+			http.Error(w, "invalid report: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// extractZip extracts the regular files in zr into dir. Archive members
+// that would be extracted outside dir, or that would take the total
+// extracted size beyond limit bytes, result in an error.
+func extractZip(zr *zip.Reader, dir string, limit int64) error {
+	for _, f := range zr.File {
+		name := filepath.FromSlash(f.Name)
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(filepath.Clean(name), ".."+string(filepath.Separator)) {
+			return fmt.Errorf("invalid archive path: %s", f.Name)
+		}
+		if !f.Mode().IsRegular() {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		err := os.MkdirAll(filepath.Dir(path), 0o755)
+		if err != nil {
+			return err
+		}
+		n, err := extractFile(f, path, limit)
+		if err != nil {
+			return err
+		}
+		limit -= n
+	}
+	return nil
+}
+
+// extractFile extracts f to path, returning the number of bytes written.
+// It returns an error if f holds more than limit bytes.
+func extractFile(f *zip.File, path string, limit int64) (int64, error) {
+	src, err := f.Open()
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+	dst, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(dst, io.LimitReader(src, limit+1))
+	if err != nil {
+		dst.Close()
+		return n, err
+	}
+	if n > limit {
+		dst.Close()
+		return n, errors.New("archive too large")
+	}
+	return n, dst.Close()
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type zipEntry struct {
+	name string
+	data string
+}
+
+// zipArchive returns a reader for a zip archive holding entries.
+func zipArchive(t *testing.T, entries []zipEntry) *zip.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, e := range entries {
+		f, err := w.Create(e.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = f.Write([]byte(e.data))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return zr
+}
+
+var extractZipTests = []struct {
+	name    string
+	entries []zipEntry
+	limit   int64
+	want    map[string]string
+	wantErr bool
+}{
+	{
+		name: "valid",
+		entries: []zipEntry{
+			{name: "manifest.yml", data: "name: pkg"},
+			{name: "data_stream/log/fields/fields.yml", data: "- name: message"},
+			{name: "data_stream/"},
+		},
+		limit: 1 << 10,
+		want: map[string]string{
+			"manifest.yml":                      "name: pkg",
+			"data_stream/log/fields/fields.yml": "- name: message",
+		},
+	},
+	{
+		name:    "parent",
+		entries: []zipEntry{{name: "../evil", data: "x"}},
+		limit:   1 << 10,
+		wantErr: true,
+	},
+	{
+		name:    "nested parent",
+		entries: []zipEntry{{name: "pkg/../../evil", data: "x"}},
+		limit:   1 << 10,
+		wantErr: true,
+	},
+	{
+		name:    "bare parent",
+		entries: []zipEntry{{name: "..", data: "x"}},
+		limit:   1 << 10,
+		wantErr: true,
+	},
+	{
+		name:    "absolute",
+		entries: []zipEntry{{name: "/tmp/evil", data: "x"}},
+		limit:   1 << 10,
+		wantErr: true,
+	},
+	{
+		name:    "too large",
+		entries: []zipEntry{{name: "manifest.yml", data: "name: pkg"}},
+		limit:   4,
+		wantErr: true,
+	},
+	{
+		name: "too large in total",
+		entries: []zipEntry{
+			{name: "a", data: "aaaa"},
+			{name: "b", data: "bbbb"},
+		},
+		limit:   6,
+		wantErr: true,
+	},
+}
+
+func TestExtractZip(t *testing.T) {
+	for _, test := range extractZipTests {
+		t.Run(test.name, func(t *testing.T) {
+			// Extract into a subdirectory so that escaping
+			// writes can be detected in its parent.
+			root := t.TempDir()
+			dir := filepath.Join(root, "pkg")
+			err := os.Mkdir(dir, 0o755)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = extractZip(zipArchive(t, test.entries), dir, test.limit)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("unexpected error: got:%v want error:%t", err, test.wantErr)
+			}
+			if _, err := os.Stat(filepath.Join(root, "evil")); err == nil {
+				t.Error("archive entry was written outside the extraction directory")
+			}
+			for name, want := range test.want {
+				got, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+				if err != nil {
+					t.Errorf("unexpected error reading %s: %v", name, err)
+					continue
+				}
+				if string(got) != want {
+					t.Errorf("unexpected content for %s: got:%q want:%q", name, got, want)
+				}
+			}
+		})
+	}
+}
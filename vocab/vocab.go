@@ -0,0 +1,212 @@
+// Package vocab defines the vocabulary of predicates of the graphs
+// constructed by this module.
+//
+// Graphs hold predicates in a short form, such as <is:name>, where the
+// scheme of the IRI names the namespace of the predicate and the rest
+// names the predicate within it. Short forms are convenient to write and
+// to match, but they are not dereferenceable IRIs, so each namespace also
+// has a canonical IRI under Base. The predicate <is:name> is written in
+// its canonical form as
+//
+//  <https://ecsinrdf.dev/ns/is#name>
+//
+// Canonical and Short convert predicates between the two forms.
+package vocab
+
+import (
+	"strings"
+
+	"gonum.org/v1/gonum/graph/formats/rdf"
+)
+
+// Base is the IRI that namespace names are appended to, to give the
+// canonical IRIs of the namespaces.
+const Base = "https://ecsinrdf.dev/ns/"
+
+// Predicate is a predicate of the vocabulary held as the N-Quads text of
+// its short form, such as <is:name>.
+type Predicate string
+
+// Predicates of the vocabulary.
+const (
+	AsAnalyzer         Predicate = "<as:analyzer>"
+	AsMetricType       Predicate = "<as:metric_type>"
+	AsObjectType       Predicate = "<as:object_type>"
+	AsSearchAnalyzer   Predicate = "<as:search_analyzer>"
+	AsType             Predicate = "<as:type>"
+	AsUnit             Predicate = "<as:unit>"
+	DefinedAt          Predicate = "<defined:at>"
+	DefinedIn          Predicate = "<defined:in>"
+	DeprecatedIn       Predicate = "<deprecated:in>"
+	ExpectsEventType   Predicate = "<expects:event_type>"
+	ExternalType       Predicate = "<external:type>"
+	HasAllowedValue    Predicate = "<has:allowed_value>"
+	HasChild           Predicate = "<has:child>"
+	HasDescendant      Predicate = "<has:descendant>"
+	HasDescription     Predicate = "<has:description>"
+	HasExample         Predicate = "<has:example>"
+	HasMulti           Predicate = "<has:multi>"
+	HasNesting         Predicate = "<has:nesting>"
+	InDataStream       Predicate = "<in:data_stream>"
+	InDataset          Predicate = "<in:dataset>"
+	InFieldset         Predicate = "<in:fieldset>"
+	InVersion          Predicate = "<in:version>"
+	InferredType       Predicate = "<inferred:type>"
+	IsCanonicalPath    Predicate = "<is:canonical_path>"
+	IsDataStream       Predicate = "<is:data_stream>"
+	IsDataset          Predicate = "<is:dataset>"
+	IsDescription      Predicate = "<is:description>"
+	IsDimension        Predicate = "<is:dimension>"
+	IsEnabled          Predicate = "<is:enabled>"
+	IsExample          Predicate = "<is:example>"
+	IsHinted           Predicate = "<is:hinted>"
+	IsHintedObject     Predicate = "<is:hinted_object>"
+	IsImplicit         Predicate = "<is:implicit>"
+	IsLevel            Predicate = "<is:level>"
+	IsMatchMappingType Predicate = "<is:match_mapping_type>"
+	IsName             Predicate = "<is:name>"
+	IsNormalized       Predicate = "<is:normalized>"
+	IsNorms            Predicate = "<is:norms>"
+	IsObserved         Predicate = "<is:observed>"
+	IsPath             Predicate = "<is:path>"
+	IsPathMatch        Predicate = "<is:path_match>"
+	IsPublished        Predicate = "<is:published>"
+	IsShort            Predicate = "<is:short>"
+	IsTopLevel         Predicate = "<is:top_level>"
+	IsType             Predicate = "<is:type>"
+	IsValue            Predicate = "<is:value>"
+	IsValueType        Predicate = "<is:value_type>"
+	IsWildcard         Predicate = "<is:wildcard>"
+	OwnedBy            Predicate = "<owned:by>"
+	ProducedBy         Predicate = "<produced:by>"
+	ReferencedBy       Predicate = "<referenced:by>"
+	RemovedIn          Predicate = "<removed:in>"
+	RequiresType       Predicate = "<requires:type>"
+	ReusedAs           Predicate = "<reused:as>"
+	ReusedAt           Predicate = "<reused:at>"
+	ReusedFrom         Predicate = "<reused:from>"
+	ReusedHere         Predicate = "<reused:here>"
+	ReroutesTo         Predicate = "<reroutes:to>"
+	UsedBy             Predicate = "<used:by>"
+)
+
+// Literal objects of the vocabulary.
+const (
+	True  = `"true"`
+	False = `"false"`
+	Group = `"group"`
+	Array = `"array"`
+)
+
+// Term returns the IRI term of p.
+func (p Predicate) Term() rdf.Term {
+	return rdf.Term{Value: string(p)}
+}
+
+// Match returns whether the predicate of s is p. Method values of Match,
+// such as vocab.IsPath.Match, are statement filters.
+func (p Predicate) Match(s *rdf.Statement) bool {
+	return s.Predicate.Value == string(p)
+}
+
+// MatchObject returns whether the predicate of s is p and the N-Quads text
+// of its object is obj, for example
+//
+//  vocab.IsPublished.MatchObject(s, vocab.True)
+//
+func (p Predicate) MatchObject(s *rdf.Statement, obj string) bool {
+	return s.Predicate.Value == string(p) && s.Object.Value == obj
+}
+
+// Of returns the predicate of s.
+func Of(s *rdf.Statement) Predicate {
+	return Predicate(s.Predicate.Value)
+}
+
+// namespaces holds the names of the namespaces of the predicates.
+var namespaces = map[string]bool{
+	"as":         true,
+	"defined":    true,
+	"deprecated": true,
+	"expects":    true,
+	"external":   true,
+	"has":        true,
+	"in":         true,
+	"inferred":   true,
+	"is":         true,
+	"owned":      true,
+	"produced":   true,
+	"referenced": true,
+	"removed":    true,
+	"requires":   true,
+	"reroutes":   true,
+	"reused":     true,
+	"used":       true,
+}
+
+// Namespace returns the canonical IRI of the named namespace, such as
+// https://ecsinrdf.dev/ns/is# for is.
+func Namespace(name string) string {
+	return Base + name + "#"
+}
+
+// Canonical returns the canonical form of the short form predicate t. Terms
+// that are not short form predicates in the namespaces of the vocabulary
+// are returned unchanged.
+func Canonical(t rdf.Term) rdf.Term {
+	ns, local, ok := short(t.Value)
+	if !ok {
+		return t
+	}
+	return rdf.Term{Value: "<" + Namespace(ns) + local + ">"}
+}
+
+// Short returns the short form of the canonical predicate t. Terms that
+// are not canonical predicates in the namespaces of the vocabulary are
+// returned unchanged.
+func Short(t rdf.Term) rdf.Term {
+	iri, ok := strings.CutPrefix(t.Value, "<"+Base)
+	if !ok {
+		return t
+	}
+	ns, local, ok := strings.Cut(strings.TrimSuffix(iri, ">"), "#")
+	if !ok || !namespaces[ns] || !isName(local) {
+		return t
+	}
+	return rdf.Term{Value: "<" + ns + ":" + local + ">"}
+}
+
+// CanonicalStatement returns a copy of s with its predicate in canonical
+// form.
+func CanonicalStatement(s *rdf.Statement) *rdf.Statement {
+	c := *s
+	c.Predicate = Canonical(s.Predicate)
+	return &c
+}
+
+// short returns the namespace and local name of the short form predicate
+// term value in a namespace of the vocabulary.
+func short(value string) (ns, local string, ok bool) {
+	if !strings.HasPrefix(value, "<") || !strings.HasSuffix(value, ">") {
+		return "", "", false
+	}
+	ns, local, ok = strings.Cut(value[1:len(value)-1], ":")
+	if !ok || !namespaces[ns] || !isName(local) {
+		return "", "", false
+	}
+	return ns, local, true
+}
+
+// isName returns whether s is a non-empty name made of lower case ASCII
+// letters and underscores, as the names of namespaces and predicates are.
+func isName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if (r < 'a' || 'z' < r) && r != '_' {
+			return false
+		}
+	}
+	return true
+}
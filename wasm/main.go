@@ -0,0 +1,136 @@
+//go:build js && wasm
+// +build js,wasm
+
+// The wasm command exposes ecsinrdf graph construction and graft queries
+// to JavaScript so that analysis can run in web tooling without a backend.
+//
+// Build it with
+//
+//  GOOS=js GOARCH=wasm go build -o ecsinrdf.wasm ./wasm
+//
+// and load it with the wasm_exec.js support file from the Go distribution.
+// When run, the module sets a global ecsinrdf object with the functions
+//
+//  build(ecs, fields): build the graph from the ECS ecs_nested.yml text
+//      and an object mapping package fields file paths to their text.
+//      Files under a data_stream/<name> directory are placed in that
+//      data stream. It returns an error message or null.
+//  query(path, type): return the graft candidates for a field with
+//      the path and type.
+//  graftCandidates(path): return the graft candidates for the package
+//      field with the path.
+//
+// Queries return an object holding either a candidates array of unquoted
+// paths or an error message.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"syscall/js"
+
+	"gonum.org/v1/gonum/graph/formats/rdf"
+
+	ecsgraph "github.com/efd6/ecsinrdf/graph"
+	"github.com/efd6/ecsinrdf/query"
+	"github.com/efd6/ecsinrdf/term"
+)
+
+// graph is the graph built by the last successful call to build.
+var graph *rdf.Graph
+
+func main() {
+	js.Global().Set("ecsinrdf", js.ValueOf(map[string]interface{}{
+		"build": js.FuncOf(func(_ js.Value, args []js.Value) interface{} {
+			if len(args) != 2 {
+				return "usage: build(ecs, fields)"
+			}
+			fields := make(map[string]string)
+			keys := js.Global().Get("Object").Call("keys", args[1])
+			for i := 0; i < keys.Length(); i++ {
+				k := keys.Index(i).String()
+				fields[k] = args[1].Get(k).String()
+			}
+			g, err := buildGraph(args[0].String(), fields)
+			if err != nil {
+				return err.Error()
+			}
+			graph = g
+			return nil
+		}),
+		"query": js.FuncOf(func(_ js.Value, args []js.Value) interface{} {
+			if len(args) != 2 {
+				return result(nil, errors.New("usage: query(path, type)"))
+			}
+			if graph == nil {
+				return result(nil, errors.New("graph not built"))
+			}
+			return result(query.CandidateGraftsFor(graph, term.Literal(args[0].String()), term.Literal(args[1].String()), query.PathRules{}))
+		}),
+		"graftCandidates": js.FuncOf(func(_ js.Value, args []js.Value) interface{} {
+			if len(args) != 1 {
+				return result(nil, errors.New("usage: graftCandidates(path)"))
+			}
+			if graph == nil {
+				return result(nil, errors.New("graph not built"))
+			}
+			return result(query.CandidateGraftsIn(graph, term.Literal(args[0].String()), query.PathRules{}))
+		}),
+	}))
+	// Keep the exported functions available.
+	select {}
+}
+
+// result returns the JS result object for the quoted candidates in cands
+// ranked for the package fields in the graph.
+func result(cands []string, err error) interface{} {
+	if err == nil {
+		var ctx query.PathContext
+		ctx, err = query.PackageContextIn(graph)
+		if err == nil {
+			cands, err = ctx.Rank(cands)
+		}
+	}
+	if err != nil {
+		return map[string]interface{}{"error": err.Error()}
+	}
+	paths := make([]interface{}, len(cands))
+	for i, c := range cands {
+		p, err := term.Text(c)
+		if err != nil {
+			return map[string]interface{}{"error": err.Error()}
+		}
+		paths[i] = p
+	}
+	return map[string]interface{}{"candidates": paths}
+}
+
+// buildGraph returns the graph constructed from the ECS ecs_nested.yml
+// text and the package fields files text keyed by path. Invalid
+// statements are omitted from the graph.
+func buildGraph(ecs string, fields map[string]string) (*rdf.Graph, error) {
+	var statements []*rdf.Statement
+	add := term.CanonicalPaths(func(s *rdf.Statement, err error) {
+		if err != nil {
+			return
+		}
+		statements = append(statements, s)
+	})
+	err := ecsgraph.ECSStatements(context.Background(), strings.NewReader(ecs), ecsgraph.Nested, add)
+	if err != nil {
+		return nil, fmt.Errorf("ecs: %w", err)
+	}
+	for file, text := range fields {
+		err := ecsgraph.FieldsStatements(file, ecsgraph.DataStreamOf(file), []byte(text), add)
+		if err != nil {
+			return nil, err
+		}
+	}
+	statements, err = ecsgraph.Canonicalize(statements)
+	if err != nil {
+		return nil, err
+	}
+	return ecsgraph.New(statements), nil
+}